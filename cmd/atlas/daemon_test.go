@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShouldDaemonizeRequiresTTY(t *testing.T) {
+	t.Parallel()
+
+	// A regular file stands in for systemd's journal/pipe stdout: never a TTY.
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+	if isTerminal(f.Fd()) {
+		t.Fatalf("regular file reported as a terminal")
+	}
+	if shouldDaemonize(true, false, false, f.Fd()) {
+		t.Fatalf("must not daemonize without a TTY")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if shouldDaemonize(true, false, false, w.Fd()) {
+		t.Fatalf("must not daemonize when stdout is a pipe")
+	}
+
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+		if !shouldDaemonize(true, false, false, tty.Fd()) {
+			t.Fatalf("expected daemonize on a TTY")
+		}
+		if shouldDaemonize(false, false, false, tty.Fd()) || shouldDaemonize(true, true, false, tty.Fd()) || shouldDaemonize(true, false, true, tty.Fd()) {
+			t.Fatalf("disabled, -foreground and -daemon-child must not daemonize")
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+
+	"github.com/MrTeeett/atlas/internal/app"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// newGRPCListener prepares gRPC on its own address (grpc_listen), with TLS from the
+// HTTPS certificate when useTLS is set.
+func newGRPCListener(srv *app.Server, addr string, useTLS bool, certFile, keyFile string) (*grpc.Server, net.Listener, error) {
+	var opts []grpc.ServerOption
+	if useTLS {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})))
+	} else if !isLoopbackAddr(addr) {
+		slog.Warn("gRPC listener is plaintext on a non-loopback address; credentials are sent unencrypted", "addr", addr)
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return srv.GRPCServer(opts...), lis, nil
+}
+
+// isLoopbackAddr reports whether a host:port listens on loopback only.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
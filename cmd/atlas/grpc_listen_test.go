@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestIsLoopbackAddr(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]bool{
+		"127.0.0.1:9090": true,
+		"[::1]:9090":     true,
+		"localhost:9090": true,
+		":9090":          false,
+		"0.0.0.0:9090":   false,
+		"10.0.0.5:9090":  false,
+		"bad":            false,
+	}
+	for addr, want := range cases {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Errorf("isLoopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
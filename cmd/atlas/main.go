@@ -12,11 +12,13 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/MrTeeett/atlas/internal/app"
+	"github.com/MrTeeett/atlas/internal/auth"
 	"github.com/MrTeeett/atlas/internal/cli"
 	"github.com/MrTeeett/atlas/internal/config"
 	filesvc "github.com/MrTeeett/atlas/internal/fs"
@@ -30,6 +32,9 @@ func main() {
 	if len(os.Args) > 1 && os.Args[1] == "fs-helper" {
 		os.Exit(filesvc.RunHelper(os.Args[2:]))
 	}
+	if len(os.Args) > 1 && os.Args[1] == "update-verify" {
+		os.Exit(app.RunUpdateVerify(os.Args[2:]))
+	}
 
 	var configPath string
 	flag.StringVar(&configPath, "config", envDefault("ATLAS_CONFIG", "atlas.json"), "config path")
@@ -40,13 +45,27 @@ func main() {
 	var foreground bool
 	flag.BoolVar(&foreground, "foreground", false, "run in foreground (don't detach)")
 
+	var noCreateConfig bool
+	flag.BoolVar(&noCreateConfig, "no-create-config", envBool("ATLAS_NO_CREATE_CONFIG"), "fail if the config file is missing instead of creating a default one")
+
 	var daemonChild bool
 	flag.BoolVar(&daemonChild, "daemon-child", false, "internal")
 	flag.Parse()
 
 	// User management CLI:
 	// atlas user add|del|passwd|list -config atlas.json -user ... [-pass ...]
+	loadConfig := config.Load
+	if noCreateConfig {
+		loadConfig = config.LoadExisting
+	}
+
 	if flag.NArg() > 0 && flag.Arg(0) == "user" {
+		if noCreateConfig {
+			if _, err := loadConfig(configPath); err != nil {
+				fmt.Fprintf(os.Stderr, "user: %v\n", err)
+				os.Exit(1)
+			}
+		}
 		code, err := cli.RunUserCLI(configPath, flag.Args()[1:])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "user: %v\n", err)
@@ -55,7 +74,7 @@ func main() {
 		os.Exit(code)
 	}
 
-	fileCfg, err := config.Load(configPath)
+	fileCfg, err := loadConfig(configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "load config %s: %v\n", configPath, err)
 		os.Exit(1)
@@ -63,10 +82,14 @@ func main() {
 	if listenAddr == "" {
 		listenAddr = fileCfg.Listen
 	}
+	if os.Geteuid() == 0 && !fileCfg.AllowRoot {
+		fmt.Fprintln(os.Stderr, "refusing to run as root (allow_root is false): run Atlas as a dedicated user and grant it the root operations it needs through sudoers (see README)")
+		os.Exit(1)
+	}
 
 	// Detach early (only when launched from a TTY) so the terminal remains usable.
-	if fileCfg.Daemonize && !foreground && !daemonChild && isTerminal(os.Stdout.Fd()) {
-		if err := daemonizeSelf(); err != nil {
+	if shouldDaemonize(fileCfg.Daemonize, foreground, daemonChild, os.Stdout.Fd()) {
+		if err := daemonizeSelf(resolveRelativeToConfigDir(configPath, fileCfg.LogFile)); err != nil {
 			fmt.Fprintf(os.Stderr, "daemonize: %v\n", err)
 			os.Exit(1)
 		}
@@ -80,12 +103,21 @@ func main() {
 	}
 
 	logFile := resolveRelativeToConfigDir(configPath, fileCfg.LogFile)
-	closeLogs, err := logging.Init(logging.Config{Level: fileCfg.LogLevel, File: logFile, Stdout: fileCfg.LogStdout})
+	closeLogs, err := logging.Init(logging.Config{
+		Level:        fileCfg.LogLevel,
+		File:         logFile,
+		Stdout:       fileCfg.LogStdout,
+		MaxSizeBytes: int64(fileCfg.LogMaxSizeMB) << 20,
+		MaxFiles:     fileCfg.LogMaxFiles,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "logging: %v\n", err)
 		os.Exit(1)
 	}
 	defer func() { _ = closeLogs() }()
+	if os.Geteuid() == 0 {
+		slog.Warn("running as root: sudo is bypassed and all file, exec and firewall operations run as root; set allow_root to false to refuse this", "config", configPath)
+	}
 
 	masterKey, err := config.EnsureMasterKeyFile(fileCfg.MasterKeyFile)
 	if err != nil {
@@ -94,33 +126,98 @@ func main() {
 	}
 	sessionSecret := sha256.Sum256(append(append([]byte{}, masterKey...), []byte("atlas:session:v1")...))
 
+	dbPerm, err := fileCfg.DBPerm()
+	if err != nil {
+		slog.Error("db permissions", "err", err)
+		os.Exit(1)
+	}
 	store, err := userdb.Open(fileCfg.UserDBPath, masterKey)
 	if err != nil {
 		slog.Error("user db", "err", err)
 		os.Exit(1)
 	}
+	store.SetFilePerm(dbPerm)
 	if !store.HasAnyUsers() {
 		slog.Warn("no users; create one via: atlas -config <cfg> user add -user admin -pass <pass>", "user_db_path", fileCfg.UserDBPath, "config", configPath)
 	}
 
+	var authn auth.Authenticator
+	if fileCfg.AuthBackend == "command" {
+		if authn, err = auth.NewCommandAuthenticator(fileCfg.AuthCommand); err != nil {
+			slog.Error("auth backend", "err", err)
+			os.Exit(1)
+		}
+	}
+
 	cfg := app.Config{
-		ListenAddr:         listenAddr,
-		RootDir:            fileCfg.Root,
-		BasePath:           fileCfg.BasePath,
-		AuthStore:          store,
-		Secret:             sessionSecret[:],
-		FSSudoEnabled:      fileCfg.FSSudo,
-		FSSudoAny:          len(fileCfg.FSUsers) == 1 && fileCfg.FSUsers[0] == "*",
-		FSSudoUsers:        fileCfg.FSUsers,
-		CookieSecure:       true,
-		EnableExec:         fileCfg.EnableExec,
-		EnableFW:           fileCfg.EnableFW,
-		FWDBPath:           fileCfg.FWDBPath,
-		ConfigPath:         configPath,
-		ServiceName:        fileCfg.ServiceName,
-		EnableAdminActions: fileCfg.EnableAdminActions,
-		LogPath:            logFile,
-		LogLevel:           fileCfg.LogLevel,
+		ListenAddr:          listenAddr,
+		RootDir:             fileCfg.Root,
+		BasePath:            fileCfg.BasePath,
+		AuthStore:           store,
+		Authenticator:       authn,
+		Secret:              sessionSecret[:],
+		FSSudoEnabled:       fileCfg.FSSudo,
+		FSSudoAny:           len(fileCfg.FSUsers) == 1 && fileCfg.FSUsers[0] == "*",
+		FSSudoUsers:         fileCfg.FSUsers,
+		FSSelfName:          fileCfg.FSSelfName,
+		HelperBinary:        fileCfg.HelperBinary,
+		CookieSecure:        true,
+		CookieName:          fileCfg.CookieName,
+		CookieSameSite:      fileCfg.CookieSameSite,
+		RememberMe:          time.Duration(fileCfg.RememberMeDays) * 24 * time.Hour,
+		EnableExec:          fileCfg.EnableExec,
+		EnableFW:            fileCfg.EnableFW,
+		FWDBPath:            fileCfg.FWDBPath,
+		FWLockoutCheck:      fileCfg.FWLockoutCheck,
+		FWAutoImport:        fileCfg.FWAutoImport,
+		FWNATPriority:       fileCfg.FWNATPriority,
+		FWInstance:          fileCfg.FWInstance,
+		FWMaxRules:          fileCfg.FWMaxRules,
+		DBPerm:              dbPerm,
+		ConfigPath:          configPath,
+		TLSCertFile:         tlsInfo.CertFile,
+		TLSKeyFile:          tlsInfo.KeyFile,
+		ServiceName:         fileCfg.ServiceName,
+		EnableAdminActions:  fileCfg.EnableAdminActions,
+		RequireApproval:     fileCfg.RequireSecondApproval,
+		UpdateCheckInterval: time.Duration(fileCfg.UpdateCheckHours) * time.Hour,
+		UpdateWebhook:       fileCfg.UpdateWebhook,
+		StateDir:            fileCfg.StateDir,
+		UpdateStatusPath:    updateStatusPath(configPath, fileCfg.StateDir),
+		LogPath:             logFile,
+		LogLevel:            fileCfg.LogLevel,
+		AccessLog:           fileCfg.AccessLog,
+		AccessLogLevel:      accessLogLevel(fileCfg.AccessLogLevel),
+		AccessLogFormat:     fileCfg.AccessLogFormat,
+		TrustedProxies:      fileCfg.TrustedProxies,
+		MountAllowlist:      fileCfg.MountAllowlist,
+		SignalAllowlist:     fileCfg.SignalAllowlist,
+		ProcessUserCacheTTL: time.Duration(fileCfg.ProcessUserCacheSeconds) * time.Second,
+		ProcessCommandMax:   fileCfg.ProcessMaxCommandLen,
+		MaxBodyBytes:        fileCfg.MaxBodyBytes,
+		MaxUploadBytes:      fileCfg.MaxUploadBytes,
+		MaxReadBytes:        fileCfg.MaxReadBytes,
+		UploadDenyExt:       fileCfg.UploadDenyExt,
+		SearchMaxResults:    fileCfg.SearchMaxResults,
+		SearchMaxDepth:      fileCfg.SearchMaxDepth,
+		SearchTimeout:       time.Duration(fileCfg.SearchTimeoutSeconds) * time.Second,
+		SudoPasswordTTL:     time.Duration(fileCfg.SudoCacheTTLSeconds) * time.Second,
+		Maintenance:         fileCfg.Maintenance,
+		BrandName:           fileCfg.BrandName,
+		BrandLogo:           fileCfg.BrandLogo,
+
+		TermIdleTTL:            time.Duration(fileCfg.TerminalIdleTimeoutSeconds) * time.Second,
+		TermMaxLifetime:        time.Duration(fileCfg.TerminalMaxLifetimeSeconds) * time.Second,
+		TermMaxSessionsPerUser: fileCfg.TerminalMaxSessionsPerUser,
+		TermMaxSessions:        fileCfg.TerminalMaxSessions,
+		TermEnv:                fileCfg.TerminalEnv,
+		TermEnvBlocklist:       fileCfg.TerminalEnvBlocklist,
+		TermCleanEnv:           fileCfg.TerminalCleanEnv,
+		TermStreamBuffer:       fileCfg.TerminalStreamBuffer,
+		TermStreamBlock:        time.Duration(fileCfg.TerminalStreamBlockMS) * time.Millisecond,
+		RegenerateTLS: func() (time.Time, error) {
+			return regenerateSelfSignedTLS(configPath, listenAddr)
+		},
 	}
 
 	srv, err := app.New(cfg)
@@ -128,12 +225,35 @@ func main() {
 		slog.Error("init app", "err", err)
 		os.Exit(1)
 	}
+	// gRPC shares the HTTPS listener unless grpc_listen gives it its own.
 	grpcServer := srv.GRPCServer()
+	muxedGRPC := grpcServer
+	if fileCfg.GRPCListen != "" {
+		gs, lis, err := newGRPCListener(srv, fileCfg.GRPCListen, fileCfg.GRPCTLS, tlsInfo.CertFile, tlsInfo.KeyFile)
+		if err != nil {
+			slog.Error("grpc listener", "err", err)
+			os.Exit(1)
+		}
+		grpcServer, muxedGRPC = gs, nil
+		go func() {
+			logging.InfoOrDebug("grpc listening", "addr", lis.Addr().String(), "tls", fileCfg.GRPCTLS)
+			if err := gs.Serve(lis); err != nil {
+				slog.Error("grpc server", "err", err)
+			}
+		}()
+	}
 
 	httpServer := &http.Server{
 		Addr:              listenAddr,
-		Handler:           app.GRPCMux(srv.Handler(), grpcServer),
-		ReadHeaderTimeout: 5 * time.Second,
+		Handler:           app.GRPCMux(srv.Handler(), muxedGRPC),
+		ReadHeaderTimeout: timeoutSeconds(fileCfg.HTTPReadHeaderTimeoutSeconds),
+		ReadTimeout:       timeoutSeconds(fileCfg.HTTPReadTimeoutSeconds),
+		WriteTimeout:      timeoutSeconds(fileCfg.HTTPWriteTimeoutSeconds),
+		IdleTimeout:       timeoutSeconds(fileCfg.HTTPIdleTimeoutSeconds),
+	}
+	if wt := httpServer.WriteTimeout; wt > 0 && wt <= app.HandlerTimeout {
+		slog.Warn("http_write_timeout_seconds is not above the request timeout; slow requests will be cut off instead of getting a 503",
+			"write_timeout", wt, "request_timeout", app.HandlerTimeout)
 	}
 
 	go func() {
@@ -156,6 +276,18 @@ func main() {
 		}
 	}()
 
+	var redirectServer *http.Server
+	if fileCfg.HTTPRedirect && tlsInfo.CertFile != "" && tlsInfo.KeyFile != "" {
+		redirectServer = newRedirectServer(listenAddr, fileCfg.HTTPRedirectPort)
+		go func() {
+			logging.InfoOrDebug("http redirect", "addr", redirectServer.Addr)
+			err := redirectServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				slog.Error("http redirect", "err", err)
+			}
+		}()
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
@@ -163,9 +295,28 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	grpcServer.GracefulStop()
+	if redirectServer != nil {
+		_ = redirectServer.Shutdown(ctx)
+	}
 	_ = httpServer.Shutdown(ctx)
 }
 
+func accessLogLevel(name string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// timeoutSeconds converts a config timeout; negative values disable it.
+func timeoutSeconds(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
 func envDefault(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -173,6 +324,12 @@ func envDefault(key, fallback string) string {
 	return fallback
 }
 
+// envBool reports whether the environment variable key is set to a true value.
+func envBool(key string) bool {
+	v, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key)))
+	return err == nil && v
+}
+
 func resolveRelativeToConfigDir(configPath, p string) string {
 	p = strings.TrimSpace(p)
 	if p == "" {
@@ -184,7 +341,18 @@ func resolveRelativeToConfigDir(configPath, p string) string {
 	return filepath.Join(filepath.Dir(filepath.Clean(configPath)), p)
 }
 
-func daemonizeSelf() error {
+// shouldDaemonize reports whether to detach. Without a TTY on stdout (systemd, pipes)
+// it is always false, whatever the config says.
+func shouldDaemonize(enabled, foreground, daemonChild bool, stdoutFd uintptr) bool {
+	if !enabled || foreground || daemonChild {
+		return false
+	}
+	return isTerminal(stdoutFd)
+}
+
+// daemonizeSelf re-execs the binary in a new session with stdout/stderr appended to
+// logPath (so panics and early errors aren't lost), and returns once it has started.
+func daemonizeSelf(logPath string) error {
 	args := make([]string, 0, len(os.Args)+1)
 	args = append(args, os.Args[1:]...)
 	args = append(args, "-daemon-child")
@@ -194,9 +362,35 @@ func daemonizeSelf() error {
 		return err
 	}
 	defer devNull.Close()
+	out := devNull
+	if logPath != "" {
+		if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
 	cmd.Stdin = devNull
-	cmd.Stdout = devNull
-	cmd.Stderr = devNull
+	cmd.Stdout = out
+	cmd.Stderr = out
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 	return cmd.Start()
 }
+
+// updateStatusPath is where the post-update health check records its result: the
+// state directory, or next to the config file.
+func updateStatusPath(configPath, stateDir string) string {
+	if stateDir == "" {
+		stateDir = filepath.Dir(filepath.Clean(configPath))
+	}
+	p := filepath.Join(stateDir, "atlas.update.json")
+	// The health check runs in its own unit with a different working directory.
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	return p
+}
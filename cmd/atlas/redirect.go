@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// newRedirectServer returns a plain HTTP server that redirects everything to the HTTPS listener.
+func newRedirectServer(listenAddr string, port int) *http.Server {
+	host, _, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		host = ""
+	}
+	return &http.Server{
+		Addr:              net.JoinHostPort(host, strconv.Itoa(port)),
+		Handler:           httpsRedirectHandler(listenAddr),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// httpsRedirectHandler redirects to https://<request host>:<tls port><path>?<query>.
+// The path is kept as-is, so the base path is preserved.
+func httpsRedirectHandler(listenAddr string) http.Handler {
+	_, tlsPort, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		tlsPort = ""
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if host == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		hostPort := host
+		if tlsPort != "" && tlsPort != "443" {
+			hostPort = net.JoinHostPort(host, tlsPort)
+		} else if strings.Contains(host, ":") {
+			hostPort = "[" + host + "]"
+		}
+		target := "https://" + hostPort + r.URL.EscapedPath()
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
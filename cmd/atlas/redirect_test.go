@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		listen, host, target, want string
+	}{
+		{"127.0.0.1:8443", "example.com", "/abc/login?x=1", "https://example.com:8443/abc/login?x=1"},
+		{"0.0.0.0:8443", "example.com:80", "/abc/", "https://example.com:8443/abc/"},
+		{":443", "example.com", "/", "https://example.com/"},
+		{"[::]:8443", "[::1]:80", "/p", "https://[::1]:8443/p"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		req.Host = tc.host
+		rr := httptest.NewRecorder()
+		httpsRedirectHandler(tc.listen).ServeHTTP(rr, req)
+		if rr.Code != http.StatusMovedPermanently {
+			t.Fatalf("%s: status=%d", tc.target, rr.Code)
+		}
+		if got := rr.Header().Get("Location"); got != tc.want {
+			t.Fatalf("%s: location=%q want %q", tc.target, got, tc.want)
+		}
+	}
+}
+
+func TestNewRedirectServerAddr(t *testing.T) {
+	t.Parallel()
+
+	if got := newRedirectServer("127.0.0.1:8443", 80).Addr; got != "127.0.0.1:80" {
+		t.Fatalf("addr=%q", got)
+	}
+}
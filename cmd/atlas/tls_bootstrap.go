@@ -1,15 +1,18 @@
 package main
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"math/big"
 	"net"
 	"os"
@@ -72,16 +75,7 @@ func ensureTLSBootstrap(configPath, listenAddr string, cfg *config.Config) (tlsB
 		return tlsBootstrapInfo{CertFile: certFile, KeyFile: keyFile}, nil
 	}
 
-	dnsNames, ipAddrs := tlsSANs(listenAddr)
-	certPEM, keyPEM, err := makeSelfSignedTLS(dnsNames, ipAddrs)
-	if err != nil {
-		return tlsBootstrapInfo{}, err
-	}
-
-	if err := writeTLSFileAtomic(certFile, certPEM, 0o600); err != nil {
-		return tlsBootstrapInfo{}, err
-	}
-	if err := writeTLSFileAtomic(keyFile, keyPEM, 0o600); err != nil {
+	if err := writeSelfSignedTLS(certFile, keyFile, listenAddr, cfg); err != nil {
 		return tlsBootstrapInfo{}, err
 	}
 
@@ -94,6 +88,48 @@ func ensureTLSBootstrap(configPath, listenAddr string, cfg *config.Config) (tlsB
 	return tlsBootstrapInfo{CertFile: certFile, KeyFile: keyFile, Generated: true}, nil
 }
 
+// writeSelfSignedTLS generates a self-signed pair for listenAddr using the cert options
+// from cfg and writes it to certFile/keyFile.
+func writeSelfSignedTLS(certFile, keyFile, listenAddr string, cfg *config.Config) error {
+	dnsNames, ipAddrs := tlsSANs(listenAddr, cfg.TLSExtraSANs)
+	certPEM, keyPEM, err := makeSelfSignedTLS(dnsNames, ipAddrs, selfSignedOptions{
+		Validity: time.Duration(cfg.TLSSelfSignedDays) * 24 * time.Hour,
+		KeyType:  cfg.TLSKeyType,
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeTLSFileAtomic(certFile, certPEM, 0o600); err != nil {
+		return err
+	}
+	return writeTLSFileAtomic(keyFile, keyPEM, 0o600)
+}
+
+// regenerateSelfSignedTLS replaces the auto-generated pair next to the config with a new
+// one (current SANs and options) and returns its expiry. The running server keeps the old
+// certificate until restarted.
+func regenerateSelfSignedTLS(configPath, listenAddr string) (time.Time, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	cfgDir := filepath.Dir(filepath.Clean(configPath))
+	certFile := filepath.Join(cfgDir, autoTLSCertName)
+	keyFile := filepath.Join(cfgDir, autoTLSKeyName)
+	if err := writeSelfSignedTLS(certFile, keyFile, listenAddr, &cfg); err != nil {
+		return time.Time{}, err
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+	return leaf.NotAfter, nil
+}
+
 func validateTLSKeyPair(certFile, keyFile string) error {
 	certPEM, err := os.ReadFile(certFile)
 	if err != nil {
@@ -110,8 +146,31 @@ func validateTLSKeyPair(certFile, keyFile string) error {
 	return nil
 }
 
-func makeSelfSignedTLS(dnsNames []string, ipAddrs []net.IP) ([]byte, []byte, error) {
-	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+// selfSignedOptions controls the generated certificate; zero values mean a 1-year P-256 cert.
+type selfSignedOptions struct {
+	Validity time.Duration
+	KeyType  string
+}
+
+func generateTLSKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case "", "ecdsa-p256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ecdsa-p384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "rsa-2048":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "rsa-4096":
+		return rsa.GenerateKey(rand.Reader, 4096)
+	}
+	return nil, fmt.Errorf("unsupported tls_key_type %q", keyType)
+}
+
+func makeSelfSignedTLS(dnsNames []string, ipAddrs []net.IP, opts selfSignedOptions) ([]byte, []byte, error) {
+	if opts.Validity <= 0 {
+		opts.Validity = 365 * 24 * time.Hour
+	}
+	priv, err := generateTLSKey(opts.KeyType)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -130,14 +189,14 @@ func makeSelfSignedTLS(dnsNames []string, ipAddrs []net.IP) ([]byte, []byte, err
 		SerialNumber: serial,
 		Subject:      pkix.Name{CommonName: cn},
 		NotBefore:    time.Now().Add(-5 * time.Minute),
-		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		NotAfter:     time.Now().Add(opts.Validity),
 		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		DNSNames:     dnsNames,
 		IPAddresses:  ipAddrs,
 	}
 
-	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &priv.PublicKey, priv)
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, priv.Public(), priv)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -152,7 +211,7 @@ func makeSelfSignedTLS(dnsNames []string, ipAddrs []net.IP) ([]byte, []byte, err
 	return certPEM, keyPEM, nil
 }
 
-func tlsSANs(listenAddr string) ([]string, []net.IP) {
+func tlsSANs(listenAddr string, extra []string) ([]string, []net.IP) {
 	dnsSet := map[string]struct{}{"localhost": {}}
 	ipSet := map[string]net.IP{
 		"127.0.0.1": net.ParseIP("127.0.0.1"),
@@ -178,6 +237,14 @@ func tlsSANs(listenAddr string) ([]string, []net.IP) {
 		dnsSet[host] = struct{}{}
 	}
 
+	for _, san := range extra {
+		if ip := net.ParseIP(san); ip != nil {
+			ipSet[ip.String()] = ip
+		} else {
+			dnsSet[strings.ToLower(san)] = struct{}{}
+		}
+	}
+
 	dnsNames := make([]string, 0, len(dnsSet))
 	for n := range dnsSet {
 		dnsNames = append(dnsNames, n)
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/MrTeeett/atlas/internal/config"
 )
@@ -72,6 +78,91 @@ func TestEnsureTLSBootstrapGeneratesAndPersists(t *testing.T) {
 	}
 }
 
+func TestEnsureTLSBootstrapHonorsSelfSignedOptions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "atlas.json")
+	body := `{"listen":"127.0.0.1:18443","root":"/","base_path":"/","tls_key_type":"ecdsa-p384","tls_self_signed_days":30,"tls_extra_sans":["panel.example.com","10.1.2.3"]}`
+	if err := os.WriteFile(cfgPath, []byte(body+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	info, err := ensureTLSBootstrap(cfgPath, cfg.Listen, &cfg)
+	if err != nil {
+		t.Fatalf("ensureTLSBootstrap: %v", err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(info.CertFile, info.KeyFile)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P384() {
+		t.Fatalf("expected a P-384 key, got %T", cert.PublicKey)
+	}
+	if d := cert.NotAfter.Sub(cert.NotBefore); d < 29*24*time.Hour || d > 31*24*time.Hour {
+		t.Fatalf("validity=%v", d)
+	}
+	if !slices.Contains(cert.DNSNames, "panel.example.com") {
+		t.Fatalf("DNSNames=%v", cert.DNSNames)
+	}
+	var hasIP bool
+	for _, ip := range cert.IPAddresses {
+		hasIP = hasIP || ip.String() == "10.1.2.3"
+	}
+	if !hasIP {
+		t.Fatalf("IPAddresses=%v", cert.IPAddresses)
+	}
+}
+
+func TestRegenerateSelfSignedTLSReplacesPair(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "atlas.json")
+	if err := os.WriteFile(cfgPath, []byte("{\"listen\":\"127.0.0.1:18443\",\"root\":\"/\",\"base_path\":\"/\"}\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	info, err := ensureTLSBootstrap(cfgPath, cfg.Listen, &cfg)
+	if err != nil {
+		t.Fatalf("ensureTLSBootstrap: %v", err)
+	}
+	before, err := os.ReadFile(info.CertFile)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	notAfter, err := regenerateSelfSignedTLS(cfgPath, cfg.Listen)
+	if err != nil {
+		t.Fatalf("regenerateSelfSignedTLS: %v", err)
+	}
+	if d := time.Until(notAfter); d < 364*24*time.Hour {
+		t.Fatalf("notAfter=%v", notAfter)
+	}
+	after, err := os.ReadFile(info.CertFile)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(before) == string(after) {
+		t.Fatalf("certificate was not replaced")
+	}
+	if err := validateTLSKeyPair(info.CertFile, info.KeyFile); err != nil {
+		t.Fatalf("validateTLSKeyPair: %v", err)
+	}
+}
+
 func TestEnsureTLSBootstrapRejectsPartialTLSConfig(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// accessInfo lets handlers deeper in the chain report the authenticated user to the
+// access log, which wraps them and can't see their request context.
+type accessInfo struct {
+	user string
+}
+
+type accessInfoKey struct{}
+
+func setAccessUser(ctx context.Context, user string) {
+	if ai, ok := ctx.Value(accessInfoKey{}).(*accessInfo); ok {
+		ai.user = user
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// accessLog logs one line per request. Terminal output streams are skipped: they stay
+// open for the whole session and say nothing about who did what.
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	if !s.cfg.AccessLog {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, s.path("/api/term/session/")) && strings.HasSuffix(r.URL.Path, "/stream") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		ai := &accessInfo{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessInfoKey{}, ai)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ip := s.clientIP(r)
+		target := r.URL.Path
+		if q := redactQuery(r.URL.RawQuery); q != "" {
+			target += "?" + q
+		}
+		dur := time.Since(start)
+		user := ai.user
+		logger := s.accessLogger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		if s.cfg.AccessLogFormat == "combined" {
+			if user == "" {
+				user = "-"
+			}
+			msg := fmt.Sprintf("%s - %s %q %d %d %s", ip, user, r.Method+" "+target+" "+r.Proto, status, rec.bytes, dur.Round(time.Millisecond))
+			logger.Log(r.Context(), s.cfg.AccessLogLevel, msg)
+			return
+		}
+		logger.Log(r.Context(), s.cfg.AccessLogLevel, "http request",
+			"method", r.Method,
+			"path", target,
+			"status", status,
+			"bytes", rec.bytes,
+			"duration_ms", dur.Milliseconds(),
+			"ip", ip,
+			"user", user,
+		)
+	})
+}
+
+// sensitiveParams are query keys whose values never reach the access log.
+var sensitiveParams = []string{"pass", "secret", "token", "key", "auth", "sig"}
+
+func redactQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return "(unparsed)"
+	}
+	for k := range q {
+		lk := strings.ToLower(k)
+		for _, p := range sensitiveParams {
+			if strings.Contains(lk, p) {
+				q[k] = []string{"REDACTED"}
+				break
+			}
+		}
+	}
+	return q.Encode()
+}
+
+// clientIP returns the request's client address. X-Forwarded-For is only believed when
+// the connection comes from a trusted proxy; the client is then the rightmost address
+// that is not itself a trusted proxy.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if len(s.trustedProxies) == 0 || !s.isTrustedProxy(net.ParseIP(host)) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if !s.isTrustedProxy(ip) {
+			return ip.String()
+		}
+	}
+	return host
+}
+
+func (s *Server) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range s.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies accepts IP addresses and CIDR ranges.
+func parseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("bad trusted proxy %q", v)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("bad trusted proxy %q", v)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+
+	srv, err := New(Config{
+		RootDir:        "/",
+		AuthStore:      &testStore{passByUser: map[string]string{"admin": "ok"}},
+		Secret:         []byte("0123456789abcdef0123456789abcdef"),
+		FWDBPath:       filepath.Join(t.TempDir(), "fw.db"),
+		AccessLog:      true,
+		AccessLogLevel: slog.LevelInfo,
+		TrustedProxies: []string{"192.0.2.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var buf bytes.Buffer
+	srv.accessLogger = slog.New(slog.NewTextHandler(&buf, nil))
+	h := srv.Handler()
+
+	form := url.Values{}
+	form.Set("user", "admin")
+	form.Set("pass", "ok")
+	r := httptest.NewRequest(http.MethodPost, "http://example/login", strings.NewReader(form.Encode()))
+	r.Header.Set("content-type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	cookieKV := strings.Split(w.Header().Get("Set-Cookie"), ";")[0]
+	buf.Reset()
+
+	r = httptest.NewRequest(http.MethodGet, "https://example/api/processes?human=1&token=s3cret", nil)
+	r.RemoteAddr = "192.0.2.10:4444"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 192.0.2.11")
+	r.Header.Set("Cookie", cookieKV)
+	r.Header.Set("X-Atlas-Sudo-Pass", "hunter2")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	line := buf.String()
+	for _, want := range []string{"method=GET", "status=200", "ip=203.0.113.7", "user=admin", "token=REDACTED", "human=1"} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("access log %q lacks %q", line, want)
+		}
+	}
+	for _, leak := range []string{"s3cret", "hunter2"} {
+		if strings.Contains(line, leak) {
+			t.Fatalf("access log leaks %q: %q", leak, line)
+		}
+	}
+
+	// An untrusted peer can't choose its logged address.
+	buf.Reset()
+	r = httptest.NewRequest(http.MethodGet, "http://example/api/me", nil)
+	r.RemoteAddr = "198.51.100.1:4444"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if line := buf.String(); !strings.Contains(line, "ip=198.51.100.1") || !strings.Contains(line, "status=401") {
+		t.Fatalf("unexpected access log %q", line)
+	}
+}
@@ -27,6 +27,8 @@ type adminStore interface {
 	SetPermissions(user string, role string, canExec bool, canProcs bool, canFW bool, fsSudo bool, fsAny bool, fsUsers []string) error
 	SetSudoPassword(user string, pass string) error
 	GetSudoPassword(user string) (string, bool, error)
+	SetMustChangePassword(user string, v bool) error
+	SetFWReadOnly(user string, v bool) error
 }
 
 func (s *Server) adminStore() (adminStore, error) {
@@ -49,10 +51,94 @@ type adminUser struct {
 	FSSudo   bool     `json:"fs_sudo"`
 	FSAny    bool     `json:"fs_any"`
 	FSUsers  []string `json:"fs_users"`
+
+	FWReadOnly         bool `json:"fw_read_only"`
+	MustChangePassword bool `json:"must_change_password"`
 }
 
 type adminUsersResponse struct {
 	Users []adminUser `json:"users"`
+	// Total counts the users matching the filters, before offset/limit.
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// maxAdminUsersPage caps how many users one listing returns.
+const maxAdminUsersPage = 1000
+
+// listAdminUsers serves GET /api/admin/users. q filters by user name substring and
+// role by exact role; offset/limit page through the sorted result. Name filtering and
+// paging happen before the per-user lookups whenever the role filter allows it.
+func (s *Server) listAdminUsers(w http.ResponseWriter, r *http.Request, st adminStore) {
+	qs := r.URL.Query()
+	q := strings.ToLower(strings.TrimSpace(qs.Get("q")))
+	role := strings.TrimSpace(qs.Get("role"))
+	offset, limit := 0, maxAdminUsersPage
+	if v := strings.TrimSpace(qs.Get("offset")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "bad offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+	if v := strings.TrimSpace(qs.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "bad limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxAdminUsersPage)
+	}
+
+	var names []string
+	for _, u := range st.ListUsers() {
+		if q == "" || strings.Contains(strings.ToLower(u), q) {
+			names = append(names, u)
+		}
+	}
+	sort.Strings(names)
+
+	page := func(n int) (int, int) {
+		from := min(offset, n)
+		return from, min(from+limit, n)
+	}
+	resp := adminUsersResponse{Users: []adminUser{}, Offset: offset, Limit: limit}
+	if role == "" {
+		resp.Total = len(names)
+		from, to := page(len(names))
+		names = names[from:to]
+	}
+	for _, u := range names {
+		info, ok, err := st.GetUser(u)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok || (role != "" && info.Role != role) {
+			continue
+		}
+		resp.Users = append(resp.Users, adminUser{
+			User:     info.User,
+			Role:     info.Role,
+			CanExec:  info.CanExec,
+			CanProcs: info.CanProcs,
+			CanFW:    info.CanFW,
+			FSSudo:   info.FSSudo,
+			FSAny:    info.FSAny,
+			FSUsers:  append([]string{}, info.FSUsers...),
+
+			FWReadOnly:         info.FWReadOnly,
+			MustChangePassword: info.MustChangePassword,
+		})
+	}
+	if role != "" {
+		resp.Total = len(resp.Users)
+		from, to := page(len(resp.Users))
+		resp.Users = resp.Users[from:to]
+	}
+	writeJSON(w, resp)
 }
 
 type adminUserUpsertRequest struct {
@@ -65,6 +151,10 @@ type adminUserUpsertRequest struct {
 	FSSudo   bool     `json:"fs_sudo"`
 	FSAny    bool     `json:"fs_any"`
 	FSUsers  []string `json:"fs_users"`
+	// FWReadOnly limits CanFW to viewing the firewall.
+	FWReadOnly bool `json:"fw_read_only"`
+	// MustChangePassword forces a password change after the next login.
+	MustChangePassword bool `json:"must_change_password"`
 }
 
 func (s *Server) HandleAdminUsers(w http.ResponseWriter, r *http.Request) {
@@ -75,30 +165,7 @@ func (s *Server) HandleAdminUsers(w http.ResponseWriter, r *http.Request) {
 	}
 	switch r.Method {
 	case http.MethodGet:
-		users := st.ListUsers()
-		sort.Strings(users)
-		var out []adminUser
-		for _, u := range users {
-			info, ok, err := st.GetUser(u)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			if !ok {
-				continue
-			}
-			out = append(out, adminUser{
-				User:     info.User,
-				Role:     info.Role,
-				CanExec:  info.CanExec,
-				CanProcs: info.CanProcs,
-				CanFW:    info.CanFW,
-				FSSudo:   info.FSSudo,
-				FSAny:    info.FSAny,
-				FSUsers:  append([]string{}, info.FSUsers...),
-			})
-		}
-		writeJSON(w, adminUsersResponse{Users: out})
+		s.listAdminUsers(w, r, st)
 		return
 
 	case http.MethodPost:
@@ -108,7 +175,7 @@ func (s *Server) HandleAdminUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req adminUserUpsertRequest
-	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -124,6 +191,10 @@ func (s *Server) HandleAdminUsers(w http.ResponseWriter, r *http.Request) {
 	if strings.TrimSpace(req.Role) == "" {
 		req.Role = "user"
 	}
+	if req.MustChangePassword && s.cfg.Authenticator != nil {
+		http.Error(w, "passwords are managed by the external auth backend", http.StatusBadRequest)
+		return
+	}
 
 	if err := st.UpsertUser(req.User, req.Pass); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -133,6 +204,16 @@ func (s *Server) HandleAdminUsers(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := st.SetFWReadOnly(req.User, req.FWReadOnly); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.MustChangePassword {
+		if err := st.SetMustChangePassword(req.User, true); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -156,13 +237,28 @@ func (s *Server) HandleAdminUserID(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPut:
 		var req adminUserUpsertRequest
-		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "bad json", http.StatusBadRequest)
 			return
 		}
 		if strings.TrimSpace(req.Role) == "" {
 			req.Role = "user"
 		}
+		if req.MustChangePassword && s.cfg.Authenticator != nil {
+			http.Error(w, "passwords are managed by the external auth backend", http.StatusBadRequest)
+			return
+		}
+		s.adminUsersMu.Lock()
+		defer s.adminUsersMu.Unlock()
+		if !isAdminRole(req.Role) {
+			if last, err := isLastAdmin(st, user); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			} else if last {
+				http.Error(w, "cannot remove the admin role from the last admin", http.StatusConflict)
+				return
+			}
+		}
 		// Optional password update.
 		if req.Pass != "" {
 			if err := st.UpsertUser(user, req.Pass); err != nil {
@@ -174,6 +270,15 @@ func (s *Server) HandleAdminUserID(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err := st.SetFWReadOnly(user, req.FWReadOnly); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := st.SetMustChangePassword(user, req.MustChangePassword); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.invalidateSudoPassword(user)
 		w.WriteHeader(http.StatusNoContent)
 		return
 
@@ -182,10 +287,20 @@ func (s *Server) HandleAdminUserID(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "cannot delete current user", http.StatusBadRequest)
 			return
 		}
+		s.adminUsersMu.Lock()
+		defer s.adminUsersMu.Unlock()
+		if last, err := isLastAdmin(st, user); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if last {
+			http.Error(w, "cannot delete the last admin", http.StatusConflict)
+			return
+		}
 		if err := st.DeleteUser(user); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		s.invalidateSudoPassword(user)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	default:
@@ -194,6 +309,31 @@ func (s *Server) HandleAdminUserID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func isAdminRole(role string) bool {
+	return strings.EqualFold(strings.TrimSpace(role), "admin")
+}
+
+// isLastAdmin reports whether user has the admin role and no other account does.
+func isLastAdmin(st adminStore, user string) (bool, error) {
+	info, ok, err := st.GetUser(user)
+	if err != nil || !ok || !isAdminRole(info.Role) {
+		return false, err
+	}
+	for _, u := range st.ListUsers() {
+		if u == user {
+			continue
+		}
+		other, ok, err := st.GetUser(u)
+		if err != nil {
+			return false, err
+		}
+		if ok && isAdminRole(other.Role) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 type adminConfigResponse struct {
 	ConfigPath         string        `json:"config_path"`
 	ServiceName        string        `json:"service_name"`
@@ -208,7 +348,7 @@ func (s *Server) HandleAdminConfig(w http.ResponseWriter, r *http.Request) {
 	}
 	switch r.Method {
 	case http.MethodGet:
-		cfg, err := config.Load(s.cfg.ConfigPath)
+		cfg, err := config.LoadBase(s.cfg.ConfigPath)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -229,7 +369,7 @@ func (s *Server) HandleAdminConfig(w http.ResponseWriter, r *http.Request) {
 
 	// Update config file on disk. Requires restart to apply.
 	var req config.Config
-	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -290,7 +430,7 @@ func (s *Server) HandleAdminAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req adminActionRequest
-	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -307,19 +447,21 @@ func (s *Server) HandleAdminAction(w http.ResponseWriter, r *http.Request) {
 	var cmd *exec.Cmd
 	switch action {
 	case "restart":
-		if strings.TrimSpace(s.cfg.ServiceName) == "" {
-			http.Error(w, "service_name is not configured", http.StatusBadRequest)
+		unit, err := serviceUnit(s.cfg.ServiceName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		unit := strings.TrimSpace(s.cfg.ServiceName)
-		if !strings.HasSuffix(unit, ".service") {
-			unit += ".service"
-		}
 		cmd = s.rootCmd(ctx, "systemctl", "restart", unit)
-	case "reboot":
-		cmd = s.rootCmd(ctx, "systemctl", "reboot")
-	case "shutdown":
-		cmd = s.rootCmd(ctx, "systemctl", "poweroff")
+	case "reboot", "shutdown":
+		if s.deferForApproval(w, r, action, req, s.HandleAdminAction) {
+			return
+		}
+		if action == "reboot" {
+			cmd = s.rootCmd(ctx, "systemctl", "reboot")
+		} else {
+			cmd = s.rootCmd(ctx, "systemctl", "poweroff")
+		}
 	default:
 		http.Error(w, "unknown action", http.StatusBadRequest)
 		return
@@ -373,6 +515,11 @@ type adminLogsResponse struct {
 	SizeBytes int64    `json:"size_bytes"`
 	Truncated bool     `json:"truncated"`
 	Lines     []string `json:"lines"`
+	// Matched is the total number of matching lines when a filter is given.
+	Matched *int `json:"matched,omitempty"`
+	// Times holds the parsed timestamp of each line; stored logs stay UTC.
+	Times    []logTime `json:"times,omitempty"`
+	TimeZone string    `json:"time_zone,omitempty"`
 }
 
 func (s *Server) HandleAdminLogs(w http.ResponseWriter, r *http.Request) {
@@ -393,15 +540,7 @@ func (s *Server) HandleAdminLogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.URL.Query().Get("download") == "1" {
-		f, err := os.Open(path)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		defer f.Close()
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filepath.Base(path)))
-		_, _ = io.Copy(w, f)
+		serveLogSnapshot(w, r, path)
 		return
 	}
 
@@ -418,6 +557,23 @@ func (s *Server) HandleAdminLogs(w http.ResponseWriter, r *http.Request) {
 		n = 5000
 	}
 
+	filter, filtered, err := parseLogFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filtered {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		offset = min(max(offset, 0), 100000)
+		lines, size, matched, err := searchLines(path, filter, n, offset)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, adminLogsResponse{Enabled: true, Path: path, SizeBytes: size, Lines: lines, Matched: &matched}.withTimes(r.Context()))
+		return
+	}
+
 	lines, size, truncated, err := tailLines(path, n, 1<<20)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -427,7 +583,28 @@ func (s *Server) HandleAdminLogs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, adminLogsResponse{Enabled: true, Path: path, SizeBytes: size, Lines: lines, Truncated: truncated})
+	writeJSON(w, adminLogsResponse{Enabled: true, Path: path, SizeBytes: size, Lines: lines, Truncated: truncated}.withTimes(r.Context()))
+}
+
+// serveLogSnapshot sends the log file as it was when opened. The logger only appends
+// and rotates by renaming, so the open descriptor stays on the same file; reading just
+// up to its size at open keeps lines written (or a rotation) mid-download out of it.
+func serveLogSnapshot(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filepath.Base(path)))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, "", st.ModTime(), io.NewSectionReader(f, 0, st.Size()))
 }
 
 func tailLines(path string, n int, maxBytes int64) (lines []string, size int64, truncated bool, _ error) {
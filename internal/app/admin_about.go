@@ -0,0 +1,51 @@
+package app
+
+import (
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/buildinfo"
+)
+
+var processStart = time.Now()
+
+type adminAboutResponse struct {
+	Version    string `json:"version"`
+	Channel    string `json:"channel"`
+	Commit     string `json:"commit,omitempty"`
+	BuiltAt    string `json:"built_at,omitempty"`
+	Repo       string `json:"repo,omitempty"`
+	GoVersion  string `json:"go_version"`
+	GOOS       string `json:"goos"`
+	GOARCH     string `json:"goarch"`
+	StartedAt  string `json:"started_at"`
+	UptimeSec  int64  `json:"uptime_seconds"`
+	PID        int    `json:"pid"`
+	EUID       int    `json:"euid"`
+	ConfigPath string `json:"config_path,omitempty"`
+}
+
+// HandleAdminAbout reports which binary is running and how (for bug reports and update checks).
+func (s *Server) HandleAdminAbout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, adminAboutResponse{
+		Version:    buildinfo.Version,
+		Channel:    buildinfo.Channel,
+		Commit:     buildinfo.Commit,
+		BuiltAt:    buildinfo.BuiltAt,
+		Repo:       buildinfo.Repo,
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		StartedAt:  processStart.UTC().Format(time.RFC3339),
+		UptimeSec:  int64(time.Since(processStart).Seconds()),
+		PID:        os.Getpid(),
+		EUID:       os.Geteuid(),
+		ConfigPath: s.cfg.ConfigPath,
+	})
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestHandleAdminAbout(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{cfg: Config{ConfigPath: "/etc/atlas/atlas.json"}}
+	rr := httptest.NewRecorder()
+	s.HandleAdminAbout(rr, httptest.NewRequest(http.MethodGet, "/api/admin/about", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status: %d body=%s", rr.Code, rr.Body.String())
+	}
+	var out adminAboutResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if out.PID != os.Getpid() || out.GOOS != runtime.GOOS || out.GoVersion != runtime.Version() || out.ConfigPath != "/etc/atlas/atlas.json" || out.Version == "" {
+		t.Fatalf("unexpected about: %#v", out)
+	}
+
+	rr = httptest.NewRecorder()
+	s.HandleAdminAbout(rr, httptest.NewRequest(http.MethodPost, "/api/admin/about", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rr.Code)
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -81,7 +81,7 @@ func (s *Server) HandleAdminAutostart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req adminAutostartSetRequest
-	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -112,14 +112,28 @@ func (s *Server) HandleAdminAutostart(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, adminActionResponse{Ok: true, Message: "autostart disabled"})
 }
 
-func (s *Server) autostartUnit() (unitName, unitPath string, _ error) {
-	name := strings.TrimSpace(s.cfg.ServiceName)
+var serviceUnitRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@-]*\.service$`)
+
+// serviceUnit normalizes the configured service name to a systemd unit name ("atlas" ->
+// "atlas.service") and rejects anything that could be read as a flag or a path.
+func serviceUnit(name string) (string, error) {
+	name = strings.TrimSpace(name)
 	if name == "" {
-		return "", "", errors.New("service_name is not configured")
+		return "", errors.New("service_name is not configured")
+	}
+	if !strings.HasSuffix(name, ".service") {
+		name += ".service"
+	}
+	if len(name) > 256 || !serviceUnitRe.MatchString(name) {
+		return "", fmt.Errorf("invalid service_name %q: use letters, digits, '-', '_', '.', '@'", name)
 	}
-	unitName = name
-	if !strings.HasSuffix(unitName, ".service") {
-		unitName += ".service"
+	return name, nil
+}
+
+func (s *Server) autostartUnit() (unitName, unitPath string, _ error) {
+	unitName, err := serviceUnit(s.cfg.ServiceName)
+	if err != nil {
+		return "", "", err
 	}
 	unitPath = filepath.Join("/etc/systemd/system", unitName)
 	return unitName, unitPath, nil
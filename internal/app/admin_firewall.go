@@ -0,0 +1,68 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"github.com/MrTeeett/atlas/internal/config"
+)
+
+type adminFirewallDBRequest struct {
+	Path string `json:"path"`
+}
+
+type adminFirewallDBResponse struct {
+	Path string `json:"path"`
+}
+
+// dataDirs are where Atlas keeps its own files: the config directory and state_dir.
+func (s *Server) dataDirs() []string {
+	dirs := []string{filepath.Dir(s.cfg.ConfigPath)}
+	if s.cfg.StateDir != "" {
+		dirs = append(dirs, s.cfg.StateDir)
+	}
+	return dirs
+}
+
+// HandleAdminFirewallDB reports (GET) or changes (POST {"path":...}) where firewall rules
+// are stored. The file is moved right away and the new path saved to the config file;
+// only the config directory, state_dir and the current DB directory are accepted.
+func (s *Server) HandleAdminFirewallDB(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, adminFirewallDBResponse{Path: s.fw.DBPath()})
+		return
+	case http.MethodPost:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.cfg.ConfigPath == "" {
+		http.Error(w, "config path is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req adminFirewallDBRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	oldPath, err := s.fw.RelocateDB(req.Path, s.dataDirs()...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	newPath := s.fw.DBPath()
+	if err := config.Update(s.cfg.ConfigPath, func(c *config.Config) { c.FWDBPath = newPath }); err != nil {
+		// Keep the running service and the config file in agreement.
+		if _, rerr := s.fw.RelocateDB(oldPath, s.dataDirs()...); rerr != nil {
+			slog.Error("firewall db: move back after config update failure", "err", rerr)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("firewall db relocated", "from", oldPath, "to", newPath)
+	writeJSON(w, adminFirewallDBResponse{Path: newPath})
+}
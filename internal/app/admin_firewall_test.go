@@ -0,0 +1,95 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrTeeett/atlas/internal/config"
+)
+
+func TestAdminFirewallDBRelocate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "atlas.json")
+	oldDB := filepath.Join(dir, "fw.db")
+	if err := os.WriteFile(cfgPath, []byte(`{"listen":"127.0.0.1:1","base_path":"/","firewall_db_path":"fw.db"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(oldDB, []byte(`{"version":1,"enabled":true,"rules":[{"id":"a","enabled":true,"type":"allow","proto":"tcp","port_from":22,"port_to":22}]}`), 0o600); err != nil {
+		t.Fatalf("WriteFile db: %v", err)
+	}
+	srv, err := New(Config{
+		RootDir:    "/",
+		AuthStore:  &testStore{passByUser: map[string]string{"admin": "ok"}},
+		Secret:     []byte("0123456789abcdef0123456789abcdef"),
+		FWDBPath:   oldDB,
+		ConfigPath: cfgPath,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.HandleAdminFirewallDB(w, httptest.NewRequest(http.MethodPost, "/api/admin/firewall/db", strings.NewReader(body)))
+		return w
+	}
+
+	if w := post(`{"path":"relative/fw.db"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("relative path: status=%d", w.Code)
+	}
+	if w := post(`{"path":"` + filepath.Join(dir, "missing", "fw.db") + `"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("missing dir: status=%d", w.Code)
+	}
+	if w := post(`{"path":"` + cfgPath + `"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("existing file must not be overwritten: status=%d", w.Code)
+	}
+
+	// Writable, but outside the config/state directories.
+	outside := t.TempDir()
+	if w := post(`{"path":"` + filepath.Join(outside, "fw.db") + `"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("outside dir: status=%d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "fw.db")); !os.IsNotExist(err) {
+		t.Fatalf("db written outside the allowed dirs: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	if w := post(`{"path":"` + filepath.Join(dir, "escape", "fw.db") + `"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("symlinked escape: status=%d", w.Code)
+	}
+
+	newDir := filepath.Join(dir, "state")
+	if err := os.Mkdir(newDir, 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	newDB := filepath.Join(newDir, "firewall.db")
+	w := post(`{"path":"` + newDB + `"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("relocate: status=%d body=%q", w.Code, w.Body.String())
+	}
+	var resp adminFirewallDBResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Path != newDB {
+		t.Fatalf("response=%+v err=%v", resp, err)
+	}
+	if _, err := os.Stat(oldDB); !os.IsNotExist(err) {
+		t.Fatalf("old db should be gone, stat err=%v", err)
+	}
+	b, err := os.ReadFile(newDB)
+	if err != nil || !strings.Contains(string(b), `"id": "a"`) {
+		t.Fatalf("new db content=%q err=%v", b, err)
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil || cfg.FWDBPath != newDB {
+		t.Fatalf("config firewall_db_path=%q err=%v", cfg.FWDBPath, err)
+	}
+	if got := srv.fw.DBPath(); got != newDB {
+		t.Fatalf("service still uses %q", got)
+	}
+}
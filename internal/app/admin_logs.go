@@ -0,0 +1,174 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/auth"
+)
+
+// logFilter selects slog text-format lines (`time=... level=... msg=...`).
+type logFilter struct {
+	Since    time.Time
+	Until    time.Time
+	Query    string
+	MinLevel int
+	HasLevel bool
+}
+
+var logLevels = map[string]int{"debug": 0, "info": 1, "warn": 2, "warning": 2, "error": 3}
+
+func parseLogFilter(q url.Values) (logFilter, bool, error) {
+	var f logFilter
+	active := false
+	for _, key := range []string{"since", "until"} {
+		v := strings.TrimSpace(q.Get(key))
+		if v == "" {
+			continue
+		}
+		t, err := parseLogTime(v)
+		if err != nil {
+			return f, false, errors.New("bad " + key + ": use RFC3339 or unix seconds")
+		}
+		if key == "since" {
+			f.Since = t
+		} else {
+			f.Until = t
+		}
+		active = true
+	}
+	if v := q.Get("q"); v != "" {
+		f.Query = strings.ToLower(v)
+		active = true
+	}
+	if v := strings.TrimSpace(strings.ToLower(q.Get("level"))); v != "" {
+		lvl, ok := logLevels[v]
+		if !ok {
+			return f, false, errors.New("bad level: use debug, info, warn or error")
+		}
+		f.MinLevel = lvl
+		f.HasLevel = true
+		active = true
+	}
+	return f, active, nil
+}
+
+func parseLogTime(v string) (time.Time, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, v)
+}
+
+func (f logFilter) match(line string) bool {
+	if f.Query != "" && !strings.Contains(strings.ToLower(line), f.Query) {
+		return false
+	}
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		t, err := time.Parse(time.RFC3339Nano, logField(line, "time"))
+		if err != nil {
+			return false
+		}
+		if !f.Since.IsZero() && t.Before(f.Since) {
+			return false
+		}
+		if !f.Until.IsZero() && t.After(f.Until) {
+			return false
+		}
+	}
+	if f.HasLevel {
+		lvl, ok := logLevels[strings.ToLower(logField(line, "level"))]
+		if !ok || lvl < f.MinLevel {
+			return false
+		}
+	}
+	return true
+}
+
+// logField returns the value of key=value in a slog text line (unquoted values only,
+// which covers time and level).
+func logField(line, key string) string {
+	prefix := key + "="
+	for _, part := range strings.Fields(line) {
+		if strings.HasPrefix(part, prefix) {
+			return strings.TrimPrefix(part, prefix)
+		}
+	}
+	return ""
+}
+
+// logTime is the timestamp of a log line as epoch seconds plus a rendering in the
+// user's time zone. Both are empty for lines without a time field.
+type logTime struct {
+	Unix  int64  `json:"unix,omitempty"`
+	Local string `json:"local,omitempty"`
+}
+
+// withTimes fills Times (parallel to Lines) and TimeZone for the request's user.
+func (resp adminLogsResponse) withTimes(ctx context.Context) adminLogsResponse {
+	resp.TimeZone = auth.LocationFromContext(ctx).String()
+	if len(resp.Lines) == 0 {
+		return resp
+	}
+	resp.Times = make([]logTime, len(resp.Lines))
+	for i, line := range resp.Lines {
+		t, err := time.Parse(time.RFC3339Nano, logField(line, "time"))
+		if err != nil {
+			continue
+		}
+		resp.Times[i] = logTime{Unix: t.Unix(), Local: auth.FormatLocal(ctx, t)}
+	}
+	return resp
+}
+
+// searchLines scans the whole file and returns the newest n matching lines, skipping the
+// newest offset matches, plus the total number of matches.
+func searchLines(path string, f logFilter, n, offset int) (lines []string, size int64, matched int, _ error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer file.Close()
+	st, err := file.Stat()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	size = st.Size()
+
+	keep := n + offset
+	ring := make([]string, 0, min(keep, 1024))
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if !f.match(line) {
+			continue
+		}
+		if len(ring) < keep {
+			ring = append(ring, line)
+		} else {
+			ring[matched%keep] = line
+		}
+		matched++
+	}
+	if err := sc.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+	if matched > keep {
+		// Rotate so the ring is oldest-first.
+		head := matched % keep
+		ring = append(ring[head:], ring[:head]...)
+	}
+	end := len(ring) - offset
+	if end <= 0 {
+		return nil, size, matched, nil
+	}
+	start := max(end-n, 0)
+	return ring[start:end], size, matched, nil
+}
@@ -2,11 +2,15 @@ package app
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestTailLines(t *testing.T) {
@@ -55,3 +59,93 @@ func TestHandleAdminLogsDisabled(t *testing.T) {
 		t.Fatalf("expected disabled")
 	}
 }
+
+// growingWriter simulates the logger appending and rotating while a download runs.
+type growingWriter struct {
+	*httptest.ResponseRecorder
+	path string
+	done bool
+}
+
+func (g *growingWriter) Write(p []byte) (int, error) {
+	if !g.done {
+		g.done = true
+		f, err := os.OpenFile(g.path, os.O_APPEND|os.O_WRONLY, 0)
+		if err == nil {
+			_, _ = f.WriteString("written during download\n")
+			_ = f.Close()
+		}
+		_ = os.Rename(g.path, g.path+".1")
+		_ = os.WriteFile(g.path, []byte("new file\n"), 0o600)
+	}
+	return g.ResponseRecorder.Write(p)
+}
+
+func TestHandleAdminLogsDownloadSnapshot(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "atlas.log")
+	want := strings.Repeat("time=2026-01-02T03:00:00Z level=INFO msg=\"event\"\n", 2000)
+	if err := os.WriteFile(p, []byte(want), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	s := &Server{cfg: Config{LogPath: p, LogLevel: "info"}}
+	w := &growingWriter{ResponseRecorder: httptest.NewRecorder(), path: p}
+	s.HandleAdminLogs(w, httptest.NewRequest("GET", "/api/admin/logs?download=1", nil))
+	if w.Code != 200 {
+		t.Fatalf("status: %d body=%s", w.Code, w.Body.String())
+	}
+	if got := w.Body.String(); got != want {
+		t.Fatalf("download is not the snapshot at open: got %d bytes, want %d (suffix %q)", len(got), len(want), got[max(0, len(got)-40):])
+	}
+	if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(len(want)) {
+		t.Fatalf("Content-Length = %q, want %d", cl, len(want))
+	}
+}
+
+func TestSearchLines(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "atlas.log")
+	var b strings.Builder
+	base := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	for i := 0; i < 30; i++ {
+		level := "INFO"
+		if i%3 == 0 {
+			level = "ERROR"
+		}
+		fmt.Fprintf(&b, "time=%s level=%s msg=\"event %d\"\n", base.Add(time.Duration(i)*time.Minute).Format(time.RFC3339Nano), level, i)
+	}
+	if err := os.WriteFile(p, []byte(b.String()), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	f, ok, err := parseLogFilter(url.Values{"level": {"error"}})
+	if err != nil || !ok {
+		t.Fatalf("parseLogFilter: ok=%v err=%v", ok, err)
+	}
+	lines, _, matched, err := searchLines(p, f, 3, 1)
+	if err != nil {
+		t.Fatalf("searchLines: %v", err)
+	}
+	if matched != 10 || len(lines) != 3 || !strings.Contains(lines[2], "event 24") || !strings.Contains(lines[0], "event 18") {
+		t.Fatalf("matched=%d lines=%q", matched, lines)
+	}
+
+	f, _, err = parseLogFilter(url.Values{
+		"since": {base.Add(10 * time.Minute).Format(time.RFC3339)},
+		"until": {strconv.FormatInt(base.Add(12*time.Minute).Unix(), 10)},
+		"q":     {"EVENT 1"},
+	})
+	if err != nil {
+		t.Fatalf("parseLogFilter: %v", err)
+	}
+	lines, _, matched, err = searchLines(p, f, 100, 0)
+	if err != nil {
+		t.Fatalf("searchLines: %v", err)
+	}
+	if matched != 3 || len(lines) != 3 || !strings.Contains(lines[0], "event 10") {
+		t.Fatalf("matched=%d lines=%q", matched, lines)
+	}
+
+	if _, _, err := parseLogFilter(url.Values{"level": {"loud"}}); err == nil {
+		t.Fatalf("expected error for bad level")
+	}
+}
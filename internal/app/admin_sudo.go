@@ -2,7 +2,6 @@ package app
 
 import (
 	"encoding/json"
-	"io"
 	"net/http"
 	"strings"
 
@@ -49,7 +48,7 @@ func (s *Server) HandleAdminSudo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req adminSudoRequest
-	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -63,6 +62,7 @@ func (s *Server) HandleAdminSudo(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		s.invalidateSudoPassword(user)
 		writeJSON(w, adminSudoResponse{User: user, HasPassword: false})
 		return
 	}
@@ -71,5 +71,6 @@ func (s *Server) HandleAdminSudo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.invalidateSudoPassword(user)
 	writeJSON(w, adminSudoResponse{User: user, HasPassword: true})
 }
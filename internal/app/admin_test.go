@@ -126,6 +126,47 @@ func TestAdminUsersAndConfigEndpoints(t *testing.T) {
 		t.Fatalf("create user status=%d body=%q", w.Code, w.Body.String())
 	}
 
+	// Filtered and paged listings.
+	for _, tc := range []struct {
+		query string
+		total int
+		users string
+	}{
+		{"", 2, "admin,alice"},
+		{"?q=LI", 1, "alice"},
+		{"?role=admin", 1, "admin"},
+		{"?offset=1&limit=1", 2, "alice"},
+		{"?role=user&offset=1", 1, ""},
+	} {
+		r = httptest.NewRequest(http.MethodGet, "http://example/x/api/admin/users"+tc.query, nil)
+		r.Header.Set("Cookie", cookie)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var list adminUsersResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("users%s: status=%d err=%v", tc.query, w.Code, err)
+		}
+		var names []string
+		for _, u := range list.Users {
+			names = append(names, u.User)
+		}
+		if list.Total != tc.total || strings.Join(names, ",") != tc.users {
+			t.Fatalf("users%s: total=%d users=%v", tc.query, list.Total, names)
+		}
+	}
+
+	// The only admin can't be demoted.
+	body, _ = json.Marshal(map[string]any{"role": "user"})
+	r = httptest.NewRequest(http.MethodPut, "http://example/x/api/admin/users/admin", bytes.NewReader(body))
+	r.Header.Set("content-type", "application/json")
+	r.Header.Set("Cookie", cookie)
+	r.Header.Set("X-Atlas-CSRF", me.CSRF)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("demote last admin status=%d body=%q", w.Code, w.Body.String())
+	}
+
 	// GET admin config.
 	r = httptest.NewRequest(http.MethodGet, "http://example/x/api/admin/config", nil)
 	r.Header.Set("Cookie", cookie)
@@ -134,4 +175,62 @@ func TestAdminUsersAndConfigEndpoints(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("config status=%d body=%q", w.Code, w.Body.String())
 	}
+
+	// Export users: permissions only, no hashes.
+	r = httptest.NewRequest(http.MethodGet, "http://example/x/api/admin/users/export", nil)
+	r.Header.Set("Cookie", cookie)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export status=%d body=%q", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "hash") || !strings.Contains(w.Body.String(), `"alice"`) {
+		t.Fatalf("unexpected export body: %s", w.Body.String())
+	}
+
+	// Import rejects the whole file on a bad record.
+	body = []byte(`{"version":1,"users":[{"user":"bob","role":"user","password":"x"},{"user":"carol","role":"nope"}]}`)
+	r = httptest.NewRequest(http.MethodPost, "http://example/x/api/admin/users/import", bytes.NewReader(body))
+	r.Header.Set("Cookie", cookie)
+	r.Header.Set("X-Atlas-CSRF", me.CSRF)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("bad import status=%d body=%q", w.Code, w.Body.String())
+	}
+	if _, ok, _ := store.GetUser("bob"); ok {
+		t.Fatalf("partial import must not create users")
+	}
+
+	body = []byte(`{"version":1,"users":[{"user":"bob","role":"user","can_fw":true}]}`)
+	r = httptest.NewRequest(http.MethodPost, "http://example/x/api/admin/users/import", bytes.NewReader(body))
+	r.Header.Set("Cookie", cookie)
+	r.Header.Set("X-Atlas-CSRF", me.CSRF)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"reset_required":["bob"]`) {
+		t.Fatalf("import status=%d body=%q", w.Code, w.Body.String())
+	}
+}
+
+func TestServiceUnitValidation(t *testing.T) {
+	t.Parallel()
+
+	ok := map[string]string{
+		"atlas":              "atlas.service",
+		" atlas.service ":    "atlas.service",
+		"atlas@main.service": "atlas@main.service",
+		"my_atlas-2.x":       "my_atlas-2.x.service",
+	}
+	for in, want := range ok {
+		got, err := serviceUnit(in)
+		if err != nil || got != want {
+			t.Fatalf("serviceUnit(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "--now", "-atlas", "atlas;reboot", "../atlas", "a/b.service", "atlas service", "atlas\n.service", ".service"} {
+		if _, err := serviceUnit(bad); err == nil {
+			t.Fatalf("serviceUnit(%q): expected error", bad)
+		}
+	}
 }
@@ -1,13 +1,18 @@
 package app
 
 import (
+	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
-	"io"
+	"encoding/pem"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/MrTeeett/atlas/internal/config"
 )
@@ -22,6 +27,36 @@ type adminTLSRequest struct {
 type adminTLSResponse struct {
 	Ok      bool   `json:"ok"`
 	Message string `json:"message,omitempty"`
+	// RestartRequired is set when the new files only take effect after a restart.
+	RestartRequired bool  `json:"restart_required,omitempty"`
+	NotAfter        int64 `json:"not_after_unix,omitempty"`
+}
+
+type adminTLSStatus struct {
+	// Enabled reports whether the running server serves TLS; CertFile/KeyFile are the
+	// files it was started with.
+	Enabled  bool   `json:"enabled"`
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// ConfiguredCertFile/ConfiguredKeyFile come from the config file and differ from the
+	// active ones until a restart picks up a change.
+	ConfiguredCertFile string `json:"configured_cert_file,omitempty"`
+	ConfiguredKeyFile  string `json:"configured_key_file,omitempty"`
+	RestartRequired    bool   `json:"restart_required,omitempty"`
+
+	// Certificate details parsed from CertFile (the leaf if it holds a chain).
+	Subject    string   `json:"subject,omitempty"`
+	Issuer     string   `json:"issuer,omitempty"`
+	DNSNames   []string `json:"dns_names,omitempty"`
+	IPs        []string `json:"ip_addresses,omitempty"`
+	SelfSigned bool     `json:"self_signed"`
+	NotBefore  int64    `json:"not_before_unix,omitempty"`
+	// NotAfter is the expiry of the certificate file on disk (0 if it cannot be read).
+	NotAfter      int64 `json:"not_after_unix,omitempty"`
+	ExpiresInDays int   `json:"expires_in_days,omitempty"`
+	// KeyMatches is false when KeyFile does not belong to the certificate.
+	KeyMatches bool   `json:"key_matches"`
+	Error      string `json:"error,omitempty"`
 }
 
 func (s *Server) HandleAdminTLS(w http.ResponseWriter, r *http.Request) {
@@ -29,20 +64,24 @@ func (s *Server) HandleAdminTLS(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "config path is not configured", http.StatusInternalServerError)
 		return
 	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, s.tlsStatus(time.Now()))
+		return
+	}
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req adminTLSRequest
-	if err := json.NewDecoder(io.LimitReader(r.Body, 8<<20)).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
 
 	// Load config (to preserve other fields) and update TLS paths.
 	path := filepath.Clean(s.cfg.ConfigPath)
-	cfg, err := config.Load(path)
+	cfg, err := config.LoadBase(path)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -140,6 +179,104 @@ func (s *Server) HandleAdminTLS(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, adminTLSResponse{Ok: true, Message: "saved (restart required)"})
 }
 
+// isSelfSigned reports whether cert is signed by its own key. CheckSignatureFrom would
+// insist on CA constraints, which leaf self-signed certs lack.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+func (s *Server) tlsStatus(now time.Time) adminTLSStatus {
+	st := adminTLSStatus{
+		Enabled:  s.cfg.TLSCertFile != "" && s.cfg.TLSKeyFile != "",
+		CertFile: s.cfg.TLSCertFile,
+		KeyFile:  s.cfg.TLSKeyFile,
+	}
+	if cfg, err := config.Load(s.cfg.ConfigPath); err == nil {
+		st.ConfiguredCertFile = cfg.TLSCertFile
+		st.ConfiguredKeyFile = cfg.TLSKeyFile
+		st.RestartRequired = cfg.TLSCertFile != st.CertFile || cfg.TLSKeyFile != st.KeyFile
+	}
+	if !st.Enabled {
+		return st
+	}
+	cert, err := readCertificate(st.CertFile)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	st.Subject = cert.Subject.String()
+	st.Issuer = cert.Issuer.String()
+	st.DNSNames = cert.DNSNames
+	for _, ip := range cert.IPAddresses {
+		st.IPs = append(st.IPs, ip.String())
+	}
+	st.SelfSigned = isSelfSigned(cert)
+	st.NotBefore = cert.NotBefore.Unix()
+	st.NotAfter = cert.NotAfter.Unix()
+	st.ExpiresInDays = int(cert.NotAfter.Sub(now).Hours() / 24)
+	if _, err := tls.LoadX509KeyPair(st.CertFile, st.KeyFile); err != nil {
+		st.Error = err.Error()
+	} else {
+		st.KeyMatches = true
+	}
+	return st
+}
+
+// readCertificate parses the first certificate of a PEM file (the leaf of a chain).
+func readCertificate(path string) (*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return nil, errors.New("no certificate found in " + path)
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// HandleAdminTLSRegenerate replaces the auto-generated self-signed certificate with a
+// fresh one for the current listen address. Custom certificates are left alone.
+func (s *Server) HandleAdminTLSRegenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.cfg.ConfigPath == "" || s.cfg.RegenerateTLS == nil {
+		http.Error(w, "tls regeneration is not available", http.StatusNotImplemented)
+		return
+	}
+	cfg, err := config.Load(s.cfg.ConfigPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cfgDir := filepath.Dir(filepath.Clean(s.cfg.ConfigPath))
+	if cfg.TLSCertFile != "" && (cfg.TLSCertFile != filepath.Join(cfgDir, "atlas.tls.crt") || cfg.TLSKeyFile != filepath.Join(cfgDir, "atlas.tls.key")) {
+		http.Error(w, "a custom certificate is configured; only the auto-generated one can be regenerated", http.StatusConflict)
+		return
+	}
+
+	notAfter, err := s.cfg.RegenerateTLS()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("self-signed tls certificate regenerated", "not_after", notAfter)
+	writeJSON(w, adminTLSResponse{
+		Ok:              true,
+		Message:         "regenerated (restart required)",
+		RestartRequired: true,
+		NotAfter:        notAfter.Unix(),
+	})
+}
+
 func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
 	path = filepath.Clean(path)
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
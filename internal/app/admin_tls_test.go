@@ -254,6 +254,78 @@ func TestAdminTLSSetPathsUpdatesConfig(t *testing.T) {
 	}
 }
 
+func TestAdminTLSStatusAndRegenerate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "atlas.json")
+	certPEM, keyPEM := genSelfSignedKeypair(t)
+	certFile := filepath.Join(dir, "atlas.tls.crt")
+	keyFile := filepath.Join(dir, "atlas.tls.key")
+	if err := os.WriteFile(certFile, []byte(certPEM), 0o600); err != nil {
+		t.Fatalf("WriteFile cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, []byte(keyPEM), 0o600); err != nil {
+		t.Fatalf("WriteFile key: %v", err)
+	}
+	writeCfg := func(cert, key string) {
+		b, _ := json.Marshal(map[string]any{"listen": "127.0.0.1:1", "base_path": "/", "tls_cert_file": cert, "tls_key_file": key})
+		if err := os.WriteFile(cfgPath, b, 0o600); err != nil {
+			t.Fatalf("WriteFile config: %v", err)
+		}
+	}
+	writeCfg("atlas.tls.crt", "atlas.tls.key")
+
+	regenerated := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	calls := 0
+	s := &Server{cfg: Config{
+		ConfigPath:  cfgPath,
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+		RegenerateTLS: func() (time.Time, error) {
+			calls++
+			return regenerated, nil
+		},
+	}}
+
+	w := httptest.NewRecorder()
+	s.HandleAdminTLS(w, httptest.NewRequest(http.MethodGet, "/api/admin/tls", nil))
+	var st adminTLSStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatalf("status: code=%d err=%v", w.Code, err)
+	}
+	if !st.Enabled || st.CertFile != certFile || st.NotAfter == 0 || st.ExpiresInDays != 0 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	if !st.SelfSigned || !st.KeyMatches || st.RestartRequired || st.Subject != "CN=atlas.test" || len(st.DNSNames) != 1 || st.NotBefore == 0 {
+		t.Fatalf("unexpected certificate details: %+v", st)
+	}
+
+	w = httptest.NewRecorder()
+	s.HandleAdminTLSRegenerate(w, httptest.NewRequest(http.MethodPost, "/api/admin/tls/regenerate", nil))
+	var resp adminTLSResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("regenerate: code=%d err=%v", w.Code, err)
+	}
+	if !resp.Ok || !resp.RestartRequired || resp.NotAfter != regenerated.Unix() || calls != 1 {
+		t.Fatalf("unexpected regenerate response: %+v calls=%d", resp, calls)
+	}
+
+	// A custom certificate must not be replaced by a self-signed one.
+	writeCfg("/etc/ssl/fullchain.pem", "/etc/ssl/privkey.pem")
+	w = httptest.NewRecorder()
+	s.HandleAdminTLS(w, httptest.NewRequest(http.MethodGet, "/api/admin/tls", nil))
+	st = adminTLSStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil || !st.RestartRequired || st.ConfiguredCertFile != "/etc/ssl/fullchain.pem" {
+		t.Fatalf("expected pending restart, got %+v (err=%v)", st, err)
+	}
+	w = httptest.NewRecorder()
+	s.HandleAdminTLSRegenerate(w, httptest.NewRequest(http.MethodPost, "/api/admin/tls/regenerate", nil))
+	if w.Code != http.StatusConflict || calls != 1 {
+		t.Fatalf("custom cert: status=%d calls=%d", w.Code, calls)
+	}
+}
+
 func genSelfSignedKeypair(t *testing.T) (certPEM, keyPEM string) {
 	t.Helper()
 
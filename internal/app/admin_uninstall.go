@@ -3,7 +3,6 @@ package app
 import (
 	"context"
 	"encoding/json"
-	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -14,13 +13,37 @@ import (
 )
 
 type adminUninstallRequest struct {
-	Confirm string `json:"confirm"` // must be "DELETE"
+	Confirm string `json:"confirm"` // must be "DELETE" (not needed for a dry run)
+	// What to remove; omitted flags default to true, i.e. a full uninstall. The
+	// service is stopped and disabled in every case.
+	RemoveConfig *bool `json:"remove_config,omitempty"` // the config file
+	RemoveData   *bool `json:"remove_data,omitempty"`   // master key, user and firewall DBs, TLS files, update status
+	RemoveUnit   *bool `json:"remove_unit,omitempty"`   // the systemd unit file
+	RemoveBinary *bool `json:"remove_binary,omitempty"` // the binary and its update backup
+	// DryRun only reports the files that would be removed.
+	DryRun bool `json:"dry_run,omitempty"`
 }
 
 type adminUninstallResponse struct {
 	Ok      bool     `json:"ok"`
+	DryRun  bool     `json:"dry_run,omitempty"`
 	Message string   `json:"message,omitempty"`
-	Files   []string `json:"files,omitempty"`
+	Files   []string `json:"files"`
+}
+
+// uninstallScope selects the groups of files an uninstall removes.
+type uninstallScope struct {
+	Config, Data, Unit, Binary bool
+}
+
+func (req adminUninstallRequest) scope() uninstallScope {
+	flag := func(b *bool) bool { return b == nil || *b }
+	return uninstallScope{
+		Config: flag(req.RemoveConfig),
+		Data:   flag(req.RemoveData),
+		Unit:   flag(req.RemoveUnit),
+		Binary: flag(req.RemoveBinary),
+	}
 }
 
 func (s *Server) HandleAdminUninstall(w http.ResponseWriter, r *http.Request) {
@@ -34,14 +57,17 @@ func (s *Server) HandleAdminUninstall(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req adminUninstallRequest
-	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
-	if strings.TrimSpace(req.Confirm) != "DELETE" {
+	if !req.DryRun && strings.TrimSpace(req.Confirm) != "DELETE" {
 		http.Error(w, "confirm mismatch", http.StatusBadRequest)
 		return
 	}
+	if !req.DryRun && s.deferForApproval(w, r, "uninstall", req, s.HandleAdminUninstall) {
+		return
+	}
 
 	exe, _ := os.Executable()
 	exe = strings.TrimSpace(exe)
@@ -54,12 +80,16 @@ func (s *Server) HandleAdminUninstall(w http.ResponseWriter, r *http.Request) {
 	cfgPath = filepath.Clean(cfgPath)
 	cfgDir := filepath.Dir(cfgPath)
 
-	files := s.uninstallTargets(cfgPath, cfgDir, exe)
+	unitName, unitPath, _ := s.autostartUnit()
+	files := existingFiles(s.uninstallTargets(cfgPath, cfgDir, exe, unitPath, req.scope()))
+	if req.DryRun {
+		writeJSON(w, adminUninstallResponse{Ok: true, DryRun: true, Files: files})
+		return
+	}
 	pid := os.Getpid()
 
 	// Run cleanup via an external shell so it can keep going after stopping this process/systemd unit.
-	unitName, unitPath, _ := s.autostartUnit()
-	script := buildUninstallScript(unitName, unitPath, cfgDir, pid, files)
+	script := buildUninstallScript(unitName, cfgDir, pid, files)
 	cmd := s.rootCmd(context.Background(), "sh", "-c", script)
 	if err := cmd.Start(); err != nil {
 		http.Error(w, "failed to start uninstall: "+err.Error(), http.StatusInternalServerError)
@@ -70,7 +100,7 @@ func (s *Server) HandleAdminUninstall(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, adminUninstallResponse{Ok: true, Message: "uninstall started", Files: files})
 }
 
-func (s *Server) uninstallTargets(cfgPath, cfgDir, exePath string) []string {
+func (s *Server) uninstallTargets(cfgPath, cfgDir, exePath, unitPath string, scope uninstallScope) []string {
 	cfgDir = filepath.Clean(cfgDir)
 
 	// Avoid config.Load here (it can create/upgrade files). We only need file paths.
@@ -78,6 +108,15 @@ func (s *Server) uninstallTargets(cfgPath, cfgDir, exePath string) []string {
 	if b, err := os.ReadFile(cfgPath); err == nil {
 		_ = json.Unmarshal(b, &cfg)
 	}
+	// Default file names live in state_dir when it is set.
+	stateDir := cfgDir
+	if d := strings.TrimSpace(cfg.StateDir); d != "" {
+		if filepath.IsAbs(d) {
+			stateDir = filepath.Clean(d)
+		} else {
+			stateDir = filepath.Join(cfgDir, filepath.Clean(d))
+		}
+	}
 
 	resolve := func(p string, def string) string {
 		p = strings.TrimSpace(p)
@@ -85,7 +124,7 @@ func (s *Server) uninstallTargets(cfgPath, cfgDir, exePath string) []string {
 			if def == "" {
 				return ""
 			}
-			return filepath.Join(cfgDir, def)
+			return filepath.Join(stateDir, def)
 		}
 		if filepath.IsAbs(p) {
 			return filepath.Clean(p)
@@ -93,33 +132,51 @@ func (s *Server) uninstallTargets(cfgPath, cfgDir, exePath string) []string {
 		return filepath.Join(cfgDir, filepath.Clean(p))
 	}
 
-	masterKey := resolve(cfg.MasterKeyFile, "atlas.master.key")
-	userDB := resolve(cfg.UserDBPath, "atlas.users.db")
-	fwDB := resolve(cfg.FWDBPath, "atlas.firewall.db")
-
-	// TLS files: only remove if they look like Atlas-generated defaults inside cfgDir.
-	cert := resolve(cfg.TLSCertFile, "")
-	key := resolve(cfg.TLSKeyFile, "")
-	var tlsFiles []string
-	for _, p := range []string{cert, key} {
-		if p == "" {
-			continue
-		}
-		base := filepath.Base(p)
-		if filepath.Dir(filepath.Clean(p)) == cfgDir && strings.HasPrefix(base, "atlas.tls.") {
-			tlsFiles = append(tlsFiles, p)
+	var out []string
+	if scope.Binary && exePath != "" {
+		exePath = filepath.Clean(exePath)
+		out = append(out, exePath, exePath+".bak")
+	}
+	if scope.Config {
+		out = append(out, cfgPath)
+	}
+	if scope.Data {
+		masterKey := resolve(cfg.MasterKeyFile, "atlas.master.key")
+		userDB := resolve(cfg.UserDBPath, "atlas.users.db")
+		fwDB := resolve(cfg.FWDBPath, "atlas.firewall.db")
+		out = append(out, masterKey, userDB, fwDB, filepath.Join(stateDir, "atlas.update.json"))
+
+		// TLS files: only remove if they look like Atlas-generated defaults inside cfgDir.
+		cert := resolve(cfg.TLSCertFile, "")
+		key := resolve(cfg.TLSKeyFile, "")
+		for _, p := range []string{cert, key} {
+			if p == "" {
+				continue
+			}
+			base := filepath.Base(p)
+			if filepath.Dir(filepath.Clean(p)) == cfgDir && strings.HasPrefix(base, "atlas.tls.") {
+				out = append(out, p)
+			}
 		}
 	}
-
-	var out []string
-	if exePath != "" {
-		out = append(out, filepath.Clean(exePath))
+	if scope.Unit && unitPath != "" {
+		out = append(out, unitPath)
 	}
-	out = append(out, cfgPath, masterKey, userDB, fwDB)
-	out = append(out, tlsFiles...)
 	return dedupNonEmpty(out)
 }
 
+// existingFiles drops the paths that do not exist, so the reported list is exactly
+// what gets removed.
+func existingFiles(paths []string) []string {
+	out := []string{}
+	for _, p := range paths {
+		if _, err := os.Lstat(p); err == nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 func dedupNonEmpty(in []string) []string {
 	seen := map[string]struct{}{}
 	var out []string
@@ -138,21 +195,18 @@ func dedupNonEmpty(in []string) []string {
 	return out
 }
 
-func buildUninstallScript(unitName, unitPath, cfgDir string, pid int, files []string) string {
+func buildUninstallScript(unitName, cfgDir string, pid int, files []string) string {
 	var b strings.Builder
 	b.WriteString("set -e\n")
 	b.WriteString("export PATH=\"$PATH:/usr/sbin:/sbin\"\n")
 	b.WriteString("UNIT=" + shellQuote(strings.TrimSpace(unitName)) + "\n")
-	b.WriteString("UNIT_PATH=" + shellQuote(strings.TrimSpace(unitPath)) + "\n")
 	b.WriteString("CFG_DIR=" + shellQuote(strings.TrimSpace(cfgDir)) + "\n")
 	b.WriteString("PID=" + shellQuote(strconv.Itoa(pid)) + "\n")
 
-	// Disable/stop service if systemd exists.
+	// Disable/stop service if systemd exists. The unit file, if selected, is among files.
 	b.WriteString("if command -v systemctl >/dev/null 2>&1 && [ -n \"$UNIT\" ]; then\n")
 	b.WriteString("  systemctl disable --now \"$UNIT\" >/dev/null 2>&1 || true\n")
 	b.WriteString("  systemctl stop \"$UNIT\" >/dev/null 2>&1 || true\n")
-	b.WriteString("  if [ -n \"$UNIT_PATH\" ]; then rm -f -- \"$UNIT_PATH\" >/dev/null 2>&1 || true; fi\n")
-	b.WriteString("  systemctl daemon-reload >/dev/null 2>&1 || true\n")
 	b.WriteString("fi\n")
 
 	// Remove files.
@@ -163,6 +217,7 @@ func buildUninstallScript(unitName, unitPath, cfgDir string, pid int, files []st
 		}
 		b.WriteString("rm -f -- " + shellQuote(p) + " >/dev/null 2>&1 || true\n")
 	}
+	b.WriteString("if command -v systemctl >/dev/null 2>&1; then systemctl daemon-reload >/dev/null 2>&1 || true; fi\n")
 
 	// Remove directory if empty.
 	b.WriteString("if [ -n \"$CFG_DIR\" ] && [ \"$CFG_DIR\" != \"/\" ]; then rmdir -- \"$CFG_DIR\" >/dev/null 2>&1 || true; fi\n")
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUninstallTargetsScope(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "atlas.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"state_dir":"state","tls_cert_file":"atlas.tls.crt"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{}
+	exe := "/opt/atlas/atlas"
+	unit := "/etc/systemd/system/atlas.service"
+	state := filepath.Join(dir, "state")
+
+	all := s.uninstallTargets(cfgPath, dir, exe, unit, uninstallScope{Config: true, Data: true, Unit: true, Binary: true})
+	want := []string{
+		exe, exe + ".bak",
+		cfgPath,
+		filepath.Join(state, "atlas.master.key"),
+		filepath.Join(state, "atlas.users.db"),
+		filepath.Join(state, "atlas.firewall.db"),
+		filepath.Join(state, "atlas.update.json"),
+		filepath.Join(dir, "atlas.tls.crt"),
+		unit,
+	}
+	if !reflect.DeepEqual(all, want) {
+		t.Fatalf("full uninstall:\n got %v\nwant %v", all, want)
+	}
+
+	keep := s.uninstallTargets(cfgPath, dir, exe, unit, uninstallScope{Unit: true, Binary: true})
+	if !reflect.DeepEqual(keep, []string{exe, exe + ".bak", unit}) {
+		t.Fatalf("keep data: %v", keep)
+	}
+	if got := s.uninstallTargets(cfgPath, dir, exe, unit, uninstallScope{}); len(got) != 0 {
+		t.Fatalf("empty scope: %v", got)
+	}
+}
+
+func TestAdminUninstallDryRun(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "atlas.json")
+	userDB := filepath.Join(dir, "atlas.users.db")
+	for _, p := range []string{cfgPath, userDB} {
+		if err := os.WriteFile(p, []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Server{cfg: Config{ConfigPath: cfgPath, EnableAdminActions: true}}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.HandleAdminUninstall(rr, httptest.NewRequest(http.MethodPost, "/api/admin/uninstall", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := post(`{"dry_run":true,"remove_binary":false}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("dry run: %d %s", rr.Code, rr.Body.String())
+	}
+	var res adminUninstallResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	// Only files that exist are reported.
+	if !res.DryRun || !reflect.DeepEqual(res.Files, []string{cfgPath, userDB}) {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+	for _, p := range []string{cfgPath, userDB} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("dry run removed %s", p)
+		}
+	}
+
+	rr = post(`{"dry_run":true,"remove_binary":false,"remove_config":false,"remove_data":false}`)
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil || len(res.Files) != 0 {
+		t.Fatalf("keep everything: %s", rr.Body.String())
+	}
+
+	if rr := post(`{"remove_data":false}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("missing confirm: %d", rr.Code)
+	}
+}
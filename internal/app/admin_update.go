@@ -29,6 +29,9 @@ type updateStatus struct {
 	LastAt    time.Time `json:"last_at,omitempty"`
 	LastError string    `json:"last_error,omitempty"`
 	TargetTag string    `json:"target_tag,omitempty"`
+	// RolledBack is set when the installed release failed its health check after
+	// the restart and the previous binary was restored.
+	RolledBack bool `json:"rolled_back,omitempty"`
 }
 
 type adminUpdateResponse struct {
@@ -41,6 +44,7 @@ type adminUpdateResponse struct {
 	CurrentCommit  string       `json:"commit"`   // buildinfo.Commit
 	CurrentBuiltAt string       `json:"built_at"` // buildinfo.BuiltAt
 	Status         updateStatus `json:"status"`
+	Check          updateCheck  `json:"check"`
 }
 
 type adminUpdateRequest struct {
@@ -74,6 +78,12 @@ func (s *Server) HandleAdminUpdate(w http.ResponseWriter, r *http.Request) {
 	updateMu.Unlock()
 
 	if r.Method == http.MethodGet {
+		// ?check=1 looks up the latest release now (subject to updateCheckTTL).
+		check := s.updates.cached()
+		if r.URL.Query().Get("check") == "1" {
+			check = s.checkForUpdate(r.Context())
+		}
+		check.Auto = s.cfg.UpdateCheckInterval > 0
 		writeJSON(w, adminUpdateResponse{
 			ActionsEnabled: s.cfg.EnableAdminActions,
 			Repo:           repo,
@@ -84,6 +94,7 @@ func (s *Server) HandleAdminUpdate(w http.ResponseWriter, r *http.Request) {
 			CurrentCommit:  strings.TrimSpace(buildinfo.Commit),
 			CurrentBuiltAt: strings.TrimSpace(buildinfo.BuiltAt),
 			Status:         st,
+			Check:          check,
 		})
 		return
 	}
@@ -98,7 +109,7 @@ func (s *Server) HandleAdminUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req adminUpdateRequest
-	_ = json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req)
+	_ = json.NewDecoder(r.Body).Decode(&req)
 	reqCh := strings.TrimSpace(req.Channel)
 	if reqCh == "" {
 		reqCh = channel
@@ -142,11 +153,25 @@ func (s *Server) HandleAdminUpdate(w http.ResponseWriter, r *http.Request) {
 		updateMu.Unlock()
 
 		logging.InfoOrDebug("update: starting", "repo", repo, "channel", resolved, "tag", tag)
-		if err := s.applyUpdate(ctx, repo, tag); err != nil {
+		exe, backup, err := s.applyUpdate(ctx, repo, tag)
+		if err != nil {
 			setUpdateErr(err)
 			slog.Error("update: failed", "err", err)
 			return
 		}
+		watched, err := s.startUpdateWatchdog(ctx, exe, backup, tag)
+		if err != nil {
+			// Without the watchdog a broken release could not be rolled back remotely.
+			slog.Error("update: start health check", "err", err)
+			if rbErr := s.runRoot(ctx, "install", "-m", "0755", backup, exe); rbErr != nil {
+				err = fmt.Errorf("%w; restoring %s failed: %v", err, backup, rbErr)
+			}
+			setUpdateErr(fmt.Errorf("health check could not be started, update reverted: %w", err))
+			return
+		}
+		if !watched {
+			slog.Warn("update: service is not managed by systemd; the new version will not be health checked")
+		}
 		logging.InfoOrDebug("update: installed, restarting service", "elapsed", time.Since(started).String())
 		if err := s.restartService(context.Background()); err != nil {
 			slog.Warn("update: restart failed", "err", err)
@@ -242,10 +267,12 @@ func isValidRepo(repo string) bool {
 	return true
 }
 
-func (s *Server) applyUpdate(ctx context.Context, repo, tag string) error {
+// applyUpdate installs release tag over the running binary and returns the path of
+// the binary and of the backup of the previous version.
+func (s *Server) applyUpdate(ctx context.Context, repo, tag string) (exe, backup string, _ error) {
 	arch := runtime.GOARCH
 	if arch != "amd64" && arch != "arm64" {
-		return fmt.Errorf("unsupported arch: %s", arch)
+		return "", "", fmt.Errorf("unsupported arch: %s", arch)
 	}
 	asset := fmt.Sprintf("atlas_%s_linux_%s.tar.gz", tag, arch)
 	base := fmt.Sprintf("https://github.com/%s/releases/download/%s", repo, tag)
@@ -254,7 +281,7 @@ func (s *Server) applyUpdate(ctx context.Context, repo, tag string) error {
 
 	tmpDir, err := os.MkdirTemp("", "atlas-update-*")
 	if err != nil {
-		return err
+		return "", "", err
 	}
 	defer func() { _ = os.RemoveAll(tmpDir) }()
 	slog.Debug("update: temp dir", "path", tmpDir)
@@ -262,61 +289,62 @@ func (s *Server) applyUpdate(ctx context.Context, repo, tag string) error {
 	sumsPath := filepath.Join(tmpDir, "SHA256SUMS.txt")
 	logging.InfoOrDebug("update: download checksums", "url", sumsURL)
 	if err := downloadToFile(ctx, sumsURL, sumsPath); err != nil {
-		return err
+		return "", "", err
 	}
 	want, err := checksumForFile(sumsPath, asset)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	assetPath := filepath.Join(tmpDir, asset)
 	logging.InfoOrDebug("update: download asset", "url", assetURL)
 	got, err := downloadWithSHA256(ctx, assetURL, assetPath)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 	if !strings.EqualFold(want, got) {
-		return fmt.Errorf("checksum mismatch: want %s got %s", want, got)
+		return "", "", fmt.Errorf("checksum mismatch: want %s got %s", want, got)
 	}
 	slog.Debug("update: checksum ok", "asset", asset)
 
 	binPath := filepath.Join(tmpDir, "atlas.new")
 	logging.InfoOrDebug("update: extracting binary", "asset", asset)
 	if err := extractTarGzFile(assetPath, "atlas", binPath); err != nil {
-		return err
+		return "", "", err
 	}
 
-	exe, err := os.Executable()
+	exe, err = os.Executable()
 	if err != nil {
-		return err
+		return "", "", err
 	}
 	exe = filepath.Clean(exe)
 	if real, err := filepath.EvalSymlinks(exe); err == nil && strings.TrimSpace(real) != "" {
 		exe = real
 	}
 	if strings.TrimSpace(exe) == "" {
-		return errors.New("cannot determine executable path")
+		return "", "", errors.New("cannot determine executable path")
 	}
 
-	backup := exe + ".bak"
+	// The backup is what a failed health check rolls back to, so it is required.
+	backup = exe + ".bak"
 	if err := s.runRoot(ctx, "cp", "-f", exe, backup); err != nil {
-		slog.Warn("update: backup failed", "err", err, "path", backup)
+		return "", "", fmt.Errorf("backup: %w", err)
 	}
 	slog.Debug("update: installing binary", "from", binPath, "to", exe)
 	if err := s.runRoot(ctx, "install", "-m", "0755", binPath, exe); err != nil {
-		return err
+		return "", "", err
 	}
-	return nil
+	return exe, backup, nil
 }
 
 func (s *Server) restartService(ctx context.Context) error {
-	name := strings.TrimSpace(s.cfg.ServiceName)
-	if name == "" {
+	if strings.TrimSpace(s.cfg.ServiceName) == "" {
 		slog.Debug("update: no service name configured; skip restart")
 		return nil
 	}
-	if !strings.HasSuffix(name, ".service") {
-		name += ".service"
+	name, err := serviceUnit(s.cfg.ServiceName)
+	if err != nil {
+		return err
 	}
 	// Best effort: do not fail update if restart isn't available.
 	if err := s.runRoot(ctx, "systemctl", "daemon-reload"); err != nil {
@@ -334,6 +362,13 @@ func setUpdateErr(err error) {
 	updateMu.Unlock()
 }
 
+// setUpdateResult shows the outcome of the health check after the last restart.
+func setUpdateResult(res updateResult) {
+	updateMu.Lock()
+	updateState = updateStatus{LastAt: res.At, LastError: res.Error, TargetTag: res.Tag, RolledBack: res.RolledBack}
+	updateMu.Unlock()
+}
+
 func downloadToFile(ctx context.Context, url, outPath string) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/MrTeeett/atlas/internal/userdb"
+)
+
+type userTransferStore interface {
+	Export() (userdb.ExportFile, error)
+	Import(f userdb.ExportFile) (userdb.ImportResult, error)
+}
+
+func (s *Server) userTransferStore() (userTransferStore, error) {
+	if s.cfg.AuthStore == nil {
+		return nil, errors.New("auth store is not configured")
+	}
+	st, ok := s.cfg.AuthStore.(userTransferStore)
+	if !ok {
+		return nil, errors.New("auth store does not support import/export")
+	}
+	return st, nil
+}
+
+// HandleAdminUsersExport returns all users and permissions (no password hashes or sudo passwords).
+func (s *Server) HandleAdminUsersExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	st, err := s.userTransferStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	exp, err := st.Export()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="atlas-users.json"`)
+	writeJSON(w, exp)
+}
+
+// HandleAdminUsersImport imports an export file. Invalid input rejects the whole file.
+func (s *Server) HandleAdminUsersImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	st, err := s.userTransferStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var req userdb.ExportFile
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	res, err := st.Import(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, u := range res.Updated {
+		s.invalidateSudoPassword(u)
+	}
+	writeJSON(w, res)
+}
@@ -1,14 +1,24 @@
 package app
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	iofs "io/fs"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MrTeeett/atlas/internal/auth"
+	"github.com/MrTeeett/atlas/internal/dbfile"
 	filesvc "github.com/MrTeeett/atlas/internal/fs"
+	"github.com/MrTeeett/atlas/internal/sudocheck"
 	"github.com/MrTeeett/atlas/internal/system"
 	"github.com/MrTeeett/atlas/internal/ui"
 )
@@ -19,21 +29,102 @@ type Config struct {
 	BasePath   string
 	AuthStore  auth.Store
 	Secret     []byte
+	// Authenticator checks passwords instead of AuthStore (nil: the user DB).
+	Authenticator auth.Authenticator
 
 	FSSudoEnabled bool
 	FSSudoAny     bool
 	FSSudoUsers   []string
+	// FSSelfName names Atlas's own file identity when /etc/passwd does not know its uid.
+	FSSelfName string
+	// HelperBinary overrides the binary sudo runs as the fs helper (default: os.Executable).
+	HelperBinary string
 
 	CookieSecure       bool
+	CookieName         string
+	CookieSameSite     string
+	RememberMe         time.Duration
 	EnableExec         bool
 	EnableFW           bool
 	FWDBPath           string
+	FWLockoutCheck     bool
+	FWAutoImport       bool
+	FWNATPriority      *int
+	FWInstance         string
+	FWMaxRules         int
+	DBPerm             dbfile.Perm
 	ConfigPath         string
 	ServiceName        string
 	EnableAdminActions bool
+	// RequireApproval makes reboot, shutdown and uninstall wait for a second admin.
+	RequireApproval bool
+	// UpdateCheckInterval checks GitHub for a newer release in the background (0: off);
+	// UpdateWebhook, if set, is POSTed once per newly found release.
+	UpdateCheckInterval time.Duration
+	UpdateWebhook       string
+	// StateDir is the configured state_dir (empty: files live next to the config).
+	StateDir string
+	// UpdateStatusPath is where the post-update health check records its result.
+	UpdateStatusPath string
+
+	// TLSCertFile/TLSKeyFile are the certificate files the server was started with.
+	TLSCertFile string
+	TLSKeyFile  string
+	// RegenerateTLS rewrites the self-signed certificate pair and returns its expiry.
+	RegenerateTLS func() (time.Time, error)
 
 	LogPath  string
 	LogLevel string
+
+	// AccessLog logs every HTTP request at AccessLogLevel, as key/value attributes or,
+	// with AccessLogFormat "combined", as one Apache-style line.
+	AccessLog       bool
+	AccessLogLevel  slog.Level
+	AccessLogFormat string
+	// TrustedProxies (IPs or CIDRs) may set X-Forwarded-For for the access log.
+	TrustedProxies []string
+
+	// MaxBodyBytes caps request bodies (default 2 MiB); MaxUploadBytes applies to
+	// multipart uploads instead (default 512 MiB).
+	MaxBodyBytes   int64
+	MaxUploadBytes int64
+	// MaxReadBytes caps file reads via /api/fs/read (default 1 MiB).
+	MaxReadBytes int64
+	// UploadDenyExt lists file extensions that may not be uploaded.
+	UploadDenyExt []string
+	// Search caps for /api/fs/search (zero values use the fs defaults).
+	SearchMaxResults int
+	SearchMaxDepth   int
+	SearchTimeout    time.Duration
+
+	// MountAllowlist lists directories under which admins may mount filesystems.
+	MountAllowlist []string
+	// SignalAllowlist limits the signals non-admin users may send (empty: all).
+	SignalAllowlist []string
+	// ProcessUserCacheTTL is how long /etc/passwd is cached for process owners (0: 5 minutes).
+	ProcessUserCacheTTL time.Duration
+	// ProcessCommandMax caps command lines in the process list (0: 512 bytes).
+	ProcessCommandMax int
+
+	TermIdleTTL            time.Duration
+	TermMaxLifetime        time.Duration
+	TermMaxSessionsPerUser int
+	TermMaxSessions        int
+	TermEnv                map[string]string
+	TermEnvBlocklist       []string
+	TermCleanEnv           bool
+	TermStreamBuffer       int
+	TermStreamBlock        time.Duration
+
+	// BrandName/BrandLogo customize the displayed product name and logo file.
+	BrandName string
+	BrandLogo string
+
+	// Maintenance starts the panel in read-only maintenance mode.
+	Maintenance bool
+
+	// SudoPasswordTTL is how long services cache a decrypted sudo password (0: default, <0: off).
+	SudoPasswordTTL time.Duration
 }
 
 type Server struct {
@@ -47,6 +138,17 @@ type Server struct {
 	exec      *system.ExecService
 	term      *system.TerminalService
 	fw        *system.FirewallService
+
+	maintenance atomic.Bool
+	approvals   *approvalStore
+	updates     *updateChecker
+	svcState    serviceStateCache
+	// adminUsersMu serializes user changes that must keep at least one admin.
+	adminUsersMu sync.Mutex
+
+	trustedProxies []*net.IPNet
+	// accessLogger overrides slog.Default() for the access log (tests).
+	accessLogger *slog.Logger
 }
 
 func New(cfg Config) (*Server, error) {
@@ -57,27 +159,79 @@ func New(cfg Config) (*Server, error) {
 		cfg.RootDir = "/"
 	}
 
-	return &Server{
+	sudoPath, _ := exec.LookPath("sudo")
+	sudoCheck := sudocheck.New(sudoPath)
+	if os.Geteuid() != 0 {
+		// Probe once at startup so the first page load already knows how sudo behaves.
+		go sudoCheck.Refresh(context.Background())
+	}
+
+	s := &Server{
 		cfg:       cfg,
-		auth:      auth.New(auth.Config{Store: cfg.AuthStore, Secret: cfg.Secret, CookieSecure: cfg.CookieSecure, BasePath: cfg.BasePath}),
+		approvals: newApprovalStore(),
+		updates:   newUpdateChecker(cfg.UpdateWebhook),
 		stats:     system.NewStatsService(),
 		info:      system.NewInfoService(),
 		autostart: system.NewAutostartService(),
-		fs:        filesvc.New(filesvc.Config{RootDir: cfg.RootDir, SudoEnabled: cfg.FSSudoEnabled, SudoAny: cfg.FSSudoAny, SudoUsers: cfg.FSSudoUsers, SudoPassword: sudoPasswordProvider(cfg.AuthStore)}),
+		fs:        filesvc.New(filesvc.Config{RootDir: cfg.RootDir, MaxUploadBytes: cfg.MaxUploadBytes, MaxWriteBytes: cfg.MaxBodyBytes, MaxReadBytes: cfg.MaxReadBytes, UploadDenyExt: cfg.UploadDenyExt, SearchMaxResults: cfg.SearchMaxResults, SearchMaxDepth: cfg.SearchMaxDepth, SearchTimeout: cfg.SearchTimeout, SudoEnabled: cfg.FSSudoEnabled, SudoAny: cfg.FSSudoAny, SudoUsers: cfg.FSSudoUsers, SudoPassword: sudoPasswordProvider(cfg.AuthStore), SudoPasswordTTL: cfg.SudoPasswordTTL, SudoCheck: sudoCheck, SelfName: cfg.FSSelfName, HelperBinary: cfg.HelperBinary}),
 		process:   system.NewProcessService(),
-		exec:      system.NewExecService(system.ExecConfig{Enabled: cfg.EnableExec}),
+		exec:      system.NewExecService(system.ExecConfig{Enabled: cfg.EnableExec, RootDir: cfg.RootDir}),
 		term: system.NewTerminalService(system.TerminalConfig{
-			Enabled:     cfg.EnableExec,
-			SudoEnabled: cfg.FSSudoEnabled,
-			SudoAny:     cfg.FSSudoAny,
-			SudoUsers:   cfg.FSSudoUsers,
+			Enabled:      cfg.EnableExec,
+			SudoEnabled:  cfg.FSSudoEnabled,
+			SudoAny:      cfg.FSSudoAny,
+			SudoUsers:    cfg.FSSudoUsers,
+			HelperBinary: cfg.HelperBinary,
+
+			SessionTTL:         cfg.TermIdleTTL,
+			MaxLifetime:        cfg.TermMaxLifetime,
+			MaxSessionsPerUser: cfg.TermMaxSessionsPerUser,
+			MaxTotalSessions:   cfg.TermMaxSessions,
+			ExtraEnv:           cfg.TermEnv,
+			EnvBlocklist:       cfg.TermEnvBlocklist,
+			CleanEnv:           cfg.TermCleanEnv,
+			StreamBuffer:       cfg.TermStreamBuffer,
+			StreamBlock:        cfg.TermStreamBlock,
 		}),
 		fw: system.NewFirewallService(system.FirewallConfig{
-			Enabled:      cfg.EnableFW,
-			DBPath:       cfg.FWDBPath,
-			SudoPassword: sudoPasswordProvider(cfg.AuthStore),
+			Enabled:         cfg.EnableFW,
+			DBPath:          cfg.FWDBPath,
+			DBPerm:          cfg.DBPerm,
+			LockoutCheck:    cfg.FWLockoutCheck,
+			AutoImport:      cfg.FWAutoImport,
+			NATPriority:     cfg.FWNATPriority,
+			Instance:        cfg.FWInstance,
+			MaxRules:        cfg.FWMaxRules,
+			SudoPassword:    sudoPasswordProvider(cfg.AuthStore),
+			SudoPasswordTTL: cfg.SudoPasswordTTL,
+			SudoCheck:       sudoCheck,
 		}),
-	}, nil
+	}
+	proxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %w", err)
+	}
+	s.trustedProxies = proxies
+	s.process.SetPasswdTTL(cfg.ProcessUserCacheTTL)
+	s.process.SetMaxCommandLen(cfg.ProcessCommandMax)
+	if err := s.process.SetAllowedSignals(cfg.SignalAllowlist); err != nil {
+		return nil, fmt.Errorf("signal_allowlist: %w", err)
+	}
+	s.maintenance.Store(cfg.Maintenance)
+	if res, ok := readUpdateResult(cfg.UpdateStatusPath); ok {
+		setUpdateResult(res)
+	}
+	if cfg.UpdateCheckInterval > 0 {
+		go s.runUpdateChecks(cfg.UpdateCheckInterval)
+	}
+	s.auth = auth.New(auth.Config{Store: cfg.AuthStore, Authenticator: cfg.Authenticator, Secret: cfg.Secret, CookieSecure: cfg.CookieSecure, BasePath: cfg.BasePath, CookieName: cfg.CookieName, SameSite: cfg.CookieSameSite, RememberFor: cfg.RememberMe, OnLogout: s.invalidateSudoPassword, Maintenance: s.maintenance.Load, BrandName: cfg.BrandName, BrandLogo: s.brandLogoURL()})
+	return s, nil
+}
+
+// invalidateSudoPassword drops any cached sudo password of user in all services.
+func (s *Server) invalidateSudoPassword(user string) {
+	s.fs.InvalidateSudoPassword(user)
+	s.fw.InvalidateSudoPassword(user)
 }
 
 func sudoPasswordProvider(store auth.Store) func(user string) (string, bool, error) {
@@ -109,22 +263,29 @@ func (s *Server) Handler() http.Handler {
 
 	mux.HandleFunc("/login", s.auth.HandleLogin)
 	mux.HandleFunc("/logout", s.auth.HandleLogout)
+	mux.HandleFunc("/branding/logo", s.HandleBrandingLogo)
+	mux.HandleFunc("/healthz", s.HandleHealthz)
 
+	index := serveIndex(renderIndex(s.path("/")))
 	mux.HandleFunc("/", s.requireHTMLAuth(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
 		}
-		http.ServeFileFS(w, r, mustSub(ui.FS, "web"), "index.html")
+		index(w, r)
 	}))
 
 	mux.Handle("/api/stats", s.requireAPIAuth(http.HandlerFunc(s.stats.HandleStats)))
-	mux.Handle("/api/system/info", s.requireAPIAuth(http.HandlerFunc(s.info.HandleInfo)))
+	mux.Handle("/api/system/info", s.requireAPIAuth(http.HandlerFunc(s.HandleSystemInfo)))
+	mux.Handle("/api/system/security", s.requireAPIAuth(http.HandlerFunc(s.HandleSecurity)))
+	mux.Handle("/api/system/mounts", s.requireAPIAuth(http.HandlerFunc(s.HandleMounts)))
 	mux.Handle("/api/system/autostart", s.requireAPIAuth(http.HandlerFunc(s.autostart.HandleAutostart)))
 	mux.Handle("/api/processes", s.requireAPIAuth(http.HandlerFunc(s.process.HandleList)))
 	mux.Handle("/api/processes/signal", s.requireAPIAuth(s.requireProcs(s.requireCSRF(http.HandlerFunc(s.process.HandleSignal)))))
+	mux.Handle("/api/processes/details", s.requireAPIAuth(http.HandlerFunc(s.process.HandleDetails)))
 
 	mux.Handle("/api/fs/list", s.requireAPIAuth(http.HandlerFunc(s.fs.HandleList)))
+	mux.Handle("/api/fs/list-stream", s.requireAPIAuth(http.HandlerFunc(s.fs.HandleListStream)))
 	mux.Handle("/api/fs/search", s.requireAPIAuth(http.HandlerFunc(s.fs.HandleSearch)))
 	mux.Handle("/api/fs/read", s.requireAPIAuth(http.HandlerFunc(s.fs.HandleRead)))
 	mux.Handle("/api/fs/download", s.requireAPIAuth(http.HandlerFunc(s.fs.HandleDownload)))
@@ -138,36 +299,61 @@ func (s *Server) Handler() http.Handler {
 
 	mux.Handle("/api/exec", s.requireAPIAuth(s.requireExec(s.requireCSRF(http.HandlerFunc(s.exec.HandleRun)))))
 	mux.Handle("/api/term/identities", s.requireAPIAuth(s.requireExec(http.HandlerFunc(s.term.HandleIdentities))))
+	mux.Handle("/api/term/sessions", s.requireAPIAuth(s.requireExec(http.HandlerFunc(s.term.HandleList))))
 	mux.Handle("/api/term/session", s.requireAPIAuth(s.requireExec(s.requireCSRF(http.HandlerFunc(s.term.HandleCreate)))))
 	mux.Handle("/api/term/session/", s.requireAPIAuth(s.requireExec(s.requireCSRF(http.HandlerFunc(s.term.HandleSession)))))
 	mux.Handle("/api/term/complete", s.requireAPIAuth(s.requireExec(http.HandlerFunc(s.term.HandleComplete))))
 	mux.Handle("/api/firewall/status", s.requireAPIAuth(s.requireFW(http.HandlerFunc(s.fw.HandleStatus))))
-	mux.Handle("/api/firewall/enabled", s.requireAPIAuth(s.requireFW(s.requireCSRF(http.HandlerFunc(s.fw.HandleEnabled)))))
-	mux.Handle("/api/firewall/apply", s.requireAPIAuth(s.requireFW(s.requireCSRF(http.HandlerFunc(s.fw.HandleApply)))))
-	mux.Handle("/api/firewall/rules", s.requireAPIAuth(s.requireFW(s.requireCSRF(http.HandlerFunc(s.fw.HandleRules)))))
-	mux.Handle("/api/firewall/rules/", s.requireAPIAuth(s.requireFW(s.requireCSRF(http.HandlerFunc(s.fw.HandleRuleID)))))
+	mux.Handle("/api/firewall/enabled", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleEnabled))))))
+	mux.Handle("/api/firewall/apply", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleApply))))))
+	mux.Handle("/api/firewall/simulate", s.requireAPIAuth(s.requireFW(s.requireCSRF(http.HandlerFunc(s.fw.HandleSimulate)))))
+	mux.Handle("/api/firewall/import-system", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleImportSystem))))))
+	mux.Handle("/api/firewall/base", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleBaseRules))))))
+	mux.Handle("/api/firewall/policy", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandlePolicy))))))
+	mux.Handle("/api/firewall/ban", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleBan))))))
+	mux.Handle("/api/firewall/unban", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleUnban))))))
+	mux.Handle("/api/firewall/rules", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleRules))))))
+	mux.Handle("/api/firewall/rules/delete", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleRulesDelete))))))
+	mux.Handle("/api/firewall/rules/", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleRuleID))))))
+	mux.Handle("/api/firewall/profiles", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleProfiles))))))
+	mux.Handle("/api/firewall/profiles/activate", s.requireAPIAuth(s.requireFW(s.requireFWEdit(s.requireCSRF(http.HandlerFunc(s.fw.HandleProfileActivate))))))
+	mux.Handle("/api/firewall/persist", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.fw.HandlePersist)))))
+	mux.Handle("/api/net/connections", s.requireAPIAuth(s.requireFW(http.HandlerFunc(s.fw.HandleConnections))))
 	mux.Handle("/api/ports/usage", s.requireAPIAuth(s.requireFW(http.HandlerFunc(s.fw.HandlePortUsage))))
 	mux.Handle("/api/admin/users", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminUsers)))))
 	mux.Handle("/api/admin/users/", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminUserID)))))
+	mux.Handle("/api/admin/users/export", s.requireAPIAuth(s.requireAdmin(http.HandlerFunc(s.HandleAdminUsersExport))))
+	mux.Handle("/api/admin/users/import", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminUsersImport)))))
 	mux.Handle("/api/admin/config", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminConfig)))))
 	mux.Handle("/api/admin/action", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminAction)))))
 	mux.Handle("/api/admin/tls", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminTLS)))))
+	mux.Handle("/api/admin/tls/regenerate", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminTLSRegenerate)))))
 	mux.Handle("/api/admin/autostart", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminAutostart)))))
 	mux.Handle("/api/admin/uninstall", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminUninstall)))))
 	mux.Handle("/api/admin/logs", s.requireAPIAuth(s.requireAdmin(http.HandlerFunc(s.HandleAdminLogs))))
 	mux.Handle("/api/admin/update", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminUpdate)))))
+	mux.Handle("/api/admin/about", s.requireAPIAuth(s.requireAdmin(http.HandlerFunc(s.HandleAdminAbout))))
+	mux.Handle("/api/admin/firewall/db", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminFirewallDB)))))
+	mux.Handle("/api/admin/approvals", s.requireAPIAuth(s.requireAdmin(http.HandlerFunc(s.HandleAdminApprovals))))
+	mux.Handle("/api/admin/approvals/", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminApprovalID)))))
+	mux.Handle("/api/admin/maintenance", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminMaintenance)))))
 	mux.Handle("/api/admin/sudo", s.requireAPIAuth(s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.HandleAdminSudo)))))
+	mux.Handle("/api/branding", s.requireAPIAuth(http.HandlerFunc(s.HandleBranding)))
 	mux.Handle("/api/me", s.requireAPIAuth(http.HandlerFunc(s.auth.HandleMe)))
+	mux.Handle("/api/me/password", s.requireAPIAuth(s.requireCSRF(http.HandlerFunc(s.HandleMePassword))))
+	mux.Handle("/api/me/timezone", s.requireAPIAuth(s.requireCSRF(http.HandlerFunc(s.HandleMeTimeZone))))
 
-	timeout := http.TimeoutHandler(mux, 60*time.Second, "request timeout")
-	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Long-lived terminal streams shouldn't be wrapped with TimeoutHandler.
-		if strings.HasPrefix(r.URL.Path, "/api/term/") {
-			mux.ServeHTTP(w, r)
+	timeout := http.TimeoutHandler(mux, HandlerTimeout, "request timeout")
+	stream := withoutDeadlines(mux)
+	inner := s.limitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Long-lived terminal streams (and streamed directory listings) shouldn't be
+		// wrapped with TimeoutHandler, nor be cut off by the server's read/write timeouts.
+		if strings.HasPrefix(r.URL.Path, "/api/term/") || r.URL.Path == "/api/fs/list-stream" {
+			stream.ServeHTTP(w, r)
 			return
 		}
 		timeout.ServeHTTP(w, r)
-	})
+	}))
 
 	basePath := strings.TrimSpace(s.cfg.BasePath)
 	withBasePath := inner
@@ -192,7 +378,29 @@ func (s *Server) Handler() http.Handler {
 		})
 	}
 
-	return s.securityHeaders(withBasePath)
+	return s.accessLog(s.securityHeaders(s.sudoPassHeader(withBasePath)))
+}
+
+// sudoPassHeader moves a one-time sudo password from the request headers into the
+// request context, so it is never visible to later handlers or logs.
+func (s *Server) sudoPassHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pass := r.Header.Get(auth.SudoPassHeader)
+		if _, ok := r.Header[http.CanonicalHeaderKey(auth.SudoPassHeader)]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Header.Del(auth.SudoPassHeader)
+		// TLS terminated by a trusted proxy counts (X-Forwarded-Proto: https).
+		if scheme, _ := s.requestScheme(r); scheme != "https" {
+			http.Error(w, "sudo password header requires TLS", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(pass) != "" {
+			r = r.WithContext(auth.WithSudoPassword(r.Context(), pass))
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (s *Server) securityHeaders(next http.Handler) http.Handler {
@@ -229,6 +437,20 @@ func (s *Server) requireFW(next http.Handler) http.Handler {
 	})
 }
 
+// requireFWEdit lets users with read-only firewall access through for GET and HEAD only.
+func (s *Server) requireFWEdit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			c, ok := auth.ClaimsFromContext(r.Context())
+			if !ok || !c.CanEditFW() {
+				http.Error(w, "firewall is read-only for this user", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *Server) requireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c, ok := auth.ClaimsFromContext(r.Context())
@@ -273,9 +495,18 @@ func (s *Server) requireAPIAuth(next http.Handler) http.Handler {
 			return
 		}
 		if c, err := s.auth.Claims(r); err == nil {
+			setAccessUser(r.Context(), c.User)
 			r = r.WithContext(auth.WithClaims(r.Context(), c))
+			if c.MustChangePassword && !passwordChangeExempt[r.URL.Path] {
+				http.Error(w, "password change required", http.StatusForbidden)
+				return
+			}
 		}
 		w.Header().Set("Cache-Control", "no-store")
+		if s.blockedByMaintenance(r) {
+			http.Error(w, "panel is in maintenance mode (read-only)", http.StatusServiceUnavailable)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -290,6 +521,10 @@ func (s *Server) requireHTMLAuth(next http.HandlerFunc) http.HandlerFunc {
 			http.Redirect(w, r, s.path("/login"), http.StatusFound)
 			return
 		}
+		if c, err := s.auth.Claims(r); err == nil && c.MustChangePassword && r.URL.Query().Get("view") != "password" {
+			http.Redirect(w, r, s.path("/")+"?view=password", http.StatusFound)
+			return
+		}
 		next(w, r)
 	}
 }
@@ -114,7 +114,7 @@ func TestLoginFlowThenAccessIndex(t *testing.T) {
 		t.Fatalf("expected redirect to /x/, got status=%d loc=%q", w.Code, w.Header().Get("Location"))
 	}
 	cookie := w.Header().Get("Set-Cookie")
-	if !strings.Contains(cookie, "atlas_session=") {
+	if !strings.Contains(cookie, "atlas_session_x=") {
 		t.Fatalf("expected session cookie, got %q", cookie)
 	}
 
@@ -130,6 +130,20 @@ func TestLoginFlowThenAccessIndex(t *testing.T) {
 	if !strings.Contains(string(b), "<title>Atlas</title>") {
 		t.Fatalf("expected index html, body=%q", string(b))
 	}
+	if !strings.Contains(string(b), `<base href="/x/"/>`) || strings.Contains(string(b), "<script>window.") {
+		t.Fatalf("expected base path injected, body=%q", string(b))
+	}
+}
+
+func TestRenderIndexWithoutBasePath(t *testing.T) {
+	t.Parallel()
+
+	if b := renderIndex("/"); strings.Contains(string(b), "<base") {
+		t.Fatalf("root base path must not inject <base>: %s", b)
+	}
+	if b := renderIndex("/x/"); !strings.Contains(string(b), `<base href="/x/"/>`) {
+		t.Fatalf("expected <base> under a prefix: %s", b)
+	}
 }
 
 func TestCSRFRequiredForPost(t *testing.T) {
@@ -202,3 +216,101 @@ func TestCSRFRequiredForPost(t *testing.T) {
 		t.Fatalf("csrf should have passed, got %d body=%q", w.Code, w.Body.String())
 	}
 }
+
+func TestSudoPassHeaderRequiresTLSAndIsScrubbed(t *testing.T) {
+	t.Parallel()
+
+	srv := &Server{}
+	var seenHeader, seenPass string
+	var seenOK bool
+	h := srv.sudoPassHeader(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenHeader = r.Header.Get(auth.SudoPassHeader)
+		ctx := auth.WithClaims(r.Context(), auth.Claims{UserInfo: auth.UserInfo{User: "admin", Role: "admin"}})
+		seenPass, seenOK = auth.SudoPasswordFromContext(ctx)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "http://example/api/fs/list", nil)
+	r.Header.Set(auth.SudoPassHeader, "secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without TLS, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "https://example/api/fs/list", nil)
+	r.Header.Set(auth.SudoPassHeader, "secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if seenHeader != "" {
+		t.Fatalf("header should be scrubbed, got %q", seenHeader)
+	}
+	if !seenOK || seenPass != "secret" {
+		t.Fatalf("expected password in context, got %q %v", seenPass, seenOK)
+	}
+
+	// X-Forwarded-Proto: https is only believed from a trusted proxy.
+	proxies, err := parseTrustedProxies([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatalf("parseTrustedProxies: %v", err)
+	}
+	srv.trustedProxies = proxies
+	for _, tc := range []struct {
+		remote string
+		code   int
+	}{
+		{"10.0.0.1:4000", http.StatusNoContent},
+		{"192.0.2.7:4000", http.StatusBadRequest},
+	} {
+		r = httptest.NewRequest(http.MethodGet, "http://example/api/fs/list", nil)
+		r.RemoteAddr = tc.remote
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set(auth.SudoPassHeader, "secret")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.code {
+			t.Fatalf("forwarded https from %s: expected %d, got %d", tc.remote, tc.code, w.Code)
+		}
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	t.Parallel()
+
+	srv, err := New(Config{
+		RootDir:        "/",
+		AuthStore:      &testStore{passByUser: map[string]string{"admin": "ok"}},
+		Secret:         []byte("0123456789abcdef0123456789abcdef"),
+		MaxBodyBytes:   64,
+		MaxUploadBytes: 1024,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h := srv.Handler()
+
+	r := httptest.NewRequest(http.MethodPost, "http://example/api/firewall/rules", strings.NewReader(strings.Repeat("x", 65)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for JSON endpoint, got %d", w.Code)
+	}
+
+	// Uploads use their own, larger limit (and then fail auth).
+	r = httptest.NewRequest(http.MethodPost, "http://example/api/fs/upload", strings.NewReader(strings.Repeat("x", 65)))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code == http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload should not use the JSON body limit")
+	}
+	if got := srv.bodyLimit("/api/fs/upload"); got != 1024 {
+		t.Fatalf("upload limit: %d", got)
+	}
+	// TLS uploads carry PEM chains and never drop below 8 MiB.
+	if got := srv.bodyLimit("/api/admin/tls"); got != 8<<20 {
+		t.Fatalf("tls limit: %d", got)
+	}
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/auth"
+)
+
+// approvalTTL is how long a destructive action waits for a second admin.
+const approvalTTL = 15 * time.Minute
+
+type pendingApproval struct {
+	ID        string
+	Action    string
+	Requester string
+	Created   time.Time
+	Expires   time.Time
+
+	// handler and body replay the original request once approved.
+	handler func(http.ResponseWriter, *http.Request)
+	path    string
+	body    []byte
+}
+
+type approvalInfo struct {
+	ID          string `json:"id"`
+	Action      string `json:"action"`
+	Requester   string `json:"requester"`
+	CreatedUnix int64  `json:"created_unix"`
+	ExpiresUnix int64  `json:"expires_unix"`
+}
+
+type approvalPendingResponse struct {
+	Pending     bool   `json:"pending"`
+	ApprovalID  string `json:"approval_id"`
+	Message     string `json:"message"`
+	ExpiresUnix int64  `json:"expires_unix"`
+}
+
+type approvalsResponse struct {
+	Required bool           `json:"required"`
+	Pending  []approvalInfo `json:"pending"`
+}
+
+// approvalStore keeps pending approvals in memory; they do not survive a restart.
+type approvalStore struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+}
+
+func newApprovalStore() *approvalStore {
+	return &approvalStore{pending: make(map[string]*pendingApproval)}
+}
+
+func (st *approvalStore) add(p *pendingApproval) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.pruneLocked(p.Created)
+	st.pending[p.ID] = p
+}
+
+// take removes and returns an unexpired approval.
+func (st *approvalStore) take(id string, now time.Time) (*pendingApproval, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.pruneLocked(now)
+	p, ok := st.pending[id]
+	if ok {
+		delete(st.pending, id)
+	}
+	return p, ok
+}
+
+func (st *approvalStore) get(id string, now time.Time) (*pendingApproval, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.pruneLocked(now)
+	p, ok := st.pending[id]
+	return p, ok
+}
+
+func (st *approvalStore) list(now time.Time) []approvalInfo {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.pruneLocked(now)
+	out := make([]approvalInfo, 0, len(st.pending))
+	for _, p := range st.pending {
+		out = append(out, approvalInfo{
+			ID:          p.ID,
+			Action:      p.Action,
+			Requester:   p.Requester,
+			CreatedUnix: p.Created.Unix(),
+			ExpiresUnix: p.Expires.Unix(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedUnix < out[j].CreatedUnix })
+	return out
+}
+
+func (st *approvalStore) pruneLocked(now time.Time) {
+	for id, p := range st.pending {
+		if !now.Before(p.Expires) {
+			delete(st.pending, id)
+		}
+	}
+}
+
+type approvedKey struct{}
+
+// deferForApproval parks a destructive request when second approval is required and
+// reports whether it did (the response is then already written). req is the decoded
+// request body; it is replayed through handler once another admin approves.
+func (s *Server) deferForApproval(w http.ResponseWriter, r *http.Request, action string, req any, handler func(http.ResponseWriter, *http.Request)) bool {
+	if !s.cfg.RequireApproval || r.Context().Value(approvedKey{}) != nil {
+		return false
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	id, err := approvalID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	requester := ""
+	if c, ok := auth.ClaimsFromContext(r.Context()); ok {
+		requester = c.User
+	}
+	now := time.Now()
+	p := &pendingApproval{
+		ID:        id,
+		Action:    action,
+		Requester: requester,
+		Created:   now,
+		Expires:   now.Add(approvalTTL),
+		handler:   handler,
+		path:      r.URL.Path,
+		body:      body,
+	}
+	s.approvals.add(p)
+	slog.Info("admin action awaiting approval", "action", action, "id", id, "by", requester)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(approvalPendingResponse{
+		Pending:     true,
+		ApprovalID:  id,
+		Message:     "waiting for approval by another admin",
+		ExpiresUnix: p.Expires.Unix(),
+	})
+	return true
+}
+
+// HandleAdminApprovals lists pending approvals.
+func (s *Server) HandleAdminApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, approvalsResponse{Required: s.cfg.RequireApproval, Pending: s.approvals.list(time.Now())})
+}
+
+// HandleAdminApprovalID approves (POST) or cancels (DELETE) a pending action. The admin
+// who requested it may cancel but not approve it.
+func (s *Server) HandleAdminApprovalID(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/approvals/"), "/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+	user := ""
+	if c, ok := auth.ClaimsFromContext(r.Context()); ok {
+		user = c.User
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		if _, ok := s.approvals.take(id, time.Now()); !ok {
+			http.Error(w, "approval not found or expired", http.StatusNotFound)
+			return
+		}
+		slog.Info("admin action approval cancelled", "id", id, "by", user)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodPost:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok := s.approvals.get(id, time.Now())
+	if !ok {
+		http.Error(w, "approval not found or expired", http.StatusNotFound)
+		return
+	}
+	if user == "" || user == p.Requester {
+		http.Error(w, "the requesting admin cannot approve their own action", http.StatusForbidden)
+		return
+	}
+	if p, ok = s.approvals.take(id, time.Now()); !ok {
+		http.Error(w, "approval not found or expired", http.StatusNotFound)
+		return
+	}
+	slog.Info("admin action approved", "action", p.Action, "id", id, "requested_by", p.Requester, "approved_by", user)
+
+	ctx := context.WithValue(r.Context(), approvedKey{}, id)
+	replay, err := http.NewRequestWithContext(ctx, http.MethodPost, p.path, bytes.NewReader(p.body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	replay.Header.Set("Content-Type", "application/json")
+	replay.RemoteAddr = r.RemoteAddr
+	p.handler(w, replay)
+}
+
+func approvalID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
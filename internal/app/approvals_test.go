@@ -0,0 +1,79 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/auth"
+)
+
+func TestSecondApprovalFlow(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{cfg: Config{RequireApproval: true}, approvals: newApprovalStore()}
+	var ran []string
+	var handler func(http.ResponseWriter, *http.Request)
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if s.deferForApproval(w, r, "reboot", json.RawMessage(b), handler) {
+			return
+		}
+		c, _ := auth.ClaimsFromContext(r.Context())
+		ran = append(ran, c.User+":"+string(b))
+		w.WriteHeader(http.StatusNoContent)
+	}
+	as := func(user string, r *http.Request) *http.Request {
+		return r.WithContext(auth.WithClaims(r.Context(), auth.Claims{UserInfo: auth.UserInfo{User: user}}))
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, as("alice", httptest.NewRequest(http.MethodPost, "/api/admin/action", strings.NewReader(`{"action":"reboot"}`))))
+	var pending approvalPendingResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &pending); err != nil || w.Code != http.StatusAccepted || !pending.Pending || len(ran) != 0 {
+		t.Fatalf("expected a pending approval, got status=%d body=%q ran=%v", w.Code, w.Body.String(), ran)
+	}
+	// Sent with the 202 status line, so the UI parses the body as JSON.
+	if ct := w.Result().Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("pending response Content-Type=%q", ct)
+	}
+	if list := s.approvals.list(time.Now()); len(list) != 1 || list[0].Requester != "alice" || list[0].Action != "reboot" {
+		t.Fatalf("pending list=%+v", list)
+	}
+
+	approve := func(user, id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.HandleAdminApprovalID(w, as(user, httptest.NewRequest(http.MethodPost, "/api/admin/approvals/"+id, nil)))
+		return w
+	}
+	if w := approve("alice", pending.ApprovalID); w.Code != http.StatusForbidden || len(ran) != 0 {
+		t.Fatalf("self-approval: status=%d ran=%v", w.Code, ran)
+	}
+	if w := approve("bob", pending.ApprovalID); w.Code != http.StatusNoContent {
+		t.Fatalf("approve: status=%d body=%q", w.Code, w.Body.String())
+	}
+	if len(ran) != 1 || ran[0] != `bob:{"action":"reboot"}` {
+		t.Fatalf("replayed request=%v", ran)
+	}
+	if w := approve("bob", pending.ApprovalID); w.Code != http.StatusNotFound || len(ran) != 1 {
+		t.Fatalf("approvals must be single-use: status=%d ran=%v", w.Code, ran)
+	}
+
+	// Expired approvals cannot be approved.
+	s.approvals.add(&pendingApproval{ID: "old", Action: "shutdown", Requester: "alice", Created: time.Now().Add(-time.Hour), Expires: time.Now().Add(-time.Minute), handler: handler})
+	if w := approve("bob", "old"); w.Code != http.StatusNotFound {
+		t.Fatalf("expired: status=%d", w.Code)
+	}
+
+	// With the mode off, actions run immediately.
+	s.cfg.RequireApproval = false
+	w = httptest.NewRecorder()
+	handler(w, as("alice", httptest.NewRequest(http.MethodPost, "/api/admin/action", strings.NewReader(`{}`))))
+	if w.Code != http.StatusNoContent || len(ran) != 2 {
+		t.Fatalf("immediate: status=%d ran=%v", w.Code, ran)
+	}
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultMaxBodyBytes   = 2 << 20
+	defaultMaxUploadBytes = 512 << 20
+)
+
+// uploadPaths receive multipart bodies and use MaxUploadBytes instead of MaxBodyBytes.
+var uploadPaths = map[string]bool{
+	"/api/fs/upload": true,
+}
+
+// minBodyLimits raises MaxBodyBytes for endpoints whose payloads are legitimately
+// larger than a typical API call (PEM chains and keys for /api/admin/tls).
+var minBodyLimits = map[string]int64{
+	"/api/admin/tls": 8 << 20,
+}
+
+func (s *Server) bodyLimit(path string) int64 {
+	if uploadPaths[path] {
+		if s.cfg.MaxUploadBytes > 0 {
+			return s.cfg.MaxUploadBytes
+		}
+		return defaultMaxUploadBytes
+	}
+	limit := int64(defaultMaxBodyBytes)
+	if s.cfg.MaxBodyBytes > 0 {
+		limit = s.cfg.MaxBodyBytes
+	}
+	return max(limit, minBodyLimits[path])
+}
+
+// limitBody caps every request body, so no handler can be made to buffer an unbounded
+// JSON document. Oversized requests with a known length are rejected up front.
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := s.bodyLimit(r.URL.Path)
+		if r.ContentLength > limit {
+			http.Error(w, "request body too large (limit "+strconv.FormatInt(limit, 10)+" bytes)", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
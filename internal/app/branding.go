@@ -0,0 +1,66 @@
+package app
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type brandingResponse struct {
+	Name    string `json:"name"`
+	LogoURL string `json:"logo_url,omitempty"`
+}
+
+func (s *Server) brandName() string {
+	if name := strings.TrimSpace(s.cfg.BrandName); name != "" {
+		return name
+	}
+	return "Atlas"
+}
+
+// brandLogoURL is relative to the base path, so it works from both the SPA and /login.
+func (s *Server) brandLogoURL() string {
+	if strings.TrimSpace(s.cfg.BrandLogo) == "" {
+		return ""
+	}
+	return "branding/logo"
+}
+
+// HandleBranding returns the display name and logo URL for the SPA header.
+func (s *Server) HandleBranding(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, brandingResponse{Name: s.brandName(), LogoURL: s.brandLogoURL()})
+}
+
+// HandleBrandingLogo serves the configured logo file. It is public because the login
+// page shows it.
+func (s *Server) HandleBrandingLogo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimSpace(s.cfg.BrandLogo)
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || !st.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	// SVG logos must not run scripts when opened directly.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	http.ServeContent(w, r, filepath.Base(path), st.ModTime(), f)
+}
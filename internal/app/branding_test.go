@@ -0,0 +1,60 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBrandingLoginPageAndLogo(t *testing.T) {
+	t.Parallel()
+
+	logo := filepath.Join(t.TempDir(), "logo.png")
+	if err := os.WriteFile(logo, []byte("\x89PNG\r\n\x1a\nfake"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	srv, err := New(Config{
+		RootDir:   "/",
+		BasePath:  "/x",
+		AuthStore: &testStore{passByUser: map[string]string{"admin": "ok"}},
+		Secret:    []byte("0123456789abcdef0123456789abcdef"),
+		FWDBPath:  filepath.Join(t.TempDir(), "fw.db"),
+		BrandName: "Acme <Panel>",
+		BrandLogo: logo,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h := srv.Handler()
+
+	r := httptest.NewRequest(http.MethodGet, "http://example/x/login", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "<h1>Acme &lt;Panel&gt;</h1>") || !strings.Contains(body, `src="branding/logo"`) {
+		t.Fatalf("login page status=%d body=%q", w.Code, body)
+	}
+
+	// The logo is public (shown before login).
+	r = httptest.NewRequest(http.MethodGet, "http://example/x/branding/logo", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("logo status=%d ct=%q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	rec := httptest.NewRecorder()
+	srv.HandleBranding(rec, httptest.NewRequest(http.MethodGet, "/api/branding", nil))
+	if !strings.Contains(rec.Body.String(), `"name":"Acme \u003cPanel\u003e"`) || !strings.Contains(rec.Body.String(), `"logo_url":"branding/logo"`) {
+		t.Fatalf("branding body=%q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	(&Server{}).HandleBranding(rec, httptest.NewRequest(http.MethodGet, "/api/branding", nil))
+	if strings.TrimSpace(rec.Body.String()) != `{"name":"Atlas"}` {
+		t.Fatalf("default branding body=%q", rec.Body.String())
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/MrTeeett/atlas/internal/auth"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
@@ -20,14 +22,25 @@ type atlasGRPCService interface {
 	GetStats(context.Context, *emptypb.Empty) (*structpb.Struct, error)
 	GetSystemInfo(context.Context, *emptypb.Empty) (*structpb.Struct, error)
 	ListProcesses(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+	GetFirewallStatus(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+	ListFirewallRules(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+}
+
+// grpcFWMethods need the firewall permission, like /api/firewall/* over HTTP.
+var grpcFWMethods = map[string]bool{
+	"/" + atlasGRPCServiceName + "/GetFirewallStatus": true,
+	"/" + atlasGRPCServiceName + "/ListFirewallRules": true,
 }
 
 type atlasGRPCHandler struct {
 	srv *Server
 }
 
-func (s *Server) GRPCServer() *grpc.Server {
-	gs := grpc.NewServer(grpc.UnaryInterceptor(s.grpcAuthUnaryInterceptor))
+// GRPCServer returns the gRPC server; opts are passed to grpc.NewServer (e.g. TLS
+// credentials for a dedicated listener).
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.UnaryInterceptor(s.grpcAuthUnaryInterceptor))
+	gs := grpc.NewServer(opts...)
 	gs.RegisterService(&atlasGRPCServiceDesc, &atlasGRPCHandler{srv: s})
 	return gs
 }
@@ -36,9 +49,10 @@ func GRPCMux(httpHandler http.Handler, grpcServer *grpc.Server) http.Handler {
 	if grpcServer == nil {
 		return httpHandler
 	}
+	grpcHandler := withoutDeadlines(grpcServer)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.ProtoMajor == 2 && strings.HasPrefix(strings.ToLower(r.Header.Get("Content-Type")), "application/grpc") {
-			grpcServer.ServeHTTP(w, r)
+			grpcHandler.ServeHTTP(w, r)
 			return
 		}
 		httpHandler.ServeHTTP(w, r)
@@ -69,6 +83,18 @@ func (h *atlasGRPCHandler) ListProcesses(_ context.Context, _ *emptypb.Empty) (*
 	return toPBStruct(map[string]any{"processes": ps})
 }
 
+func (h *atlasGRPCHandler) GetFirewallStatus(ctx context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	return toPBStruct(h.srv.fw.Status(ctx))
+}
+
+func (h *atlasGRPCHandler) ListFirewallRules(ctx context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	rules, err := h.srv.fw.Rules(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toPBStruct(rules)
+}
+
 func (s *Server) grpcAuthUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
 	if s.cfg.AuthStore == nil {
 		return nil, status.Error(codes.Internal, "auth store is not configured")
@@ -79,14 +105,29 @@ func (s *Server) grpcAuthUnaryInterceptor(ctx context.Context, req any, info *gr
 	if user == "" || pass == "" {
 		return nil, status.Error(codes.Unauthenticated, "missing credentials")
 	}
-	ok, err := s.cfg.AuthStore.Authenticate(user, pass)
+	ok, err := auth.CheckPassword(s.cfg.AuthStore, s.cfg.Authenticator, user, pass)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	if !ok {
 		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
 	}
-	return handler(ctx, req)
+	u, ok, err := s.cfg.AuthStore.GetUser(user)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+	// Like requireAPIAuth, but gRPC exposes none of the passwordChangeExempt endpoints,
+	// so a user with a pending password change can't call anything here.
+	if u.MustChangePassword {
+		return nil, status.Error(codes.PermissionDenied, "password change required")
+	}
+	if grpcFWMethods[info.FullMethod] && !u.CanFW {
+		return nil, status.Error(codes.PermissionDenied, "forbidden")
+	}
+	return handler(auth.WithClaims(ctx, auth.Claims{UserInfo: u}), req)
 }
 
 func firstMetadata(md metadata.MD, key string) string {
@@ -132,6 +173,14 @@ var atlasGRPCServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListProcesses",
 			Handler:    _Atlas_ListProcesses_Handler,
 		},
+		{
+			MethodName: "GetFirewallStatus",
+			Handler:    _Atlas_GetFirewallStatus_Handler,
+		},
+		{
+			MethodName: "ListFirewallRules",
+			Handler:    _Atlas_ListFirewallRules_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "atlas/v1/atlas.proto",
@@ -190,3 +239,39 @@ func _Atlas_ListProcesses_Handler(srv interface{}, ctx context.Context, dec func
 	}
 	return interceptor(ctx, in, info, handler)
 }
+
+func _Atlas_GetFirewallStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(atlasGRPCService).GetFirewallStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + atlasGRPCServiceName + "/GetFirewallStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(atlasGRPCService).GetFirewallStatus(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Atlas_ListFirewallRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(atlasGRPCService).ListFirewallRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + atlasGRPCServiceName + "/ListFirewallRules",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(atlasGRPCService).ListFirewallRules(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
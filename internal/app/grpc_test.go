@@ -5,6 +5,8 @@ import (
 	"net"
 	"testing"
 
+	"github.com/MrTeeett/atlas/internal/auth"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
@@ -51,13 +53,87 @@ func TestGRPCGetStats(t *testing.T) {
 	}
 }
 
+// noFWStore is a testStore whose users lack the firewall permission.
+type noFWStore struct{ *testStore }
+
+func (s noFWStore) GetUser(user string) (auth.UserInfo, bool, error) {
+	u, ok, err := s.testStore.GetUser(user)
+	u.CanFW = false
+	return u, ok, err
+}
+
+func TestGRPCFirewallRequiresCanFW(t *testing.T) {
+	t.Parallel()
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(
+		"x-atlas-user", "admin",
+		"x-atlas-pass", "ok",
+	))
+
+	conn, cleanup := dialGRPCWithStore(t, noFWStore{&testStore{passByUser: map[string]string{"admin": "ok"}}})
+	defer cleanup()
+	for _, m := range []string{"GetFirewallStatus", "ListFirewallRules"} {
+		var out structpb.Struct
+		err := conn.Invoke(ctx, "/atlas.v1.AtlasService/"+m, &emptypb.Empty{}, &out)
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("%s: expected PermissionDenied, got %v", m, err)
+		}
+	}
+	// Other methods stay available.
+	var stats structpb.Struct
+	if err := conn.Invoke(ctx, "/atlas.v1.AtlasService/GetStats", &emptypb.Empty{}, &stats); err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+
+	conn2, cleanup2 := dialGRPCForTest(t)
+	defer cleanup2()
+	var out structpb.Struct
+	if err := conn2.Invoke(ctx, "/atlas.v1.AtlasService/GetFirewallStatus", &emptypb.Empty{}, &out); err != nil {
+		t.Fatalf("GetFirewallStatus: %v", err)
+	}
+	if _, ok := out.Fields["tool"]; !ok {
+		t.Fatalf("expected tool in response, got keys=%v", keys(out.Fields))
+	}
+}
+
+// mustChangeStore is a testStore whose users have a pending password change.
+type mustChangeStore struct{ *testStore }
+
+func (s mustChangeStore) GetUser(user string) (auth.UserInfo, bool, error) {
+	u, ok, err := s.testStore.GetUser(user)
+	u.MustChangePassword = true
+	return u, ok, err
+}
+
+func TestGRPCRefusesPendingPasswordChange(t *testing.T) {
+	t.Parallel()
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(
+		"x-atlas-user", "admin",
+		"x-atlas-pass", "ok",
+	))
+
+	conn, cleanup := dialGRPCWithStore(t, mustChangeStore{&testStore{passByUser: map[string]string{"admin": "ok"}}})
+	defer cleanup()
+	var out structpb.Struct
+	err := conn.Invoke(ctx, "/atlas.v1.AtlasService/GetStats", &emptypb.Empty{}, &out)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+}
+
 func dialGRPCForTest(t *testing.T) (*grpc.ClientConn, func()) {
 	t.Helper()
+	return dialGRPCWithStore(t, &testStore{passByUser: map[string]string{"admin": "ok"}})
+}
+
+func dialGRPCWithStore(t *testing.T, store auth.Store) (*grpc.ClientConn, func()) {
+	t.Helper()
 
 	srv, err := New(Config{
 		RootDir:    "/",
 		BasePath:   "/x",
-		AuthStore:  &testStore{passByUser: map[string]string{"admin": "ok"}},
+		AuthStore:  store,
 		Secret:     []byte("0123456789abcdef0123456789abcdef"),
 		FWDBPath:   "/tmp/fw.db",
 		ConfigPath: "/tmp/atlas.json",
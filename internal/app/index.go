@@ -0,0 +1,45 @@
+package app
+
+import (
+	"bytes"
+	"html"
+	iofs "io/fs"
+	"net/http"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/ui"
+)
+
+// renderIndex returns the embedded index.html with the effective base path injected as
+// <base href>, so relative asset and API URLs resolve under the prefix. Without a base
+// path the page is left alone: relative URLs then follow the document URL, which keeps
+// reverse proxies that strip their own prefix working.
+func renderIndex(base string) []byte {
+	b, err := iofs.ReadFile(ui.FS, "web/index.html")
+	if err != nil {
+		panic(err)
+	}
+	if base == "" || base == "/" {
+		return b
+	}
+	inject := "\n  <base href=\"" + html.EscapeString(base) + "\"/>"
+	head := []byte("<head>")
+	i := bytes.Index(b, head)
+	if i < 0 {
+		return b
+	}
+	i += len(head)
+	out := make([]byte, 0, len(b)+len(inject))
+	out = append(out, b[:i]...)
+	out = append(out, inject...)
+	out = append(out, b[i:]...)
+	return out
+}
+
+func serveIndex(index []byte) http.HandlerFunc {
+	modTime := time.Now()
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeContent(w, r, "index.html", modTime, bytes.NewReader(index))
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/system"
+)
+
+// serviceStateTTL caches the unit state; the dashboard polls /api/system/info every
+// few seconds and each lookup runs systemctl twice.
+const serviceStateTTL = 15 * time.Second
+
+// serviceState tells whether Atlas's own unit is running and will start on boot.
+type serviceState struct {
+	Unit    string `json:"unit"`
+	Enabled bool   `json:"enabled"`
+	Active  bool   `json:"active"`
+}
+
+type systemInfoResponse struct {
+	system.SystemInfo
+	// Service is omitted when systemctl is missing or no service is configured.
+	Service *serviceState `json:"service,omitempty"`
+}
+
+type serviceStateCache struct {
+	mu    sync.Mutex
+	at    time.Time
+	state *serviceState
+}
+
+// HandleSystemInfo serves the host info together with the state of Atlas's unit.
+func (s *Server) HandleSystemInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := s.info.Collect()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, systemInfoResponse{SystemInfo: info, Service: s.serviceState(r.Context())})
+}
+
+func (s *Server) serviceState(ctx context.Context) *serviceState {
+	s.svcState.mu.Lock()
+	defer s.svcState.mu.Unlock()
+	if !s.svcState.at.IsZero() && time.Since(s.svcState.at) < serviceStateTTL {
+		return s.svcState.state
+	}
+	s.svcState.state = s.lookupServiceState(ctx)
+	s.svcState.at = time.Now()
+	return s.svcState.state
+}
+
+func (s *Server) lookupServiceState(ctx context.Context) *serviceState {
+	if strings.TrimSpace(s.cfg.ServiceName) == "" {
+		return nil
+	}
+	unitName, _, err := s.autostartUnit()
+	if err != nil {
+		return nil
+	}
+	systemctl, err := exec.LookPath("systemctl")
+	if err != nil {
+		return nil
+	}
+	enabled, _ := systemctlBool(ctx, systemctl, "is-enabled", unitName)
+	active, _ := systemctlBool(ctx, systemctl, "is-active", unitName)
+	return &serviceState{Unit: unitName, Enabled: enabled, Active: active}
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/system"
+)
+
+func TestHandleSystemInfoService(t *testing.T) {
+	t.Parallel()
+
+	get := func(s *Server) map[string]any {
+		rr := httptest.NewRecorder()
+		s.HandleSystemInfo(rr, httptest.NewRequest(http.MethodGet, "/api/system/info", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+		}
+		var out map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// No service configured: the host info is there, the service state is not.
+	out := get(&Server{info: system.NewInfoService()})
+	if _, ok := out["hostname"]; !ok {
+		t.Fatalf("missing host info: %v", out)
+	}
+	if _, ok := out["service"]; ok {
+		t.Fatalf("unexpected service state: %v", out["service"])
+	}
+
+	s := &Server{info: system.NewInfoService(), cfg: Config{ServiceName: "atlas"}}
+	s.svcState.state = &serviceState{Unit: "atlas.service", Enabled: true, Active: true}
+	s.svcState.at = time.Now()
+	svc, ok := get(s)["service"].(map[string]any)
+	if !ok || svc["unit"] != "atlas.service" || svc["enabled"] != true || svc["active"] != true {
+		t.Fatalf("unexpected service state: %v", svc)
+	}
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/MrTeeett/atlas/internal/auth"
+	"github.com/MrTeeett/atlas/internal/config"
+)
+
+type maintenanceRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type maintenanceResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+// blockedByMaintenance reports whether r must be refused while the panel is read-only:
+// reads and admin endpoints stay available so the mode can be inspected and turned off.
+func (s *Server) blockedByMaintenance(r *http.Request) bool {
+	if !s.maintenance.Load() {
+		return false
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return false
+	}
+	return !strings.HasPrefix(r.URL.Path, "/api/admin/")
+}
+
+// HandleAdminMaintenance reports (GET) or toggles (POST {"enabled":bool}) maintenance mode.
+// The flag is persisted to the config file so it survives restarts.
+func (s *Server) HandleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, maintenanceResponse{Enabled: s.maintenance.Load()})
+		return
+	case http.MethodPost:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	enabled := *req.Enabled
+	if s.cfg.ConfigPath != "" {
+		if err := config.Update(s.cfg.ConfigPath, func(c *config.Config) { c.Maintenance = enabled }); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.maintenance.Store(enabled)
+
+	user := ""
+	if c, ok := auth.ClaimsFromContext(r.Context()); ok {
+		user = c.User
+	}
+	slog.Info("maintenance mode changed", "enabled", enabled, "by", user)
+	writeJSON(w, maintenanceResponse{Enabled: enabled})
+}
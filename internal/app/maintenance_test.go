@@ -0,0 +1,90 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrTeeett/atlas/internal/config"
+)
+
+func TestMaintenanceModeBlocksMutations(t *testing.T) {
+	t.Parallel()
+
+	cfgPath := filepath.Join(t.TempDir(), "atlas.json")
+	srv, err := New(Config{
+		RootDir:    "/",
+		AuthStore:  &testStore{passByUser: map[string]string{"admin": "ok"}},
+		Secret:     []byte("0123456789abcdef0123456789abcdef"),
+		FWDBPath:   filepath.Join(t.TempDir(), "fw.db"),
+		ConfigPath: cfgPath,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h := srv.Handler()
+
+	form := url.Values{}
+	form.Set("user", "admin")
+	form.Set("pass", "ok")
+	r := httptest.NewRequest(http.MethodPost, "http://example/login", strings.NewReader(form.Encode()))
+	r.Header.Set("content-type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	cookieKV := strings.Split(w.Header().Get("Set-Cookie"), ";")[0]
+
+	var me struct {
+		CSRF        string `json:"csrf"`
+		Maintenance bool   `json:"maintenance"`
+	}
+	getMe := func() {
+		r := httptest.NewRequest(http.MethodGet, "http://example/api/me", nil)
+		r.Header.Set("Cookie", cookieKV)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if err := json.Unmarshal(w.Body.Bytes(), &me); err != nil {
+			t.Fatalf("me: status=%d err=%v", w.Code, err)
+		}
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://example"+path, strings.NewReader(body))
+		r.Header.Set("Cookie", cookieKV)
+		r.Header.Set("X-Atlas-CSRF", me.CSRF)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	getMe()
+	if me.Maintenance {
+		t.Fatalf("maintenance should be off by default")
+	}
+	if w := do(http.MethodPost, "/api/admin/maintenance", `{"enabled":true}`); w.Code != http.StatusOK {
+		t.Fatalf("enable status=%d body=%q", w.Code, w.Body.String())
+	}
+	getMe()
+	if !me.Maintenance {
+		t.Fatalf("expected maintenance in /api/me")
+	}
+	if cfg, err := config.Load(cfgPath); err != nil || !cfg.Maintenance {
+		t.Fatalf("expected persisted flag, err=%v", err)
+	}
+
+	if w := do(http.MethodPost, "/api/fs/mkdir", `{"path":"/tmp/x"}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d body=%q", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/admin/maintenance", ""); w.Code != http.StatusOK {
+		t.Fatalf("GET status=%d", w.Code)
+	}
+
+	if w := do(http.MethodPost, "/api/admin/maintenance", `{"enabled":false}`); w.Code != http.StatusOK {
+		t.Fatalf("disable status=%d body=%q", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/fs/mkdir", `{}`); w.Code == http.StatusServiceUnavailable {
+		t.Fatalf("mutation still blocked after disable")
+	}
+}
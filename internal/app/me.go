@@ -0,0 +1,129 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/auth"
+)
+
+type timeZoneStore interface {
+	SetTimeZone(user, tz string) error
+}
+
+type timeZoneRequest struct {
+	TimeZone string `json:"time_zone"`
+}
+
+type timeZoneResponse struct {
+	TimeZone string `json:"time_zone"`
+	Now      string `json:"now"`
+}
+
+// HandleMeTimeZone sets the current user's display time zone (POST {"time_zone":"Europe/Berlin"};
+// empty resets to UTC). Only presentation changes: stored and epoch times stay UTC.
+func (s *Server) HandleMeTimeZone(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	st, ok := s.cfg.AuthStore.(timeZoneStore)
+	if !ok {
+		http.Error(w, "auth store does not support time zones", http.StatusInternalServerError)
+		return
+	}
+	var req timeZoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	tz := strings.TrimSpace(req.TimeZone)
+	loc := time.UTC
+	if tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "unknown time zone", http.StatusBadRequest)
+			return
+		}
+		loc = l
+	}
+	if err := st.SetTimeZone(c.User, tz); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, timeZoneResponse{TimeZone: loc.String(), Now: time.Now().In(loc).Format(time.RFC3339)})
+}
+
+// passwordChangeExempt lists the API paths a user who must change their password can
+// still reach.
+var passwordChangeExempt = map[string]bool{
+	"/api/me":          true,
+	"/api/me/password": true,
+	"/api/branding":    true,
+}
+
+type passwordStore interface {
+	UpsertUser(user, pass string) error
+}
+
+type mePasswordRequest struct {
+	Current string `json:"current_password"`
+	New     string `json:"new_password"`
+}
+
+// HandleMePassword changes the current user's password (POST {"current_password","new_password"})
+// and clears a pending forced change.
+func (s *Server) HandleMePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.cfg.Authenticator != nil {
+		http.Error(w, "passwords are managed by the external auth backend", http.StatusConflict)
+		return
+	}
+	st, ok := s.cfg.AuthStore.(passwordStore)
+	if !ok {
+		http.Error(w, "auth store does not support password changes", http.StatusInternalServerError)
+		return
+	}
+	var req mePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.New == "" {
+		http.Error(w, "new_password is required", http.StatusBadRequest)
+		return
+	}
+	if req.New == req.Current {
+		http.Error(w, "new password must differ from the current one", http.StatusBadRequest)
+		return
+	}
+	valid, err := s.cfg.AuthStore.Authenticate(c.User, req.Current)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "current password is wrong", http.StatusForbidden)
+		return
+	}
+	if err := st.UpsertUser(c.User, req.New); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrTeeett/atlas/internal/auth"
+	"github.com/MrTeeett/atlas/internal/userdb"
+)
+
+func TestHandleMeTimeZone(t *testing.T) {
+	t.Parallel()
+
+	store, err := userdb.Open(filepath.Join(t.TempDir(), "users.db"), bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("userdb.Open: %v", err)
+	}
+	if err := store.UpsertUser("bob", "pw"); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	s := &Server{cfg: Config{AuthStore: store}}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/me/timezone", strings.NewReader(body))
+		r = r.WithContext(auth.WithClaims(r.Context(), auth.Claims{UserInfo: auth.UserInfo{User: "bob"}}))
+		w := httptest.NewRecorder()
+		s.HandleMeTimeZone(w, r)
+		return w
+	}
+
+	if w := post(`{"time_zone":"Not/AZone"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad zone status=%d", w.Code)
+	}
+	w := post(`{"time_zone":"Asia/Tokyo"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"time_zone":"Asia/Tokyo"`) {
+		t.Fatalf("status=%d body=%q", w.Code, w.Body.String())
+	}
+	info, _, _ := store.GetUser("bob")
+	if info.TimeZone != "Asia/Tokyo" {
+		t.Fatalf("stored tz=%q", info.TimeZone)
+	}
+
+	// The stored zone drives rendering; the same instant is only presented differently.
+	ctx := auth.WithClaims(httptest.NewRequest(http.MethodGet, "/", nil).Context(), auth.Claims{UserInfo: info})
+	resp := adminLogsResponse{Lines: []string{`time=2026-01-02T03:04:05Z level=INFO msg=hi`, "no time"}}.withTimes(ctx)
+	if resp.TimeZone != "Asia/Tokyo" || len(resp.Times) != 2 {
+		t.Fatalf("unexpected times: %+v", resp)
+	}
+	if resp.Times[0].Unix != 1767323045 || resp.Times[0].Local != "2026-01-02T12:04:05+09:00" || resp.Times[1] != (logTime{}) {
+		t.Fatalf("unexpected times: %+v", resp.Times)
+	}
+
+	if w := post(`{"time_zone":""}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"time_zone":"UTC"`) {
+		t.Fatalf("reset status=%d body=%q", w.Code, w.Body.String())
+	}
+}
+
+func TestForcedPasswordChange(t *testing.T) {
+	t.Parallel()
+
+	store, err := userdb.Open(filepath.Join(t.TempDir(), "users.db"), bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("userdb.Open: %v", err)
+	}
+	if err := store.UpsertUser("bob", "temp"); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	if err := store.SetMustChangePassword("bob", true); err != nil {
+		t.Fatalf("SetMustChangePassword: %v", err)
+	}
+	srv, err := New(Config{RootDir: "/", AuthStore: store, Secret: []byte("0123456789abcdef0123456789abcdef")})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h := srv.Handler()
+
+	form := url.Values{"user": {"bob"}, "pass": {"temp"}}
+	r := httptest.NewRequest(http.MethodPost, "http://example/login", strings.NewReader(form.Encode()))
+	r.Header.Set("content-type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	cookie := strings.Split(w.Header().Get("Set-Cookie"), ";")[0]
+	if cookie == "" {
+		t.Fatalf("expected session cookie")
+	}
+	do := func(method, path, csrf, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://example"+path, strings.NewReader(body))
+		r.Header.Set("Cookie", cookie)
+		if csrf != "" {
+			r.Header.Set("X-Atlas-CSRF", csrf)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w = do(http.MethodGet, "/api/me", "", "")
+	var me struct {
+		CSRF       string `json:"csrf"`
+		MustChange bool   `json:"must_change_password"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &me); err != nil || !me.MustChange {
+		t.Fatalf("/api/me status=%d body=%q", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/stats", "", ""); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "password change required") {
+		t.Fatalf("api while change pending: status=%d body=%q", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/", "", ""); w.Code != http.StatusFound || w.Header().Get("Location") != "/?view=password" {
+		t.Fatalf("index while change pending: status=%d location=%q", w.Code, w.Header().Get("Location"))
+	}
+
+	if w := do(http.MethodPost, "/api/me/password", me.CSRF, `{"current_password":"wrong","new_password":"fresh"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("wrong current password: status=%d", w.Code)
+	}
+	if w := do(http.MethodPost, "/api/me/password", me.CSRF, `{"current_password":"temp","new_password":"fresh"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("change: status=%d body=%q", w.Code, w.Body.String())
+	}
+	if info, _, _ := store.GetUser("bob"); info.MustChangePassword {
+		t.Fatalf("flag not cleared")
+	}
+	if ok, _ := store.Authenticate("bob", "fresh"); !ok {
+		t.Fatalf("new password not stored")
+	}
+	if w := do(http.MethodGet, "/api/stats", "", ""); w.Code == http.StatusForbidden {
+		t.Fatalf("api still blocked after the change: body=%q", w.Body.String())
+	}
+}
+
+func TestFirewallReadOnlyPermission(t *testing.T) {
+	t.Parallel()
+
+	store, err := userdb.Open(filepath.Join(t.TempDir(), "users.db"), bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("userdb.Open: %v", err)
+	}
+	if err := store.UpsertUser("ops", "pw"); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	if err := store.SetPermissions("ops", "user", false, false, true, false, false, nil); err != nil {
+		t.Fatalf("SetPermissions: %v", err)
+	}
+	if err := store.SetFWReadOnly("ops", true); err != nil {
+		t.Fatalf("SetFWReadOnly: %v", err)
+	}
+	srv, err := New(Config{RootDir: "/", AuthStore: store, Secret: []byte("0123456789abcdef0123456789abcdef")})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h := srv.Handler()
+
+	form := url.Values{"user": {"ops"}, "pass": {"pw"}}
+	r := httptest.NewRequest(http.MethodPost, "http://example/login", strings.NewReader(form.Encode()))
+	r.Header.Set("content-type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	cookie := strings.Split(w.Header().Get("Set-Cookie"), ";")[0]
+	do := func(method, path, csrf, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://example"+path, strings.NewReader(body))
+		r.Header.Set("Cookie", cookie)
+		if csrf != "" {
+			r.Header.Set("X-Atlas-CSRF", csrf)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	var me struct {
+		CSRF    string `json:"csrf"`
+		CanFW   bool   `json:"can_firewall"`
+		CanEdit bool   `json:"can_firewall_edit"`
+	}
+	w = do(http.MethodGet, "/api/me", "", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &me); err != nil || !me.CanFW || me.CanEdit {
+		t.Fatalf("/api/me status=%d body=%q", w.Code, w.Body.String())
+	}
+	readOnly := func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusForbidden && strings.Contains(w.Body.String(), "read-only")
+	}
+	for _, path := range []string{"/api/firewall/status", "/api/firewall/rules", "/api/ports/usage?port=22"} {
+		if w := do(http.MethodGet, path, "", ""); w.Code == http.StatusForbidden {
+			t.Fatalf("GET %s: status=%d body=%q", path, w.Code, w.Body.String())
+		}
+	}
+	if w := do(http.MethodPost, "/api/firewall/simulate", me.CSRF, `{"proto":"tcp","port":22}`); readOnly(w) {
+		t.Fatalf("simulate should stay available: body=%q", w.Body.String())
+	}
+	for _, path := range []string{"/api/firewall/enabled", "/api/firewall/apply", "/api/firewall/rules", "/api/firewall/ban"} {
+		if w := do(http.MethodPost, path, me.CSRF, `{}`); !readOnly(w) {
+			t.Fatalf("POST %s: status=%d body=%q", path, w.Code, w.Body.String())
+		}
+	}
+
+	if err := store.SetFWReadOnly("ops", false); err != nil {
+		t.Fatalf("SetFWReadOnly: %v", err)
+	}
+	if w := do(http.MethodPost, "/api/firewall/enabled", me.CSRF, `{}`); readOnly(w) {
+		t.Fatalf("full access still read-only: body=%q", w.Body.String())
+	}
+}
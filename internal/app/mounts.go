@@ -0,0 +1,155 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/system"
+)
+
+const procMountsPath = "/proc/mounts"
+
+var (
+	mountDeviceRe = regexp.MustCompile(`^[A-Za-z0-9_.:/@\[\]=+-]+$`)
+	mountFSTypeRe = regexp.MustCompile(`^[a-z0-9._]+$`)
+	mountOptionRe = regexp.MustCompile(`^[A-Za-z0-9_.=:/+-]+$`)
+
+	// Mounting over these (or below the pseudo filesystems) would break the host.
+	forbiddenMountTargets = []string{"/", "/bin", "/boot", "/dev", "/etc", "/lib", "/lib64", "/proc", "/root", "/run", "/sbin", "/sys", "/usr", "/var"}
+)
+
+type mountsResponse struct {
+	Mounts    []system.Mount `json:"mounts"`
+	Allowlist []string       `json:"allowlist"`
+}
+
+type mountRequest struct {
+	Device  string   `json:"device"`
+	Target  string   `json:"target"`
+	FSType  string   `json:"fstype,omitempty"`
+	Options []string `json:"options,omitempty"`
+}
+
+// HandleMounts lists mounts (GET); POST mounts and DELETE ?target= unmounts (admin only).
+func (s *Server) HandleMounts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeMounts(w)
+	case http.MethodPost, http.MethodDelete:
+		s.requireAdmin(s.requireCSRF(http.HandlerFunc(s.handleMountChange))).ServeHTTP(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) writeMounts(w http.ResponseWriter) {
+	mounts, err := system.ReadMounts(procMountsPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, mountsResponse{Mounts: mounts, Allowlist: append([]string{}, s.cfg.MountAllowlist...)})
+}
+
+func (s *Server) handleMountChange(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.EnableAdminActions {
+		http.Error(w, "admin actions are disabled (enable_admin_actions=false)", http.StatusForbidden)
+		return
+	}
+	if len(s.cfg.MountAllowlist) == 0 {
+		http.Error(w, "mounting is disabled (mount_allowlist is empty)", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodDelete {
+		target, err := s.mountTarget(r.URL.Query().Get("target"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.runRoot(ctx, "umount", "--", target); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.writeMounts(w)
+		return
+	}
+
+	var req mountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	args, err := s.mountArgs(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.runRoot(ctx, "mount", args...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeMounts(w)
+}
+
+func (s *Server) mountArgs(req mountRequest) ([]string, error) {
+	device := strings.TrimSpace(req.Device)
+	if device == "" || strings.HasPrefix(device, "-") || !mountDeviceRe.MatchString(device) {
+		return nil, errors.New("bad device")
+	}
+	target, err := s.mountTarget(req.Target)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	if fstype := strings.TrimSpace(req.FSType); fstype != "" {
+		if !mountFSTypeRe.MatchString(fstype) {
+			return nil, errors.New("bad fstype")
+		}
+		args = append(args, "-t", fstype)
+	}
+	if len(req.Options) > 0 {
+		for _, o := range req.Options {
+			if !mountOptionRe.MatchString(o) || strings.HasPrefix(o, "-") {
+				return nil, errors.New("bad mount option: " + o)
+			}
+		}
+		args = append(args, "-o", strings.Join(req.Options, ","))
+	}
+	return append(args, "--", device, target), nil
+}
+
+// mountTarget validates that target is an absolute path below one of the allowlisted
+// directories and neither a system directory nor inside one.
+func (s *Server) mountTarget(target string) (string, error) {
+	target = strings.TrimSpace(target)
+	if !filepath.IsAbs(target) {
+		return "", errors.New("target must be an absolute path")
+	}
+	target = filepath.Clean(target)
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	for _, bad := range forbiddenMountTargets {
+		// "/" only matches itself; every other system directory also covers its subtree.
+		if target == bad || bad != "/" && strings.HasPrefix(target, bad+"/") {
+			return "", errors.New("refusing to use system directory as mount target")
+		}
+	}
+	for _, dir := range s.cfg.MountAllowlist {
+		dir = filepath.Clean(dir)
+		if target != dir && strings.HasPrefix(target, strings.TrimRight(dir, "/")+"/") {
+			return target, nil
+		}
+	}
+	return "", errors.New("target is outside mount_allowlist")
+}
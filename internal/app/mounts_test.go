@@ -0,0 +1,62 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMountArgsValidation(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{cfg: Config{MountAllowlist: []string{"/mnt", "/media/"}}}
+
+	args, err := s.mountArgs(mountRequest{Device: "server:/export", Target: "/mnt/nfs", FSType: "nfs4", Options: []string{"ro", "vers=4.2"}})
+	if err != nil {
+		t.Fatalf("mountArgs: %v", err)
+	}
+	want := []string{"-t", "nfs4", "-o", "ro,vers=4.2", "--", "server:/export", "/mnt/nfs"}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("args: got %q want %q", args, want)
+	}
+	if _, err := s.mountArgs(mountRequest{Device: "/dev/sdb1", Target: "/media/usb"}); err != nil {
+		t.Fatalf("mountArgs: %v", err)
+	}
+
+	bad := []mountRequest{
+		{Device: "-oremount", Target: "/mnt/x"},
+		{Device: "/dev/sdb1; rm -rf /", Target: "/mnt/x"},
+		{Device: "/dev/sdb1", Target: "/mnt"},
+		{Device: "/dev/sdb1", Target: "/etc"},
+		{Device: "/dev/sdb1", Target: "/"},
+		{Device: "/dev/sdb1", Target: "/mnt/../etc"},
+		{Device: "/dev/sdb1", Target: "mnt/x"},
+		{Device: "/dev/sdb1", Target: "/mnt/x", FSType: "ext4 -o"},
+		{Device: "/dev/sdb1", Target: "/mnt/x", Options: []string{"--bind"}},
+	}
+	for _, req := range bad {
+		if _, err := s.mountArgs(req); err == nil {
+			t.Fatalf("expected error for %#v", req)
+		}
+	}
+
+	// An allowlist entry can't open up the inside of a system directory.
+	s = &Server{cfg: Config{MountAllowlist: []string{"/var", "/usr/local"}}}
+	for _, target := range []string{"/var/lib/x", "/usr/local/share"} {
+		if _, err := s.mountTarget(target); err == nil {
+			t.Fatalf("expected error for target %q", target)
+		}
+	}
+}
+
+func TestHandleMountsDisabledWithoutAllowlist(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{cfg: Config{EnableAdminActions: true}}
+	rr := httptest.NewRecorder()
+	s.handleMountChange(rr, httptest.NewRequest(http.MethodDelete, "/api/system/mounts?target=/mnt/x", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+}
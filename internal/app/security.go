@@ -0,0 +1,76 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// securityStatus is the connection security posture shown by the UI.
+type securityStatus struct {
+	// TLS is set when Atlas itself serves HTTPS with a loaded certificate.
+	TLS        bool `json:"tls"`
+	SelfSigned bool `json:"self_signed"`
+	// Scheme is how the browser reached Atlas: the request's own scheme, or
+	// X-Forwarded-Proto when the request came through a trusted proxy (Proxied).
+	Scheme  string `json:"scheme"`
+	Proxied bool   `json:"proxied"`
+	// SecureCookies reports whether the session cookie has the Secure flag.
+	SecureCookies bool `json:"secure_cookies"`
+	// Warnings lists problems as codes: "plain_http", "insecure_cookies", "self_signed".
+	Warnings []string `json:"warnings"`
+}
+
+// HandleSecurity reports whether the connection and session cookie are protected.
+func (s *Server) HandleSecurity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	st := securityStatus{
+		TLS:           s.cfg.TLSCertFile != "" && s.cfg.TLSKeyFile != "",
+		SecureCookies: s.auth.SecureCookies(),
+		Warnings:      []string{},
+	}
+	if st.TLS {
+		if cert, err := readCertificate(s.cfg.TLSCertFile); err == nil {
+			st.SelfSigned = isSelfSigned(cert)
+		}
+	}
+	st.Scheme, st.Proxied = s.requestScheme(r)
+
+	if st.Scheme != "https" {
+		st.Warnings = append(st.Warnings, "plain_http")
+	}
+	if !st.SecureCookies {
+		st.Warnings = append(st.Warnings, "insecure_cookies")
+	}
+	// Behind a proxy the browser sees the proxy's certificate, not this one.
+	if st.SelfSigned && !st.Proxied {
+		st.Warnings = append(st.Warnings, "self_signed")
+	}
+	writeJSON(w, st)
+}
+
+// requestScheme returns the scheme the client used. X-Forwarded-Proto is only believed
+// from trusted proxies; its first value is the one the original client used.
+func (s *Server) requestScheme(r *http.Request) (string, bool) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	fwd := r.Header.Get("X-Forwarded-Proto")
+	if fwd == "" || !s.isTrustedProxy(net.ParseIP(host)) {
+		return scheme, false
+	}
+	first, _, _ := strings.Cut(fwd, ",")
+	switch p := strings.ToLower(strings.TrimSpace(first)); p {
+	case "http", "https":
+		return p, true
+	}
+	return scheme, false
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleSecurity(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certPEM, keyPEM := genSelfSignedKeypair(t)
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certPath, []byte(certPEM), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(keyPath, []byte(keyPEM), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	srv, err := New(Config{
+		RootDir:        "/",
+		AuthStore:      &testStore{passByUser: map[string]string{"admin": "ok"}},
+		Secret:         []byte("0123456789abcdef0123456789abcdef"),
+		FWDBPath:       filepath.Join(dir, "fw.db"),
+		CookieSecure:   true,
+		TLSCertFile:    certPath,
+		TLSKeyFile:     keyPath,
+		TrustedProxies: []string{"192.0.2.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	get := func(url, remote, proto string) securityStatus {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.RemoteAddr = remote
+		if proto != "" {
+			r.Header.Set("X-Forwarded-Proto", proto)
+		}
+		w := httptest.NewRecorder()
+		srv.HandleSecurity(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%q", w.Code, w.Body.String())
+		}
+		var st securityStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		return st
+	}
+
+	st := get("https://example/api/system/security", "198.51.100.1:1234", "http")
+	if !st.TLS || !st.SelfSigned || !st.SecureCookies || st.Scheme != "https" || st.Proxied {
+		t.Fatalf("direct https: %+v", st)
+	}
+	if strings.Join(st.Warnings, ",") != "self_signed" {
+		t.Fatalf("direct https warnings: %q", st.Warnings)
+	}
+
+	// A trusted proxy terminating TLS speaks plain HTTP to Atlas.
+	st = get("http://example/api/system/security", "192.0.2.5:1234", "https, http")
+	if st.Scheme != "https" || !st.Proxied || len(st.Warnings) != 0 {
+		t.Fatalf("trusted proxy: %+v", st)
+	}
+	st = get("http://example/api/system/security", "192.0.2.5:1234", "http")
+	if st.Scheme != "http" || strings.Join(st.Warnings, ",") != "plain_http" {
+		t.Fatalf("trusted proxy over http: %+v", st)
+	}
+}
@@ -0,0 +1,23 @@
+package app
+
+import (
+	"net/http"
+	"time"
+)
+
+// HandlerTimeout bounds ordinary API requests (http.TimeoutHandler answers 503 once it
+// passes). The server's write timeout should stay above it, or the connection is cut
+// before that answer is written.
+const HandlerTimeout = 60 * time.Second
+
+// withoutDeadlines lifts the server's read and write deadlines for long-lived
+// responses (terminal streams, gRPC calls), which would otherwise be cut off once
+// http.Server's ReadTimeout or WriteTimeout passes.
+func withoutDeadlines(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithoutDeadlinesOutlivesWriteTimeout(t *testing.T) {
+	t.Parallel()
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	})
+	get := func(h http.Handler) (string, error) {
+		ts := httptest.NewUnstartedServer(h)
+		ts.Config.ReadTimeout = 100 * time.Millisecond
+		ts.Config.WriteTimeout = 100 * time.Millisecond
+		ts.Start()
+		defer ts.Close()
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	if body, err := get(slow); err == nil && body == "done" {
+		t.Fatalf("expected the write timeout to cut the plain handler off")
+	}
+	body, err := get(withoutDeadlines(slow))
+	if err != nil || body != "done" {
+		t.Fatalf("stream: body=%q err=%v", body, err)
+	}
+}
@@ -0,0 +1,197 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/buildinfo"
+	"github.com/MrTeeett/atlas/internal/config"
+)
+
+// updateCheckTTL is how long a release lookup is reused. Unauthenticated GitHub API
+// calls are limited to 60 per hour per IP, and other software on the host may share it.
+const updateCheckTTL = time.Hour
+
+// updateCheck is the result of the last release lookup. Checking never installs
+// anything; updates stay a manual admin action.
+type updateCheck struct {
+	Auto      bool      `json:"auto"`
+	Available bool      `json:"available"`
+	Latest    string    `json:"latest,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type updateChecker struct {
+	// run serializes lookups; mu guards the fields below it and is not held while
+	// GitHub is queried, so readers of the cached result never wait for the network.
+	run      sync.Mutex
+	mu       sync.Mutex
+	last     updateCheck
+	repo     string // repo last was looked up in
+	notified string // tag the webhook was last sent for
+
+	webhook string
+	// latest looks up the newest release tag (githubLatestTag; replaced in tests).
+	latest func(ctx context.Context, repo string) (string, error)
+}
+
+func newUpdateChecker(webhook string) *updateChecker {
+	return &updateChecker{webhook: webhook, latest: githubLatestTag}
+}
+
+func (c *updateChecker) cached() updateCheck {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// check looks up the latest release of repo unless a result younger than
+// updateCheckTTL is cached. Dev builds follow the moving "dev" tag, which has no
+// version to compare against, so they are not checked.
+func (c *updateChecker) check(ctx context.Context, repo, channel, current string) updateCheck {
+	c.run.Lock()
+	defer c.run.Unlock()
+
+	c.mu.Lock()
+	if channel == "dev" {
+		c.last = updateCheck{CheckedAt: time.Now()}
+		defer c.mu.Unlock()
+		return c.last
+	}
+	if c.repo == repo && !c.last.CheckedAt.IsZero() && time.Since(c.last.CheckedAt) < updateCheckTTL {
+		defer c.mu.Unlock()
+		return c.last
+	}
+	notified := c.notified
+	c.mu.Unlock()
+
+	res := updateCheck{CheckedAt: time.Now()}
+	tag, err := c.latest(ctx, repo)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Latest = tag
+		res.Available = newerVersion(tag, current)
+	}
+	if res.Available && c.webhook != "" && notified != tag {
+		if err := postUpdateWebhook(ctx, c.webhook, repo, current, tag); err != nil {
+			slog.Warn("update check: webhook failed", "err", err)
+		} else {
+			notified = tag
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.repo, c.last, c.notified = repo, res, notified
+	return res
+}
+
+// checkForUpdate checks the configured repo and channel for a newer release.
+func (s *Server) checkForUpdate(ctx context.Context) updateCheck {
+	cfg, err := config.Load(s.cfg.ConfigPath)
+	if err != nil {
+		return updateCheck{Error: err.Error()}
+	}
+	channel := resolveUpdateChannel(cfg.UpdateChannel)
+	return s.updates.check(ctx, strings.TrimSpace(cfg.UpdateRepo), channel, strings.TrimSpace(buildinfo.Version))
+}
+
+// runUpdateChecks checks for a new release every interval, starting a minute after
+// startup so a restart loop does not hammer GitHub.
+func (s *Server) runUpdateChecks(interval time.Duration) {
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+	for range timer.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		res := s.checkForUpdate(ctx)
+		cancel()
+		switch {
+		case res.Error != "":
+			slog.Warn("update check failed", "err", res.Error)
+		case res.Available:
+			slog.Info("update available", "current", buildinfo.Version, "latest", res.Latest)
+		}
+		timer.Reset(interval)
+	}
+}
+
+func postUpdateWebhook(ctx context.Context, url, repo, current, latest string) error {
+	host, _ := os.Hostname()
+	body, err := json.Marshal(map[string]string{
+		"event":   "update_available",
+		"host":    host,
+		"repo":    repo,
+		"current": current,
+		"latest":  latest,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Atlas")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// newerVersion reports whether release tag latest is a higher "vX.Y.Z" version than
+// current. Builds without a parseable version are never reported as outdated.
+func newerVersion(latest, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	var out [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return out, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
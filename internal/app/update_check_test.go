@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewerVersion(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v0.2.0", "v0.1.9", true},
+		{"v1.0.0", "v0.99.0", true},
+		{"v0.1.10", "v0.1.9", true},
+		{"v0.1.0", "v0.1.0", false},
+		{"v0.1.0", "v0.2.0", false},
+		{"v0.2", "0.1.5", true},
+		{"v0.2.0-rc1", "v0.1.0", true},
+		{"v0.2.0", "dev", false},
+		{"v0.2.0", "", false},
+		{"nightly", "v0.1.0", false},
+	}
+	for _, c := range cases {
+		if got := newerVersion(c.latest, c.current); got != c.want {
+			t.Errorf("newerVersion(%q, %q) = %v, want %v", c.latest, c.current, got, c.want)
+		}
+	}
+}
+
+func TestUpdateCheckerCachesAndNotifies(t *testing.T) {
+	t.Parallel()
+
+	var hooks []map[string]string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		hooks = append(hooks, body)
+	}))
+	defer hook.Close()
+
+	calls := 0
+	c := newUpdateChecker(hook.URL)
+	c.latest = func(ctx context.Context, repo string) (string, error) {
+		calls++
+		return "v0.3.0", nil
+	}
+	ctx := context.Background()
+
+	res := c.check(ctx, "o/r", "stable", "v0.2.0")
+	if !res.Available || res.Latest != "v0.3.0" || res.Error != "" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	c.check(ctx, "o/r", "stable", "v0.2.0")
+	if calls != 1 {
+		t.Fatalf("expected cached result within TTL, got %d lookups", calls)
+	}
+	if got := c.cached(); got.Latest != "v0.3.0" {
+		t.Fatalf("cached: %+v", got)
+	}
+	if len(hooks) != 1 || hooks[0]["latest"] != "v0.3.0" || hooks[0]["current"] != "v0.2.0" || hooks[0]["event"] != "update_available" {
+		t.Fatalf("unexpected webhooks: %+v", hooks)
+	}
+
+	// Another repo is looked up again, but the same tag is not announced twice.
+	c.check(ctx, "o/other", "stable", "v0.2.0")
+	if calls != 2 || len(hooks) != 1 {
+		t.Fatalf("calls=%d hooks=%d", calls, len(hooks))
+	}
+
+	if res := c.check(ctx, "o/r", "dev", "dev"); res.Available || res.Latest != "" {
+		t.Fatalf("dev builds must not be checked: %+v", res)
+	}
+	if calls != 2 {
+		t.Fatalf("dev channel queried GitHub")
+	}
+}
+
+func TestUpdateCheckerError(t *testing.T) {
+	t.Parallel()
+	c := newUpdateChecker("")
+	c.latest = func(ctx context.Context, repo string) (string, error) {
+		return "", errors.New("rate limited")
+	}
+	res := c.check(context.Background(), "o/r", "stable", "v0.1.0")
+	if res.Available || res.Error != "rate limited" || res.CheckedAt.IsZero() {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
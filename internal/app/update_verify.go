@@ -0,0 +1,260 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A self-update is verified by a watchdog started from the backup of the running
+// binary in its own transient systemd unit, so it survives the service restart. It
+// waits for the old process to exit, then requires the new one to answer /healthz for
+// a while; otherwise it reinstalls the backup and restarts the service again.
+
+// HandleHealthz reports that the server is up. It needs no session, so service
+// managers and the update watchdog can use it.
+func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = io.WriteString(w, "ok\n")
+}
+
+// updateResult is what the watchdog leaves in Config.UpdateStatusPath for the next
+// process to show in /api/admin/update.
+type updateResult struct {
+	Tag        string    `json:"tag"`
+	At         time.Time `json:"at"`
+	Error      string    `json:"error,omitempty"`
+	RolledBack bool      `json:"rolled_back,omitempty"`
+}
+
+func readUpdateResult(path string) (updateResult, bool) {
+	var res updateResult
+	if path == "" {
+		return res, false
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return res, false
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		slog.Warn("update: bad status file", "path", path, "err", err)
+		return res, false
+	}
+	return res, true
+}
+
+func writeUpdateResult(path string, res updateResult) error {
+	if path == "" {
+		return nil
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// healthURL returns the loopback URL of /healthz for a server listening on listen.
+func healthURL(listen, path string) (string, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", err
+	}
+	switch ip := net.ParseIP(host); {
+	case host == "" || (ip != nil && ip.Equal(net.IPv4zero)):
+		host = "127.0.0.1"
+	case ip != nil && ip.Equal(net.IPv6unspecified):
+		host = "::1"
+	}
+	return "https://" + net.JoinHostPort(host, port) + path, nil
+}
+
+// startUpdateWatchdog launches the post-restart health check for tag. It returns
+// false without error when the service is not managed by systemd, in which case the
+// update is not verified (the restart would not happen either).
+func (s *Server) startUpdateWatchdog(ctx context.Context, exe, backup, tag string) (bool, error) {
+	if strings.TrimSpace(s.cfg.ServiceName) == "" {
+		return false, nil
+	}
+	unit, err := serviceUnit(s.cfg.ServiceName)
+	if err != nil {
+		return false, err
+	}
+	systemctl, err := exec.LookPath("systemctl")
+	if err != nil {
+		return false, nil
+	}
+	if _, err := exec.LookPath("systemd-run"); err != nil {
+		return false, nil
+	}
+	if active, _ := systemctlBool(ctx, systemctl, "is-active", unit); !active {
+		return false, nil
+	}
+	url, err := healthURL(s.cfg.ListenAddr, s.path("/healthz"))
+	if err != nil {
+		return false, err
+	}
+	args := []string{
+		"--unit", fmt.Sprintf("atlas-update-verify-%d", time.Now().Unix()),
+		"--collect", "--quiet",
+		backup, "update-verify",
+		"-exe", exe,
+		"-backup", backup,
+		"-service", unit,
+		"-url", url,
+		"-pid", strconv.Itoa(os.Getpid()),
+		"-tag", tag,
+	}
+	if s.cfg.UpdateStatusPath != "" {
+		args = append(args, "-status", s.cfg.UpdateStatusPath)
+	}
+	if err := s.runRoot(ctx, "systemd-run", args...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RunUpdateVerify is the "update-verify" subcommand run by the watchdog unit.
+func RunUpdateVerify(args []string) int {
+	fs := flag.NewFlagSet("update-verify", flag.ContinueOnError)
+	exe := fs.String("exe", "", "installed binary")
+	backup := fs.String("backup", "", "binary to roll back to")
+	service := fs.String("service", "", "systemd unit")
+	url := fs.String("url", "", "health check URL")
+	pid := fs.Int("pid", 0, "pid of the process being replaced")
+	tag := fs.String("tag", "", "release being installed")
+	status := fs.String("status", "", "file to record the result in")
+	timeout := fs.Duration("timeout", 2*time.Minute, "time for the new version to become healthy")
+	stable := fs.Duration("stable", 15*time.Second, "how long it must stay healthy")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !filepath.IsAbs(*exe) || !filepath.IsAbs(*backup) || *service == "" || *url == "" {
+		fmt.Fprintln(os.Stderr, "update-verify: -exe, -backup, -service and -url are required")
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	res := updateResult{Tag: *tag}
+	if err := waitForExit(ctx, *pid); err != nil {
+		// The old process is still running, so the new binary was never started.
+		res.Error = "service was not restarted; the update takes effect on the next restart"
+	} else if err := waitHealthy(ctx, *url, *stable, 2*time.Second); err != nil {
+		fmt.Fprintf(os.Stderr, "update-verify: %s is unhealthy (%v); rolling back\n", *tag, err)
+		res.Error = fmt.Sprintf("%s did not become healthy: %v", *tag, err)
+		if err := rollbackUpdate(*backup, *exe, *service); err != nil {
+			res.Error += "; rollback failed: " + err.Error()
+		} else {
+			res.RolledBack = true
+		}
+	}
+	res.At = time.Now()
+	if werr := writeUpdateResult(*status, res); werr != nil {
+		fmt.Fprintf(os.Stderr, "update-verify: %v\n", werr)
+	}
+	if res.Error != "" {
+		fmt.Fprintf(os.Stderr, "update-verify: %s\n", res.Error)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "update-verify: %s is healthy\n", *tag)
+	return 0
+}
+
+// waitForExit waits until process pid is gone.
+func waitForExit(ctx context.Context, pid int) error {
+	if pid <= 0 {
+		return nil
+	}
+	for {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// waitHealthy polls url every interval until it has answered 200 continuously for
+// stable. A failed probe (e.g. a crash-looping service) restarts the count.
+func waitHealthy(ctx context.Context, url string, stable, interval time.Duration) error {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		// The probe goes to loopback, where the certificate's names rarely match.
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	var since time.Time
+	lastErr := errors.New("no response")
+	for {
+		if err := probeHealth(ctx, client, url); err != nil {
+			since, lastErr = time.Time{}, err
+		} else if since.IsZero() {
+			since = time.Now()
+		} else if time.Since(since) >= stable {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if !since.IsZero() {
+				return fmt.Errorf("healthy for only %s", time.Since(since).Round(time.Second))
+			}
+			return lastErr
+		case <-time.After(interval):
+		}
+	}
+}
+
+func probeHealth(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check: %s", resp.Status)
+	}
+	return nil
+}
+
+func rollbackUpdate(backup, exe, service string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, "install", "-m", "0755", backup, exe).CombinedOutput(); err != nil {
+		return fmt.Errorf("install: %s", strings.TrimSpace(string(out)))
+	}
+	if out, err := exec.CommandContext(ctx, "systemctl", "restart", service).CombinedOutput(); err != nil {
+		return fmt.Errorf("systemctl restart: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
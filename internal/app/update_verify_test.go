@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthURL(t *testing.T) {
+	t.Parallel()
+	cases := map[string]string{
+		"127.0.0.1:8443": "https://127.0.0.1:8443/x/healthz",
+		"0.0.0.0:8443":   "https://127.0.0.1:8443/x/healthz",
+		":8443":          "https://127.0.0.1:8443/x/healthz",
+		"[::]:8443":      "https://[::1]:8443/x/healthz",
+		"10.0.0.5:8443":  "https://10.0.0.5:8443/x/healthz",
+	}
+	for listen, want := range cases {
+		got, err := healthURL(listen, "/x/healthz")
+		if err != nil || got != want {
+			t.Errorf("healthURL(%q) = %q, %v; want %q", listen, got, err, want)
+		}
+	}
+	if _, err := healthURL("nope", "/healthz"); err == nil {
+		t.Fatal("expected error for address without port")
+	}
+}
+
+func TestHealthzNeedsNoSession(t *testing.T) {
+	t.Parallel()
+	srv, err := New(Config{
+		RootDir:   "/",
+		BasePath:  "/base",
+		AuthStore: &testStore{passByUser: map[string]string{}},
+		Secret:    []byte("0123456789abcdef0123456789abcdef"),
+		FWDBPath:  filepath.Join(t.TempDir(), "fw.db"),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/base/healthz", nil))
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "ok" {
+		t.Fatalf("healthz: %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestWaitHealthy(t *testing.T) {
+	t.Parallel()
+
+	// Fails twice (a restarting service), then stays up.
+	var n atomic.Int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) <= 2 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := waitHealthy(ctx, ts.URL, 50*time.Millisecond, 10*time.Millisecond); err != nil {
+		t.Fatalf("waitHealthy: %v", err)
+	}
+
+	down := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := waitHealthy(ctx, down.URL, 50*time.Millisecond, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("expected unhealthy error, got %v", err)
+	}
+}
+
+func TestUpdateResultRoundTrip(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "atlas.update.json")
+	if _, ok := readUpdateResult(path); ok {
+		t.Fatal("missing file must not yield a result")
+	}
+	want := updateResult{Tag: "v1.2.3", At: time.Unix(1700000000, 0).UTC(), Error: "v1.2.3 did not become healthy", RolledBack: true}
+	if err := writeUpdateResult(path, want); err != nil {
+		t.Fatalf("writeUpdateResult: %v", err)
+	}
+	got, ok := readUpdateResult(path)
+	if !ok || got.Tag != want.Tag || !got.At.Equal(want.At) || got.Error != want.Error || !got.RolledBack {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -17,19 +17,39 @@ import (
 )
 
 type Config struct {
-	Store        Store
-	Secret       []byte
-	CookieSecure bool
-	BasePath     string
+	Store Store
+	// Authenticator replaces Store for password checks (nil: the local user DB).
+	Authenticator Authenticator
+	Secret        []byte
+	CookieSecure  bool
+	BasePath      string
+	// CookieName defaults to DefaultCookieName(BasePath).
+	CookieName string
+	// SameSite is "strict" (default), "lax" or "none"; "none" forces Secure cookies.
+	SameSite string
+	// RememberFor is the session lifetime when "remember me" is checked at login
+	// (0 hides the checkbox). Other sessions last sessionTTL.
+	RememberFor time.Duration
+	// OnLogout is called with the session user when a user logs out.
+	OnLogout func(user string)
+	// Maintenance reports whether the panel is in read-only maintenance mode (shown in /api/me).
+	Maintenance func() bool
+	// BrandName replaces "Atlas" on the login page; BrandLogo is an optional logo URL
+	// relative to the login page.
+	BrandName string
+	BrandLogo string
 }
 
 type Auth struct {
-	cfg      Config
-	basePath string
+	cfg        Config
+	basePath   string
+	cookieName string
+	sameSite   http.SameSite
+	secure     bool
 }
 
 type Store interface {
-	Authenticate(user, pass string) (bool, error)
+	Authenticator
 	HasAnyUsers() bool
 	GetUser(user string) (UserInfo, bool, error)
 }
@@ -40,9 +60,20 @@ type UserInfo struct {
 	CanExec  bool
 	CanProcs bool
 	CanFW    bool
-	FSSudo   bool
-	FSAny    bool
-	FSUsers  []string
+	// FWReadOnly limits CanFW to viewing: status, rules and port usage, but no changes.
+	FWReadOnly bool
+	FSSudo     bool
+	FSAny      bool
+	FSUsers    []string
+	// TimeZone is the user's display zone (IANA name, empty for UTC).
+	TimeZone string
+	// MustChangePassword restricts the user to changing their password until they do.
+	MustChangePassword bool
+}
+
+// CanEditFW reports whether the user may change the firewall, not just view it.
+func (u UserInfo) CanEditFW() bool {
+	return u.CanFW && !u.FWReadOnly
 }
 
 type Claims struct {
@@ -61,20 +92,117 @@ func ClaimsFromContext(ctx context.Context) (Claims, bool) {
 	return c, ok
 }
 
+type sudoPassKey struct{}
+
+// SudoPassHeader carries a one-time sudo password for a single request.
+const SudoPassHeader = "X-Atlas-Sudo-Pass"
+
+// WithSudoPassword stores a one-time sudo password (from SudoPassHeader) in ctx.
+func WithSudoPassword(ctx context.Context, pass string) context.Context {
+	return context.WithValue(ctx, sudoPassKey{}, pass)
+}
+
+// SudoPasswordFromContext returns the one-time sudo password of the request.
+// It is only honored for admins, matching the stored sudo password policy.
+func SudoPasswordFromContext(ctx context.Context) (string, bool) {
+	pass, _ := ctx.Value(sudoPassKey{}).(string)
+	if pass == "" {
+		return "", false
+	}
+	c, ok := ClaimsFromContext(ctx)
+	if !ok || strings.ToLower(strings.TrimSpace(c.Role)) != "admin" {
+		return "", false
+	}
+	return pass, true
+}
+
+// LocationFromContext returns the display time zone of the request's user (UTC by default).
+// Stored and epoch times stay UTC; this is only for human-facing renderings.
+func LocationFromContext(ctx context.Context) *time.Location {
+	c, ok := ClaimsFromContext(ctx)
+	if !ok || c.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// FormatLocal renders t in the request user's time zone (RFC 3339, with offset).
+func FormatLocal(ctx context.Context, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(LocationFromContext(ctx)).Format(time.RFC3339)
+}
+
 type session struct {
 	User string `json:"u"`
 	Exp  int64  `json:"e"`
 	CSRF string `json:"c"`
 }
 
-const cookieName = "atlas_session"
+const defaultCookieName = "atlas_session"
+
+// sessionTTL is the lifetime of a session without "remember me".
+const sessionTTL = 24 * time.Hour
+
+// DefaultCookieName returns the session cookie name for a base path, so instances served
+// under different prefixes on one host don't overwrite each other's sessions.
+func DefaultCookieName(basePath string) string {
+	p := normalizeBasePath(basePath)
+	if p == "/" {
+		return defaultCookieName
+	}
+	var b strings.Builder
+	for _, r := range strings.TrimPrefix(p, "/") {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return defaultCookieName + "_" + b.String()
+}
+
+// ParseSameSite maps a config value to http.SameSite; "" means strict.
+func ParseSameSite(v string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, errors.New("samesite must be strict, lax or none")
+	}
+}
 
 func New(cfg Config) *Auth {
 	a := &Auth{cfg: cfg}
 	a.basePath = normalizeBasePath(cfg.BasePath)
+	a.cookieName = strings.TrimSpace(cfg.CookieName)
+	if a.cookieName == "" {
+		a.cookieName = DefaultCookieName(a.basePath)
+	}
+	sameSite, err := ParseSameSite(cfg.SameSite)
+	if err != nil {
+		sameSite = http.SameSiteStrictMode
+	}
+	a.sameSite = sameSite
+	a.secure = cfg.CookieSecure || sameSite == http.SameSiteNoneMode
+	if strings.TrimSpace(a.cfg.BrandName) == "" {
+		a.cfg.BrandName = "Atlas"
+	}
 	return a
 }
 
+// SecureCookies reports whether session cookies carry the Secure flag.
+func (a *Auth) SecureCookies() bool { return a.secure }
+
 func (a *Auth) IsAuthenticated(r *http.Request) bool {
 	sess, err := a.readSession(r)
 	return err == nil && sess.Exp > time.Now().Unix()
@@ -134,19 +262,29 @@ func (a *Auth) HandleMe(w http.ResponseWriter, r *http.Request) {
 			resp["can_exec"] = info.CanExec
 			resp["can_procs"] = info.CanProcs
 			resp["can_firewall"] = info.CanFW
+			resp["can_firewall_edit"] = info.CanEditFW()
 			resp["fs_sudo"] = info.FSSudo
+			tz := info.TimeZone
+			if tz == "" {
+				tz = "UTC"
+			}
+			resp["time_zone"] = tz
+			resp["must_change_password"] = info.MustChangePassword
 		}
 	}
+	if a.cfg.Maintenance != nil {
+		resp["maintenance"] = a.cfg.Maintenance()
+	}
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
 func (a *Auth) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	lang := loginLang(r)
-	i18n := loginI18n(lang)
+	i18n := loginI18n(lang, a.cfg.BrandName)
 
 	switch r.Method {
 	case http.MethodGet:
-		a.writeLoginPage(w, http.StatusOK, loginPageData{Lang: lang, T: i18n})
+		a.writeLoginPage(w, http.StatusOK, loginPageData{Lang: lang, Logo: a.cfg.BrandLogo, T: i18n, RememberOn: a.cfg.RememberFor > 0})
 		return
 	case http.MethodPost:
 	default:
@@ -159,16 +297,17 @@ func (a *Auth) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		if lang == "ru" {
 			msg = "некорректная форма"
 		}
-		a.writeLoginPage(w, http.StatusBadRequest, loginPageData{Lang: lang, T: i18n, Error: msg})
+		a.writeLoginPage(w, http.StatusBadRequest, loginPageData{Lang: lang, Logo: a.cfg.BrandLogo, T: i18n, Error: msg, RememberOn: a.cfg.RememberFor > 0})
 		return
 	}
 	user := r.Form.Get("user")
 	pass := r.Form.Get("pass")
+	remember := a.cfg.RememberFor > 0 && r.Form.Get("remember") != ""
 	if a.cfg.Store == nil {
 		http.Error(w, "auth store is not configured", http.StatusInternalServerError)
 		return
 	}
-	ok, err := a.cfg.Store.Authenticate(user, pass)
+	ok, err := CheckPassword(a.cfg.Store, a.cfg.Authenticator, user, pass)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -178,7 +317,7 @@ func (a *Auth) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		if lang == "ru" {
 			msg = "неверные учётные данные"
 		}
-		a.writeLoginPage(w, http.StatusUnauthorized, loginPageData{Lang: lang, T: i18n, Error: msg, User: user})
+		a.writeLoginPage(w, http.StatusUnauthorized, loginPageData{Lang: lang, Logo: a.cfg.BrandLogo, T: i18n, Error: msg, User: user, RememberOn: a.cfg.RememberFor > 0, Remember: remember})
 		return
 	}
 
@@ -188,9 +327,13 @@ func (a *Auth) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ttl := sessionTTL
+	if remember {
+		ttl = a.cfg.RememberFor
+	}
 	sess := session{
 		User: user,
-		Exp:  time.Now().Add(24 * time.Hour).Unix(),
+		Exp:  time.Now().Add(ttl).Unix(),
 		CSRF: csrf,
 	}
 	value, err := a.seal(sess)
@@ -200,12 +343,12 @@ func (a *Auth) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	http.SetCookie(w, &http.Cookie{
-		Name:     cookieName,
+		Name:     a.cookieName,
 		Value:    value,
 		Path:     a.basePath,
 		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-		Secure:   a.cfg.CookieSecure,
+		SameSite: a.sameSite,
+		Secure:   a.secure,
 		Expires:  time.Unix(sess.Exp, 0),
 	})
 	http.Redirect(w, r, a.path("/"), http.StatusFound)
@@ -215,7 +358,11 @@ type loginPageData struct {
 	Lang  string
 	Error string
 	User  string
+	Logo  string
 	T     loginPageI18n
+	// RememberOn shows the "remember me" checkbox; Remember keeps it checked after an error.
+	RememberOn bool
+	Remember   bool
 }
 
 type loginPageI18n struct {
@@ -223,6 +370,7 @@ type loginPageI18n struct {
 	Heading   string
 	UserLabel string
 	PassLabel string
+	Remember  string
 	Submit    string
 	Hint      string
 }
@@ -241,22 +389,24 @@ func loginLang(r *http.Request) string {
 	return "en"
 }
 
-func loginI18n(lang string) loginPageI18n {
+func loginI18n(lang, brand string) loginPageI18n {
 	if lang == "ru" {
 		return loginPageI18n{
-			Title:     "Atlas — Вход",
-			Heading:   "Atlas",
+			Title:     brand + " — Вход",
+			Heading:   brand,
 			UserLabel: "Пользователь",
 			PassLabel: "Пароль",
+			Remember:  "Запомнить меня",
 			Submit:    "Войти",
 			Hint:      "Учётные данные хранятся в зашифрованной базе пользователей.",
 		}
 	}
 	return loginPageI18n{
-		Title:     "Atlas — Login",
-		Heading:   "Atlas",
+		Title:     brand + " — Login",
+		Heading:   brand,
 		UserLabel: "User",
 		PassLabel: "Password",
+		Remember:  "Remember me",
 		Submit:    "Sign in",
 		Hint:      "Credentials are stored in the encrypted user database.",
 	}
@@ -271,13 +421,18 @@ func (a *Auth) writeLoginPage(w http.ResponseWriter, status int, data loginPageD
 }
 
 func (a *Auth) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if a.cfg.OnLogout != nil {
+		if sess, err := a.readSession(r); err == nil && sess.User != "" {
+			a.cfg.OnLogout(sess.User)
+		}
+	}
 	http.SetCookie(w, &http.Cookie{
-		Name:     cookieName,
+		Name:     a.cookieName,
 		Value:    "",
 		Path:     a.basePath,
 		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-		Secure:   a.cfg.CookieSecure,
+		SameSite: a.sameSite,
+		Secure:   a.secure,
 		Expires:  time.Unix(0, 0),
 		MaxAge:   -1,
 	})
@@ -285,7 +440,7 @@ func (a *Auth) HandleLogout(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *Auth) readSession(r *http.Request) (session, error) {
-	c, err := r.Cookie(cookieName)
+	c, err := r.Cookie(a.cookieName)
 	if err != nil {
 		return session{}, err
 	}
@@ -378,8 +533,11 @@ const loginHTML = `<!doctype html>
     body{font-family:system-ui,-apple-system,Segoe UI,Roboto,Ubuntu; background:#0b1220; color:#e7eefc; display:flex; min-height:100vh; align-items:center; justify-content:center;}
     .card{background:#101a30; border:1px solid #223155; border-radius:14px; padding:18px; width:min(420px,92vw);}
     h1{font-size:18px; margin:0 0 12px;}
+    .logo{display:block; max-width:100%; max-height:64px; margin:0 0 12px;}
     label{display:block; font-size:12px; color:#b7c3dc; margin:10px 0 6px;}
     input{display:block; width:100%; margin:0; padding:10px 12px; height:42px; border-radius:10px; border:1px solid #2a3b63; background:#0b1220; color:#e7eefc; font:inherit; font-size:14px; line-height:20px; appearance:none; -webkit-appearance:none;}
+    .remember{display:flex; align-items:center; gap:8px; margin:12px 0 0; font-size:13px; color:#b7c3dc;}
+    .remember input{display:inline-block; width:auto; height:auto; margin:0; appearance:auto; -webkit-appearance:auto;}
     button{margin-top:14px; width:100%; padding:10px 12px; border:0; border-radius:10px; background:#4f7cff; color:white; font-weight:600; cursor:pointer;}
     .hint{margin-top:10px; font-size:12px; color:#9fb0d1;}
     .err{margin:10px 0 0; padding:10px 12px; border-radius:10px; border:1px solid #5a2030; background:#2a1120; color:#ffb6c1; font-size:13px;}
@@ -387,12 +545,14 @@ const loginHTML = `<!doctype html>
 </head>
 <body>
   <form class="card" method="post" action="">
+    {{if .Logo}}<img class="logo" src="{{.Logo}}" alt=""/>{{end}}
     <h1>{{.T.Heading}}</h1>
     {{if .Error}}<div class="err">{{.Error}}</div>{{end}}
     <label for="user">{{.T.UserLabel}}</label>
     <input id="user" name="user" autocomplete="username" value="{{.User}}" />
     <label for="pass">{{.T.PassLabel}}</label>
     <input id="pass" name="pass" type="password" autocomplete="current-password" />
+    {{if .RememberOn}}<label class="remember"><input type="checkbox" name="remember" value="1"{{if .Remember}} checked{{end}}/> {{.T.Remember}}</label>{{end}}
     <button type="submit">{{.T.Submit}}</button>
     <div class="hint">{{.T.Hint}}</div>
   </form>
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -92,7 +93,7 @@ func TestLoginValidSetsCookieAndRedirectsWithBasePath(t *testing.T) {
 		t.Fatalf("expected redirect /x/, got %q", loc)
 	}
 	setCookie := rr.Header().Get("Set-Cookie")
-	if !strings.Contains(setCookie, "atlas_session=") {
+	if !strings.Contains(setCookie, "atlas_session_x=") {
 		t.Fatalf("expected session cookie, got %q", setCookie)
 	}
 	if !strings.Contains(setCookie, "Path=/x") {
@@ -121,7 +122,7 @@ func TestLogoutClearsCookieAndRedirectsWithBasePath(t *testing.T) {
 		t.Fatalf("expected redirect /x/login, got %q", loc)
 	}
 	setCookie := rr.Header().Get("Set-Cookie")
-	if !strings.Contains(setCookie, "atlas_session=") || !(strings.Contains(setCookie, "Max-Age=0") || strings.Contains(setCookie, "Max-Age=-1")) {
+	if !strings.Contains(setCookie, "atlas_session_x=") || !(strings.Contains(setCookie, "Max-Age=0") || strings.Contains(setCookie, "Max-Age=-1")) {
 		t.Fatalf("expected cookie cleared, got %q", setCookie)
 	}
 	if !strings.Contains(setCookie, "Path=/x") {
@@ -161,3 +162,115 @@ func TestSealUnsealRoundtripAndTamper(t *testing.T) {
 		t.Fatalf("expected error for tampered signature")
 	}
 }
+
+func TestSudoPasswordFromContextAdminOnly(t *testing.T) {
+	t.Parallel()
+
+	ctx := WithSudoPassword(context.Background(), "pw")
+	if _, ok := SudoPasswordFromContext(ctx); ok {
+		t.Fatalf("expected no password without claims")
+	}
+	userCtx := WithClaims(ctx, Claims{UserInfo: UserInfo{User: "u", Role: "user"}})
+	if _, ok := SudoPasswordFromContext(userCtx); ok {
+		t.Fatalf("expected no password for non-admin")
+	}
+	adminCtx := WithClaims(ctx, Claims{UserInfo: UserInfo{User: "a", Role: "admin"}})
+	if pass, ok := SudoPasswordFromContext(adminCtx); !ok || pass != "pw" {
+		t.Fatalf("expected password for admin, got %q %v", pass, ok)
+	}
+}
+
+func TestCookieNameAndSameSite(t *testing.T) {
+	t.Parallel()
+
+	if got := DefaultCookieName("/"); got != "atlas_session" {
+		t.Fatalf("root cookie name: %q", got)
+	}
+	if got := DefaultCookieName("/a.b/c"); got != "atlas_session_a_b_c" {
+		t.Fatalf("derived cookie name: %q", got)
+	}
+	if _, err := ParseSameSite("bogus"); err == nil {
+		t.Fatalf("expected error for bad samesite")
+	}
+
+	a := New(Config{
+		Store:      &testStore{passByUser: map[string]string{"admin": "ok"}},
+		Secret:     []byte("0123456789abcdef"),
+		BasePath:   "/x",
+		CookieName: "panel",
+		SameSite:   "none",
+	})
+	form := url.Values{}
+	form.Set("user", "admin")
+	form.Set("pass", "ok")
+	req := httptest.NewRequest(http.MethodPost, "http://example/x/login", strings.NewReader(form.Encode()))
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	a.HandleLogin(rr, req)
+
+	setCookie := rr.Header().Get("Set-Cookie")
+	if !strings.HasPrefix(setCookie, "panel=") || !strings.Contains(setCookie, "SameSite=None") || !strings.Contains(setCookie, "Secure") {
+		t.Fatalf("unexpected cookie: %q", setCookie)
+	}
+	req = httptest.NewRequest(http.MethodGet, "http://example/x/", nil)
+	req.Header.Set("Cookie", strings.Split(setCookie, ";")[0])
+	if !a.IsAuthenticated(req) {
+		t.Fatalf("expected session to be read from custom cookie")
+	}
+}
+
+func TestLoginRememberMe(t *testing.T) {
+	t.Parallel()
+
+	a := New(Config{
+		Store:       &testStore{passByUser: map[string]string{"admin": "ok"}},
+		Secret:      []byte("0123456789abcdef"),
+		RememberFor: 30 * 24 * time.Hour,
+	})
+
+	login := func(remember bool) *http.Cookie {
+		form := url.Values{"user": {"admin"}, "pass": {"ok"}}
+		if remember {
+			form.Set("remember", "1")
+		}
+		req := httptest.NewRequest(http.MethodPost, "http://example/login", strings.NewReader(form.Encode()))
+		req.Header.Set("content-type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		a.HandleLogin(rr, req)
+		cookies := rr.Result().Cookies()
+		if rr.Code != http.StatusFound || len(cookies) != 1 {
+			t.Fatalf("login: status=%d cookies=%v", rr.Code, cookies)
+		}
+		return cookies[0]
+	}
+	sessionExp := func(c *http.Cookie) time.Time {
+		sess, err := a.unseal(c.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Unix(sess.Exp, 0)
+	}
+
+	short := login(false)
+	if d := time.Until(sessionExp(short)); d > 25*time.Hour || d < 23*time.Hour {
+		t.Fatalf("default session should last 24h, got %v", d)
+	}
+	long := login(true)
+	if d := time.Until(sessionExp(long)); d < 29*24*time.Hour {
+		t.Fatalf("remembered session should last 30 days, got %v", d)
+	}
+	if !long.Expires.Equal(sessionExp(long)) {
+		t.Fatalf("cookie expiry %v does not match session expiry %v", long.Expires, sessionExp(long))
+	}
+
+	rr := httptest.NewRecorder()
+	a.HandleLogin(rr, httptest.NewRequest(http.MethodGet, "http://example/login", nil))
+	if !strings.Contains(rr.Body.String(), `name="remember"`) {
+		t.Fatalf("login form is missing the remember-me checkbox")
+	}
+	rr = httptest.NewRecorder()
+	New(Config{Store: &testStore{}, Secret: []byte("0123456789abcdef")}).HandleLogin(rr, httptest.NewRequest(http.MethodGet, "http://example/login", nil))
+	if strings.Contains(rr.Body.String(), `name="remember"`) {
+		t.Fatalf("remember-me checkbox shown although it is disabled")
+	}
+}
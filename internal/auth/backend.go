@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Authenticator verifies a user's password. Store implements it with the local user DB;
+// an external backend (PAM, LDAP, ...) can be plugged in through Config.Authenticator,
+// in which case permissions still come from the Store record of the same name.
+type Authenticator interface {
+	Authenticate(user, pass string) (bool, error)
+}
+
+// CheckPassword authenticates user against authn, or against store when authn is nil.
+// With an external authenticator the user must also exist in store, since that is where
+// the role and permissions live.
+func CheckPassword(store Store, authn Authenticator, user, pass string) (bool, error) {
+	if authn == nil {
+		return store.Authenticate(user, pass)
+	}
+	user = strings.TrimSpace(user)
+	if user == "" || pass == "" {
+		return false, nil
+	}
+	if _, ok, err := store.GetUser(user); err != nil || !ok {
+		return false, err
+	}
+	return authn.Authenticate(user, pass)
+}
+
+// CommandAuthenticator checks passwords with an external program in the style of pwauth
+// or checkpassword helpers: the user name and password are written to its stdin on two
+// lines, and exit status 0 means the credentials are valid. This is the usual way to
+// reach PAM or an LDAP bind without linking either into Atlas.
+type CommandAuthenticator struct {
+	Argv    []string
+	Timeout time.Duration
+}
+
+// NewCommandAuthenticator validates argv (an absolute program path and its arguments).
+func NewCommandAuthenticator(argv []string) (*CommandAuthenticator, error) {
+	if len(argv) == 0 || !filepath.IsAbs(argv[0]) {
+		return nil, errors.New("auth command must start with an absolute program path")
+	}
+	return &CommandAuthenticator{Argv: append([]string{}, argv...), Timeout: 10 * time.Second}, nil
+}
+
+func (c *CommandAuthenticator) Authenticate(user, pass string) (bool, error) {
+	if strings.ContainsAny(user, "\r\n") || strings.ContainsAny(pass, "\r\n") {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.Argv[0], c.Argv[1:]...)
+	cmd.Stdin = strings.NewReader(user + "\n" + pass + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return false, nil
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return false, errors.New("auth command: " + msg)
+	}
+	return false, err
+}
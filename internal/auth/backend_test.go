@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCommandAuthenticatorBackend(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	// Accepts "alice" / "ldap-secret" only, like an external PAM or LDAP helper would.
+	script := filepath.Join(t.TempDir(), "check.sh")
+	body := "#!/bin/sh\nread user\nread pass\n[ \"$user\" = alice ] && [ \"$pass\" = ldap-secret ]\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCommandAuthenticator([]string{"check.sh"}); err == nil {
+		t.Fatalf("expected a relative program path to be rejected")
+	}
+	authn, err := NewCommandAuthenticator([]string{script})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bob passes the external check in neither case; carol has no local record.
+	store := &testStore{passByUser: map[string]string{"alice": "local-pass", "bob": "x"}}
+	cases := []struct {
+		user, pass string
+		want       bool
+	}{
+		{"alice", "ldap-secret", true},
+		{"alice", "local-pass", false},
+		{"alice", "ldap-secret\nx", false},
+		{"carol", "ldap-secret", false},
+		{"", "ldap-secret", false},
+	}
+	for _, c := range cases {
+		ok, err := CheckPassword(store, authn, c.user, c.pass)
+		if err != nil || ok != c.want {
+			t.Fatalf("CheckPassword(%q, %q)=%v, %v; want %v", c.user, c.pass, ok, err, c.want)
+		}
+	}
+	if ok, _ := CheckPassword(store, nil, "alice", "local-pass"); !ok {
+		t.Fatalf("without an authenticator the store must check the password")
+	}
+
+	a := New(Config{Store: store, Authenticator: authn, Secret: []byte("0123456789abcdef"), BasePath: "/x"})
+	form := url.Values{"user": {"alice"}, "pass": {"ldap-secret"}}
+	req := httptest.NewRequest(http.MethodPost, "http://example/x/login", strings.NewReader(form.Encode()))
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	a.HandleLogin(rr, req)
+	if rr.Code != http.StatusFound && rr.Code != http.StatusSeeOther {
+		t.Fatalf("login via external backend: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+}
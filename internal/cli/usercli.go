@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"strings"
@@ -14,9 +16,10 @@ import (
 
 // RunUserCLI implements:
 // atlas user add|del|passwd|set|list -config atlas.json -user ... [-pass ...]
+// atlas user export|import -config atlas.json [-file users.json]
 func RunUserCLI(configPath string, args []string) (int, error) {
 	if len(args) == 0 {
-		return 2, errors.New("missing user subcommand (add|del|passwd|set|list)")
+		return 2, errors.New("missing user subcommand (add|del|passwd|set|list|export|import)")
 	}
 	sub := args[0]
 	fs := flag.NewFlagSet("user "+sub, flag.ContinueOnError)
@@ -28,18 +31,22 @@ func RunUserCLI(configPath string, args []string) (int, error) {
 	var execStr string
 	var procsStr string
 	var fwStr string
+	var fwROStr string
 	var fsSudoStr string
 	var fsAnyStr string
 	var fsUsersStr string
+	var file string
 	fs.StringVar(&user, "user", "", "username")
 	fs.StringVar(&pass, "pass", "", "password")
 	fs.StringVar(&role, "role", "", "role (e.g. admin/user)")
 	fs.StringVar(&execStr, "exec", "", "allow exec: true/false")
 	fs.StringVar(&procsStr, "procs", "", "allow process signals: true/false")
 	fs.StringVar(&fwStr, "fw", "", "allow firewall: true/false")
+	fs.StringVar(&fwROStr, "fw-read-only", "", "firewall view only: true/false")
 	fs.StringVar(&fsSudoStr, "fs-sudo", "", "allow FS sudo: true/false")
 	fs.StringVar(&fsAnyStr, "fs-any", "", "allow any FS user: true/false")
 	fs.StringVar(&fsUsersStr, "fs-users", "", "allowed FS users (csv) or '*' (requires fs-any)")
+	fs.StringVar(&file, "file", "-", "export/import file ('-' for stdout/stdin)")
 	if err := fs.Parse(args[1:]); err != nil {
 		return 2, err
 	}
@@ -52,10 +59,15 @@ func RunUserCLI(configPath string, args []string) (int, error) {
 	if err != nil {
 		return 1, fmt.Errorf("master key: %w", err)
 	}
+	dbPerm, err := cfg.DBPerm()
+	if err != nil {
+		return 1, err
+	}
 	store, err := userdb.Open(cfg.UserDBPath, masterKey)
 	if err != nil {
 		return 1, fmt.Errorf("user db: %w", err)
 	}
+	store.SetFilePerm(dbPerm)
 
 	switch sub {
 	case "add":
@@ -68,7 +80,7 @@ func RunUserCLI(configPath string, args []string) (int, error) {
 		if err := store.UpsertUser(user, pass); err != nil {
 			return 1, err
 		}
-		if err := applyPerms(store, user, role, execStr, procsStr, fwStr, fsSudoStr, fsAnyStr, fsUsersStr); err != nil {
+		if err := applyPerms(store, user, role, execStr, procsStr, fwStr, fwROStr, fsSudoStr, fsAnyStr, fsUsersStr); err != nil {
 			return 1, err
 		}
 		fmt.Printf("ok: user %q added/updated\n", user)
@@ -91,7 +103,7 @@ func RunUserCLI(configPath string, args []string) (int, error) {
 		if strings.TrimSpace(user) == "" {
 			return 2, errors.New("-user is required")
 		}
-		if err := applyPerms(store, user, role, execStr, procsStr, fwStr, fsSudoStr, fsAnyStr, fsUsersStr); err != nil {
+		if err := applyPerms(store, user, role, execStr, procsStr, fwStr, fwROStr, fsSudoStr, fsAnyStr, fsUsersStr); err != nil {
 			return 1, err
 		}
 		fmt.Printf("ok: permissions updated for %q\n", user)
@@ -116,7 +128,51 @@ func RunUserCLI(configPath string, args []string) (int, error) {
 				fmt.Println(u)
 				continue
 			}
-			fmt.Printf("%s\trole=%s\texec=%t\tprocs=%t\tfw=%t\tfs_sudo=%t\tfs_any=%t\tfs_users=%s\n", info.User, info.Role, info.CanExec, info.CanProcs, info.CanFW, info.FSSudo, info.FSAny, strings.Join(info.FSUsers, ","))
+			fmt.Printf("%s\trole=%s\texec=%t\tprocs=%t\tfw=%t\tfw_read_only=%t\tfs_sudo=%t\tfs_any=%t\tfs_users=%s\n", info.User, info.Role, info.CanExec, info.CanProcs, info.CanFW, info.FWReadOnly, info.FSSudo, info.FSAny, strings.Join(info.FSUsers, ","))
+		}
+		return 0, nil
+
+	case "export":
+		exp, err := store.Export()
+		if err != nil {
+			return 1, err
+		}
+		b, err := json.MarshalIndent(exp, "", "  ")
+		if err != nil {
+			return 1, err
+		}
+		b = append(b, '\n')
+		if file == "" || file == "-" {
+			_, err = os.Stdout.Write(b)
+		} else {
+			err = os.WriteFile(file, b, 0o600)
+		}
+		if err != nil {
+			return 1, err
+		}
+		return 0, nil
+
+	case "import":
+		var b []byte
+		if file == "" || file == "-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return 1, err
+		}
+		var in userdb.ExportFile
+		if err := json.Unmarshal(b, &in); err != nil {
+			return 2, fmt.Errorf("parse %s: %w", file, err)
+		}
+		res, err := store.Import(in)
+		if err != nil {
+			return 1, err
+		}
+		fmt.Printf("ok: %d created, %d updated\n", len(res.Created), len(res.Updated))
+		for _, u := range res.ResetRequired {
+			fmt.Printf("reset required: %s (set a password with `atlas user passwd`)\n", u)
 		}
 		return 0, nil
 
@@ -125,7 +181,7 @@ func RunUserCLI(configPath string, args []string) (int, error) {
 	}
 }
 
-func applyPerms(store *userdb.Store, user, role, execStr, procsStr, fwStr, fsSudoStr, fsAnyStr, fsUsersStr string) error {
+func applyPerms(store *userdb.Store, user, role, execStr, procsStr, fwStr, fwROStr, fsSudoStr, fsAnyStr, fsUsersStr string) error {
 	info, ok, err := store.GetUser(user)
 	if err != nil {
 		return err
@@ -184,7 +240,15 @@ func applyPerms(store *userdb.Store, user, role, execStr, procsStr, fwStr, fsSud
 	if role == "" {
 		role = info.Role
 	}
-	return store.SetPermissions(user, role, canExec, canProcs, canFW, fsSudo, fsAny, fsUsers)
+	if err := store.SetPermissions(user, role, canExec, canProcs, canFW, fsSudo, fsAny, fsUsers); err != nil {
+		return err
+	}
+	if b, ok, err := parseOptBool(fwROStr); err != nil {
+		return err
+	} else if ok {
+		return store.SetFWReadOnly(user, b)
+	}
+	return nil
 }
 
 func parseOptBool(s string) (val bool, ok bool, _ error) {
@@ -77,6 +77,54 @@ func TestRunUserCLIFlow(t *testing.T) {
 	}
 }
 
+func TestRunUserCLIExportImport(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "atlas.json")
+	cfg := config.Config{
+		Listen:        "127.0.0.1:1",
+		Root:          "/",
+		MasterKeyFile: filepath.Join(dir, "atlas.master.key"),
+		UserDBPath:    filepath.Join(dir, "atlas.users.db"),
+		FWDBPath:      filepath.Join(dir, "atlas.firewall.db"),
+	}
+	b, _ := json.MarshalIndent(cfg, "", "  ")
+	if err := os.WriteFile(cfgPath, append(b, '\n'), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if code, err := RunUserCLI(cfgPath, []string{"add", "-user", "ops", "-pass", "pw", "-fw", "true"}); err != nil || code != 0 {
+		t.Fatalf("add: code=%d err=%v", code, err)
+	}
+	exportPath := filepath.Join(dir, "users.json")
+	if code, err := RunUserCLI(cfgPath, []string{"export", "-file", exportPath}); err != nil || code != 0 {
+		t.Fatalf("export: code=%d err=%v", code, err)
+	}
+	if code, err := RunUserCLI(cfgPath, []string{"del", "-user", "ops"}); err != nil || code != 0 {
+		t.Fatalf("del: code=%d err=%v", code, err)
+	}
+	if code, err := RunUserCLI(cfgPath, []string{"import", "-file", exportPath}); err != nil || code != 0 {
+		t.Fatalf("import: code=%d err=%v", code, err)
+	}
+
+	mk, err := config.EnsureMasterKeyFile(cfg.MasterKeyFile)
+	if err != nil {
+		t.Fatalf("EnsureMasterKeyFile: %v", err)
+	}
+	st, err := userdb.Open(cfg.UserDBPath, mk)
+	if err != nil {
+		t.Fatalf("Open userdb: %v", err)
+	}
+	info, ok, err := st.GetUser("ops")
+	if err != nil || !ok || !info.CanFW {
+		t.Fatalf("GetUser: ok=%v err=%v info=%#v", ok, err, info)
+	}
+	if ok, _ := st.Authenticate("ops", "pw"); ok {
+		t.Fatalf("re-imported user without password must require a reset")
+	}
+}
+
 func TestParseOptBool(t *testing.T) {
 	t.Parallel()
 
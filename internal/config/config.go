@@ -8,9 +8,14 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/MrTeeett/atlas/internal/dbfile"
 )
 
 type Config struct {
@@ -26,11 +31,73 @@ type Config struct {
 	TLSCertFile string `json:"tls_cert_file,omitempty"`
 	TLSKeyFile  string `json:"tls_key_file,omitempty"`
 
-	CookieSecure       bool   `json:"cookie_secure"`
-	EnableExec         bool   `json:"enable_exec"`
-	EnableFW           bool   `json:"enable_firewall"`
-	EnableAdminActions bool   `json:"enable_admin_actions"`
-	ServiceName        string `json:"service_name"`
+	// Parameters of the self-signed certificate generated when no TLS files are configured.
+	// TLSSelfSignedDays is its validity (default 365), TLSKeyType one of ecdsa-p256 (default),
+	// ecdsa-p384, rsa-2048 or rsa-4096, and TLSExtraSANs extra DNS names or IPs.
+	TLSSelfSignedDays int      `json:"tls_self_signed_days,omitempty"`
+	TLSKeyType        string   `json:"tls_key_type,omitempty"`
+	TLSExtraSANs      []string `json:"tls_extra_sans,omitempty"`
+
+	// HTTPRedirect starts a plain HTTP listener that 301-redirects every request to HTTPS.
+	HTTPRedirect bool `json:"http_redirect"`
+	// HTTPRedirectPort is the port of the redirect listener (default 80).
+	HTTPRedirectPort int `json:"http_redirect_port,omitempty"`
+
+	// HTTP server timeouts in seconds: reading request headers (default 5), reading the
+	// whole request (default 60), writing the response (default 90) and keeping an idle
+	// keep-alive connection (default 120). A negative value disables that timeout.
+	// Terminal streams and gRPC calls are exempt from the read and write timeouts.
+	HTTPReadHeaderTimeoutSeconds int `json:"http_read_header_timeout_seconds,omitempty"`
+	HTTPReadTimeoutSeconds       int `json:"http_read_timeout_seconds,omitempty"`
+	HTTPWriteTimeoutSeconds      int `json:"http_write_timeout_seconds,omitempty"`
+	HTTPIdleTimeoutSeconds       int `json:"http_idle_timeout_seconds,omitempty"`
+
+	// GRPCListen serves gRPC on its own address (e.g. "127.0.0.1:9090") instead of
+	// sharing the HTTPS listener. GRPCTLS enables TLS there with the HTTPS certificate;
+	// without it the listener is plaintext, which is only meant for private interfaces.
+	GRPCListen string `json:"grpc_listen,omitempty"`
+	GRPCTLS    bool   `json:"grpc_tls,omitempty"`
+
+	CookieSecure bool `json:"cookie_secure"`
+	// CookieName overrides the session cookie name (default derived from base_path).
+	CookieName string `json:"cookie_name,omitempty"`
+	// CookieSameSite is "strict" (default), "lax" or "none" (e.g. to embed Atlas in an iframe).
+	CookieSameSite string `json:"cookie_samesite,omitempty"`
+	// RememberMeDays is the session lifetime when "remember me" is checked at login
+	// (default 30; sessions otherwise last 24 hours).
+	RememberMeDays int `json:"remember_me_days,omitempty"`
+
+	// AuthBackend checks passwords: "userdb" (default) or "command", which runs AuthCommand
+	// (e.g. pwauth for PAM or an LDAP bind helper). Permissions always come from the user DB.
+	AuthBackend string   `json:"auth_backend,omitempty"`
+	AuthCommand []string `json:"auth_command,omitempty"`
+
+	EnableExec bool `json:"enable_exec"`
+	EnableFW   bool `json:"enable_firewall"`
+	// FWLockoutCheck makes firewall apply refuse rule sets that would block the
+	// caller's own connection to the panel.
+	FWLockoutCheck bool `json:"firewall_lockout_check,omitempty"`
+	// FWAutoImport copies the existing ufw/firewalld rules into Atlas when it has none
+	// (otherwise that only happens through POST /api/firewall/import-system).
+	FWAutoImport bool `json:"firewall_auto_import,omitempty"`
+	// FWNATPriority is the hook priority of the nft prerouting NAT chain (default -100,
+	// nft's dstnat; lower runs earlier, e.g. before Docker's DNAT).
+	FWNATPriority *int `json:"firewall_nat_priority,omitempty"`
+	// FWInstance names Atlas's nft tables, rule comments and persisted ruleset (default
+	// "atlas"), so several instances can manage one host without touching each other.
+	FWInstance string `json:"firewall_instance,omitempty"`
+	// FWMaxRules caps the number of firewall rules plus bans (default 1000).
+	FWMaxRules         int  `json:"firewall_max_rules,omitempty"`
+	EnableAdminActions bool `json:"enable_admin_actions"`
+	// RequireSecondApproval makes reboot, shutdown and uninstall wait until a different
+	// admin approves them.
+	RequireSecondApproval bool   `json:"require_second_approval,omitempty"`
+	ServiceName           string `json:"service_name"`
+
+	// AllowRoot lets Atlas run with euid 0, where sudo is bypassed and every file, exec
+	// and firewall operation runs as root. It defaults to true (a warning is logged);
+	// set it to false to refuse to start as root.
+	AllowRoot bool `json:"allow_root"`
 
 	// Daemonize detaches the process when started from a TTY (so it doesn't block the shell).
 	// It is ignored when stdout isn't a TTY (e.g. systemd).
@@ -42,14 +109,112 @@ type Config struct {
 	LogFile string `json:"log_file"`
 	// LogStdout mirrors logs to stdout (default false).
 	LogStdout bool `json:"log_stdout"`
+	// LogMaxSizeMB rotates log_file to log_file.1 once it reaches this size
+	// (default 10; negative disables rotation).
+	LogMaxSizeMB int `json:"log_max_size_mb,omitempty"`
+	// LogMaxFiles is how many rotated logs are kept (default 5).
+	LogMaxFiles int `json:"log_max_files,omitempty"`
+	// AccessLog logs every HTTP request (method, path, status, duration, client IP, user)
+	// at AccessLogLevel ("debug", "info" (default) or "warn"). AccessLogFormat is "kv"
+	// (default, key/value attributes) or "combined" (one Apache-style line).
+	AccessLog       bool   `json:"access_log,omitempty"`
+	AccessLogLevel  string `json:"access_log_level,omitempty"`
+	AccessLogFormat string `json:"access_log_format,omitempty"`
+	// TrustedProxies lists reverse proxies (IPs or CIDRs) whose X-Forwarded-For is
+	// believed when logging the client address.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
 
 	// UpdateRepo is a GitHub repository in form "owner/name".
 	UpdateRepo string `json:"update_repo"`
 	// UpdateChannel selects update source: "auto" (default), "stable", "dev".
 	UpdateChannel string `json:"update_channel"`
+	// UpdateCheckHours checks for a newer release every this many hours and shows it
+	// in Settings → Update (0, the default, disables it). Nothing is installed
+	// automatically. UpdateWebhook is an http(s) URL POSTed once per new release.
+	UpdateCheckHours int    `json:"update_check_hours,omitempty"`
+	UpdateWebhook    string `json:"update_webhook,omitempty"`
+
+	// BrandName replaces "Atlas" in the login page and UI header (default "Atlas").
+	BrandName string `json:"brand_name,omitempty"`
+	// BrandLogo is an optional image file shown on the login page and in the header.
+	BrandLogo string `json:"brand_logo,omitempty"`
+
+	// TerminalIdleTimeoutSeconds closes idle terminal sessions (default 1800).
+	TerminalIdleTimeoutSeconds int `json:"terminal_idle_timeout_seconds,omitempty"`
+	// TerminalMaxLifetimeSeconds closes sessions this long after creation (0: no cap).
+	TerminalMaxLifetimeSeconds int `json:"terminal_max_lifetime_seconds,omitempty"`
+	// TerminalMaxSessionsPerUser/TerminalMaxSessions cap concurrent PTYs
+	// (defaults 8 and 64; negative means unlimited).
+	TerminalMaxSessionsPerUser int `json:"terminal_max_sessions_per_user,omitempty"`
+	TerminalMaxSessions        int `json:"terminal_max_sessions,omitempty"`
+	// TerminalEnv is added to every PTY session's environment.
+	TerminalEnv map[string]string `json:"terminal_env,omitempty"`
+	// TerminalEnvBlocklist removes inherited variables ("NAME" or "PREFIX_*").
+	TerminalEnvBlocklist []string `json:"terminal_env_blocklist,omitempty"`
+	// TerminalCleanEnv starts sessions with only PATH, HOME, USER, LOGNAME, SHELL and LANG.
+	TerminalCleanEnv bool `json:"terminal_clean_env,omitempty"`
+	// TerminalStreamBuffer is the output queue depth per terminal client, in chunks (default
+	// 128, minimum 2 so a client that fell behind has room for the drop marker and output).
+	TerminalStreamBuffer int `json:"terminal_stream_buffer,omitempty"`
+	// TerminalStreamBlockMS is how long output waits for a slow client before dropping
+	// its output and showing a marker (default 200).
+	TerminalStreamBlockMS int `json:"terminal_stream_block_ms,omitempty"`
 
 	FSSudo  bool     `json:"fs_sudo"`
 	FSUsers []string `json:"fs_users"`
+	// FSSelfName is shown for Atlas's own identity when its uid is not in /etc/passwd
+	// (e.g. in a container with a minimal passwd).
+	FSSelfName string `json:"fs_self_name,omitempty"`
+	// HelperBinary is the atlas binary that sudo runs to act as another user (default:
+	// the running executable). Set it when that path goes stale, e.g. after an update.
+	HelperBinary string `json:"helper_binary,omitempty"`
+
+	// Maintenance puts the panel into read-only mode (toggled via /api/admin/maintenance).
+	Maintenance bool `json:"maintenance,omitempty"`
+
+	// MaxBodyBytes caps JSON/API request bodies and /api/fs/write (default 2 MiB; /api/admin/tls gets at least 8 MiB).
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+	// MaxUploadBytes caps file uploads (default 512 MiB).
+	MaxUploadBytes int64 `json:"max_upload_bytes,omitempty"`
+	// MaxReadBytes caps how much of a file /api/fs/read returns (default 1 MiB, at most 64 MiB).
+	MaxReadBytes int64 `json:"max_read_bytes,omitempty"`
+	// File name search caps: results per request (default 5000), directory levels below
+	// the searched one (0: unlimited) and walking time before partial results are
+	// returned (default 10, below the 60s request timeout).
+	SearchMaxResults     int `json:"search_max_results,omitempty"`
+	SearchMaxDepth       int `json:"search_max_depth,omitempty"`
+	SearchTimeoutSeconds int `json:"search_timeout_seconds,omitempty"`
+	// UploadDenyExt blocks creating files by final extension, case-insensitively (e.g.
+	// ["php", "phtml"]): uploads, touch, writes to new paths and renames that change the
+	// extension. Existing files stay editable. Empty allows every file.
+	UploadDenyExt []string `json:"upload_deny_ext,omitempty"`
+
+	// MountAllowlist lists directories (e.g. "/mnt", "/media") under which admins may
+	// mount filesystems from the UI; targets inside system directories (/etc, /var, /usr, ...)
+	// are refused regardless. Empty disables mount/umount.
+	MountAllowlist []string `json:"mount_allowlist,omitempty"`
+
+	// SignalAllowlist limits the signals non-admin users may send to processes
+	// (e.g. ["HUP","TERM"]). Empty allows all.
+	SignalAllowlist []string `json:"signal_allowlist,omitempty"`
+	// ProcessUserCacheSeconds is how long the process list caches /etc/passwd for
+	// uid-to-name lookups (default 300).
+	ProcessUserCacheSeconds int `json:"process_user_cache_seconds,omitempty"`
+	// ProcessMaxCommandLen is how many bytes of each command line the process list
+	// returns (default 512); the details endpoint has the full one.
+	ProcessMaxCommandLen int `json:"process_max_command_len,omitempty"`
+
+	// SudoCacheTTLSeconds is how long a decrypted sudo password is cached in memory
+	// (default 60; negative disables caching).
+	SudoCacheTTLSeconds int `json:"sudo_cache_ttl_seconds,omitempty"`
+
+	// StateDir, when set, holds the master key, user DB, firewall DB and log file unless
+	// their paths are given explicitly (default: next to the config file).
+	StateDir string `json:"state_dir,omitempty"`
+
+	// Profiles holds per-environment overrides (e.g. "dev", "prod"). The one named by
+	// ATLAS_PROFILE replaces the matching top-level keys of the base config at load time.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
 
 	// MasterKeyFile stores a 32-byte random key (base64).
 	// It's used to derive both session signing secret and user DB encryption key.
@@ -57,6 +222,22 @@ type Config struct {
 
 	UserDBPath string `json:"user_db_path"`
 	FWDBPath   string `json:"firewall_db_path"`
+
+	// DBFileMode is the octal mode of the user and firewall DBs (default "0600").
+	// DBOwner/DBGroup (names or numeric ids) chown the DBs, e.g. to a dedicated
+	// service account when Atlas runs as root.
+	DBFileMode string `json:"db_file_mode,omitempty"`
+	DBOwner    string `json:"db_owner,omitempty"`
+	DBGroup    string `json:"db_group,omitempty"`
+}
+
+// DBPerm resolves DBFileMode/DBOwner/DBGroup.
+func (c Config) DBPerm() (dbfile.Perm, error) {
+	p, err := dbfile.Resolve(c.DBFileMode, c.DBOwner, c.DBGroup)
+	if err != nil {
+		return dbfile.Perm{}, fmt.Errorf("config: db permissions: %w", err)
+	}
+	return p, nil
 }
 
 // DefaultAllAllowed returns a config with permissive defaults (everything enabled).
@@ -79,6 +260,7 @@ func DefaultAllAllowed(configPath string) Config {
 		EnableFW:           true,
 		EnableAdminActions: true,
 		ServiceName:        "atlas.service",
+		AllowRoot:          true,
 		FSSudo:             true,
 		FSUsers:            []string{"*"},
 	}
@@ -86,11 +268,45 @@ func DefaultAllAllowed(configPath string) Config {
 	return cfg
 }
 
+// ErrNotFound is returned by LoadExisting when the config file does not exist.
+var ErrNotFound = errors.New("config file does not exist")
+
+// ProfileEnv selects the entry of Config.Profiles applied by Load and LoadExisting.
+const ProfileEnv = "ATLAS_PROFILE"
+
+// Load reads the config at path. A missing file is created from DefaultAllAllowed,
+// which suits an interactive first run; use LoadExisting to fail instead.
 func Load(path string) (Config, error) {
+	return load(path, true, os.Getenv(ProfileEnv))
+}
+
+// LoadExisting is Load without the first-run fallback: a missing file is an error
+// (ErrNotFound) rather than a freshly written permissive config.
+func LoadExisting(path string) (Config, error) {
+	return load(path, false, os.Getenv(ProfileEnv))
+}
+
+// LoadBase is Load without the ATLAS_PROFILE overrides, for callers that write the
+// config back to disk.
+func LoadBase(path string) (Config, error) {
+	return load(path, true, "")
+}
+
+func load(path string, create bool, profile string) (Config, error) {
 	path = filepath.Clean(path)
+	if profile = strings.TrimSpace(profile); profile != "" {
+		// Create or migrate the base file first, so nothing from the profile is
+		// written back into it. The base must be valid on its own.
+		if _, err := load(path, create, ""); err != nil {
+			return Config{}, err
+		}
+	}
 	b, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
+			if !create {
+				return Config{}, fmt.Errorf("%s: %w", path, ErrNotFound)
+			}
 			cfg := DefaultAllAllowed(path)
 			if err := writeFileAtomic(path, cfg, 0o600); err != nil {
 				return Config{}, err
@@ -99,6 +315,11 @@ func Load(path string) (Config, error) {
 		}
 		return Config{}, err
 	}
+	if profile != "" {
+		if b, err = applyProfile(b, profile); err != nil {
+			return Config{}, err
+		}
+	}
 
 	var raw map[string]json.RawMessage
 	_ = json.Unmarshal(b, &raw)
@@ -108,6 +329,11 @@ func Load(path string) (Config, error) {
 		return Config{}, err
 	}
 
+	// Configs written before allow_root existed keep running as root.
+	if _, ok := raw["allow_root"]; !ok {
+		cfg.AllowRoot = true
+	}
+
 	// Migrate old configs (no base_path) by generating a random base_path, and (optionally)
 	// randomizing listen port if it is empty or the old default.
 	_, hasBasePath := raw["base_path"]
@@ -134,11 +360,104 @@ func Load(path string) (Config, error) {
 	if cfg.Listen == "" {
 		return Config{}, errors.New("config: listen is required")
 	}
+	switch cfg.AccessLogLevel {
+	case "debug", "info", "warn":
+	default:
+		return Config{}, fmt.Errorf("config: access_log_level must be debug, info or warn, got %q", cfg.AccessLogLevel)
+	}
+	switch cfg.AccessLogFormat {
+	case "kv", "combined":
+	default:
+		return Config{}, fmt.Errorf("config: access_log_format must be kv or combined, got %q", cfg.AccessLogFormat)
+	}
+	for _, p := range cfg.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				return Config{}, fmt.Errorf("config: bad trusted_proxies entry %q", p)
+			}
+		}
+	}
+	if cfg.GRPCListen != "" {
+		if _, _, err := net.SplitHostPort(cfg.GRPCListen); err != nil {
+			return Config{}, fmt.Errorf("config: bad grpc_listen %q", cfg.GRPCListen)
+		}
+		if cfg.GRPCListen == cfg.Listen {
+			return Config{}, errors.New("config: grpc_listen must differ from listen")
+		}
+	}
+	switch strings.ToLower(cfg.CookieSameSite) {
+	case "", "strict", "lax", "none":
+	default:
+		return Config{}, fmt.Errorf("config: cookie_samesite must be strict, lax or none, got %q", cfg.CookieSameSite)
+	}
+	switch cfg.AuthBackend {
+	case "", "userdb":
+	case "command":
+		if len(cfg.AuthCommand) == 0 || !filepath.IsAbs(cfg.AuthCommand[0]) {
+			return Config{}, errors.New("config: auth_command must start with an absolute program path")
+		}
+	default:
+		return Config{}, fmt.Errorf("config: auth_backend must be userdb or command, got %q", cfg.AuthBackend)
+	}
+	if strings.ContainsAny(cfg.CookieName, " \t;,=\"") {
+		return Config{}, fmt.Errorf("config: bad cookie_name %q", cfg.CookieName)
+	}
+	if _, err := dbfile.ParseMode(cfg.DBFileMode); err != nil {
+		return Config{}, fmt.Errorf("config: db_file_mode: %w", err)
+	}
+	if !ValidTLSKeyType(cfg.TLSKeyType) {
+		return Config{}, fmt.Errorf("config: tls_key_type must be ecdsa-p256, ecdsa-p384, rsa-2048 or rsa-4096, got %q", cfg.TLSKeyType)
+	}
+	if cfg.RememberMeDays < 1 || cfg.RememberMeDays > 365 {
+		return Config{}, errors.New("config: remember_me_days must be between 1 and 365")
+	}
+	if cfg.TLSSelfSignedDays < 1 || cfg.TLSSelfSignedDays > 3650 {
+		return Config{}, errors.New("config: tls_self_signed_days must be between 1 and 3650")
+	}
+	for _, san := range cfg.TLSExtraSANs {
+		if !validSAN(san) {
+			return Config{}, fmt.Errorf("config: bad tls_extra_sans entry %q", san)
+		}
+	}
+	if cfg.MaxReadBytes > 64<<20 {
+		return Config{}, fmt.Errorf("config: max_read_bytes must be at most %d", 64<<20)
+	}
+	if cfg.SearchTimeoutSeconds >= 60 {
+		return Config{}, errors.New("config: search_timeout_seconds must be below the 60s request timeout")
+	}
+	if cfg.ProcessMaxCommandLen < 0 {
+		return Config{}, errors.New("config: process_max_command_len must not be negative")
+	}
+	if cfg.FWMaxRules < 0 {
+		return Config{}, errors.New("config: firewall_max_rules must not be negative")
+	}
+	if cfg.UpdateCheckHours < 0 {
+		return Config{}, errors.New("config: update_check_hours must not be negative")
+	}
+	if cfg.UpdateWebhook != "" {
+		if u, err := url.Parse(cfg.UpdateWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, fmt.Errorf("config: bad update_webhook %q", cfg.UpdateWebhook)
+		}
+	}
+	if cfg.FWInstance != "" && !validFWInstance(cfg.FWInstance) {
+		return Config{}, fmt.Errorf("config: bad firewall_instance %q (use up to 24 of a-z, 0-9, _, starting with a letter)", cfg.FWInstance)
+	}
+	if cfg.TerminalStreamBuffer < 2 {
+		return Config{}, errors.New("config: terminal_stream_buffer must be at least 2")
+	}
+	if cfg.SearchMaxDepth < 0 {
+		return Config{}, errors.New("config: search_max_depth must not be negative")
+	}
+	for name := range cfg.TerminalEnv {
+		if !validEnvName(name) {
+			return Config{}, fmt.Errorf("config: bad terminal_env name %q", name)
+		}
+	}
 	if cfg.Root == "" {
 		cfg.Root = "/"
 	}
 
-	if changed {
+	if changed && profile == "" {
 		if err := writeFileAtomic(path, cfg, 0o600); err != nil {
 			return Config{}, err
 		}
@@ -146,6 +465,101 @@ func Load(path string) (Config, error) {
 	return cfg, nil
 }
 
+// applyProfile returns the config JSON b with the top-level keys of profile replaced
+// by its overrides.
+func applyProfile(b []byte, profile string) ([]byte, error) {
+	var base map[string]json.RawMessage
+	if err := json.Unmarshal(b, &base); err != nil {
+		return nil, err
+	}
+	var profiles map[string]map[string]json.RawMessage
+	if p, ok := base["profiles"]; ok {
+		if err := json.Unmarshal(p, &profiles); err != nil {
+			return nil, fmt.Errorf("config: profiles: %w", err)
+		}
+	}
+	overrides, ok := profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("config: unknown profile %q (%s): the config has no profiles", profile, ProfileEnv)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("config: unknown profile %q (%s), known: %s", profile, ProfileEnv, strings.Join(names, ", "))
+	}
+	for k, v := range overrides {
+		if k == "profiles" {
+			return nil, fmt.Errorf("config: profile %q must not contain profiles", profile)
+		}
+		base[k] = v
+	}
+	return json.Marshal(base)
+}
+
+// Update loads the config at path without profile overrides, applies fn and writes it back.
+func Update(path string, fn func(*Config)) error {
+	cfg, err := LoadBase(path)
+	if err != nil {
+		return err
+	}
+	fn(&cfg)
+	return writeFileAtomic(path, cfg, 0o600)
+}
+
+// ValidTLSKeyType reports whether t names a supported self-signed key type.
+func ValidTLSKeyType(t string) bool {
+	switch t {
+	case "ecdsa-p256", "ecdsa-p384", "rsa-2048", "rsa-4096":
+		return true
+	}
+	return false
+}
+
+// validSAN accepts an IP address or a DNS name (optionally a leading "*." wildcard).
+func validSAN(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	name := strings.TrimPrefix(s, "*.")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validFWInstance accepts names usable as nft table names and in unit file names.
+func validFWInstance(name string) bool {
+	if name == "" || len(name) > 24 || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func validEnvName(name string) bool {
+	if name == "" || strings.ContainsAny(name, "=\x00") {
+		return false
+	}
+	return true
+}
+
 func (c *Config) applyDefaults(configPath string) {
 	cfgDir := filepath.Dir(filepath.Clean(configPath))
 	if c.Listen == "" {
@@ -161,24 +575,72 @@ func (c *Config) applyDefaults(configPath string) {
 	c.TLSCertFile = strings.TrimSpace(c.TLSCertFile)
 	c.TLSKeyFile = strings.TrimSpace(c.TLSKeyFile)
 	c.CookieSecure = true
+	c.CookieName = strings.TrimSpace(c.CookieName)
+	c.CookieSameSite = strings.ToLower(strings.TrimSpace(c.CookieSameSite))
 	if c.TLSCertFile != "" {
 		c.TLSCertFile = resolveRel(cfgDir, c.TLSCertFile)
 	}
 	if c.TLSKeyFile != "" {
 		c.TLSKeyFile = resolveRel(cfgDir, c.TLSKeyFile)
 	}
+	c.TLSKeyType = strings.ToLower(strings.TrimSpace(c.TLSKeyType))
+	if c.TLSKeyType == "" {
+		c.TLSKeyType = "ecdsa-p256"
+	}
+	if c.TLSSelfSignedDays == 0 {
+		c.TLSSelfSignedDays = 365
+	}
+	if c.RememberMeDays == 0 {
+		c.RememberMeDays = 30
+	}
+	c.TLSExtraSANs = normalizeCSV(c.TLSExtraSANs)
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = 2 << 20
+	}
+	if c.MaxUploadBytes <= 0 {
+		c.MaxUploadBytes = 512 << 20
+	}
+	if c.MaxReadBytes <= 0 {
+		c.MaxReadBytes = 1 << 20
+	}
+	if c.SearchMaxResults <= 0 {
+		c.SearchMaxResults = 5000
+	}
+	if c.SearchTimeoutSeconds <= 0 {
+		c.SearchTimeoutSeconds = 10
+	}
+	if c.HTTPRedirectPort <= 0 {
+		c.HTTPRedirectPort = 80
+	}
+	if c.HTTPReadHeaderTimeoutSeconds == 0 {
+		c.HTTPReadHeaderTimeoutSeconds = 5
+	}
+	if c.HTTPReadTimeoutSeconds == 0 {
+		c.HTTPReadTimeoutSeconds = 60
+	}
+	if c.HTTPWriteTimeoutSeconds == 0 {
+		c.HTTPWriteTimeoutSeconds = 90
+	}
+	if c.HTTPIdleTimeoutSeconds == 0 {
+		c.HTTPIdleTimeoutSeconds = 120
+	}
+	stateDir := cfgDir
+	if c.StateDir = strings.TrimSpace(c.StateDir); c.StateDir != "" {
+		c.StateDir = resolveRel(cfgDir, c.StateDir)
+		stateDir = c.StateDir
+	}
 	if c.MasterKeyFile == "" {
-		c.MasterKeyFile = filepath.Join(cfgDir, "atlas.master.key")
+		c.MasterKeyFile = filepath.Join(stateDir, "atlas.master.key")
 	} else {
 		c.MasterKeyFile = resolveRel(cfgDir, c.MasterKeyFile)
 	}
 	if c.UserDBPath == "" {
-		c.UserDBPath = filepath.Join(cfgDir, "atlas.users.db")
+		c.UserDBPath = filepath.Join(stateDir, "atlas.users.db")
 	} else {
 		c.UserDBPath = resolveRel(cfgDir, c.UserDBPath)
 	}
 	if c.FWDBPath == "" {
-		c.FWDBPath = filepath.Join(cfgDir, "atlas.firewall.db")
+		c.FWDBPath = filepath.Join(stateDir, "atlas.firewall.db")
 	} else {
 		c.FWDBPath = resolveRel(cfgDir, c.FWDBPath)
 	}
@@ -188,17 +650,56 @@ func (c *Config) applyDefaults(configPath string) {
 	if strings.TrimSpace(c.LogLevel) == "" {
 		c.LogLevel = "info"
 	}
+	if c.AccessLogLevel = strings.ToLower(strings.TrimSpace(c.AccessLogLevel)); c.AccessLogLevel == "" {
+		c.AccessLogLevel = "info"
+	}
+	if c.AccessLogFormat = strings.ToLower(strings.TrimSpace(c.AccessLogFormat)); c.AccessLogFormat == "" {
+		c.AccessLogFormat = "kv"
+	}
+	c.TrustedProxies = normalizeCSV(c.TrustedProxies)
 	if strings.TrimSpace(c.LogFile) == "" {
-		c.LogFile = filepath.Join(cfgDir, "atlas.log")
+		c.LogFile = filepath.Join(stateDir, "atlas.log")
 	} else {
 		c.LogFile = resolveRel(cfgDir, c.LogFile)
 	}
+	if strings.TrimSpace(c.BrandLogo) != "" {
+		c.BrandLogo = resolveRel(cfgDir, c.BrandLogo)
+	}
+	if c.LogMaxSizeMB == 0 {
+		c.LogMaxSizeMB = 10
+	}
+	if c.LogMaxFiles <= 0 {
+		c.LogMaxFiles = 5
+	}
 	if strings.TrimSpace(c.UpdateRepo) == "" {
 		c.UpdateRepo = "MrTeeett/Atlas"
 	}
+	if c.TerminalIdleTimeoutSeconds <= 0 {
+		c.TerminalIdleTimeoutSeconds = 1800
+	}
+	if c.TerminalMaxSessionsPerUser == 0 {
+		c.TerminalMaxSessionsPerUser = 8
+	}
+	if c.TerminalMaxSessions == 0 {
+		c.TerminalMaxSessions = 64
+	}
+	if c.TerminalStreamBuffer <= 0 {
+		c.TerminalStreamBuffer = 128
+	}
+	if c.TerminalStreamBlockMS <= 0 {
+		c.TerminalStreamBlockMS = 200
+	}
+	if c.ProcessUserCacheSeconds <= 0 {
+		c.ProcessUserCacheSeconds = 300
+	}
+	if c.SudoCacheTTLSeconds == 0 {
+		c.SudoCacheTTLSeconds = 60
+	}
 	if strings.TrimSpace(c.UpdateChannel) == "" {
 		c.UpdateChannel = "auto"
 	}
+	c.UpdateWebhook = strings.TrimSpace(c.UpdateWebhook)
+	c.FWInstance = strings.TrimSpace(c.FWInstance)
 	c.FSUsers = normalizeCSV(c.FSUsers)
 }
 
@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"net"
 	"os"
 	"path/filepath"
@@ -46,6 +47,47 @@ func TestLoadCreatesIfMissing(t *testing.T) {
 	}
 }
 
+func TestLoadExistingDoesNotCreate(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "atlas.json")
+	if _, err := LoadExisting(path); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no config file, stat err=%v", err)
+	}
+
+	if _, err := Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, err := LoadExisting(path); err != nil {
+		t.Fatalf("LoadExisting of a created config: %v", err)
+	}
+}
+
+func TestAllowRootDefaultsToTrue(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.json")
+	if err := os.WriteFile(old, []byte(`{"listen":"127.0.0.1:9000","base_path":"/x"}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg, err := Load(old)
+	if err != nil || !cfg.AllowRoot {
+		t.Fatalf("expected allow_root to default to true, err=%v cfg=%v", err, cfg.AllowRoot)
+	}
+
+	strict := filepath.Join(dir, "strict.json")
+	if err := os.WriteFile(strict, []byte(`{"listen":"127.0.0.1:9000","base_path":"/x","allow_root":false}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if cfg, err := Load(strict); err != nil || cfg.AllowRoot {
+		t.Fatalf("expected allow_root false, err=%v cfg=%v", err, cfg.AllowRoot)
+	}
+}
+
 func TestLoadMigratesAddsBasePath(t *testing.T) {
 	t.Parallel()
 
@@ -112,3 +154,140 @@ func TestDefaultsIncludeLoggingAndUpdate(t *testing.T) {
 		t.Fatalf("expected update defaults, got repo=%q channel=%q", cfg.UpdateRepo, cfg.UpdateChannel)
 	}
 }
+
+func TestStateDirDefaults(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "atlas.json")
+	body := `{"listen":"127.0.0.1:9000","base_path":"/","state_dir":"state","firewall_db_path":"fw.db"}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	state := filepath.Join(dir, "state")
+	if cfg.StateDir != state {
+		t.Fatalf("state_dir=%q, want %q", cfg.StateDir, state)
+	}
+	for name, got := range map[string]string{
+		"atlas.master.key": cfg.MasterKeyFile,
+		"atlas.users.db":   cfg.UserDBPath,
+		"atlas.log":        cfg.LogFile,
+	} {
+		if got != filepath.Join(state, name) {
+			t.Fatalf("expected %s in the state dir, got %q", name, got)
+		}
+	}
+	// An explicit path still wins and stays relative to the config file.
+	if cfg.FWDBPath != filepath.Join(dir, "fw.db") {
+		t.Fatalf("firewall_db_path=%q", cfg.FWDBPath)
+	}
+}
+
+func TestLoadRejectsBadDBFileMode(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "atlas.json")
+	if err := os.WriteFile(path, []byte(`{"listen":"127.0.0.1:1","base_path":"/x","db_file_mode":"0644"}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "db_file_mode") {
+		t.Fatalf("expected db_file_mode error, got %v", err)
+	}
+}
+
+func TestLoadRejectsTinyTerminalStreamBuffer(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "atlas.json")
+	if err := os.WriteFile(path, []byte(`{"listen":"127.0.0.1:1","base_path":"/x","terminal_stream_buffer":1}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "terminal_stream_buffer") {
+		t.Fatalf("expected terminal_stream_buffer error, got %v", err)
+	}
+}
+
+func TestLoadValidatesSelfSignedTLS(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		body string
+		want string
+	}{
+		{`"tls_key_type":"ecdsa-p521"`, "tls_key_type"},
+		{`"tls_key_type":"rsa-1024"`, "tls_key_type"},
+		{`"tls_self_signed_days":-1`, "tls_self_signed_days"},
+		{`"tls_extra_sans":["bad host"]`, "tls_extra_sans"},
+		{`"tls_key_type":"RSA-4096","tls_self_signed_days":825,"tls_extra_sans":["panel.example.com","10.0.0.5"]`, ""},
+	} {
+		path := filepath.Join(t.TempDir(), "atlas.json")
+		if err := os.WriteFile(path, []byte(`{"listen":"127.0.0.1:1","base_path":"/x",`+tc.body+`}`), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		cfg, err := Load(path)
+		if tc.want == "" {
+			if err != nil {
+				t.Fatalf("%s: %v", tc.body, err)
+			}
+			if cfg.TLSKeyType != "rsa-4096" || cfg.TLSSelfSignedDays != 825 || len(cfg.TLSExtraSANs) != 2 {
+				t.Fatalf("unexpected config: %+v", cfg)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected %s error, got %v", tc.body, tc.want, err)
+		}
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "atlas.json")
+	body := `{"listen":"127.0.0.1:1","base_path":"/x","log_level":"info","terminal_env":{"A":"1"},
+		"profiles":{"prod":{"listen":"0.0.0.0:443","terminal_env":{"B":"2"}},"dev":{"log_level":"debug"}}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	base, err := load(path, true, "")
+	if err != nil {
+		t.Fatalf("load base: %v", err)
+	}
+	if base.Listen != "127.0.0.1:1" || base.LogLevel != "info" || len(base.Profiles) != 2 {
+		t.Fatalf("unexpected base config: %+v", base)
+	}
+
+	prod, err := load(path, true, "prod")
+	if err != nil {
+		t.Fatalf("load prod: %v", err)
+	}
+	// Top-level keys are replaced as a whole; the rest comes from the base.
+	if prod.Listen != "0.0.0.0:443" || prod.LogLevel != "info" || prod.BasePath != "/x" {
+		t.Fatalf("unexpected prod config: %+v", prod)
+	}
+	if len(prod.TerminalEnv) != 1 || prod.TerminalEnv["B"] != "2" {
+		t.Fatalf("unexpected prod terminal_env: %v", prod.TerminalEnv)
+	}
+
+	if _, err := load(path, true, "staging"); err == nil || !strings.Contains(err.Error(), `unknown profile "staging"`) {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+
+	// Writing the config back keeps the base values and the profiles.
+	if err := Update(path, func(c *Config) { c.Maintenance = true }); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	after, err := load(path, true, "")
+	if err != nil {
+		t.Fatalf("load after update: %v", err)
+	}
+	if after.Listen != "127.0.0.1:1" || !after.Maintenance || len(after.Profiles) != 2 {
+		t.Fatalf("unexpected config after update: %+v", after)
+	}
+}
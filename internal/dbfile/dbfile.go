@@ -0,0 +1,140 @@
+// Package dbfile writes Atlas database files atomically with a configurable mode and owner.
+package dbfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultMode is used for database files unless configured otherwise.
+const DefaultMode os.FileMode = 0o600
+
+// Perm describes how database files and their directory are created. The zero value
+// means DefaultMode, owned by the running user. With Chown set, UID/GID of -1 leave
+// that part of the ownership unchanged.
+type Perm struct {
+	Mode  os.FileMode
+	Chown bool
+	UID   int
+	GID   int
+}
+
+// Resolve builds a Perm from config values. mode is an octal string ("0640");
+// owner and group are names or numeric ids. Empty values keep the defaults.
+func Resolve(mode, owner, group string) (Perm, error) {
+	p := Perm{UID: -1, GID: -1}
+	m, err := ParseMode(mode)
+	if err != nil {
+		return Perm{}, err
+	}
+	p.Mode = m
+	if owner = strings.TrimSpace(owner); owner != "" {
+		uid, err := lookupID(owner, false)
+		if err != nil {
+			return Perm{}, err
+		}
+		p.UID = uid
+		p.Chown = true
+	}
+	if group = strings.TrimSpace(group); group != "" {
+		gid, err := lookupID(group, true)
+		if err != nil {
+			return Perm{}, err
+		}
+		p.GID = gid
+		p.Chown = true
+	}
+	return p, nil
+}
+
+// ParseMode parses an octal file mode. The DBs hold secrets, so the owner must be able to
+// read and write them and no permission bits for others are accepted.
+func ParseMode(s string) (os.FileMode, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DefaultMode, nil
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || v > 0o777 {
+		return 0, fmt.Errorf("bad file mode %q", s)
+	}
+	m := os.FileMode(v)
+	if m&0o600 != 0o600 {
+		return 0, fmt.Errorf("file mode %q must allow owner read/write", s)
+	}
+	if m&0o007 != 0 {
+		return 0, fmt.Errorf("file mode %q must not grant access to others", s)
+	}
+	return m, nil
+}
+
+func lookupID(name string, group bool) (int, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("bad id %q", name)
+		}
+		return n, nil
+	}
+	if group {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(g.Gid)
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// MkdirAll creates dir (0755). Ownership is only applied to directories it creates,
+// so a DB placed in e.g. /etc doesn't hand that directory to the service account.
+func (p Perm) MkdirAll(dir string) error {
+	dir = filepath.Clean(dir)
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if p.Chown {
+		return os.Chown(dir, p.UID, p.GID)
+	}
+	return nil
+}
+
+// WriteFile writes data to path via a temporary file and rename, applying the mode
+// and owner before the file becomes visible.
+func (p Perm) WriteFile(path string, data []byte) error {
+	if err := p.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	mode := p.Mode
+	if mode == 0 {
+		mode = DefaultMode
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, DefaultMode); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if p.Chown {
+		if err := os.Chown(tmp, p.UID, p.GID); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
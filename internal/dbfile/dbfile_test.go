@@ -0,0 +1,71 @@
+package dbfile
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]os.FileMode{"": 0o600, "0600": 0o600, "0640": 0o640, "660": 0o660, "0o600": 0o600}
+	for in, want := range cases {
+		got, err := ParseMode(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseMode(%q) = %o, %v; want %o", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"0644", "0606", "0400", "abc", "0999", "01600"} {
+		if _, err := ParseMode(bad); err == nil {
+			t.Fatalf("ParseMode(%q): expected error", bad)
+		}
+	}
+}
+
+func TestWriteFileAppliesMode(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sub", "x.db")
+	if err := (Perm{}).WriteFile(path, []byte("a")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if st.Mode().Perm() != DefaultMode {
+		t.Fatalf("default mode = %o", st.Mode().Perm())
+	}
+
+	p, err := Resolve("0640", "", "")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if p.Chown {
+		t.Fatalf("expected no chown without owner/group")
+	}
+	if err := p.WriteFile(path, []byte("b")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	st, _ = os.Stat(path)
+	if st.Mode().Perm() != 0o640 {
+		t.Fatalf("mode = %o, want 640", st.Mode().Perm())
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+
+	// Chown to our own uid/gid works without privileges.
+	p, err = Resolve("", strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid()))
+	if err != nil {
+		t.Fatalf("Resolve ids: %v", err)
+	}
+	if !p.Chown || p.UID != os.Getuid() || p.GID != os.Getgid() {
+		t.Fatalf("unexpected perm %+v", p)
+	}
+	if err := p.WriteFile(path, []byte("c")); err != nil {
+		t.Fatalf("WriteFile chown: %v", err)
+	}
+}
@@ -5,17 +5,20 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/MrTeeett/atlas/internal/auth"
+	"github.com/MrTeeett/atlas/internal/nss"
 )
 
 type fileInfo struct {
@@ -76,6 +79,10 @@ func (s *Service) writeFSError(w http.ResponseWriter, err error) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if strings.Contains(err.Error(), errUploadBlocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	lower := strings.ToLower(err.Error())
 	if strings.Contains(lower, "sudo:") || strings.Contains(lower, "a password is required") || strings.Contains(lower, "not in the sudoers file") {
 		http.Error(w, "sudo is not configured", http.StatusForbidden)
@@ -92,6 +99,17 @@ func (s *Service) writeFSError(w http.ResponseWriter, err error) {
 	http.Error(w, err.Error(), http.StatusInternalServerError)
 }
 
+// isNotExist is like isPermission for missing files; helper errors only carry the text.
+func isNotExist(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "no such file or directory")
+}
+
 func isPermission(err error) bool {
 	if err == nil {
 		return false
@@ -128,13 +146,13 @@ func (s *Service) listAs(ctx context.Context, as string, clientPath string) (lis
 	return resp, nil
 }
 
-func (s *Service) searchAs(ctx context.Context, as string, clientPath string, query string, limit int) (searchResponse, error) {
+func (s *Service) searchAs(ctx context.Context, as string, clientPath string, query string, limit, maxDepth int) (searchResponse, error) {
 	if as == "self" {
 		abs, err := s.resolve(clientPath)
 		if err != nil {
 			return searchResponse{}, err
 		}
-		entries, truncated, err := s.search(abs, query, limit)
+		entries, truncated, err := s.searchLimited(ctx, abs, query, limit, maxDepth)
 		if err != nil {
 			return searchResponse{}, err
 		}
@@ -147,7 +165,7 @@ func (s *Service) searchAs(ctx context.Context, as string, clientPath string, qu
 	}
 
 	var stdout bytes.Buffer
-	if err := s.runHelper(ctx, as, &stdout, nil, "search", "--path", clientPath, "--q", query, "--limit", strconv.Itoa(limit)); err != nil {
+	if err := s.runHelper(ctx, as, &stdout, nil, "search", "--path", clientPath, "--q", query, "--limit", strconv.Itoa(limit), "--max-depth", strconv.Itoa(maxDepth)); err != nil {
 		return searchResponse{}, err
 	}
 	var resp searchResponse
@@ -159,33 +177,36 @@ func (s *Service) searchAs(ctx context.Context, as string, clientPath string, qu
 	return resp, nil
 }
 
-func (s *Service) readAs(ctx context.Context, as string, clientPath string, limit int64) ([]byte, error) {
+// readAs reads up to limit bytes and reports whether the file is longer than that.
+func (s *Service) readAs(ctx context.Context, as string, clientPath string, limit int64) ([]byte, bool, error) {
+	var buf []byte
 	if as == "self" {
 		abs, err := s.resolve(clientPath)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		f, err := os.Open(abs)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		defer f.Close()
 
-		buf, err := io.ReadAll(io.LimitReader(f, limit+1))
+		buf, err = io.ReadAll(io.LimitReader(f, limit+1))
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
-		if int64(len(buf)) > limit {
-			buf = append(buf[:limit], []byte("\n\n... file truncated ...\n")...)
+	} else {
+		// --raw makes the helper emit up to limit+1 bytes and no marker.
+		var stdout bytes.Buffer
+		if err := s.runHelper(ctx, as, &stdout, nil, "read", "--path", clientPath, "--limit", strconv.FormatInt(limit, 10), "--raw"); err != nil {
+			return nil, false, err
 		}
-		return buf, nil
+		buf = stdout.Bytes()
 	}
-
-	var stdout bytes.Buffer
-	if err := s.runHelper(ctx, as, &stdout, nil, "read", "--path", clientPath, "--limit", strconv.FormatInt(limit, 10)); err != nil {
-		return nil, err
+	if int64(len(buf)) > limit {
+		return buf[:limit], true, nil
 	}
-	return stdout.Bytes(), nil
+	return buf, false, nil
 }
 
 func (s *Service) statAs(ctx context.Context, as string, clientPath string) (fileInfo, error) {
@@ -280,6 +301,9 @@ func (s *Service) saveUploadedFileAs(ctx context.Context, as string, dirAbs stri
 	if err := validateName(name); err != nil {
 		return err
 	}
+	if err := checkUploadName(s.denyExt, name); err != nil {
+		return err
+	}
 	file, err := fh.Open()
 	if err != nil {
 		return err
@@ -323,6 +347,9 @@ func (s *Service) mkdirAs(ctx context.Context, as string, clientDir string, name
 }
 
 func (s *Service) touchAs(ctx context.Context, as string, clientDir string, name string) error {
+	if err := checkUploadName(s.denyExt, name); err != nil {
+		return err
+	}
 	if as == "self" {
 		dirAbs, err := s.resolve(clientDir)
 		if err != nil {
@@ -343,6 +370,9 @@ func (s *Service) touchAs(ctx context.Context, as string, clientDir string, name
 }
 
 func (s *Service) renameAs(ctx context.Context, as string, fromClient string, toName string) error {
+	if err := checkRenameName(s.denyExt, fromClient, toName); err != nil {
+		return err
+	}
 	if as == "self" {
 		fromAbs, err := s.resolve(fromClient)
 		if err != nil {
@@ -391,6 +421,9 @@ func (s *Service) writeFileAs(ctx context.Context, as string, clientPath string,
 		if s.clientPath(abs) == "/" {
 			return errors.New("cannot write root")
 		}
+		if err := checkWriteName(s.denyExt, abs); err != nil {
+			return err
+		}
 		if st, err := os.Stat(abs); err == nil && st.IsDir() {
 			return errors.New("path is a directory")
 		}
@@ -405,9 +438,20 @@ func (s *Service) writeFileAs(ctx context.Context, as string, clientPath string,
 	return s.runHelper(ctx, as, nil, bytes.NewReader(content), "writefile", "--path", clientPath)
 }
 
+// helperArgs returns the fs-helper command line for op, carrying over the service limits.
+func (s *Service) helperArgs(op string, args ...string) []string {
+	out := []string{s.helperPath, "fs-helper", "--root", s.root, "--max-read", strconv.FormatInt(s.maxRead, 10),
+		"--max-write", strconv.FormatInt(s.maxWrite, 10),
+		"--search-max", strconv.Itoa(s.searchMax), "--search-depth", strconv.Itoa(s.searchDepth), "--search-timeout", s.searchTimeout.String()}
+	if len(s.denyExt) > 0 {
+		out = append(out, "--deny-ext", extList(s.denyExt))
+	}
+	out = append(out, op)
+	return append(out, args...)
+}
+
 func (s *Service) sudoCmd(ctx context.Context, as string, op string, args ...string) *exec.Cmd {
-	cmdArgs := []string{"-n", "-u", as, s.helperPath, "fs-helper", "--root", s.root, op}
-	cmdArgs = append(cmdArgs, args...)
+	cmdArgs := append([]string{"-n", "-u", as}, s.helperArgs(op, args...)...)
 	return exec.CommandContext(ctx, s.sudoPath, cmdArgs...)
 }
 
@@ -439,25 +483,48 @@ func (s *Service) runHelper(ctx context.Context, as string, stdout io.Writer, st
 	return nil
 }
 
+// errHelperUnusable is returned instead of running sudo when the helper can't be run.
+var errHelperUnusable = errors.New("sudo helper binary is not usable")
+
+// checkHelper makes sure path is an executable file. After a self-update
+// os.Executable can name the replaced (deleted) binary.
+func checkHelper(path string) error {
+	if path == "" {
+		return fmt.Errorf("%w: its path is unknown (set helper_binary)", errHelperUnusable)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v (set helper_binary)", errHelperUnusable, err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("%w: %s is not an executable file (set helper_binary)", errHelperUnusable, path)
+	}
+	return nil
+}
+
 func (s *Service) sudoCmdWithPassword(ctx context.Context, as string, op string, args ...string) (*exec.Cmd, string, error) {
 	if s.sudoPath == "" {
 		return nil, "", errors.New("sudo is not available")
 	}
+	if err := checkHelper(s.helperPath); err != nil {
+		return nil, "", err
+	}
 	pass, ok, err := s.sudoPassFor(ctx)
 	if err != nil {
 		return nil, "", err
 	}
 	if ok && pass != "" {
-		cmdArgs := []string{"-S", "-p", "", "-u", as, s.helperPath, "fs-helper", "--root", s.root, op}
-		cmdArgs = append(cmdArgs, args...)
+		cmdArgs := append([]string{"-S", "-p", "", "-u", as}, s.helperArgs(op, args...)...)
 		return exec.CommandContext(ctx, s.sudoPath, cmdArgs...), pass, nil
 	}
-	cmdArgs := []string{"-n", "-u", as, s.helperPath, "fs-helper", "--root", s.root, op}
-	cmdArgs = append(cmdArgs, args...)
+	cmdArgs := append([]string{"-n", "-u", as}, s.helperArgs(op, args...)...)
 	return exec.CommandContext(ctx, s.sudoPath, cmdArgs...), "", nil
 }
 
 func (s *Service) sudoPassFor(ctx context.Context) (string, bool, error) {
+	if pass, ok := auth.SudoPasswordFromContext(ctx); ok {
+		return pass, true, nil
+	}
 	if s.sudoPassword == nil {
 		return "", false, nil
 	}
@@ -465,7 +532,7 @@ func (s *Service) sudoPassFor(ctx context.Context) (string, bool, error) {
 	if !ok || strings.TrimSpace(c.User) == "" {
 		return "", false, nil
 	}
-	return s.sudoPassword(c.User)
+	return s.sudoPassword.Get(c.User)
 }
 
 func normalizeClientPath(p string) string {
@@ -486,12 +553,10 @@ func normalizeClientPath(p string) string {
 	return p
 }
 
-func lookupSelfUser() string {
-	uid := os.Geteuid()
-	b, err := os.ReadFile("/etc/passwd")
-	if err != nil {
-		return "self"
-	}
+// lookupSelfUser names the euid Atlas runs as: /etc/passwd first, then override (when
+// set), then NSS and os/user.Current, and finally the literal "self".
+func lookupSelfUser(uid int, passwdPath, override string) string {
+	b, _ := os.ReadFile(passwdPath)
 	for _, line := range strings.Split(string(b), "\n") {
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
@@ -504,5 +569,16 @@ func lookupSelfUser() string {
 			return parts[0]
 		}
 	}
+	if override != "" {
+		return override
+	}
+	// Not in the local file: the account may come from NSS (LDAP, SSSD, ...).
+	if u, err := nss.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+	// Without cgo, Current falls back to $USER, which helps in minimal containers.
+	if u, err := user.Current(); err == nil && u.Uid == strconv.Itoa(uid) && u.Username != "" {
+		return u.Username
+	}
 	return "self"
 }
@@ -0,0 +1,138 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// truncatedMarker is appended to partial reads.
+const truncatedMarker = "\n\n... file truncated ...\n"
+
+// Charsets understood by HandleRead/HandleWrite. "utf-8-bom" keeps the BOM on save.
+const (
+	charsetUTF8    = "utf-8"
+	charsetUTF8BOM = "utf-8-bom"
+	charsetUTF16LE = "utf-16le"
+	charsetUTF16BE = "utf-16be"
+	charsetLatin1  = "iso-8859-1"
+	charsetWin1252 = "windows-1252"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+func normalizeCharset(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "utf8", "utf-8":
+		return charsetUTF8, nil
+	case "utf-8-bom", "utf8-bom", "utf-8-sig":
+		return charsetUTF8BOM, nil
+	case "utf-16le", "utf16le":
+		return charsetUTF16LE, nil
+	case "utf-16be", "utf16be":
+		return charsetUTF16BE, nil
+	case "latin1", "latin-1", "iso-8859-1", "iso8859-1":
+		return charsetLatin1, nil
+	case "windows-1252", "cp1252":
+		return charsetWin1252, nil
+	default:
+		return "", errors.New("unsupported charset")
+	}
+}
+
+// detectCharset sniffs a BOM and otherwise falls back to a UTF-8 validity check.
+// Non-UTF-8 text is assumed to be windows-1252 (a superset of latin1's printable range).
+func detectCharset(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		return charsetUTF8BOM
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return charsetUTF16LE
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return charsetUTF16BE
+	}
+	if validUTF8Prefix(b) {
+		return charsetUTF8
+	}
+	return charsetWin1252
+}
+
+// validUTF8Prefix reports whether b is UTF-8, allowing a rune cut off by a partial read.
+func validUTF8Prefix(b []byte) bool {
+	if utf8.Valid(b) {
+		return true
+	}
+	for cut := 1; cut <= utf8.UTFMax-1 && cut < len(b); cut++ {
+		if utf8.Valid(b[:len(b)-cut]) && !utf8.FullRune(b[len(b)-cut:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// charsetEncoding returns the x/text encoding for cs. UTF-16 uses UseBOM: a BOM, when
+// present, overrides the byte order, files without one still decode, and encoding
+// always writes one.
+func charsetEncoding(cs string) encoding.Encoding {
+	switch cs {
+	case charsetUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case charsetUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	case charsetLatin1:
+		return charmap.ISO8859_1
+	case charsetWin1252:
+		return charmap.Windows1252
+	default:
+		return nil
+	}
+}
+
+// decodeCharset converts b from cs to UTF-8, dropping a UTF-8 BOM.
+func decodeCharset(b []byte, cs string) ([]byte, error) {
+	switch cs {
+	case charsetUTF8:
+		return b, nil
+	case charsetUTF8BOM:
+		return bytes.TrimPrefix(b, bomUTF8), nil
+	}
+	enc := charsetEncoding(cs)
+	if enc == nil {
+		return nil, errors.New("unsupported charset")
+	}
+	if (cs == charsetUTF16LE || cs == charsetUTF16BE) && len(b)%2 == 1 {
+		b = b[:len(b)-1] // partial read cut a code unit in half
+	}
+	return enc.NewDecoder().Bytes(b)
+}
+
+// encodeCharset converts UTF-8 text to cs (adding a BOM for utf-8-bom / utf-16).
+func encodeCharset(text []byte, cs string) ([]byte, error) {
+	switch cs {
+	case charsetUTF8:
+		return text, nil
+	case charsetUTF8BOM:
+		if bytes.HasPrefix(text, bomUTF8) {
+			return text, nil
+		}
+		return append(append([]byte{}, bomUTF8...), text...), nil
+	}
+	enc := charsetEncoding(cs)
+	if enc == nil {
+		return nil, errors.New("unsupported charset")
+	}
+	out, err := enc.NewEncoder().Bytes(text)
+	if err != nil {
+		return nil, errors.New("content cannot be encoded as " + cs)
+	}
+	return out, nil
+}
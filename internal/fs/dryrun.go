@@ -0,0 +1,153 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// maxDryRunPaths caps the paths listed by a dry run; Count and TotalBytes still cover
+// everything.
+const maxDryRunPaths = 10000
+
+// dryRunResponse is returned by ?dry_run=1 instead of deleting or renaming.
+type dryRunResponse struct {
+	// Paths would be removed (delete) or moved (rename), each directory before its contents.
+	Paths      []string `json:"paths"`
+	Count      int      `json:"count"`
+	TotalBytes int64    `json:"total_bytes"`
+	Truncated  bool     `json:"truncated,omitempty"`
+	// Overwrites is the existing destination a rename would replace.
+	Overwrites string `json:"overwrites,omitempty"`
+}
+
+func dryRunRequested(r *http.Request) bool {
+	v := r.URL.Query().Get("dry_run")
+	return v == "1" || v == "true"
+}
+
+func (p *dryRunResponse) add(clientPath string, size int64) {
+	p.Count++
+	p.TotalBytes += size
+	if len(p.Paths) >= maxDryRunPaths {
+		p.Truncated = true
+		return
+	}
+	p.Paths = append(p.Paths, clientPath)
+}
+
+func (p *dryRunResponse) merge(o dryRunResponse) {
+	for _, path := range o.Paths {
+		p.add(path, 0)
+	}
+	p.Count += o.Count - len(o.Paths)
+	p.TotalBytes += o.TotalBytes
+	p.Truncated = p.Truncated || o.Truncated
+}
+
+// walkPlan adds abs and everything below it. Symlinks are listed but not followed,
+// matching os.RemoveAll and os.Rename.
+func (s *Service) walkPlan(ctx context.Context, abs string, plan *dryRunResponse) error {
+	return filepath.WalkDir(abs, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path, err := s.ensureWithinRoot(path)
+		if err != nil {
+			return err
+		}
+		var size int64
+		if !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size = info.Size()
+			}
+		}
+		plan.add(s.clientPath(path), size)
+		return nil
+	})
+}
+
+func (s *Service) planDelete(ctx context.Context, clientPath string) (dryRunResponse, error) {
+	plan := dryRunResponse{Paths: []string{}}
+	abs, err := s.resolve(clientPath)
+	if err != nil {
+		return plan, err
+	}
+	if s.clientPath(abs) == "/" {
+		return plan, errors.New("cannot delete root")
+	}
+	err = s.walkPlan(ctx, abs, &plan)
+	return plan, err
+}
+
+func (s *Service) planRename(ctx context.Context, fromClient, toName string) (dryRunResponse, error) {
+	plan := dryRunResponse{Paths: []string{}}
+	fromAbs, err := s.resolve(fromClient)
+	if err != nil {
+		return plan, err
+	}
+	if s.clientPath(fromAbs) == "/" {
+		return plan, errors.New("cannot rename root")
+	}
+	dstAbs, err := s.ensureWithinRoot(filepath.Join(filepath.Dir(fromAbs), toName))
+	if err != nil {
+		return plan, err
+	}
+	if err := s.walkPlan(ctx, fromAbs, &plan); err != nil {
+		return plan, err
+	}
+	if dstAbs != fromAbs {
+		if _, err := os.Lstat(dstAbs); err == nil {
+			plan.Overwrites = s.clientPath(dstAbs)
+		}
+	}
+	return plan, nil
+}
+
+func (s *Service) planDeleteAs(ctx context.Context, as string, clientPaths []string) (dryRunResponse, error) {
+	plan := dryRunResponse{Paths: []string{}}
+	for _, p := range clientPaths {
+		var one dryRunResponse
+		var err error
+		if as == "self" {
+			one, err = s.planDelete(ctx, p)
+		} else {
+			one, err = s.planAs(ctx, as, "delete", "--path", p, "--dry-run")
+		}
+		if err != nil {
+			return plan, err
+		}
+		plan.merge(one)
+	}
+	return plan, nil
+}
+
+func (s *Service) planRenameAs(ctx context.Context, as string, fromClient, toName string) (dryRunResponse, error) {
+	if as == "self" {
+		return s.planRename(ctx, fromClient, toName)
+	}
+	return s.planAs(ctx, as, "rename", "--from", fromClient, "--to", toName, "--dry-run")
+}
+
+// planAs runs a helper op in dry-run mode, which prints a dryRunResponse.
+func (s *Service) planAs(ctx context.Context, as string, op string, args ...string) (dryRunResponse, error) {
+	var stdout bytes.Buffer
+	if err := s.runHelper(ctx, as, &stdout, nil, op, args...); err != nil {
+		return dryRunResponse{}, err
+	}
+	var plan dryRunResponse
+	if err := json.Unmarshal(stdout.Bytes(), &plan); err != nil {
+		return dryRunResponse{}, err
+	}
+	for i, p := range plan.Paths {
+		plan.Paths[i] = normalizeClientPath(p)
+	}
+	return plan, nil
+}
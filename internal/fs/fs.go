@@ -2,10 +2,13 @@ package fs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -17,6 +20,9 @@ import (
 	"time"
 
 	"github.com/MrTeeett/atlas/internal/auth"
+	"github.com/MrTeeett/atlas/internal/sudocache"
+	"github.com/MrTeeett/atlas/internal/sudocheck"
+	"github.com/MrTeeett/atlas/internal/units"
 )
 
 type Config struct {
@@ -26,17 +32,59 @@ type Config struct {
 	SudoUsers    []string
 	HelperBinary string
 	SudoPassword func(user string) (string, bool, error)
+	// MaxUploadBytes caps multipart uploads (default 512 MiB).
+	MaxUploadBytes int64
+	// MaxWriteBytes caps /api/fs/write bodies (default 2 MiB); the sudo helper gets the same cap.
+	MaxWriteBytes int64
+	// SudoPasswordTTL controls how long SudoPassword results are cached (0: default, <0: off).
+	SudoPasswordTTL time.Duration
+	// SudoCheck reports whether sudo works without a password (optional).
+	SudoCheck *sudocheck.Checker
+	// MaxReadBytes caps the ?limit of /api/fs/read (default 1 MiB); the sudo helper gets the same cap.
+	MaxReadBytes int64
+	// UploadDenyExt lists file extensions ("php", ".phtml") that may not be uploaded.
+	UploadDenyExt []string
+	// SearchMaxResults caps the ?limit of /api/fs/search (default 5000), SearchMaxDepth
+	// how many levels below the searched directory it descends (0: no cap) and
+	// SearchTimeout how long it walks before returning partial results (default 10s).
+	SearchMaxResults int
+	SearchMaxDepth   int
+	SearchTimeout    time.Duration
+	// SelfName names Atlas's own identity when its euid is missing from /etc/passwd.
+	SelfName string
 }
 
+const (
+	// defaultReadLimit is used when /api/fs/read has no ?limit.
+	defaultReadLimit = 65536
+	defaultMaxRead   = 1 << 20
+	defaultMaxWrite  = 2 << 20
+
+	// defaultSearchLimit is used when /api/fs/search has no ?limit.
+	defaultSearchLimit   = 500
+	defaultSearchMax     = 5000
+	defaultSearchTimeout = 10 * time.Second
+)
+
 type Service struct {
 	root         string
 	sudoEnabled  bool
 	sudoAny      bool
 	sudoUsers    map[string]bool
 	selfUser     string
+	selfUID      int
 	helperPath   string
 	sudoPath     string
-	sudoPassword func(user string) (string, bool, error)
+	sudoPassword *sudocache.Cache
+	sudoCheck    *sudocheck.Checker
+	maxUpload    int64
+	maxWrite     int64
+	maxRead      int64
+	denyExt      map[string]bool
+
+	searchMax     int
+	searchDepth   int
+	searchTimeout time.Duration
 }
 
 type Entry struct {
@@ -45,6 +93,22 @@ type Entry struct {
 	IsDir   bool   `json:"is_dir"`
 	Size    int64  `json:"size"`
 	ModUnix int64  `json:"mod_unix"`
+	// RelPath is the path relative to the searched directory (search results only).
+	RelPath string `json:"rel_path,omitempty"`
+	// SizeHuman is only set with ?human=1 (and never for directories).
+	SizeHuman string `json:"size_human,omitempty"`
+}
+
+// humanizeEntries fills SizeHuman when the request asked for it.
+func humanizeEntries(r *http.Request, entries []Entry) {
+	if !units.HumanRequested(r) {
+		return
+	}
+	for i := range entries {
+		if !entries[i].IsDir && entries[i].Size >= 0 {
+			entries[i].SizeHuman = units.HumanizeBytes(uint64(entries[i].Size))
+		}
+	}
 }
 
 type listResponse struct {
@@ -71,6 +135,8 @@ type deleteRequest struct {
 type writeRequest struct {
 	Path    string `json:"path"`
 	Content string `json:"content"`
+	// Charset re-encodes Content (UTF-8) before writing; see X-Atlas-Charset on read.
+	Charset string `json:"charset,omitempty"`
 }
 
 func New(cfg Config) *Service {
@@ -91,19 +157,66 @@ func New(cfg Config) *Service {
 			helperPath = exe
 		}
 	}
+	if cfg.SudoEnabled {
+		if err := checkHelper(helperPath); err != nil {
+			slog.Warn("fs: operations as other users will fail", "err", err)
+		}
+	}
 	sudoPath, _ := exec.LookPath("sudo")
+	maxUpload := cfg.MaxUploadBytes
+	if maxUpload <= 0 {
+		maxUpload = 512 << 20
+	}
+	maxWrite := cfg.MaxWriteBytes
+	if maxWrite <= 0 {
+		maxWrite = defaultMaxWrite
+	}
+	maxRead := cfg.MaxReadBytes
+	if maxRead <= 0 {
+		maxRead = defaultMaxRead
+	}
+	searchMax := cfg.SearchMaxResults
+	if searchMax <= 0 {
+		searchMax = defaultSearchMax
+	}
+	searchTimeout := cfg.SearchTimeout
+	if searchTimeout <= 0 {
+		searchTimeout = defaultSearchTimeout
+	}
 	return &Service{
 		root:         filepath.Clean(root),
 		sudoEnabled:  cfg.SudoEnabled,
 		sudoAny:      cfg.SudoAny,
 		sudoUsers:    sudoUsers,
-		selfUser:     lookupSelfUser(),
+		selfUser:     lookupSelfUser(os.Geteuid(), "/etc/passwd", strings.TrimSpace(cfg.SelfName)),
+		selfUID:      os.Geteuid(),
 		helperPath:   helperPath,
 		sudoPath:     sudoPath,
-		sudoPassword: cfg.SudoPassword,
+		sudoPassword: newSudoCache(cfg),
+		sudoCheck:    cfg.SudoCheck,
+		maxUpload:    maxUpload,
+		maxWrite:     maxWrite,
+		maxRead:      maxRead,
+		denyExt:      parseExtList(cfg.UploadDenyExt),
+
+		searchMax:     searchMax,
+		searchDepth:   max(cfg.SearchMaxDepth, 0),
+		searchTimeout: searchTimeout,
 	}
 }
 
+func newSudoCache(cfg Config) *sudocache.Cache {
+	if cfg.SudoPassword == nil {
+		return nil
+	}
+	return sudocache.New(cfg.SudoPassword, cfg.SudoPasswordTTL)
+}
+
+// InvalidateSudoPassword drops the cached sudo password of user.
+func (s *Service) InvalidateSudoPassword(user string) {
+	s.sudoPassword.Invalidate(user)
+}
+
 func (s *Service) HandleList(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -120,6 +233,7 @@ func (s *Service) HandleList(w http.ResponseWriter, r *http.Request) {
 		s.writeFSError(w, err)
 		return
 	}
+	humanizeEntries(r, resp.Entries)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_ = json.NewEncoder(w).Encode(resp)
 }
@@ -135,25 +249,32 @@ func (s *Service) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	clientPath := r.URL.Query().Get("path")
-	limit := 500
+	limit := defaultSearchLimit
 	if v := strings.TrimSpace(r.URL.Query().Get("limit")); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			if n > 5000 {
-				n = 5000
-			}
 			limit = n
 		}
 	}
+	maxDepth := 0
+	if v := strings.TrimSpace(r.URL.Query().Get("max_depth")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "bad max_depth", http.StatusBadRequest)
+			return
+		}
+		maxDepth = n
+	}
 	as, err := s.identityFromRequest(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	resp, err := s.searchAs(r.Context(), as, clientPath, q, limit)
+	resp, err := s.searchAs(r.Context(), as, clientPath, q, limit, maxDepth)
 	if err != nil {
 		s.writeFSError(w, err)
 		return
 	}
+	humanizeEntries(r, resp.Entries)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_ = json.NewEncoder(w).Encode(resp)
 }
@@ -169,20 +290,55 @@ func (s *Service) HandleRead(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	limit := int64(65536)
+	limit := min(int64(defaultReadLimit), s.maxRead)
 	if v := r.URL.Query().Get("limit"); v != "" {
-		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 && n <= 1<<20 {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 && n <= s.maxRead {
 			limit = n
 		}
 	}
 
-	buf, err := s.readAs(r.Context(), as, clientPath, limit)
+	override := strings.TrimSpace(r.URL.Query().Get("charset"))
+	cs := ""
+	if override != "" {
+		if cs, err = normalizeCharset(override); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	buf, truncated, err := s.readAs(r.Context(), as, clientPath, limit)
 	if err != nil {
 		s.writeFSError(w, err)
 		return
 	}
+	if r.URL.Query().Get("raw") == "1" {
+		// Exact bytes: truncation is only reported in a header.
+		ctype := mime.TypeByExtension(filepath.Ext(clientPath))
+		if ctype == "" {
+			ctype = http.DetectContentType(buf)
+		}
+		w.Header().Set("Content-Type", ctype)
+		// Never let file content (e.g. .html) run as same-origin script.
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+		w.Header().Set("X-Atlas-Truncated", strconv.FormatBool(truncated))
+		_, _ = w.Write(buf)
+		return
+	}
+	if cs == "" {
+		cs = detectCharset(buf)
+	}
+	text, err := decodeCharset(buf, cs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if truncated {
+		text = append(text, truncatedMarker...)
+	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	_, _ = w.Write(buf)
+	w.Header().Set("X-Atlas-Charset", cs)
+	_, _ = w.Write(text)
 }
 
 func (s *Service) HandleDownload(w http.ResponseWriter, r *http.Request) {
@@ -291,8 +447,8 @@ func (s *Service) HandleUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 512<<20)
-	if err := r.ParseMultipartForm(512 << 20); err != nil {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		http.Error(w, "bad multipart form", http.StatusBadRequest)
 		return
 	}
@@ -302,13 +458,106 @@ func (s *Service) HandleUpload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "file is required", http.StatusBadRequest)
 		return
 	}
-	for _, fh := range files {
-		if err := s.saveUploadedFileAs(r.Context(), as, dirAbs, fh); err != nil {
+	if r.URL.Query().Get("all_or_nothing") == "1" {
+		if err := s.uploadAllOrNothing(r.Context(), as, dirAbs, files); err != nil {
 			s.writeFSError(w, err)
 			return
 		}
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
-	w.WriteHeader(http.StatusNoContent)
+
+	// Each file is saved independently; failures are reported per file instead of
+	// aborting the batch with earlier files already written.
+	results := make([]uploadResult, 0, len(files))
+	var firstErr error
+	for _, fh := range files {
+		res := uploadResult{Name: filepath.Base(fh.Filename), Ok: true}
+		if err := s.saveUploadedFileAs(r.Context(), as, dirAbs, fh); err != nil {
+			res.Ok = false
+			res.Error = err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		results = append(results, res)
+	}
+	if firstErr == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if len(files) == 1 {
+		s.writeFSError(w, firstErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_ = json.NewEncoder(w).Encode(uploadResponse{Results: results})
+}
+
+type uploadResult struct {
+	Name  string `json:"name"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type uploadResponse struct {
+	Results []uploadResult `json:"results"`
+}
+
+// uploadAllOrNothing saves either every file or none. As "self" all files are staged
+// before any is renamed into place; via sudo, files this request created are removed
+// again after a failure (files it overwrote cannot be restored).
+func (s *Service) uploadAllOrNothing(ctx context.Context, as string, dirAbs string, files []*multipart.FileHeader) error {
+	if as == "self" {
+		var done []stagedFile
+		cleanup := func() {
+			for _, st := range done {
+				st.discard()
+			}
+		}
+		for _, fh := range files {
+			st, err := s.stageUploadedFile(dirAbs, fh)
+			if err != nil {
+				cleanup()
+				return fmt.Errorf("%s: %w", filepath.Base(fh.Filename), err)
+			}
+			done = append(done, st)
+		}
+		for i, st := range done {
+			if err := st.commit(); err != nil {
+				cleanup()
+				return fmt.Errorf("%s: %w", filepath.Base(st.dst), err)
+			}
+			done[i].tmp = ""
+		}
+		return nil
+	}
+
+	var created []string
+	for _, fh := range files {
+		clientPath := s.clientPath(filepath.Join(dirAbs, filepath.Base(fh.Filename)))
+		_, statErr := s.statAs(ctx, as, clientPath)
+		if err := s.saveUploadedFileAs(ctx, as, dirAbs, fh); err != nil {
+			for _, p := range created {
+				_ = s.deleteAs(ctx, as, p, false)
+			}
+			return fmt.Errorf("%s: %w", filepath.Base(fh.Filename), err)
+		}
+		// Only a file that was verifiably absent may be deleted on rollback.
+		if isNotExist(statErr) {
+			created = append(created, clientPath)
+		}
+	}
+	return nil
+}
+
+func (s *Service) sudoReport(r *http.Request) *sudocheck.Report {
+	if !s.sudoEnabled {
+		return nil
+	}
+	pass, ok, _ := s.sudoPassFor(r.Context())
+	return s.sudoCheck.ReportFor(r.Context(), r.URL.Query().Get("refresh") == "1", ok && pass != "")
 }
 
 func (s *Service) HandleIdentities(w http.ResponseWriter, r *http.Request) {
@@ -348,8 +597,14 @@ func (s *Service) HandleIdentities(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_ = json.NewEncoder(w).Encode(map[string]any{
 		"self":         s.selfUser,
+		"self_uid":     s.selfUID,
 		"sudo_enabled": s.sudoEnabled && s.sudoPath != "",
-		"allowed":      allowed,
+		// sudo tells the UI whether switching users needs a stored sudo password (?refresh=1 probes again).
+		"sudo":    s.sudoReport(r),
+		"allowed": allowed,
+		// The editor may request up to max_read_bytes via ?limit=.
+		"max_read_bytes":     s.maxRead,
+		"default_read_bytes": min(int64(defaultReadLimit), s.maxRead),
 	})
 }
 
@@ -451,7 +706,7 @@ func (s *Service) HandleWrite(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	r.Body = http.MaxBytesReader(w, r.Body, 2<<20)
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxWrite)
 	var req writeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
@@ -462,7 +717,22 @@ func (s *Service) HandleWrite(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "path is required", http.StatusBadRequest)
 		return
 	}
-	if err := s.writeFileAs(r.Context(), as, req.Path, []byte(req.Content)); err != nil {
+	cs, err := normalizeCharset(req.Charset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	content, err := encodeCharset([]byte(req.Content), cs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Wider charsets (UTF-16) can grow the content past the cap the body was read with.
+	if int64(len(content)) > s.maxWrite {
+		http.Error(w, "content too large (limit "+strconv.FormatInt(s.maxWrite, 10)+" bytes)", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := s.writeFileAs(r.Context(), as, req.Path, content); err != nil {
 		s.writeFSError(w, err)
 		return
 	}
@@ -489,6 +759,16 @@ func (s *Service) HandleRename(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if dryRunRequested(r) {
+		plan, err := s.planRenameAs(r.Context(), as, req.From, toName)
+		if err != nil {
+			s.writeFSError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(plan)
+		return
+	}
 	if err := s.renameAs(r.Context(), as, req.From, toName); err != nil {
 		s.writeFSError(w, err)
 		return
@@ -515,6 +795,16 @@ func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "paths required", http.StatusBadRequest)
 		return
 	}
+	if dryRunRequested(r) {
+		plan, err := s.planDeleteAs(r.Context(), as, req.Paths)
+		if err != nil {
+			s.writeFSError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(plan)
+		return
+	}
 	for _, p := range req.Paths {
 		if err := s.deleteAs(r.Context(), as, p, true); err != nil {
 			s.writeFSError(w, err)
@@ -572,7 +862,26 @@ func (s *Service) list(absDir string) ([]Entry, error) {
 	return out, nil
 }
 
-func (s *Service) search(absRoot string, query string, limit int) ([]Entry, bool, error) {
+// searchLimited runs search within the service caps: limit and maxDepth (0: the
+// configured cap) are clamped, and the walk stops after the search timeout.
+func (s *Service) searchLimited(ctx context.Context, absRoot string, query string, limit, maxDepth int) ([]Entry, bool, error) {
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, s.searchMax)
+	if s.searchDepth > 0 && (maxDepth <= 0 || maxDepth > s.searchDepth) {
+		maxDepth = s.searchDepth
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.searchTimeout)
+	defer cancel()
+	return s.search(ctx, absRoot, query, limit, maxDepth)
+}
+
+// search finds entries under absRoot whose name contains query (case-insensitive),
+// at most maxDepth levels down (0: any depth). It stops after limit matches or once
+// ctx is done, with truncated set, and ranks what it found: exact name matches
+// first, then prefix matches, then other substrings, newest first within each group.
+func (s *Service) search(ctx context.Context, absRoot string, query string, limit, maxDepth int) ([]Entry, bool, error) {
 	query = strings.ToLower(strings.TrimSpace(query))
 	if query == "" {
 		return nil, false, errors.New("query is required")
@@ -585,7 +894,7 @@ func (s *Service) search(absRoot string, query string, limit int) ([]Entry, bool
 		name := filepath.Base(absRoot)
 		if strings.Contains(strings.ToLower(name), query) {
 			client := s.clientPath(absRoot)
-			return []Entry{{Name: name, Path: client, IsDir: false, Size: info.Size(), ModUnix: info.ModTime().Unix()}}, false, nil
+			return []Entry{{Name: name, Path: client, IsDir: false, Size: info.Size(), ModUnix: info.ModTime().Unix(), RelPath: name}}, false, nil
 		}
 		return nil, false, nil
 	}
@@ -601,17 +910,30 @@ func (s *Service) search(absRoot string, query string, limit int) ([]Entry, bool
 		if path == absRoot {
 			return nil
 		}
+		if ctx.Err() != nil {
+			truncated = true
+			return limitErr
+		}
+		rel, err := filepath.Rel(absRoot, path)
+		if err != nil {
+			return nil
+		}
+		// Matching directories at the depth limit are still reported, just not entered.
+		var skip error
+		if maxDepth > 0 && d.IsDir() && strings.Count(rel, string(filepath.Separator))+1 >= maxDepth {
+			skip = filepath.SkipDir
+		}
 		name := d.Name()
 		if !strings.Contains(strings.ToLower(name), query) {
-			return nil
+			return skip
 		}
 		info, err := d.Info()
 		if err != nil {
-			return nil
+			return skip
 		}
 		p, err := s.ensureWithinRoot(path)
 		if err != nil {
-			return nil
+			return skip
 		}
 		client := s.clientPath(p)
 		out = append(out, Entry{
@@ -620,19 +942,46 @@ func (s *Service) search(absRoot string, query string, limit int) ([]Entry, bool
 			IsDir:   info.IsDir(),
 			Size:    info.Size(),
 			ModUnix: info.ModTime().Unix(),
+			RelPath: filepath.ToSlash(rel),
 		})
 		if len(out) >= limit {
 			truncated = true
 			return limitErr
 		}
-		return nil
+		return skip
 	})
 	if err != nil && !errors.Is(err, limitErr) {
 		return nil, false, err
 	}
+	rankSearchResults(out, query)
 	return out, truncated, nil
 }
 
+// rankSearchResults orders entries by how well their name matches query (lower-case).
+func rankSearchResults(entries []Entry, query string) {
+	rank := func(e Entry) int {
+		name := strings.ToLower(e.Name)
+		switch {
+		case name == query:
+			return 0
+		case strings.HasPrefix(name, query):
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		ri, rj := rank(entries[i]), rank(entries[j])
+		if ri != rj {
+			return ri < rj
+		}
+		if entries[i].ModUnix != entries[j].ModUnix {
+			return entries[i].ModUnix > entries[j].ModUnix
+		}
+		return entries[i].RelPath < entries[j].RelPath
+	})
+}
+
 func (s *Service) resolve(clientPath string) (string, error) {
 	if clientPath == "" {
 		clientPath = "/"
@@ -719,27 +1068,128 @@ func collectMultipartFiles(r *http.Request, field string) []*multipart.FileHeade
 }
 
 func (s *Service) saveUploadedFile(dirAbs string, fh *multipart.FileHeader) error {
+	st, err := s.stageUploadedFile(dirAbs, fh)
+	if err != nil {
+		return err
+	}
+	return st.commit()
+}
+
+// stageUploadedFile stages fh for its destination; the caller commits (or discards) it.
+func (s *Service) stageUploadedFile(dirAbs string, fh *multipart.FileHeader) (stagedFile, error) {
 	name := filepath.Base(fh.Filename)
 	if err := validateName(name); err != nil {
-		return err
+		return stagedFile{}, err
 	}
-	dstPath := filepath.Join(dirAbs, name)
-	dstPath, err := s.ensureWithinRoot(dstPath)
+	if err := checkUploadName(s.denyExt, name); err != nil {
+		return stagedFile{}, err
+	}
+	dst, err := s.ensureWithinRoot(filepath.Join(dirAbs, name))
 	if err != nil {
-		return err
+		return stagedFile{}, err
 	}
 
 	file, err := fh.Open()
 	if err != nil {
-		return err
+		return stagedFile{}, err
 	}
 	defer file.Close()
 
-	out, err := os.Create(dstPath)
+	return stageFile(dst, file)
+}
+
+// stagedFile is upload content held in a temp file until commit puts it at dst.
+type stagedFile struct {
+	tmp, dst string
+	// inPlace commits by copying into dst instead of renaming over it (see stageFile).
+	inPlace bool
+}
+
+// commit moves the staged content to dst and removes the temp file.
+func (f stagedFile) commit() error {
+	if !f.inPlace {
+		if err := os.Rename(f.tmp, f.dst); err != nil {
+			f.discard()
+			return err
+		}
+		return nil
+	}
+	defer f.discard()
+	in, err := os.Open(f.tmp)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	_, err = io.Copy(out, file)
+	defer in.Close()
+	out, err := os.OpenFile(f.dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
 	return err
 }
+
+func (f stagedFile) discard() {
+	if f.tmp != "" {
+		_ = os.Remove(f.tmp)
+	}
+}
+
+// stageFile copies src into a temp file, so a failed or truncated upload never
+// replaces dst. Normally the temp file sits next to dst and commit renames it over dst;
+// it then gets dst's mode and, where permitted, its owner and group (ACLs, extended
+// attributes and other hard links still stay with the old inode).
+//
+// Where a rename would change what the upload means, the temp file goes to the system
+// temp directory and commit writes through dst instead, as a plain overwrite would: when
+// dst is a symlink (the link target is updated, not the link replaced) and when the
+// directory is not writable but dst may be.
+func stageFile(dst string, src io.Reader) (stagedFile, error) {
+	mode := os.FileMode(0o644)
+	prev, err := os.Stat(dst)
+	if err == nil {
+		if !prev.Mode().IsRegular() {
+			return stagedFile{}, fmt.Errorf("%s is not a regular file", filepath.Base(dst))
+		}
+		mode = prev.Mode().Perm()
+	} else {
+		prev = nil
+	}
+	inPlace := false
+	if lst, err := os.Lstat(dst); err == nil && lst.Mode()&os.ModeSymlink != 0 {
+		inPlace = true
+	}
+	pattern := "." + filepath.Base(dst) + ".upload-*"
+	var out *os.File
+	if !inPlace {
+		out, err = os.CreateTemp(filepath.Dir(dst), pattern)
+		if errors.Is(err, os.ErrPermission) {
+			inPlace = true
+		} else if err != nil {
+			return stagedFile{}, err
+		}
+	}
+	if inPlace {
+		if out, err = os.CreateTemp("", pattern); err != nil {
+			return stagedFile{}, err
+		}
+	}
+	f := stagedFile{tmp: out.Name(), dst: dst, inPlace: inPlace}
+	_, err = io.Copy(out, src)
+	if err == nil && !inPlace {
+		if prev != nil {
+			keepOwner(out, prev)
+		}
+		err = out.Chmod(mode)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		f.discard()
+		return stagedFile{}, err
+	}
+	return f, nil
+}
@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/MrTeeett/atlas/internal/auth"
 )
@@ -118,6 +123,89 @@ func TestHandleListIncludesParent(t *testing.T) {
 	}
 }
 
+func TestHandleListStream(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "big")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	const files = listStreamBatch*2 + 10
+	for i := 0; i < files; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%04d", i)), []byte("abc"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	s := New(Config{RootDir: root})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.HandleListStream(rr, httptest.NewRequest(http.MethodGet, "http://example/api/fs/list-stream?path="+path, nil))
+		return rr
+	}
+	rr := get("/big")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/x-ndjson") {
+		t.Fatalf("status=%d type=%q body=%q", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	var end listStreamEnd
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &end); err != nil || !end.Done || end.Count != len(lines)-1 {
+		t.Fatalf("bad trailer %q: %v", lines[len(lines)-1], err)
+	}
+	seen := map[string]Entry{}
+	for i, line := range lines[:len(lines)-1] {
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if i == 0 && e.Name != ".." {
+			t.Fatalf("expected .. first, got %q", e.Name)
+		}
+		seen[e.Name] = e
+	}
+	// "..", "sub" and every file.
+	if len(seen) != files+2 || !seen["sub"].IsDir || seen["f0000"].Path != "/big/f0000" || seen["f0000"].Size != 3 {
+		t.Fatalf("unexpected entries: %d", len(seen))
+	}
+
+	if rr := get("/big/f0000"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("file: status=%d", rr.Code)
+	}
+	if rr := get("/missing"); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing: status=%d", rr.Code)
+	}
+}
+
+func TestHandleListHumanSizes(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "big.bin"), make([]byte, 3*1024/2), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	s := New(Config{RootDir: root})
+
+	for _, q := range []string{"", "&human=1"} {
+		req := httptest.NewRequest(http.MethodGet, "http://example/api/fs/list?path=/"+q, nil)
+		rr := httptest.NewRecorder()
+		s.HandleList(rr, req)
+		var resp listResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		want := ""
+		if q != "" {
+			want = "1.5 KiB"
+		}
+		for _, e := range resp.Entries {
+			if e.Name == "big.bin" && (e.Size != 1536 || e.SizeHuman != want) {
+				t.Fatalf("query %q: got %#v", q, e)
+			}
+		}
+	}
+}
+
 func TestHandleSearchRecursive(t *testing.T) {
 	t.Parallel()
 
@@ -151,6 +239,113 @@ func TestHandleSearchRecursive(t *testing.T) {
 	}
 }
 
+func TestSearchRanking(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "x", "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	now := time.Now()
+	files := []struct {
+		path string
+		age  time.Duration
+	}{
+		{"x/sub/snapp", 3 * time.Hour},
+		{"x/sub/myapp.conf", time.Hour},
+		{"x/apple.txt", 5 * time.Hour},
+		{"x/App", 10 * time.Hour},
+		{"x/other", 0},
+	}
+	for _, f := range files {
+		p := filepath.Join(root, f.path)
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		mt := now.Add(-f.age)
+		if err := os.Chtimes(p, mt, mt); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+	s := New(Config{RootDir: root})
+
+	entries, truncated, err := s.search(context.Background(), filepath.Join(root, "x"), "app", 100, 0)
+	if err != nil || truncated {
+		t.Fatalf("search: truncated=%v err=%v", truncated, err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.RelPath)
+	}
+	want := []string{"App", "apple.txt", "sub/myapp.conf", "sub/snapp"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("order=%q want %q", got, want)
+	}
+	if entries[2].Path != "/x/sub/myapp.conf" {
+		t.Fatalf("path=%q", entries[2].Path)
+	}
+
+	if entries, truncated, err = s.search(context.Background(), filepath.Join(root, "x"), "app", 2, 0); err != nil || !truncated || len(entries) != 2 {
+		t.Fatalf("limited: n=%d truncated=%v err=%v", len(entries), truncated, err)
+	}
+}
+
+func TestSearchDepthAndTimeout(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "deep", "deeper"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "deep", "deeper", "deepest.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	search := func(s *Service, query string) searchResponse {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		s.HandleSearch(rr, httptest.NewRequest(http.MethodGet, "http://example/api/fs/search?path=/&q=deep"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("search %s: status=%d body=%q", query, rr.Code, rr.Body.String())
+		}
+		var resp searchResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		return resp
+	}
+	names := func(resp searchResponse) []string {
+		var out []string
+		for _, e := range resp.Entries {
+			out = append(out, e.RelPath)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	s := New(Config{RootDir: root})
+	if got := names(search(s, "")); len(got) != 3 {
+		t.Fatalf("unlimited depth: %q", got)
+	}
+	if got := names(search(s, "&max_depth=2")); strings.Join(got, ",") != "deep,deep/deeper" {
+		t.Fatalf("max_depth=2: %q", got)
+	}
+	capped := New(Config{RootDir: root, SearchMaxDepth: 1, SearchMaxResults: 10})
+	if got := names(search(capped, "&max_depth=5")); strings.Join(got, ",") != "deep" {
+		t.Fatalf("configured cap: %q", got)
+	}
+	if resp := search(capped, "&limit=1000"); resp.Truncated {
+		t.Fatalf("limit above the cap should be clamped, not truncate: %+v", resp)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	entries, truncated, err := s.search(ctx, root, "deep", 100, 0)
+	if err != nil || !truncated || len(entries) != 0 {
+		t.Fatalf("expired budget: n=%d truncated=%v err=%v", len(entries), truncated, err)
+	}
+}
+
 func TestHandleDownloadSelf(t *testing.T) {
 	t.Parallel()
 
@@ -223,6 +418,116 @@ func TestHandleReadTruncates(t *testing.T) {
 	if !strings.Contains(rr.Body.String(), "file truncated") {
 		t.Fatalf("expected truncated marker, got %q", rr.Body.String())
 	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example/api/fs/read?path=/big.txt&limit=10&raw=1", nil)
+	rr = httptest.NewRecorder()
+	s.HandleRead(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != strings.Repeat("a", 10) {
+		t.Fatalf("raw read status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Atlas-Truncated") != "true" || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected raw headers: %v", rr.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example/api/fs/read?path=/big.txt&limit=100&raw=1", nil)
+	rr = httptest.NewRecorder()
+	s.HandleRead(rr, req)
+	if rr.Body.Len() != 50 || rr.Header().Get("X-Atlas-Truncated") != "false" {
+		t.Fatalf("raw full read len=%d headers=%v", rr.Body.Len(), rr.Header())
+	}
+}
+
+func TestHandleReadHonorsConfiguredCap(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "big.txt"), []byte(strings.Repeat("a", 50)), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	s := New(Config{RootDir: root, MaxReadBytes: 20})
+
+	// Limits above the cap are ignored; the default request limit is clamped to the cap.
+	req := httptest.NewRequest(http.MethodGet, "http://example/api/fs/read?path=/big.txt&limit=40&raw=1", nil)
+	rr := httptest.NewRecorder()
+	s.HandleRead(rr, req)
+	if rr.Body.Len() != 20 || rr.Header().Get("X-Atlas-Truncated") != "true" {
+		t.Fatalf("capped read len=%d headers=%v", rr.Body.Len(), rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	s.HandleIdentities(rr, httptest.NewRequest(http.MethodGet, "http://example/api/fs/identities", nil))
+	if !strings.Contains(rr.Body.String(), `"max_read_bytes":20`) || !strings.Contains(rr.Body.String(), `"default_read_bytes":20`) {
+		t.Fatalf("identities body=%q", rr.Body.String())
+	}
+}
+
+func TestHandleWriteHonorsConfiguredCap(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	s := New(Config{RootDir: root, MaxWriteBytes: 64})
+
+	req := httptest.NewRequest(http.MethodPost, "http://example/api/fs/write", strings.NewReader(`{"path":"/a.txt","content":"`+strings.Repeat("a", 64)+`"}`))
+	rr := httptest.NewRecorder()
+	s.HandleWrite(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 above the write cap, got %d", rr.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("oversized write created the file: %v", err)
+	}
+	if got := strings.Join(s.helperArgs("writefile"), " "); !strings.Contains(got, "--max-write 64") {
+		t.Fatalf("helper args must carry the write cap: %q", got)
+	}
+
+	// The body fits, but UTF-16 doubles it past the cap.
+	s = New(Config{RootDir: root, MaxWriteBytes: 200})
+	req = httptest.NewRequest(http.MethodPost, "http://example/api/fs/write", strings.NewReader(`{"path":"/a.txt","content":"`+strings.Repeat("a", 100)+`","charset":"utf-16le"}`))
+	rr = httptest.NewRecorder()
+	s.HandleWrite(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for encoded content above the cap, got %d body=%q", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("oversized encoded write created the file: %v", err)
+	}
+}
+
+// TestHelperWriteFileCap swaps os.Stdin, so it must not run in parallel.
+func TestHelperWriteFileCap(t *testing.T) {
+	root := t.TempDir()
+	dst := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(dst, []byte("keep"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	run := func(content string) int {
+		in := filepath.Join(t.TempDir(), "stdin")
+		if err := os.WriteFile(in, []byte(content), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		f, err := os.Open(in)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer f.Close()
+		old := os.Stdin
+		os.Stdin = f
+		defer func() { os.Stdin = old }()
+		return RunHelper([]string{"--root", root, "--max-write", "8", "writefile", "--path", "/a.txt"})
+	}
+
+	if code := run("123456789"); code == 0 {
+		t.Fatalf("oversized writefile succeeded")
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "keep" {
+		t.Fatalf("oversized writefile touched the file: %q", b)
+	}
+	if code := run("12345678"); code != 0 {
+		t.Fatalf("writefile at the cap failed: %d", code)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "12345678" {
+		t.Fatalf("writefile content: %q", b)
+	}
 }
 
 func TestHandleMkdirBadName(t *testing.T) {
@@ -272,6 +577,41 @@ func TestHandleIdentitiesSudoIntersection(t *testing.T) {
 	}
 }
 
+func TestLookupSelfUser(t *testing.T) {
+	t.Parallel()
+
+	passwd := filepath.Join(t.TempDir(), "passwd")
+	if err := os.WriteFile(passwd, []byte("# comment\nroot:x:0:0::/root:/bin/sh\napp:x:4242:4242::/app:/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// An uid nobody has, so NSS and os/user.Current cannot answer either.
+	const unknown = 2147480001
+	for _, tc := range []struct {
+		uid      int
+		override string
+		want     string
+	}{
+		{4242, "", "app"},
+		{4242, "svc", "app"},
+		{unknown, "svc", "svc"},
+		{unknown, "", "self"},
+	} {
+		if got := lookupSelfUser(tc.uid, passwd, tc.override); got != tc.want {
+			t.Fatalf("lookupSelfUser(%d, %q) = %q, want %q", tc.uid, tc.override, got, tc.want)
+		}
+	}
+
+	s := New(Config{RootDir: t.TempDir()})
+	rr := httptest.NewRecorder()
+	s.HandleIdentities(rr, httptest.NewRequest(http.MethodGet, "http://example/api/fs/identities", nil))
+	var resp struct {
+		SelfUID *int `json:"self_uid"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.SelfUID == nil || *resp.SelfUID != os.Geteuid() {
+		t.Fatalf("self_uid: %v %s", err, rr.Body.String())
+	}
+}
+
 func TestIdentityFromRequestSudoDisabled(t *testing.T) {
 	t.Parallel()
 
@@ -329,3 +669,369 @@ func TestWriteFSErrorMapping(t *testing.T) {
 		t.Fatalf("expected 500, got %d", rr.Code)
 	}
 }
+
+func TestHandleReadDetectsCharset(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	files := map[string][]byte{
+		"utf8.txt":   []byte("héllo"),
+		"bom.txt":    append([]byte{0xEF, 0xBB, 0xBF}, []byte("héllo")...),
+		"latin1.txt": {'h', 0xE9, 'l', 'l', 'o'},
+		"utf16.txt":  {0xFF, 0xFE, 'h', 0, 0xE9, 0, 'l', 0, 'l', 0, 'o', 0},
+		"le.txt":     {'h', 0, 0xE9, 0, 'l', 0, 'l', 0, 'o', 0},
+		"be.txt":     {0, 'h', 0, 0xE9, 0, 'l', 0, 'l', 0, 'o'},
+	}
+	for name, b := range files {
+		if err := os.WriteFile(filepath.Join(root, name), b, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	s := New(Config{RootDir: root})
+
+	cases := []struct{ name, query, charset, want string }{
+		{"utf8.txt", "", "utf-8", "héllo"},
+		{"bom.txt", "", "utf-8-bom", "héllo"},
+		{"latin1.txt", "", "windows-1252", "héllo"},
+		{"latin1.txt", "&charset=latin1", "iso-8859-1", "héllo"},
+		{"utf16.txt", "", "utf-16le", "héllo"},
+		// UTF-16 without a BOM can't be sniffed, but decodes when asked for.
+		{"le.txt", "&charset=utf-16le", "utf-16le", "héllo"},
+		{"be.txt", "&charset=utf-16be", "utf-16be", "héllo"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example/api/fs/read?path=/"+tc.name+tc.query, nil)
+		rr := httptest.NewRecorder()
+		s.HandleRead(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: status=%d body=%q", tc.name, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("X-Atlas-Charset"); got != tc.charset {
+			t.Fatalf("%s: charset=%q want %q", tc.name, got, tc.charset)
+		}
+		if rr.Body.String() != tc.want {
+			t.Fatalf("%s: body=%q", tc.name, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example/api/fs/read?path=/utf8.txt&charset=klingon", nil)
+	rr := httptest.NewRecorder()
+	s.HandleRead(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown charset, got %d", rr.Code)
+	}
+}
+
+func TestHandleWriteEncodesCharset(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	s := New(Config{RootDir: root})
+
+	req := httptest.NewRequest(http.MethodPost, "http://example/api/fs/write", strings.NewReader(`{"path":"/a.txt","content":"héllo","charset":"iso-8859-1"}`))
+	rr := httptest.NewRecorder()
+	s.HandleWrite(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("write status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	b, err := os.ReadFile(filepath.Join(root, "a.txt"))
+	if err != nil || string(b) != "h\xe9llo" {
+		t.Fatalf("written=%q err=%v", b, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "http://example/api/fs/write", strings.NewReader(`{"path":"/b.txt","content":"日本","charset":"iso-8859-1"}`))
+	rr = httptest.NewRecorder()
+	s.HandleWrite(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unencodable content, got %d", rr.Code)
+	}
+}
+
+func TestStageFileWritesThrough(t *testing.T) {
+	t.Parallel()
+
+	// A symlinked destination is updated through the link, not replaced by a file.
+	root := t.TempDir()
+	target := filepath.Join(root, "real.txt")
+	link := filepath.Join(root, "link.txt")
+	if err := os.WriteFile(target, []byte("old"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Symlink("real.txt", link); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	st, err := stageFile(link, strings.NewReader("new"))
+	if err != nil {
+		t.Fatalf("stageFile: %v", err)
+	}
+	if filepath.Dir(st.tmp) == root {
+		t.Fatalf("symlink upload staged next to the link: %s", st.tmp)
+	}
+	if err := st.commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("link replaced: %v %v", fi, err)
+	}
+	if b, _ := os.ReadFile(target); string(b) != "new" {
+		t.Fatalf("target content=%q", b)
+	}
+	if _, err := os.Stat(st.tmp); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+
+	if !isNotExist(errors.New("stat /x: no such file or directory")) || isNotExist(errors.New("permission denied")) || isNotExist(nil) {
+		t.Fatalf("isNotExist misclassifies helper errors")
+	}
+
+	// A file the user may write in a directory they may not: overwrite in place.
+	if os.Geteuid() == 0 {
+		return // root bypasses directory permissions
+	}
+	dir := filepath.Join(t.TempDir(), "ro")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	dst := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(dst, []byte("old"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	defer os.Chmod(dir, 0o755)
+	st, err = stageFile(dst, strings.NewReader("new"))
+	if err != nil {
+		t.Fatalf("stageFile in a read-only dir: %v", err)
+	}
+	if err := st.commit(); err != nil {
+		t.Fatalf("commit in a read-only dir: %v", err)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "new" {
+		t.Fatalf("read-only dir content=%q", b)
+	}
+}
+
+func TestHandleUploadPartialAndAllOrNothing(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "d", "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	s := New(Config{RootDir: root})
+
+	upload := func(query string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		// "sub" is an existing directory, so it cannot be replaced by a file.
+		for _, name := range []string{"a.txt", "sub", "c.txt"} {
+			fw, err := mw.CreateFormFile("file", name)
+			if err != nil {
+				t.Fatalf("CreateFormFile: %v", err)
+			}
+			_, _ = fw.Write([]byte("payload " + name))
+		}
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "http://example/api/fs/upload?path=/d"+query, &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+		s.HandleUpload(rr, req)
+		return rr
+	}
+
+	rr := upload("&all_or_nothing=1")
+	if rr.Code < 400 {
+		t.Fatalf("expected error, got %d", rr.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "d", "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("all_or_nothing left a.txt behind: %v", err)
+	}
+	if ents, _ := os.ReadDir(filepath.Join(root, "d")); len(ents) != 1 {
+		t.Fatalf("expected only sub/, got %v", ents)
+	}
+
+	rr = upload("")
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d body=%q", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Results []struct {
+			Name  string `json:"name"`
+			Ok    bool   `json:"ok"`
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(resp.Results) != 3 || !resp.Results[0].Ok || resp.Results[1].Ok || resp.Results[1].Error == "" || !resp.Results[2].Ok {
+		t.Fatalf("unexpected results: %+v", resp.Results)
+	}
+	for _, name := range []string{"a.txt", "c.txt"} {
+		b, err := os.ReadFile(filepath.Join(root, "d", name))
+		if err != nil || string(b) != "payload "+name {
+			t.Fatalf("%s mismatch err=%v body=%q", name, err, string(b))
+		}
+	}
+}
+
+func TestHandleUploadDenyExt(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	s := New(Config{RootDir: root, UploadDenyExt: []string{".PHP", "phtml"}})
+
+	upload := func(names ...string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, name := range names {
+			fw, err := mw.CreateFormFile("file", name)
+			if err != nil {
+				t.Fatalf("CreateFormFile: %v", err)
+			}
+			_, _ = fw.Write([]byte("<?php"))
+		}
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "http://example/api/fs/upload?path=/&all_or_nothing=1", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+		s.HandleUpload(rr, req)
+		return rr
+	}
+
+	rr := upload("ok.txt", "shell.Php")
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "shell.Php") {
+		t.Fatalf("blocked upload status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "ok.txt")); !os.IsNotExist(err) {
+		t.Fatalf("all-or-nothing upload wrote a file despite the blocked one: %v", err)
+	}
+	if rr := upload("notes.php.txt", "php"); rr.Code != http.StatusNoContent {
+		t.Fatalf("only the final extension should count: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	if got := New(Config{RootDir: root}).helperArgs("write"); strings.Contains(strings.Join(got, " "), "--deny-ext") {
+		t.Fatalf("helper args without a denylist: %q", got)
+	}
+	if got := strings.Join(s.helperArgs("write", "--name", "x"), " "); !strings.Contains(got, "--deny-ext php,phtml write --name x") {
+		t.Fatalf("helper args must carry the denylist: %q", got)
+	}
+
+	// Touch, rename and write must not be a way around the denylist.
+	post := func(h http.HandlerFunc, url, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		return rr
+	}
+	if rr := post(s.HandleTouch, "http://example/api/fs/touch?path=/&name=x.php", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("touch status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := post(s.HandleRename, "http://example/api/fs/rename", `{"from":"/notes.php.txt","to":"notes.php"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("rename status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := post(s.HandleWrite, "http://example/api/fs/write", `{"path":"/y.phtml","content":"<?php"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("write status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	for _, name := range []string{"x.php", "notes.php", "y.phtml"} {
+		if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s was created despite the denylist: %v", name, err)
+		}
+	}
+
+	// Files that already exist stay editable and can be renamed within their extension.
+	if err := os.WriteFile(filepath.Join(root, "legacy.php"), []byte("<?php"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if rr := post(s.HandleWrite, "http://example/api/fs/write", `{"path":"/legacy.php","content":"<?php echo 1;"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("write existing status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := post(s.HandleRename, "http://example/api/fs/rename", `{"from":"/legacy.php","to":"old.PHP"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("rename existing status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "old.PHP")); err != nil || string(b) != "<?php echo 1;" {
+		t.Fatalf("old.PHP=%q err=%v", b, err)
+	}
+}
+
+func TestDeleteRenameDryRun(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "d", "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for name, data := range map[string]string{"d/a.txt": "aaa", "d/sub/b.txt": "bb", "c.txt": "c"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	s := New(Config{RootDir: root})
+
+	post := func(h http.HandlerFunc, url string, body any) (*httptest.ResponseRecorder, dryRunResponse) {
+		b, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(b)))
+		var plan dryRunResponse
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &plan); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return rr, plan
+	}
+
+	rr, plan := post(s.HandleDelete, "http://example/api/fs/delete?dry_run=1", map[string]any{"paths": []string{"/d", "/c.txt"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete dry run status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	want := []string{"/d", "/d/a.txt", "/d/sub", "/d/sub/b.txt", "/c.txt"}
+	if !reflect.DeepEqual(plan.Paths, want) || plan.Count != 5 || plan.TotalBytes != 6 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if _, err := os.Stat(filepath.Join(root, "d", "sub", "b.txt")); err != nil {
+		t.Fatalf("dry run deleted files: %v", err)
+	}
+
+	rr, plan = post(s.HandleRename, "http://example/api/fs/rename?dry_run=1", map[string]any{"from": "/d/a.txt", "to": "sub"})
+	if rr.Code != http.StatusOK || plan.Count != 1 || plan.Overwrites != "/d/sub" {
+		t.Fatalf("rename dry run status=%d plan=%+v", rr.Code, plan)
+	}
+	if _, err := os.Stat(filepath.Join(root, "d", "a.txt")); err != nil {
+		t.Fatalf("dry run renamed the file: %v", err)
+	}
+
+	if rr, _ := post(s.HandleDelete, "http://example/api/fs/delete?dry_run=1", map[string]any{"paths": []string{"/../.."}}); rr.Code == http.StatusOK {
+		t.Fatalf("expected root to be refused, got %d", rr.Code)
+	}
+}
+
+func TestMissingHelperBinary(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain")
+	if err := os.WriteFile(plain, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkHelper("/bin/true"); err != nil {
+		t.Fatalf("checkHelper(/bin/true): %v", err)
+	}
+	for _, p := range []string{"", plain, dir, filepath.Join(dir, "gone")} {
+		if err := checkHelper(p); !errors.Is(err, errHelperUnusable) {
+			t.Fatalf("checkHelper(%q) = %v", p, err)
+		}
+	}
+
+	missing := filepath.Join(dir, "atlas (deleted)")
+	s := New(Config{RootDir: dir, SudoEnabled: true, SudoAny: true, HelperBinary: missing})
+	s.sudoPath = "/bin/sudo"
+	claims := auth.Claims{UserInfo: auth.UserInfo{FSSudo: true, FSAny: true}}
+	req := httptest.NewRequest(http.MethodGet, "http://example/api/fs/list?path=/", nil).WithContext(auth.WithClaims(context.Background(), claims))
+	req.Header.Set("X-Atlas-FS-User", "daemon")
+	rr := httptest.NewRecorder()
+	s.HandleList(rr, req)
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "sudo helper binary is not usable") || !strings.Contains(rr.Body.String(), missing) {
+		t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+	}
+}
@@ -1,6 +1,8 @@
 package fs
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -16,6 +18,12 @@ func RunHelper(args []string) int {
 	global := flag.NewFlagSet("fs-helper", flag.ContinueOnError)
 	global.SetOutput(io.Discard)
 	root := global.String("root", os.Getenv("ATLAS_ROOT"), "root")
+	maxRead := global.Int64("max-read", defaultMaxRead, "max read limit")
+	maxWrite := global.Int64("max-write", defaultMaxWrite, "max writefile size")
+	denyExt := global.String("deny-ext", "", "comma-separated upload extension denylist")
+	searchMax := global.Int("search-max", defaultSearchMax, "search result cap")
+	searchDepth := global.Int("search-depth", 0, "search depth cap")
+	searchTimeout := global.Duration("search-timeout", defaultSearchTimeout, "search time budget")
 	if err := global.Parse(args); err != nil {
 		fmt.Fprintln(os.Stderr, "bad args")
 		return 2
@@ -27,7 +35,8 @@ func RunHelper(args []string) int {
 	}
 	op := rest[0]
 	rest = rest[1:]
-	svc := New(Config{RootDir: *root})
+	svc := New(Config{RootDir: *root, MaxReadBytes: *maxRead, MaxWriteBytes: *maxWrite, UploadDenyExt: []string{*denyExt},
+		SearchMaxResults: *searchMax, SearchMaxDepth: *searchDepth, SearchTimeout: *searchTimeout})
 
 	switch op {
 	case "list":
@@ -51,12 +60,44 @@ func RunHelper(args []string) int {
 		_ = json.NewEncoder(os.Stdout).Encode(listResponse{Path: svc.clientPath(abs), Entries: entries})
 		return 0
 
+	case "list-stream":
+		fs := flag.NewFlagSet("list-stream", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		path := fs.String("path", "/", "path")
+		if err := fs.Parse(rest); err != nil {
+			fmt.Fprintln(os.Stderr, "bad args")
+			return 2
+		}
+		abs, err := svc.resolve(*path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		dir, err := openListDir(abs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		defer dir.Close()
+		out := bufio.NewWriter(os.Stdout)
+		enc := json.NewEncoder(out)
+		err = svc.streamList(context.Background(), dir, func(e Entry) error { return enc.Encode(e) })
+		if ferr := out.Flush(); err == nil {
+			err = ferr
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		return 0
+
 	case "search":
 		fs := flag.NewFlagSet("search", flag.ContinueOnError)
 		fs.SetOutput(io.Discard)
 		path := fs.String("path", "/", "path")
 		query := fs.String("q", "", "query")
-		limit := fs.Int("limit", 500, "limit")
+		limit := fs.Int("limit", defaultSearchLimit, "limit")
+		maxDepth := fs.Int("max-depth", 0, "max depth")
 		if err := fs.Parse(rest); err != nil {
 			fmt.Fprintln(os.Stderr, "bad args")
 			return 2
@@ -65,18 +106,12 @@ func RunHelper(args []string) int {
 			fmt.Fprintln(os.Stderr, "q is required")
 			return 2
 		}
-		if *limit <= 0 {
-			*limit = 500
-		}
-		if *limit > 5000 {
-			*limit = 5000
-		}
 		abs, err := svc.resolve(*path)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 1
 		}
-		entries, truncated, err := svc.search(abs, *query, *limit)
+		entries, truncated, err := svc.searchLimited(context.Background(), abs, *query, *limit, *maxDepth)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 1
@@ -93,11 +128,16 @@ func RunHelper(args []string) int {
 		fs := flag.NewFlagSet("read", flag.ContinueOnError)
 		fs.SetOutput(io.Discard)
 		path := fs.String("path", "/", "path")
-		limit := fs.Int64("limit", 65536, "limit")
+		limit := fs.Int64("limit", defaultReadLimit, "limit")
+		raw := fs.Bool("raw", false, "write up to limit+1 bytes without the truncation marker")
 		if err := fs.Parse(rest); err != nil {
 			fmt.Fprintln(os.Stderr, "bad args")
 			return 2
 		}
+		if *limit <= 0 || *limit > svc.maxRead {
+			fmt.Fprintln(os.Stderr, "limit out of range")
+			return 2
+		}
 		abs, err := svc.resolve(*path)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
@@ -114,8 +154,8 @@ func RunHelper(args []string) int {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 1
 		}
-		if int64(len(buf)) > *limit {
-			buf = append(buf[:*limit], []byte("\n\n... file truncated ...\n")...)
+		if int64(len(buf)) > *limit && !*raw {
+			buf = append(buf[:*limit], []byte(truncatedMarker)...)
 		}
 		_, _ = os.Stdout.Write(buf)
 		return 0
@@ -184,6 +224,10 @@ func RunHelper(args []string) int {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 2
 		}
+		if err := checkUploadName(svc.denyExt, *name); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
 		dirAbs, err := svc.resolve(*dir)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
@@ -199,13 +243,12 @@ func RunHelper(args []string) int {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 1
 		}
-		out, err := os.Create(dst)
+		staged, err := stageFile(dst, os.Stdin)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 1
 		}
-		defer out.Close()
-		if _, err := io.Copy(out, os.Stdin); err != nil {
+		if err := staged.commit(); err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 1
 		}
@@ -254,6 +297,10 @@ func RunHelper(args []string) int {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 2
 		}
+		if err := checkUploadName(svc.denyExt, *name); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
 		dirAbs, err := svc.resolve(*path)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
@@ -298,17 +345,31 @@ func RunHelper(args []string) int {
 			fmt.Fprintln(os.Stderr, "cannot write root")
 			return 2
 		}
+		if err := checkWriteName(svc.denyExt, abs); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
 		if st, err := os.Stat(abs); err == nil && st.IsDir() {
 			fmt.Fprintln(os.Stderr, "path is a directory")
 			return 1
 		}
+		// Read everything first, so oversized content fails before the file is truncated.
+		content, err := io.ReadAll(io.LimitReader(os.Stdin, svc.maxWrite+1))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		if int64(len(content)) > svc.maxWrite {
+			fmt.Fprintln(os.Stderr, "content too large")
+			return 1
+		}
 		f, err := os.OpenFile(abs, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 1
 		}
 		defer f.Close()
-		if _, err := io.Copy(f, io.LimitReader(os.Stdin, 2<<20)); err != nil {
+		if _, err := f.Write(content); err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 1
 		}
@@ -319,6 +380,7 @@ func RunHelper(args []string) int {
 		fs.SetOutput(io.Discard)
 		from := fs.String("from", "", "from")
 		to := fs.String("to", "", "to")
+		dryRun := fs.Bool("dry-run", false, "print what would be moved")
 		if err := fs.Parse(rest); err != nil {
 			fmt.Fprintln(os.Stderr, "bad args")
 			return 2
@@ -331,6 +393,13 @@ func RunHelper(args []string) int {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return 2
 		}
+		if *dryRun {
+			return printPlan(svc.planRename(context.Background(), *from, *to))
+		}
+		if err := checkRenameName(svc.denyExt, *from, *to); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
 		fromAbs, err := svc.resolve(*from)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
@@ -357,6 +426,7 @@ func RunHelper(args []string) int {
 		fs.SetOutput(io.Discard)
 		path := fs.String("path", "", "path")
 		recursive := fs.Bool("recursive", false, "recursive")
+		dryRun := fs.Bool("dry-run", false, "print what would be removed")
 		if err := fs.Parse(rest); err != nil {
 			fmt.Fprintln(os.Stderr, "bad args")
 			return 2
@@ -365,6 +435,9 @@ func RunHelper(args []string) int {
 			fmt.Fprintln(os.Stderr, "path is required")
 			return 2
 		}
+		if *dryRun {
+			return printPlan(svc.planDelete(context.Background(), *path))
+		}
 		abs, err := svc.resolve(*path)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
@@ -391,3 +464,12 @@ func RunHelper(args []string) int {
 		return 2
 	}
 }
+
+func printPlan(plan dryRunResponse, err error) int {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(plan)
+	return 0
+}
@@ -0,0 +1,230 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MrTeeett/atlas/internal/units"
+)
+
+// listStreamBatch is how many directory entries are read (and flushed) at a time.
+const listStreamBatch = 256
+
+// listStreamEnd is the last line of /api/fs/list-stream. A stream without it was cut off.
+type listStreamEnd struct {
+	Done  bool   `json:"done"`
+	Count int    `json:"count"`
+	Error string `json:"error,omitempty"`
+}
+
+var errNotDir = errors.New("not a directory")
+
+// openListDir opens absDir for streamList.
+func openListDir(absDir string) (*os.File, error) {
+	f, err := os.Open(absDir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.IsDir() {
+		f.Close()
+		return nil, errNotDir
+	}
+	return f, nil
+}
+
+// streamList calls emit for each entry of dir in directory order (".." first), unlike
+// list, which reads and sorts everything. Only one batch is held in memory.
+func (s *Service) streamList(ctx context.Context, dir *os.File, emit func(Entry) error) error {
+	absDir := dir.Name()
+	client := s.clientPath(absDir)
+	if client != "/" {
+		parentAbs, _ := s.resolve(filepath.Dir(client))
+		if err := emit(Entry{Name: "..", Path: s.clientPath(parentAbs), IsDir: true}); err != nil {
+			return err
+		}
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, err := dir.ReadDir(listStreamBatch)
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			p, err := s.ensureWithinRoot(filepath.Join(absDir, e.Name()))
+			if err != nil {
+				continue
+			}
+			if err := emit(Entry{
+				Name:    e.Name(),
+				Path:    s.clientPath(p),
+				IsDir:   info.IsDir(),
+				Size:    info.Size(),
+				ModUnix: info.ModTime().Unix(),
+			}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// HandleListStream lists a directory as NDJSON: one Entry per line, unsorted, then a
+// listStreamEnd line. Use it instead of HandleList for very large directories.
+func (s *Service) HandleListStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	clientPath := r.URL.Query().Get("path")
+	as, err := s.identityFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	human := units.HumanRequested(r)
+	enc := json.NewEncoder(w)
+	end := listStreamEnd{}
+	emit := func(e Entry) error {
+		if human && !e.IsDir && e.Size >= 0 {
+			e.SizeHuman = units.HumanizeBytes(uint64(e.Size))
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		end.Count++
+		if end.Count%listStreamBatch == 0 {
+			fl.Flush()
+		}
+		return nil
+	}
+	start := func() {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	finish := func(err error) {
+		if err != nil {
+			end.Error = err.Error()
+		} else {
+			end.Done = true
+		}
+		_ = enc.Encode(end)
+		fl.Flush()
+	}
+
+	if as == "self" {
+		abs, err := s.resolve(clientPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dir, err := openListDir(abs)
+		if errors.Is(err, errNotDir) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			s.writeFSError(w, err)
+			return
+		}
+		defer dir.Close()
+		start()
+		finish(s.streamList(r.Context(), dir, emit))
+		return
+	}
+
+	// The helper prints bare entries; the first line (or its failure) decides the status.
+	cmd, pass, err := s.sudoCmdWithPassword(r.Context(), as, "list-stream", "--path", clientPath)
+	if err != nil {
+		s.writeFSError(w, err)
+		return
+	}
+	if pass != "" {
+		cmd.Stdin = strings.NewReader(pass + "\n")
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		s.writeFSError(w, err)
+		return
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		s.writeFSError(w, err)
+		return
+	}
+	wait := func() error {
+		if err := cmd.Wait(); err != nil {
+			if stderr.Len() > 0 {
+				return errors.New(strings.TrimSpace(stderr.String()))
+			}
+			return err
+		}
+		return nil
+	}
+	sc := bufio.NewScanner(stdout)
+	if !sc.Scan() {
+		if err := wait(); err != nil {
+			if err.Error() == errNotDir.Error() {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.writeFSError(w, err)
+			return
+		}
+		start()
+		finish(nil)
+		return
+	}
+	start()
+	var streamErr error
+	for {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			streamErr = err
+			break
+		}
+		e.Path = normalizeClientPath(e.Path)
+		if err := emit(e); err != nil {
+			streamErr = err
+			break
+		}
+		if !sc.Scan() {
+			streamErr = sc.Err()
+			break
+		}
+	}
+	if streamErr != nil {
+		_ = cmd.Process.Kill()
+		_ = wait()
+	} else {
+		streamErr = wait()
+	}
+	finish(streamErr)
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// keepOwner gives f the owner and group of st (the file it is about to replace).
+// It is best-effort: only root can hand a file to another user, and a failed chown
+// leaves the new file owned by whoever wrote it.
+func keepOwner(f *os.File, st os.FileInfo) {
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+		_ = f.Chown(int(sys.Uid), int(sys.Gid))
+	}
+}
@@ -0,0 +1,38 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestStageFileKeepsOwner(t *testing.T) {
+	t.Parallel()
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to chown")
+	}
+
+	dst := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(dst, []byte("old"), 0o640); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Chown(dst, 65534, 65534); err != nil {
+		t.Fatalf("chown: %v", err)
+	}
+
+	staged, err := stageFile(dst, strings.NewReader("new"))
+	if err != nil {
+		t.Fatalf("stageFile: %v", err)
+	}
+	defer staged.discard()
+	st, err := os.Stat(staged.tmp)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	sys := st.Sys().(*syscall.Stat_t)
+	if sys.Uid != 65534 || sys.Gid != 65534 || st.Mode().Perm() != 0o640 {
+		t.Fatalf("staged file uid=%d gid=%d mode=%v", sys.Uid, sys.Gid, st.Mode().Perm())
+	}
+}
@@ -0,0 +1,70 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// errUploadBlocked prefixes upload denylist errors; the sudo helper reports the same text
+// on stderr, so writeFSError can map both to 403.
+const errUploadBlocked = "upload blocked"
+
+// parseExtList normalizes extensions ("PHP", ".php") to a set of lowercase names without
+// the leading dot.
+func parseExtList(exts []string) map[string]bool {
+	out := map[string]bool{}
+	for _, e := range exts {
+		for _, part := range strings.Split(e, ",") {
+			part = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(part), "."))
+			if part != "" {
+				out[part] = true
+			}
+		}
+	}
+	return out
+}
+
+// extList is the inverse of parseExtList, for passing the set to the helper.
+func extList(set map[string]bool) string {
+	out := make([]string, 0, len(set))
+	for e := range set {
+		out = append(out, e)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ",")
+}
+
+// checkUploadName rejects names whose final extension is on the denylist. It guards every
+// way a new name can be created (upload, touch, rename, write), not just multipart uploads;
+// see checkRenameName and checkWriteName for files that already exist.
+func checkUploadName(deny map[string]bool, name string) error {
+	if len(deny) == 0 {
+		return nil
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	if ext != "" && deny[ext] {
+		return fmt.Errorf("%s: %q (.%s files are not allowed)", errUploadBlocked, name, ext)
+	}
+	return nil
+}
+
+// checkRenameName checks a rename target unless it keeps the source's extension: renaming
+// an existing run.sh to deploy.sh doesn't bring in a new kind of file.
+func checkRenameName(deny map[string]bool, from, to string) error {
+	if strings.EqualFold(filepath.Ext(filepath.Base(from)), filepath.Ext(to)) {
+		return nil
+	}
+	return checkUploadName(deny, to)
+}
+
+// checkWriteName checks a write target only if it doesn't exist yet, so existing files
+// with a denied extension stay editable.
+func checkWriteName(deny map[string]bool, abs string) error {
+	if _, err := os.Stat(abs); err == nil {
+		return nil
+	}
+	return checkUploadName(deny, filepath.Base(abs))
+}
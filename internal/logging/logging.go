@@ -15,6 +15,11 @@ type Config struct {
 	Level  string
 	File   string
 	Stdout bool
+
+	// MaxSizeBytes rotates File once it would exceed this size (<=0: never).
+	MaxSizeBytes int64
+	// MaxFiles is how many rotated copies (File.1 ... File.N) are kept.
+	MaxFiles int
 }
 
 var (
@@ -48,7 +53,7 @@ func Init(cfg Config) (func() error, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, err
 	}
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	f, err := openRotating(path, cfg.MaxSizeBytes, cfg.MaxFiles)
 	if err != nil {
 		return nil, err
 	}
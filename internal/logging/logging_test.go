@@ -74,3 +74,35 @@ func TestDebugEnabledFalsey(t *testing.T) {
 		t.Fatalf("expected debug disabled")
 	}
 }
+
+func TestRotatingFileRotates(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "atlas.log")
+	r, err := openRotating(path, 10, 2)
+	if err != nil {
+		t.Fatalf("openRotating: %v", err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	want := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for p, w := range want {
+		b, err := os.ReadFile(p)
+		if err != nil || string(b) != w {
+			t.Fatalf("%s = %q, %v; want %q", p, b, err, w)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected only 2 rotated files, stat .3: %v", err)
+	}
+}
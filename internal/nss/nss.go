@@ -0,0 +1,39 @@
+// Package nss resolves accounts through the system's name service switch.
+//
+// Atlas is built with CGO_ENABLED=0, where os/user only parses /etc/passwd, so
+// accounts from LDAP, SSSD and the like are looked up with getent(1) instead.
+package nss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// Timeout bounds a single getent call, so a slow directory server can't stall callers.
+const Timeout = 2 * time.Second
+
+// LookupId is os/user.LookupId backed by `getent passwd <uid>`.
+func LookupId(uid string) (*user.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "getent", "passwd", uid).Output()
+	if err != nil {
+		return nil, fmt.Errorf("nss: uid %s: %w", uid, err)
+	}
+	return parsePasswdLine(string(out), uid)
+}
+
+// parsePasswdLine reads the first passwd(5) entry in out and checks it is for uid.
+func parsePasswdLine(out, uid string) (*user.User, error) {
+	line, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	parts := strings.Split(line, ":")
+	if len(parts) < 7 || parts[0] == "" || parts[2] != uid {
+		return nil, errors.New("nss: unexpected getent output")
+	}
+	return &user.User{Uid: parts[2], Gid: parts[3], Username: parts[0], Name: parts[4], HomeDir: parts[5]}, nil
+}
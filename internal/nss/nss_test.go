@@ -0,0 +1,17 @@
+package nss
+
+import "testing"
+
+func TestParsePasswdLine(t *testing.T) {
+	t.Parallel()
+
+	u, err := parsePasswdLine("jdoe:*:5001:5001:Jane Doe:/home/jdoe:/bin/bash\n", "5001")
+	if err != nil || u.Username != "jdoe" || u.Gid != "5001" || u.Name != "Jane Doe" || u.HomeDir != "/home/jdoe" {
+		t.Fatalf("u=%+v err=%v", u, err)
+	}
+	for _, bad := range []string{"", "jdoe:*:5002:5002::/home/jdoe:/bin/sh", "garbage"} {
+		if _, err := parsePasswdLine(bad, "5001"); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
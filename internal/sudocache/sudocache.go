@@ -0,0 +1,107 @@
+// Package sudocache keeps decrypted sudo passwords in memory for a short time,
+// so bursts of privileged operations don't hit the user DB on every call.
+package sudocache
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTTL is used when a non-positive TTL is passed to New with caching enabled.
+const DefaultTTL = 60 * time.Second
+
+type Provider func(user string) (string, bool, error)
+
+type entry struct {
+	pass string
+	ok   bool
+	exp  time.Time
+}
+
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]entry
+	// gen is bumped by Invalidate and Clear; a provider result fetched under an older
+	// generation is returned but not stored, so it can't undo the invalidation.
+	gen uint64
+	now func() time.Time
+}
+
+// New wraps provider with a per-user cache. A negative ttl disables caching.
+func New(provider Provider, ttl time.Duration) *Cache {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	return &Cache{
+		provider: provider,
+		ttl:      ttl,
+		entries:  make(map[string]entry),
+		now:      time.Now,
+	}
+}
+
+// Get returns the cached password for user, asking the provider on a miss.
+// Provider errors are returned as-is and never cached.
+func (c *Cache) Get(user string) (string, bool, error) {
+	if c == nil || c.provider == nil {
+		return "", false, nil
+	}
+	if c.ttl < 0 {
+		return c.provider(user)
+	}
+	now := c.now()
+	c.mu.Lock()
+	e, hit := c.entries[user]
+	gen := c.gen
+	c.mu.Unlock()
+	if hit && now.Before(e.exp) {
+		return e.pass, e.ok, nil
+	}
+
+	pass, ok, err := c.provider(user)
+	if err != nil {
+		return "", false, err
+	}
+	c.mu.Lock()
+	if c.gen == gen {
+		c.pruneLocked(now)
+		c.entries[user] = entry{pass: pass, ok: ok, exp: now.Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return pass, ok, nil
+}
+
+// pruneLocked drops expired entries, so users who stop making requests don't keep
+// their password in memory past the TTL.
+func (c *Cache) pruneLocked(now time.Time) {
+	for u, e := range c.entries {
+		if !now.Before(e.exp) {
+			delete(c.entries, u)
+		}
+	}
+}
+
+// Invalidate drops the cached entry for user.
+func (c *Cache) Invalidate(user string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.entries, user)
+	c.gen++
+	c.mu.Unlock()
+}
+
+// Clear drops all cached entries.
+func (c *Cache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.entries = make(map[string]entry)
+	c.gen++
+	c.mu.Unlock()
+}
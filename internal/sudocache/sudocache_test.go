@@ -0,0 +1,126 @@
+package sudocache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCacheHitsAndExpires(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	c := New(func(user string) (string, bool, error) {
+		calls++
+		return "pw-" + user, true, nil
+	}, time.Minute)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		pass, ok, err := c.Get("alice")
+		if err != nil || !ok || pass != "pw-alice" {
+			t.Fatalf("Get: %q %v %v", pass, ok, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 provider call, got %d", calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, _, _ = c.Get("alice")
+	if calls != 2 {
+		t.Fatalf("expected refresh after ttl, got %d calls", calls)
+	}
+
+	c.Invalidate("alice")
+	_, _, _ = c.Get("alice")
+	if calls != 3 {
+		t.Fatalf("expected refresh after invalidate, got %d calls", calls)
+	}
+
+	c.Clear()
+	_, _, _ = c.Get("alice")
+	if calls != 4 {
+		t.Fatalf("expected refresh after clear, got %d calls", calls)
+	}
+}
+
+func TestCacheErrorsNotCached(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	c := New(func(string) (string, bool, error) {
+		calls++
+		return "", false, errors.New("boom")
+	}, time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, _, err := c.Get("bob"); err == nil {
+			t.Fatalf("expected error")
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("errors must not be cached, got %d calls", calls)
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	c := New(func(string) (string, bool, error) {
+		calls++
+		return "x", true, nil
+	}, -1)
+	_, _, _ = c.Get("u")
+	_, _, _ = c.Get("u")
+	if calls != 2 {
+		t.Fatalf("expected no caching, got %d calls", calls)
+	}
+
+	var nilCache *Cache
+	if _, ok, err := nilCache.Get("u"); ok || err != nil {
+		t.Fatalf("nil cache should be a no-op")
+	}
+}
+
+func TestCacheInvalidateDuringFetch(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	var c *Cache
+	c = New(func(user string) (string, bool, error) {
+		calls++
+		if calls == 1 {
+			// The password changes while the old one is being read.
+			c.Invalidate(user)
+			return "old", true, nil
+		}
+		return "new", true, nil
+	}, time.Minute)
+
+	if pass, _, _ := c.Get("alice"); pass != "old" {
+		t.Fatalf("first Get: %q", pass)
+	}
+	if pass, _, _ := c.Get("alice"); pass != "new" || calls != 2 {
+		t.Fatalf("stale entry survived Invalidate: %q after %d calls", pass, calls)
+	}
+}
+
+func TestCachePrunesExpired(t *testing.T) {
+	t.Parallel()
+
+	c := New(func(user string) (string, bool, error) { return "pw-" + user, true, nil }, time.Minute)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	_, _, _ = c.Get("alice")
+	now = now.Add(2 * time.Minute)
+	_, _, _ = c.Get("bob")
+	c.mu.Lock()
+	_, stale := c.entries["alice"]
+	c.mu.Unlock()
+	if stale {
+		t.Fatalf("expired entry for alice was kept")
+	}
+}
@@ -0,0 +1,177 @@
+// Package sudocheck finds out what the running process can do with sudo, so features
+// that silently depend on it can explain why they don't work.
+package sudocheck
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAge is how long a probe result is reused before Status probes again.
+const maxAge = 5 * time.Minute
+
+type Status struct {
+	// Available is false when there is no sudo binary.
+	Available bool `json:"available"`
+	// Root is set when the process already runs as root and never needs sudo.
+	Root bool `json:"root"`
+	// Passwordless reports that `sudo -n true` succeeds.
+	Passwordless bool `json:"passwordless"`
+	// PasswordRequired reports that sudo works only with a password.
+	PasswordRequired bool `json:"password_required"`
+	// RunAs lists the target users from `sudo -n -l` ("ALL" for any user).
+	RunAs []string `json:"run_as,omitempty"`
+	Error string   `json:"error,omitempty"`
+
+	CheckedUnix int64 `json:"checked_unix"`
+}
+
+// Report is Status for one Atlas user.
+type Report struct {
+	Status
+	HasStoredPassword bool `json:"has_stored_password"`
+	// NeedsStoredPassword is set when sudo asks for a password and none is stored:
+	// sudo-based features fail until the user stores one.
+	NeedsStoredPassword bool `json:"needs_stored_password"`
+}
+
+// For combines the probe result with whether the user has a stored sudo password.
+func (st Status) For(hasStored bool) Report {
+	return Report{
+		Status:              st,
+		HasStoredPassword:   hasStored,
+		NeedsStoredPassword: st.Available && !st.Root && !st.Passwordless && !hasStored,
+	}
+}
+
+type Checker struct {
+	sudoPath string
+	euid     int
+	run      func(ctx context.Context, args ...string) (string, error)
+
+	mu   sync.Mutex
+	last Status
+	at   time.Time
+}
+
+// New returns a checker using sudoPath ("" when sudo is not installed).
+func New(sudoPath string) *Checker {
+	c := &Checker{sudoPath: sudoPath, euid: os.Geteuid()}
+	c.run = func(ctx context.Context, args ...string) (string, error) {
+		out, err := exec.CommandContext(ctx, c.sudoPath, args...).CombinedOutput()
+		return string(out), err
+	}
+	return c
+}
+
+// Status returns the last probe result, probing again when it is older than a few minutes.
+func (c *Checker) Status(ctx context.Context) Status {
+	if c == nil {
+		return Status{}
+	}
+	c.mu.Lock()
+	st, at := c.last, c.at
+	c.mu.Unlock()
+	if !at.IsZero() && time.Since(at) < maxAge {
+		return st
+	}
+	return c.Refresh(ctx)
+}
+
+// ReportFor returns the status for a user with or without a stored sudo password,
+// probing again first when refresh is set. It returns nil on a nil Checker.
+func (c *Checker) ReportFor(ctx context.Context, refresh, hasStored bool) *Report {
+	if c == nil {
+		return nil
+	}
+	st := c.Status(ctx)
+	if refresh {
+		st = c.Refresh(ctx)
+	}
+	r := st.For(hasStored)
+	return &r
+}
+
+// Refresh probes sudo now.
+func (c *Checker) Refresh(ctx context.Context) Status {
+	if c == nil {
+		return Status{}
+	}
+	st := c.probe(ctx)
+	c.mu.Lock()
+	c.last, c.at = st, time.Now()
+	c.mu.Unlock()
+	return st
+}
+
+func (c *Checker) probe(ctx context.Context) Status {
+	st := Status{Available: c.sudoPath != "", Root: c.euid == 0, CheckedUnix: time.Now().Unix()}
+	if st.Root {
+		st.Passwordless = true
+		st.RunAs = []string{"ALL"}
+		return st
+	}
+	if !st.Available {
+		st.Error = "sudo not found"
+		return st
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	out, err := c.run(ctx, "-n", "true")
+	switch {
+	case err == nil:
+		st.Passwordless = true
+	case strings.Contains(out, "password is required"):
+		st.PasswordRequired = true
+	default:
+		st.Error = firstLine(out, err)
+	}
+	// Listing works without a password only when some rule is NOPASSWD (or listpw=never).
+	if out, err := c.run(ctx, "-n", "-l"); err == nil {
+		st.RunAs = parseRunAs(out)
+	} else if strings.Contains(out, "password is required") {
+		st.PasswordRequired = true
+	}
+	return st
+}
+
+func firstLine(out string, err error) string {
+	if line, _, _ := strings.Cut(strings.TrimSpace(out), "\n"); line != "" {
+		return line
+	}
+	return err.Error()
+}
+
+// parseRunAs extracts the run-as users of `sudo -l` entries such as
+// "(root, sysdba : ALL) NOPASSWD: /usr/bin/nft".
+func parseRunAs(out string) []string {
+	set := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "(") {
+			continue
+		}
+		end := strings.IndexByte(line, ')')
+		if end < 0 {
+			continue
+		}
+		users, _, _ := strings.Cut(line[1:end], ":")
+		for _, u := range strings.Split(users, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				set[u] = true
+			}
+		}
+	}
+	users := make([]string, 0, len(set))
+	for u := range set {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	return users
+}
@@ -0,0 +1,67 @@
+package sudocheck
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseRunAs(t *testing.T) {
+	t.Parallel()
+
+	out := `Matching Defaults entries for atlas on host:
+    env_reset, secure_path=/usr/sbin\:/usr/bin
+
+User atlas may run the following commands on host:
+    (sysdba) NOPASSWD: /opt/atlas/atlas fs-helper *
+    (root, www-data : ALL) NOPASSWD: /usr/sbin/nft
+    (ALL) ALL
+`
+	if got, want := parseRunAs(out), []string{"ALL", "root", "sysdba", "www-data"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseRunAs = %v, want %v", got, want)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	fake := func(outs map[string]string, ok map[string]bool) func(context.Context, ...string) (string, error) {
+		return func(_ context.Context, args ...string) (string, error) {
+			key := args[len(args)-1]
+			if ok[key] {
+				return outs[key], nil
+			}
+			return outs[key], errors.New("exit status 1")
+		}
+	}
+
+	c := &Checker{sudoPath: "/usr/bin/sudo", euid: 1000}
+	c.run = fake(map[string]string{
+		"true": "sudo: a password is required\n",
+		"-l":   "sudo: a password is required\n",
+	}, nil)
+	st := c.Refresh(context.Background())
+	if st.Passwordless || !st.PasswordRequired || st.Error != "" {
+		t.Fatalf("password-only sudo: %+v", st)
+	}
+	if r := st.For(false); !r.NeedsStoredPassword {
+		t.Fatalf("expected a stored password to be needed: %+v", r)
+	}
+	if r := st.For(true); r.NeedsStoredPassword {
+		t.Fatalf("a stored password should satisfy sudo: %+v", r)
+	}
+
+	c.run = fake(map[string]string{"-l": "    (sysdba) NOPASSWD: ALL\n"}, map[string]bool{"true": true, "-l": true})
+	st = c.Refresh(context.Background())
+	if !st.Passwordless || st.PasswordRequired || !reflect.DeepEqual(st.RunAs, []string{"sysdba"}) {
+		t.Fatalf("passwordless sudo: %+v", st)
+	}
+	if st.For(false).NeedsStoredPassword {
+		t.Fatalf("passwordless sudo needs no stored password")
+	}
+
+	if st := (&Checker{euid: 1000}).Refresh(context.Background()); st.Available || st.For(false).NeedsStoredPassword {
+		t.Fatalf("missing sudo: %+v", st)
+	}
+}
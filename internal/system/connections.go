@@ -0,0 +1,115 @@
+package system
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxConnections = 5000
+
+type netConnection struct {
+	Proto     string `json:"proto"`
+	State     string `json:"state"`
+	Local     string `json:"local"`
+	LocalPort int    `json:"local_port"`
+	Peer      string `json:"peer"`
+	PeerPort  int    `json:"peer_port"`
+	Interface string `json:"interface,omitempty"`
+	Process   string `json:"process,omitempty"`
+	PID       int    `json:"pid,omitempty"`
+}
+
+type connectionsResponse struct {
+	Items     []netConnection `json:"items"`
+	Truncated bool            `json:"truncated,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// HandleConnections lists sockets (all states) from `ss`, optionally filtered by
+// ?proto=tcp|udp, ?state= (e.g. estab, listen) and ?iface=.
+func (s *FirewallService) HandleConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	proto := strings.ToLower(strings.TrimSpace(q.Get("proto")))
+	if proto != "" && proto != "tcp" && proto != "udp" && proto != "any" {
+		http.Error(w, "bad proto", http.StatusBadRequest)
+		return
+	}
+	state := strings.ToLower(strings.TrimSpace(q.Get("state")))
+	iface := strings.TrimSpace(q.Get("iface"))
+	if s.ssPath == "" {
+		writeJSON(w, connectionsResponse{Items: []netConnection{}, Error: "ss not available"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	// Both -t and -u so the Netid column is always present.
+	out, err := s.run(ctx, s.ssPath, "-H", "-n", "-p", "-a", "-t", "-u")
+	if err != nil {
+		writeJSON(w, connectionsResponse{Items: []netConnection{}, Error: err.Error()})
+		return
+	}
+
+	resp := connectionsResponse{Items: []netConnection{}}
+	for _, c := range parseConnections(out) {
+		if proto != "" && proto != "any" && c.Proto != proto {
+			continue
+		}
+		if state != "" && strings.ToLower(c.State) != state {
+			continue
+		}
+		if iface != "" && c.Interface != iface {
+			continue
+		}
+		if len(resp.Items) >= maxConnections {
+			resp.Truncated = true
+			break
+		}
+		resp.Items = append(resp.Items, c)
+	}
+	writeJSON(w, resp)
+}
+
+// parseConnections parses `ss -H -n -p -a -t -u` output, dropping duplicate lines
+// (sockets shared by several processes are reported once per process by some ss versions).
+func parseConnections(out string) []netConnection {
+	var items []netConnection
+	seen := map[netConnection]bool{}
+	for _, ln := range strings.Split(out, "\n") {
+		fields := strings.Fields(ln)
+		if len(fields) < 6 {
+			continue
+		}
+		c := netConnection{
+			Proto: fields[0],
+			State: fields[1],
+			Local: fields[4],
+			Peer:  fields[5],
+		}
+		c.LocalPort = parsePort(c.Local)
+		c.PeerPort = parsePort(c.Peer)
+		if i := strings.Index(c.Local, "%"); i >= 0 {
+			rest := c.Local[i+1:]
+			if j := strings.LastIndex(rest, ":"); j >= 0 {
+				c.Interface = rest[:j]
+			}
+		}
+		if m := reUsers.FindStringSubmatch(ln); len(m) == 3 {
+			c.Process = m[1]
+			c.PID, _ = strconv.Atoi(m[2])
+		}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		items = append(items, c)
+	}
+	return items
+}
@@ -0,0 +1,22 @@
+package system
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// decodeJSON decodes a single JSON value from the request body and rejects
+// anything but whitespace after it. The body size is bounded by the app-level
+// limitBody middleware (max_body_bytes), so no second cap is applied here.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if err := dec.Decode(&json.RawMessage{}); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after JSON body")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package system
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiskIOStat is the per-device throughput since the previous sample.
+type DiskIOStat struct {
+	Device      string  `json:"device"`
+	ReadBytesS  float64 `json:"read_bytes_s"`
+	WriteBytesS float64 `json:"write_bytes_s"`
+	// UtilPct is the share of wall time the device had I/O in flight.
+	UtilPct float64 `json:"util_pct"`
+}
+
+type diskCounters struct {
+	readSectors  uint64
+	writeSectors uint64
+	ioMillis     uint64
+}
+
+// /proc/diskstats always counts 512-byte sectors, regardless of the device's block size.
+const diskSectorBytes = 512
+
+// isWholeDisk reports whether name is a real block device rather than a partition,
+// loop or RAM disk. Partitions have no entry of their own in /sys/block.
+func isWholeDisk(name string) bool {
+	for _, p := range []string{"loop", "ram", "zram"} {
+		if strings.HasPrefix(name, p) {
+			return false
+		}
+	}
+	_, err := os.Stat(filepath.Join("/sys/block", name))
+	return err == nil
+}
+
+func readDiskStats(path string, keep func(string) bool) (map[string]diskCounters, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	out := map[string]diskCounters{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 13 {
+			continue
+		}
+		name := fields[2]
+		if !keep(name) {
+			continue
+		}
+		var nums [3]uint64
+		ok := true
+		for i, idx := range []int{5, 9, 12} {
+			v, err := strconv.ParseUint(fields[idx], 10, 64)
+			if err != nil {
+				ok = false
+				break
+			}
+			nums[i] = v
+		}
+		if !ok {
+			continue
+		}
+		out[name] = diskCounters{readSectors: nums[0], writeSectors: nums[1], ioMillis: nums[2]}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// diskRates turns two samples into per-device rates. Without a previous sample
+// (or for a device that just appeared) the rates are zero.
+func diskRates(prev, cur map[string]diskCounters, elapsed time.Duration) []DiskIOStat {
+	secs := elapsed.Seconds()
+	out := make([]DiskIOStat, 0, len(cur))
+	for name, c := range cur {
+		st := DiskIOStat{Device: name}
+		if p, ok := prev[name]; ok && secs > 0 {
+			st.ReadBytesS = float64(counterDelta(c.readSectors, p.readSectors)*diskSectorBytes) / secs
+			st.WriteBytesS = float64(counterDelta(c.writeSectors, p.writeSectors)*diskSectorBytes) / secs
+			st.UtilPct = float64(counterDelta(c.ioMillis, p.ioMillis)) / (secs * 1000) * 100
+			if st.UtilPct > 100 {
+				st.UtilPct = 100
+			}
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Device < out[j].Device })
+	return out
+}
+
+// counterDelta treats a counter that went backwards (device reset) as no activity.
+func counterDelta(cur, prev uint64) uint64 {
+	if cur < prev {
+		return 0
+	}
+	return cur - prev
+}
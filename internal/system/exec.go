@@ -1,16 +1,25 @@
 package system
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 type ExecConfig struct {
 	Enabled bool
+	// RootDir confines the working directory callers may choose (default "/").
+	RootDir string
 }
 
 type ExecService struct {
@@ -23,10 +32,50 @@ func NewExecService(cfg ExecConfig) *ExecService {
 
 type execRequest struct {
 	Command string `json:"command"`
+	// Cwd is a directory inside RootDir, in the same form as file manager paths
+	// ("/" is RootDir itself). Empty keeps the server's working directory.
+	Cwd string `json:"cwd,omitempty"`
+	// Env is added to (and overrides) the server's environment.
+	Env map[string]string `json:"env,omitempty"`
 }
 
 type execResponse struct {
-	Output string `json:"output"`
+	// Output interleaves stdout and stderr in the order they were written.
+	Output     string `json:"output"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMS int64  `json:"duration_ms"`
+	// Error is set when the command did not run to a normal exit: the shell failed to
+	// start, the command was not found or not executable, it timed out or was killed.
+	// ExitCode is -1 when there is no exit status.
+	Error    string `json:"error,omitempty"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+}
+
+// execOutputMax caps each output field of the response.
+const execOutputMax = 1 << 20
+
+// execSink writes one stream to its own buffer and to the combined one. exec.Cmd copies
+// stdout and stderr from separate goroutines, so both sinks share mu.
+type execSink struct {
+	mu       *sync.Mutex
+	own      *bytes.Buffer
+	combined *bytes.Buffer
+}
+
+func (w execSink) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.combined.Write(p)
+	return w.own.Write(p)
+}
+
+func truncateOutput(s string) string {
+	if len(s) > execOutputMax {
+		return s[:execOutputMax] + "\n\n... output truncated ...\n"
+	}
+	return s
 }
 
 func (s *ExecService) HandleRun(w http.ResponseWriter, r *http.Request) {
@@ -40,7 +89,7 @@ func (s *ExecService) HandleRun(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req execRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSON(w, r, &req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -49,17 +98,111 @@ func (s *ExecService) HandleRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	dir := ""
+	if strings.TrimSpace(req.Cwd) != "" {
+		var err error
+		if dir, err = s.resolveCwd(req.Cwd); err != nil {
+			http.Error(w, "cwd: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	env, err := execEnv(os.Environ(), req.Env)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
 	defer cancel()
 
+	var (
+		mu                       sync.Mutex
+		combined, stdout, stderr bytes.Buffer
+	)
 	cmd := exec.CommandContext(ctx, "/bin/bash", "-lc", req.Command)
-	out, _ := cmd.CombinedOutput()
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = execSink{mu: &mu, own: &stdout, combined: &combined}
+	cmd.Stderr = execSink{mu: &mu, own: &stderr, combined: &combined}
+	start := time.Now()
+	err = cmd.Run()
 
-	const max = 1 << 20
-	sout := string(out)
-	if len(sout) > max {
-		sout = sout[:max] + "\n\n... output truncated ...\n"
+	resp := execResponse{DurationMS: time.Since(start).Milliseconds(), ExitCode: -1}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		resp.ExitCode = 0
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		resp.TimedOut = true
+		resp.Error = "command timed out"
+	case errors.As(err, &exitErr):
+		resp.ExitCode = exitErr.ExitCode()
+		switch resp.ExitCode {
+		case -1:
+			resp.Error = "command was killed: " + exitErr.String()
+		case 126:
+			resp.Error = "command is not executable"
+		case 127:
+			resp.Error = "command not found"
+		}
+	default:
+		resp.Error = "start: " + err.Error()
 	}
+
+	resp.Output = truncateOutput(combined.String())
+	resp.Stdout = truncateOutput(stdout.String())
+	resp.Stderr = truncateOutput(stderr.String())
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	_ = json.NewEncoder(w).Encode(execResponse{Output: sout})
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// resolveCwd maps a client path onto RootDir and checks that it is an existing
+// directory that stays inside RootDir once symlinks are resolved.
+func (s *ExecService) resolveCwd(clientPath string) (string, error) {
+	root := s.cfg.RootDir
+	if root == "" {
+		root = "/"
+	}
+	root, err := filepath.EvalSymlinks(filepath.Clean(root))
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(root, filepath.Clean("/"+clientPath))
+	p, err = filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", errors.New("directory does not exist")
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("path escapes root")
+	}
+	st, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if !st.IsDir() {
+		return "", errors.New("not a directory")
+	}
+	return p, nil
+}
+
+// execEnv returns base with extra set on top of it.
+func execEnv(base []string, extra map[string]string) ([]string, error) {
+	if len(extra) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(extra))
+	for name, v := range extra {
+		if name == "" || strings.ContainsAny(name, "=\x00") || strings.Contains(v, "\x00") {
+			return nil, fmt.Errorf("bad env var %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	env := append([]string{}, base...)
+	for _, name := range names {
+		env = stripEnv(env, name+"=")
+		env = append(env, name+"="+extra[name])
+	}
+	return env, nil
 }
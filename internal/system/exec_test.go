@@ -2,8 +2,12 @@ package system
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -36,3 +40,81 @@ func TestExecServiceBadRequest(t *testing.T) {
 		t.Fatalf("expected 400, got %d", rr.Code)
 	}
 }
+
+func TestExecServiceResult(t *testing.T) {
+	t.Parallel()
+	if _, err := os.Stat("/bin/bash"); err != nil {
+		t.Skip("needs /bin/bash")
+	}
+	s := NewExecService(ExecConfig{Enabled: true})
+
+	run := func(command string) execResponse {
+		t.Helper()
+		body, _ := json.Marshal(execRequest{Command: command})
+		rr := httptest.NewRecorder()
+		s.HandleRun(rr, httptest.NewRequest(http.MethodPost, "http://example/api/exec", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%q: status=%d", command, rr.Code)
+		}
+		var resp execResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	// bash -l may print profile noise first, so only the tails are compared.
+	resp := run("echo out; echo err >&2; exit 3")
+	if resp.ExitCode != 3 || resp.Error != "" || !strings.HasSuffix(resp.Stdout, "out\n") || !strings.HasSuffix(resp.Stderr, "err\n") ||
+		!strings.HasSuffix(resp.Output, "out\nerr\n") || strings.Contains(resp.Stdout, "err") {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+	if resp = run("true"); resp.ExitCode != 0 || resp.Error != "" {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+	if resp = run("atlas-no-such-command-xyz"); resp.ExitCode != 127 || resp.Error != "command not found" {
+		t.Fatalf("unexpected result %+v", resp)
+	}
+}
+
+func TestExecServiceCwdAndEnv(t *testing.T) {
+	t.Parallel()
+	if _, err := os.Stat("/bin/bash"); err != nil {
+		t.Skip("needs /bin/bash")
+	}
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "work"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.Symlink(os.TempDir(), filepath.Join(root, "out")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	s := NewExecService(ExecConfig{Enabled: true, RootDir: root})
+
+	run := func(req execRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		s.HandleRun(rr, httptest.NewRequest(http.MethodPost, "http://example/api/exec", bytes.NewReader(body)))
+		return rr
+	}
+
+	rr := run(execRequest{Command: `echo "$PWD:$ATLAS_TEST_VAR"`, Cwd: "/work", Env: map[string]string{"ATLAS_TEST_VAR": "v1"}})
+	var resp execResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status=%d err=%v body=%q", rr.Code, err, rr.Body.String())
+	}
+	wantDir, _ := filepath.EvalSymlinks(filepath.Join(root, "work"))
+	if !strings.HasSuffix(resp.Stdout, wantDir+":v1\n") {
+		t.Fatalf("unexpected stdout %q", resp.Stdout)
+	}
+
+	for _, req := range []execRequest{
+		{Command: "true", Cwd: "/missing"},
+		{Command: "true", Cwd: "/out"},
+		{Command: "true", Env: map[string]string{"A=B": "x"}},
+	} {
+		if rr := run(req); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%+v: expected 400, got %d", req, rr.Code)
+		}
+	}
+}
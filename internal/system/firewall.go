@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -16,19 +17,40 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MrTeeett/atlas/internal/auth"
+	"github.com/MrTeeett/atlas/internal/dbfile"
+	"github.com/MrTeeett/atlas/internal/sudocache"
+	"github.com/MrTeeett/atlas/internal/sudocheck"
 )
 
 type FirewallConfig struct {
-	Enabled      bool
-	DBPath       string
+	Enabled bool
+	DBPath  string
+	// DBPerm sets the mode/owner of the DB file (default 0600, running user).
+	DBPerm dbfile.Perm
+	// LockoutCheck refuses to apply a rule set that would drop the caller's connection.
+	LockoutCheck bool
+	// AutoImport copies the ufw/firewalld rules into an empty rule set when it is read.
+	AutoImport bool
+	// NATPriority is the hook priority of the nft prerouting NAT chain (nil: -100, dstnat).
+	NATPriority *int
+	// Instance names the nft tables, rule comments and persisted ruleset (default "atlas").
+	Instance string
+	// MaxRules caps the number of rules and bans in the rule set (0: defaultMaxFWRules).
+	MaxRules     int
 	SudoPassword func(user string) (string, bool, error)
+	// SudoPasswordTTL controls how long SudoPassword results are cached (0: default, <0: off).
+	SudoPasswordTTL time.Duration
+	// SudoCheck reports whether sudo works without a password (optional).
+	SudoCheck *sudocheck.Checker
 }
 
 type FirewallService struct {
-	cfg FirewallConfig
+	cfg   FirewallConfig
+	names nftNames
 
 	mu sync.Mutex
 	db fwDB
@@ -39,7 +61,28 @@ type FirewallService struct {
 	ufwPath       string
 	fwCmdPath     string
 	systemctlPath string
-	sudoPassword  func(user string) (string, bool, error)
+	sudoPassword  *sudocache.Cache
+
+	// nftNoJSON is set once `nft -j` turns out to be unsupported.
+	nftNoJSON atomic.Bool
+
+	statusMu  sync.Mutex
+	status    cachedStatus
+	statusGen uint64
+
+	reaperOnce sync.Once
+	// reapErr and reapFailures describe consecutive failed removals of expired rules, and
+	// reapNext is when the reaper tries again (all guarded by mu).
+	reapErr      string
+	reapFailures int
+	reapNext     time.Time
+
+	dockerMu sync.Mutex
+	docker   cachedDocker
+
+	linkerOnce sync.Once
+	// unitStates holds the last `systemctl is-active` result of each linked unit.
+	unitStates map[string]string
 }
 
 type fwDB struct {
@@ -47,6 +90,20 @@ type fwDB struct {
 	Enabled bool      `json:"enabled"`
 	Rules   []FWRule  `json:"rules"`
 	Updated time.Time `json:"updated_utc,omitempty"`
+	// UpdatedBy is the user behind the last change ("atlas" for automatic ones).
+	UpdatedBy string `json:"updated_by,omitempty"`
+
+	// Profiles holds named rule sets; Rules is always the live copy of ActiveProfile.
+	Profiles      map[string][]FWRule `json:"profiles,omitempty"`
+	ActiveProfile string              `json:"active_profile,omitempty"`
+
+	// BaseRules seeds the nft input chain with loopback/established accepts;
+	// PolicyDrop switches its policy to drop (default-deny).
+	BaseRules  bool `json:"base_rules,omitempty"`
+	PolicyDrop bool `json:"policy_drop,omitempty"`
+
+	// Bans drop all traffic from an address; they apply whatever profile is active.
+	Bans []FWBan `json:"bans,omitempty"`
 }
 
 type FWRule struct {
@@ -57,12 +114,34 @@ type FWRule struct {
 
 	PortFrom int `json:"port_from"`
 	PortTo   int `json:"port_to,omitempty"`
+	// PortRanges is set for port lists ("80,443,8000-8100"); PortFrom/PortTo then hold
+	// its first element.
+	PortRanges []PortRange `json:"port_ranges,omitempty"`
 
 	ToPort int `json:"to_port,omitempty"` // redirect
+	// ToAddr makes a redirect forward to another host (DNAT, IPv4) instead of a local
+	// port. Masquerade also rewrites the source so replies come back through this host.
+	ToAddr     string `json:"to_addr,omitempty"`
+	Masquerade bool   `json:"masquerade,omitempty"`
+
+	// Interface limits the rule to traffic arriving on that interface ("": all).
+	Interface string `json:"interface,omitempty"`
 
 	Service string    `json:"service,omitempty"`
 	Comment string    `json:"comment,omitempty"`
 	Created time.Time `json:"created_utc,omitempty"`
+	// ExpiresUnix removes the rule automatically at that time (0: permanent).
+	ExpiresUnix int64 `json:"expires_unix,omitempty"`
+	// LinkedUnit keeps the rule enabled only while that systemd unit is active.
+	LinkedUnit string `json:"linked_unit,omitempty"`
+
+	// RuntimeOnly applies a firewalld rule without --permanent, so it is gone after the
+	// next firewalld reload or reboot (firewalld only).
+	RuntimeOnly bool `json:"runtime_only,omitempty"`
+
+	// CreatedBy and UpdatedBy name the users who created and last changed the rule.
+	CreatedBy string `json:"created_by,omitempty"`
+	UpdatedBy string `json:"updated_by,omitempty"`
 }
 
 // UFWRule is a read-only representation of a ufw rule.
@@ -74,7 +153,7 @@ type UFWRule struct {
 	Raw    string `json:"raw,omitempty"`
 }
 
-type fwStatus struct {
+type FirewallStatus struct {
 	ConfigEnabled  bool   `json:"config_enabled"`
 	DBEnabled      bool   `json:"db_enabled"`
 	Tool           string `json:"tool"`
@@ -86,6 +165,11 @@ type fwStatus struct {
 	EUID           int    `json:"euid"`
 	HasSudo        bool   `json:"has_sudo"`
 	DBPath         string `json:"db_path,omitempty"`
+	LiveRules      *int   `json:"live_rules,omitempty"`
+	// Sudo is set when Atlas is not root and tells whether a stored sudo password is needed.
+	Sudo *sudocheck.Report `json:"sudo,omitempty"`
+	// Docker is set when Docker's netfilter rules may keep Atlas rules from applying.
+	Docker *DockerStatus `json:"docker,omitempty"`
 }
 
 func NewFirewallService(cfg FirewallConfig) *FirewallService {
@@ -97,32 +181,52 @@ func NewFirewallService(cfg FirewallConfig) *FirewallService {
 	systemctl, _ := exec.LookPath("systemctl")
 	s := &FirewallService{
 		cfg:           cfg,
+		names:         newNftNames(cfg.Instance),
 		nftPath:       nft,
 		ssPath:        ss,
 		sudoPath:      sudo,
 		ufwPath:       ufw,
 		fwCmdPath:     fwcmd,
 		systemctlPath: systemctl,
-		sudoPassword:  cfg.SudoPassword,
+		sudoPassword:  newSudoCache(cfg.SudoPassword, cfg.SudoPasswordTTL),
 		db: fwDB{
-			Version: 1,
-			Enabled: false,
-			Rules:   nil,
+			Version:       1,
+			Enabled:       false,
+			Rules:         nil,
+			ActiveProfile: defaultProfile,
 		},
 	}
 	_ = s.load()
+	if s.hasExpiringRules() {
+		s.startReaper()
+	}
+	if s.hasLinkedRules() {
+		s.startLinker()
+	}
 	return s
 }
 
 func (s *FirewallService) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("refresh") == "1" {
+		s.cfg.SudoCheck.Refresh(r.Context())
+	}
+	writeJSON(w, s.Status(r.Context()))
+}
+
+// Status reports the configured and live state of the firewall.
+func (s *FirewallService) Status(ctx context.Context) FirewallStatus {
 	s.mu.Lock()
 	enabled := s.db.Enabled
 	dbPath := s.cfg.DBPath
+	hasRedirects := false
+	for _, r := range s.db.Rules {
+		hasRedirects = hasRedirects || (r.Enabled && r.Type == "redirect")
+	}
 	s.mu.Unlock()
 
 	backend, berr := s.backend()
 	tool := backendToolName(backend)
-	st := fwStatus{
+	st := FirewallStatus{
 		ConfigEnabled: s.cfg.Enabled,
 		DBEnabled:     enabled,
 		Tool:          tool,
@@ -133,19 +237,25 @@ func (s *FirewallService) HandleStatus(w http.ResponseWriter, r *http.Request) {
 	if berr != nil {
 		st.Error = berr.Error()
 	}
+	if os.Geteuid() != 0 {
+		pass, ok, _ := s.sudoPassFor(ctx)
+		st.Sudo = s.cfg.SudoCheck.ReportFor(ctx, false, ok && pass != "")
+	}
 	if !s.cfg.Enabled {
-		writeJSON(w, st)
-		return
+		return st
 	}
-	active, err := s.backendActive(r.Context(), backend)
+	active, live, err := s.cachedBackendStatus(ctx, backend)
 	st.Active = active
 	if err != nil {
 		st.Error = err.Error()
 	}
 	if backend != "nft" {
 		st.DBEnabled = active
+	} else {
+		st.LiveRules = live
 	}
-	writeJSON(w, st)
+	st.Docker = s.dockerStatus(ctx, backend, hasRedirects)
+	return st
 }
 
 type setEnabledRequest struct {
@@ -162,7 +272,7 @@ func (s *FirewallService) HandleEnabled(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	var req setEnabledRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSON(w, r, &req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -174,6 +284,16 @@ func (s *FirewallService) HandleEnabled(w http.ResponseWriter, r *http.Request)
 		http.Error(w, berr.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.mu.Lock()
+	prevEnabled := s.db.Enabled
+	s.db.Enabled = req.Enabled
+	lerr := s.checkLockoutLocked(r, backend)
+	s.db.Enabled = prevEnabled
+	s.mu.Unlock()
+	if lerr != nil {
+		http.Error(w, lerr.Error(), http.StatusConflict)
+		return
+	}
 	if backend != "nft" {
 		if err := s.setSystemFirewallEnabled(ctx, backend, req.Enabled); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -181,7 +301,7 @@ func (s *FirewallService) HandleEnabled(w http.ResponseWriter, r *http.Request)
 		}
 		s.mu.Lock()
 		s.db.Enabled = req.Enabled
-		s.db.Updated = time.Now().UTC()
+		s.touchLocked(changedBy(r.Context()))
 		_ = s.saveLocked()
 		s.mu.Unlock()
 		w.WriteHeader(http.StatusNoContent)
@@ -191,7 +311,7 @@ func (s *FirewallService) HandleEnabled(w http.ResponseWriter, r *http.Request)
 	s.mu.Lock()
 	prev := s.db
 	s.db.Enabled = req.Enabled
-	s.db.Updated = time.Now().UTC()
+	s.touchLocked(changedBy(r.Context()))
 	if err := s.saveLocked(); err != nil {
 		s.db = prev
 		s.mu.Unlock()
@@ -228,6 +348,13 @@ func (s *FirewallService) HandleApply(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, berr.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.mu.Lock()
+	lerr := s.checkLockoutLocked(r, backend)
+	s.mu.Unlock()
+	if lerr != nil {
+		http.Error(w, lerr.Error(), http.StatusConflict)
+		return
+	}
 	if backend != "nft" {
 		if err := s.applySystem(ctx, backend); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -247,50 +374,152 @@ func (s *FirewallService) HandleApply(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-type rulesResponse struct {
+type FirewallRules struct {
 	Enabled        bool      `json:"enabled"`
 	Rules          []FWRule  `json:"rules"`
 	ExternalTool   string    `json:"external_tool,omitempty"`
 	ExternalActive bool      `json:"external_active,omitempty"`
 	ExternalRules  []UFWRule `json:"external_rules,omitempty"`
 	ExternalError  string    `json:"external_error,omitempty"`
+	// Warnings flags allow/deny rules that overlap (rule order decides which applies) and
+	// expired rules the reaper failed to remove.
+	Warnings []string `json:"warnings,omitempty"`
+	// SystemRules are Atlas-managed base rules (nft only), applied before Rules.
+	SystemRules []fwSystemRule `json:"system_rules,omitempty"`
+	Policy      string         `json:"policy,omitempty"`
+	// Bans are listed apart from Rules; they are applied before everything else.
+	Bans []FWBan `json:"bans,omitempty"`
+	// Created maps rule IDs to their creation time as epoch and in TimeZone
+	// (the requesting user's zone); created_utc in Rules stays authoritative.
+	Created  map[string]fwTime `json:"created,omitempty"`
+	TimeZone string            `json:"time_zone,omitempty"`
+	// ExpiresIn maps temporary rule IDs to their remaining lifetime in seconds.
+	ExpiresIn map[string]int64 `json:"expires_in,omitempty"`
+	// LinkedUnits maps the units rules are linked to to their last seen state.
+	LinkedUnits map[string]string `json:"linked_units,omitempty"`
+	// UpdatedUnix and UpdatedBy describe the last change to the rule set.
+	UpdatedUnix int64  `json:"updated_unix,omitempty"`
+	UpdatedBy   string `json:"updated_by,omitempty"`
+	// Sort is set when ?sort= reordered Rules; otherwise they are in apply order.
+	Sort string `json:"sort,omitempty"`
+}
+
+type fwTime struct {
+	Unix  int64  `json:"unix"`
+	Local string `json:"local"`
+}
+
+// withTimes fills Created, TimeZone and ExpiresIn for the user of ctx.
+func (resp FirewallRules) withTimes(ctx context.Context) FirewallRules {
+	resp.TimeZone = auth.LocationFromContext(ctx).String()
+	now := time.Now().Unix()
+	for _, r := range resp.Rules {
+		if r.ExpiresUnix > 0 {
+			if resp.ExpiresIn == nil {
+				resp.ExpiresIn = map[string]int64{}
+			}
+			resp.ExpiresIn[r.ID] = max(r.ExpiresUnix-now, 0)
+		}
+		if r.Created.IsZero() {
+			continue
+		}
+		if resp.Created == nil {
+			resp.Created = make(map[string]fwTime, len(resp.Rules))
+		}
+		resp.Created[r.ID] = fwTime{Unix: r.Created.Unix(), Local: auth.FormatLocal(ctx, r.Created)}
+	}
+	for _, b := range resp.Bans {
+		if b.ExpiresUnix > 0 {
+			if resp.ExpiresIn == nil {
+				resp.ExpiresIn = map[string]int64{}
+			}
+			resp.ExpiresIn[b.ID] = max(b.ExpiresUnix-now, 0)
+		}
+		if b.Created.IsZero() {
+			continue
+		}
+		if resp.Created == nil {
+			resp.Created = map[string]fwTime{}
+		}
+		resp.Created[b.ID] = fwTime{Unix: b.Created.Unix(), Local: auth.FormatLocal(ctx, b.Created)}
+	}
+	return resp
 }
 
 type createRuleRequest struct {
-	Enabled  bool   `json:"enabled"`
-	Type     string `json:"type"`
-	Proto    string `json:"proto"`
-	Ports    string `json:"ports"`   // "80" or "1000-2000"
-	ToPort   int    `json:"to_port"` // redirect
-	Service  string `json:"service,omitempty"`
-	Comment  string `json:"comment"`  // optional
-	Position int    `json:"position"` // optional insert at index; -1 append
+	Enabled bool   `json:"enabled"`
+	Type    string `json:"type"`
+	Proto   string `json:"proto"`
+	Ports   string `json:"ports"`   // "80", "1000-2000" or a list "80,443,8000-8100"
+	ToPort  int    `json:"to_port"` // redirect
+	// ToAddr and Masquerade turn a redirect into a forward to another host.
+	ToAddr     string `json:"to_addr,omitempty"`
+	Masquerade bool   `json:"masquerade,omitempty"`
+	Service    string `json:"service,omitempty"`
+	// Interface binds the rule to one network interface (optional).
+	Interface string `json:"interface,omitempty"`
+	Comment   string `json:"comment"`  // optional
+	Position  int    `json:"position"` // optional insert at index; -1 append
+	// TTLSeconds makes the rule temporary: it is removed that many seconds from now.
+	TTLSeconds int64 `json:"ttl_seconds,omitempty"`
+	// LinkedUnit enables the rule only while that systemd unit is active.
+	LinkedUnit string `json:"linked_unit,omitempty"`
+	// Permanent=false applies the rule to the firewalld runtime only (default true).
+	Permanent *bool `json:"permanent,omitempty"`
+}
+
+// Rules returns the rule list as shown to the user of ctx.
+func (s *FirewallService) Rules(ctx context.Context) (FirewallRules, error) {
+	backend, err := s.backend()
+	if err != nil {
+		return FirewallRules{}, err
+	}
+	if backend != "nft" {
+		tctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+		s.mu.Lock()
+		if s.cfg.AutoImport && len(s.db.Rules) == 0 {
+			_, _ = s.importSystemRulesLocked(tctx, backend)
+		}
+		active, _, _ := s.cachedBackendStatus(tctx, backend)
+		resp := FirewallRules{Enabled: active, Rules: append([]FWRule{}, s.db.Rules...), Warnings: s.warningsLocked(), LinkedUnits: s.linkedStatesLocked(s.db.Rules), Bans: append([]FWBan{}, s.db.Bans...)}
+		resp.setUpdated(s.db)
+		s.mu.Unlock()
+		return resp.withTimes(ctx), nil
+	}
+	s.mu.Lock()
+	resp := FirewallRules{
+		Enabled:     s.db.Enabled,
+		Rules:       append([]FWRule{}, s.db.Rules...),
+		Warnings:    s.warningsLocked(),
+		SystemRules: s.systemRulesLocked(),
+		Policy:      s.inputPolicyLocked(),
+		LinkedUnits: s.linkedStatesLocked(s.db.Rules),
+		Bans:        append([]FWBan{}, s.db.Bans...),
+	}
+	resp.setUpdated(s.db)
+	s.mu.Unlock()
+	return resp.withTimes(ctx), nil
 }
 
 func (s *FirewallService) HandleRules(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		backend, berr := s.backend()
-		if berr != nil {
-			http.Error(w, berr.Error(), http.StatusInternalServerError)
+		sortBy := r.URL.Query().Get("sort")
+		less, ok := ruleSorts[sortBy]
+		if sortBy != "" && !ok {
+			http.Error(w, "sort must be created, port or type", http.StatusBadRequest)
 			return
 		}
-		if backend != "nft" {
-			ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
-			defer cancel()
-			s.mu.Lock()
-			if len(s.db.Rules) == 0 {
-				_ = s.importSystemRulesLocked(ctx, backend)
-			}
-			active, _ := s.backendActive(ctx, backend)
-			resp := rulesResponse{Enabled: active, Rules: append([]FWRule{}, s.db.Rules...)}
-			s.mu.Unlock()
-			writeJSON(w, resp)
+		resp, err := s.Rules(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		s.mu.Lock()
-		resp := rulesResponse{Enabled: s.db.Enabled, Rules: append([]FWRule{}, s.db.Rules...)}
-		s.mu.Unlock()
+		if ok {
+			sortRules(resp.Rules, less)
+			resp.Sort = sortBy
+		}
 		writeJSON(w, resp)
 		return
 
@@ -306,7 +535,7 @@ func (s *FirewallService) HandleRules(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req createRuleRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSON(w, r, &req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -315,6 +544,7 @@ func (s *FirewallService) HandleRules(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	rule.CreatedBy = changedBy(r.Context())
 
 	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
 	defer cancel()
@@ -324,15 +554,42 @@ func (s *FirewallService) HandleRules(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, berr.Error(), http.StatusInternalServerError)
 		return
 	}
+	if rule.RuntimeOnly && backend != "firewalld" {
+		http.Error(w, "runtime-only rules require the firewalld backend", http.StatusBadRequest)
+		return
+	}
+	if backend == "firewalld" {
+		if err := s.checkFirewalldIfaceZone(ctx, rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	s.mu.Lock()
+	if dup, ok := findDuplicate(s.db.Rules, rule, ""); ok {
+		s.mu.Unlock()
+		http.Error(w, "duplicate of rule "+dup.ID, http.StatusConflict)
+		return
+	}
+	if max := s.maxRules(); s.ruleCountLocked() >= max {
+		s.mu.Unlock()
+		http.Error(w, fmt.Sprintf("too many rules (max %d)", max), http.StatusConflict)
+		return
+	}
 	prev := s.db
 	pos := req.Position
 	if pos < 0 || pos > len(s.db.Rules) {
 		pos = len(s.db.Rules)
 	}
-	s.db.Rules = append(s.db.Rules[:pos], append([]FWRule{rule}, s.db.Rules[pos:]...)...)
-	s.db.Updated = time.Now().UTC()
+	rules := append(append(append([]FWRule{}, s.db.Rules[:pos]...), rule), s.db.Rules[pos:]...)
+	s.db.Rules = rules
+	if err := s.checkLockoutLocked(r, backend); err != nil {
+		s.db = prev
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.touchLocked(rule.CreatedBy)
 	if err := s.saveLocked(); err != nil {
 		s.db = prev
 		s.mu.Unlock()
@@ -358,6 +615,12 @@ func (s *FirewallService) HandleRules(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	s.mu.Unlock()
+	if rule.ExpiresUnix > 0 {
+		s.startReaper()
+	}
+	if rule.LinkedUnit != "" {
+		s.startLinker()
+	}
 	writeJSON(w, rule)
 }
 
@@ -366,12 +629,18 @@ type toggleRuleRequest struct {
 }
 
 type updateRuleRequest struct {
-	Type    string `json:"type"`
-	Proto   string `json:"proto"`
-	Ports   string `json:"ports"`
-	ToPort  int    `json:"to_port"`
-	Service string `json:"service,omitempty"`
-	Comment string `json:"comment"`
+	Type       string `json:"type"`
+	Proto      string `json:"proto"`
+	Ports      string `json:"ports"`
+	ToPort     int    `json:"to_port"`
+	ToAddr     string `json:"to_addr,omitempty"`
+	Masquerade bool   `json:"masquerade,omitempty"`
+	Service    string `json:"service,omitempty"`
+	Interface  string `json:"interface,omitempty"`
+	LinkedUnit string `json:"linked_unit,omitempty"`
+	Comment    string `json:"comment"`
+	// Permanent changes whether the rule is runtime-only (firewalld); nil keeps it.
+	Permanent *bool `json:"permanent,omitempty"`
 }
 
 func (s *FirewallService) HandleRuleID(w http.ResponseWriter, r *http.Request) {
@@ -401,30 +670,45 @@ func (s *FirewallService) HandleRuleID(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, berr.Error(), http.StatusInternalServerError)
 		return
 	}
+	by := changedBy(r.Context())
 
 	switch {
 	case action == "toggle" && r.Method == http.MethodPost:
 		var req toggleRuleRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err := decodeJSON(w, r, &req); err != nil {
 			http.Error(w, "bad json", http.StatusBadRequest)
 			return
 		}
 		s.mu.Lock()
 		prev := s.db
+		s.db.Rules = cloneRules(s.db.Rules)
 		found := false
 		for i := range s.db.Rules {
 			if s.db.Rules[i].ID == id {
+				if unit := s.db.Rules[i].LinkedUnit; unit != "" && s.db.Rules[i].Enabled != req.Enabled {
+					s.mu.Unlock()
+					http.Error(w, "rule follows unit "+unit+"; unlink it to toggle by hand", http.StatusConflict)
+					return
+				}
 				s.db.Rules[i].Enabled = req.Enabled
+				s.db.Rules[i].UpdatedBy = by
 				found = true
 				break
 			}
 		}
 		if !found {
+			s.db = prev
 			s.mu.Unlock()
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
-		s.db.Updated = time.Now().UTC()
+		if err := s.checkLockoutLocked(r, backend); err != nil {
+			s.db = prev
+			s.mu.Unlock()
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		s.touchLocked(by)
 		if err := s.saveLocked(); err != nil {
 			s.db = prev
 			s.mu.Unlock()
@@ -482,7 +766,13 @@ func (s *FirewallService) HandleRuleID(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		s.db.Rules = out
-		s.db.Updated = time.Now().UTC()
+		if err := s.checkLockoutLocked(r, backend); err != nil {
+			s.db = prev
+			s.mu.Unlock()
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		s.touchLocked(by)
 		if err := s.saveLocked(); err != nil {
 			s.db = prev
 			s.mu.Unlock()
@@ -513,7 +803,7 @@ func (s *FirewallService) HandleRuleID(w http.ResponseWriter, r *http.Request) {
 
 	case action == "" && r.Method == http.MethodPut:
 		var req updateRuleRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err := decodeJSON(w, r, &req); err != nil {
 			http.Error(w, "bad json", http.StatusBadRequest)
 			return
 		}
@@ -526,8 +816,24 @@ func (s *FirewallService) HandleRuleID(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "service rules are not supported with nft backend", http.StatusBadRequest)
 			return
 		}
+		if update.RuntimeOnly && backend != "firewalld" {
+			http.Error(w, "runtime-only rules require the firewalld backend", http.StatusBadRequest)
+			return
+		}
+		if backend == "firewalld" {
+			if err := s.checkFirewalldIfaceZone(ctx, update); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 		s.mu.Lock()
+		if dup, ok := findDuplicate(s.db.Rules, update, id); ok {
+			s.mu.Unlock()
+			http.Error(w, "duplicate of rule "+dup.ID, http.StatusConflict)
+			return
+		}
 		prev := s.db
+		s.db.Rules = cloneRules(s.db.Rules)
 		found := false
 		var prevRule FWRule
 		for i := range s.db.Rules {
@@ -536,17 +842,30 @@ func (s *FirewallService) HandleRuleID(w http.ResponseWriter, r *http.Request) {
 				update.ID = id
 				update.Enabled = s.db.Rules[i].Enabled
 				update.Created = s.db.Rules[i].Created
+				update.CreatedBy = s.db.Rules[i].CreatedBy
+				update.UpdatedBy = by
+				update.ExpiresUnix = s.db.Rules[i].ExpiresUnix
+				if req.Permanent == nil {
+					update.RuntimeOnly = s.db.Rules[i].RuntimeOnly
+				}
 				s.db.Rules[i] = update
 				found = true
 				break
 			}
 		}
 		if !found {
+			s.db = prev
 			s.mu.Unlock()
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
-		s.db.Updated = time.Now().UTC()
+		if err := s.checkLockoutLocked(r, backend); err != nil {
+			s.db = prev
+			s.mu.Unlock()
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		s.touchLocked(by)
 		if err := s.saveLocked(); err != nil {
 			s.db = prev
 			s.mu.Unlock()
@@ -583,6 +902,9 @@ func (s *FirewallService) HandleRuleID(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		s.mu.Unlock()
+		if update.LinkedUnit != "" {
+			s.startLinker()
+		}
 		writeJSON(w, update)
 		return
 	}
@@ -696,14 +1018,26 @@ func (s *FirewallService) ruleFromCreate(req createRuleRequest) (FWRule, error)
 		return FWRule{}, err
 	}
 	rule := FWRule{
-		ID:      id,
-		Enabled: req.Enabled,
-		Type:    strings.ToLower(strings.TrimSpace(req.Type)),
-		Proto:   strings.ToLower(strings.TrimSpace(req.Proto)),
-		ToPort:  req.ToPort,
-		Service: strings.TrimSpace(req.Service),
-		Comment: strings.TrimSpace(req.Comment),
-		Created: time.Now().UTC(),
+		ID:         id,
+		Enabled:    req.Enabled,
+		Type:       strings.ToLower(strings.TrimSpace(req.Type)),
+		Proto:      strings.ToLower(strings.TrimSpace(req.Proto)),
+		ToPort:     req.ToPort,
+		ToAddr:     strings.TrimSpace(req.ToAddr),
+		Masquerade: req.Masquerade,
+		Service:    strings.TrimSpace(req.Service),
+		Interface:  strings.TrimSpace(req.Interface),
+		LinkedUnit: strings.TrimSpace(req.LinkedUnit),
+		Comment:    strings.TrimSpace(req.Comment),
+		Created:    time.Now().UTC(),
+
+		RuntimeOnly: req.Permanent != nil && !*req.Permanent,
+	}
+	if req.TTLSeconds < 0 || req.TTLSeconds > maxRuleTTL {
+		return FWRule{}, fmt.Errorf("ttl_seconds must be between 0 and %d", maxRuleTTL)
+	}
+	if req.TTLSeconds > 0 {
+		rule.ExpiresUnix = rule.Created.Unix() + req.TTLSeconds
 	}
 	if rule.Proto == "" {
 		if rule.Service != "" {
@@ -723,16 +1057,36 @@ func (s *FirewallService) ruleFromCreate(req createRuleRequest) (FWRule, error)
 	if err := validateRule(rule); err != nil {
 		return FWRule{}, err
 	}
+	if rule.Interface != "" {
+		if err := validateInterface(rule.Interface); err != nil {
+			return FWRule{}, err
+		}
+	}
+	if rule.LinkedUnit != "" {
+		if err := validateLinkedUnit(rule.LinkedUnit); err != nil {
+			return FWRule{}, err
+		}
+		// Start in step with the unit rather than waiting for the next reconcile.
+		if up, known := unitUp(s.unitState(context.Background(), rule.LinkedUnit)); known {
+			rule.Enabled = up
+		}
+	}
 	return rule, nil
 }
 
 func (s *FirewallService) ruleFromUpdate(req updateRuleRequest) (FWRule, error) {
 	rule := FWRule{
-		Type:    strings.ToLower(strings.TrimSpace(req.Type)),
-		Proto:   strings.ToLower(strings.TrimSpace(req.Proto)),
-		ToPort:  req.ToPort,
-		Service: strings.TrimSpace(req.Service),
-		Comment: strings.TrimSpace(req.Comment),
+		Type:       strings.ToLower(strings.TrimSpace(req.Type)),
+		Proto:      strings.ToLower(strings.TrimSpace(req.Proto)),
+		ToPort:     req.ToPort,
+		ToAddr:     strings.TrimSpace(req.ToAddr),
+		Masquerade: req.Masquerade,
+		Service:    strings.TrimSpace(req.Service),
+		Interface:  strings.TrimSpace(req.Interface),
+		LinkedUnit: strings.TrimSpace(req.LinkedUnit),
+		Comment:    strings.TrimSpace(req.Comment),
+
+		RuntimeOnly: req.Permanent != nil && !*req.Permanent,
 	}
 	if rule.Proto == "" {
 		if rule.Service != "" {
@@ -752,6 +1106,16 @@ func (s *FirewallService) ruleFromUpdate(req updateRuleRequest) (FWRule, error)
 	if err := validateRule(rule); err != nil {
 		return FWRule{}, err
 	}
+	if rule.Interface != "" {
+		if err := validateInterface(rule.Interface); err != nil {
+			return FWRule{}, err
+		}
+	}
+	if rule.LinkedUnit != "" {
+		if err := validateLinkedUnit(rule.LinkedUnit); err != nil {
+			return FWRule{}, err
+		}
+	}
 	return rule, nil
 }
 
@@ -760,26 +1124,16 @@ func parsePortsInto(rule *FWRule, ports string) error {
 	if ports == "" {
 		return errors.New("ports is required")
 	}
-	if strings.Contains(ports, "-") {
-		parts := strings.SplitN(ports, "-", 2)
-		a, _ := strconv.Atoi(strings.TrimSpace(parts[0]))
-		b, _ := strconv.Atoi(strings.TrimSpace(parts[1]))
-		if a <= 0 || b <= 0 {
-			return errors.New("bad ports range")
-		}
-		if b < a {
-			a, b = b, a
-		}
-		rule.PortFrom = a
-		rule.PortTo = b
-		return nil
+	ranges, err := parsePortList(ports)
+	if err != nil {
+		return err
 	}
-	p, _ := strconv.Atoi(ports)
-	if p <= 0 {
-		return errors.New("bad port")
+	rule.PortFrom = ranges[0].From
+	rule.PortTo = ranges[0].To
+	rule.PortRanges = nil
+	if len(ranges) > 1 {
+		rule.PortRanges = ranges
 	}
-	rule.PortFrom = p
-	rule.PortTo = p
 	return nil
 }
 
@@ -798,20 +1152,37 @@ func validateRule(r FWRule) error {
 	if r.Proto != "tcp" && r.Proto != "udp" {
 		return errors.New("proto must be tcp or udp")
 	}
-	if r.PortFrom <= 0 || r.PortFrom > 65535 || r.PortTo <= 0 || r.PortTo > 65535 {
-		return errors.New("port must be 1..65535")
-	}
-	if r.PortTo < r.PortFrom {
-		return errors.New("port_to must be >= port_from")
+	for _, p := range r.portRanges() {
+		if p.From <= 0 || p.From > 65535 || p.To <= 0 || p.To > 65535 {
+			return errors.New("port must be 1..65535")
+		}
+		if p.To < p.From {
+			return errors.New("port_to must be >= port_from")
+		}
 	}
 	if r.Type == "redirect" {
-		if r.PortFrom != r.PortTo {
+		if r.PortFrom != r.PortTo || len(r.PortRanges) > 1 {
 			return errors.New("redirect supports single port only")
 		}
 		if r.ToPort <= 0 || r.ToPort > 65535 {
 			return errors.New("to_port must be 1..65535")
 		}
 	}
+	if r.ToAddr != "" || r.Masquerade {
+		if r.Type != "redirect" {
+			return errors.New("to_addr and masquerade need type redirect")
+		}
+		if r.ToAddr == "" {
+			return errors.New("masquerade needs to_addr")
+		}
+		ip := net.ParseIP(r.ToAddr)
+		if ip == nil || ip.To4() == nil || strings.Contains(r.ToAddr, ":") {
+			return errors.New("to_addr must be an IPv4 address")
+		}
+		if ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+			return fmt.Errorf("to_addr %s cannot be forwarded to", r.ToAddr)
+		}
+	}
 	return nil
 }
 
@@ -857,6 +1228,7 @@ func (s *FirewallService) backendActive(ctx context.Context, backend string) (bo
 }
 
 func (s *FirewallService) setSystemFirewallEnabled(ctx context.Context, backend string, enabled bool) error {
+	defer s.invalidateStatus()
 	switch backend {
 	case "firewalld":
 		if s.systemctlPath == "" {
@@ -881,6 +1253,7 @@ func (s *FirewallService) setSystemFirewallEnabled(ctx context.Context, backend
 }
 
 func (s *FirewallService) applySystem(ctx context.Context, backend string) error {
+	defer s.invalidateStatus()
 	switch backend {
 	case "firewalld":
 		_, err := s.firewalld(ctx, "--reload")
@@ -894,6 +1267,7 @@ func (s *FirewallService) applySystem(ctx context.Context, backend string) error
 }
 
 func (s *FirewallService) applyRuleSystem(ctx context.Context, backend string, rule FWRule, enable bool) error {
+	defer s.invalidateStatus()
 	switch backend {
 	case "firewalld":
 		return s.applyFirewalldRule(ctx, rule, enable)
@@ -904,7 +1278,9 @@ func (s *FirewallService) applyRuleSystem(ctx context.Context, backend string, r
 	}
 }
 
-func (s *FirewallService) importSystemRulesLocked(ctx context.Context, backend string) error {
+// importSystemRulesLocked appends the ufw/firewalld rules that Atlas doesn't have yet
+// and returns them.
+func (s *FirewallService) importSystemRulesLocked(ctx context.Context, backend string) ([]FWRule, error) {
 	var (
 		rules []FWRule
 		err   error
@@ -915,14 +1291,80 @@ func (s *FirewallService) importSystemRulesLocked(ctx context.Context, backend s
 	case "ufw":
 		rules, err = s.readUfwRules(ctx)
 	default:
-		return nil
+		return nil, nil
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	s.db.Rules = rules
-	s.db.Updated = time.Now().UTC()
-	return s.saveLocked()
+	var added []FWRule
+	for _, r := range rules {
+		if _, dup := findDuplicate(s.db.Rules, r, ""); dup {
+			continue
+		}
+		if _, dup := findDuplicate(added, r, ""); dup {
+			continue
+		}
+		r.CreatedBy = changedBy(ctx)
+		added = append(added, r)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	if max := s.maxRules(); s.ruleCountLocked()+len(added) > max {
+		return nil, fmt.Errorf("%w: importing %d would exceed the limit of %d", errTooManyRules, len(added), max)
+	}
+	prev := s.db
+	s.db.Rules = append(append([]FWRule{}, s.db.Rules...), added...)
+	s.touchLocked(changedBy(ctx))
+	if err := s.saveLocked(); err != nil {
+		s.db = prev
+		return nil, err
+	}
+	return added, nil
+}
+
+type importSystemResponse struct {
+	Imported []FWRule `json:"imported"`
+}
+
+// HandleImportSystem copies the current ufw/firewalld rules into Atlas's rule set,
+// skipping ones it already has. Nothing is changed on the system itself.
+func (s *FirewallService) HandleImportSystem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.cfg.Enabled {
+		http.Error(w, "firewall is disabled by config", http.StatusForbidden)
+		return
+	}
+	backend, err := s.backend()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if backend != "ufw" && backend != "firewalld" {
+		http.Error(w, "import is only supported with ufw or firewalld", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	added, err := s.importSystemRulesLocked(ctx, backend)
+	s.mu.Unlock()
+	if errors.Is(err, errTooManyRules) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if added == nil {
+		added = []FWRule{}
+	}
+	writeJSON(w, importSystemResponse{Imported: added})
 }
 
 func (s *FirewallService) isActive(ctx context.Context) (bool, error) {
@@ -931,11 +1373,11 @@ func (s *FirewallService) isActive(ctx context.Context) (bool, error) {
 	}
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
-	_, err := s.nft(ctx, "list", "table", "inet", "atlas")
+	t, err := s.nftListTable(ctx, "inet", s.names.Filter)
 	if err != nil {
 		return false, nil
 	}
-	return true, nil
+	return t.Found, nil
 }
 
 var (
@@ -1088,26 +1530,40 @@ func (s *FirewallService) firewalldZone(ctx context.Context) string {
 }
 
 func (s *FirewallService) applyLocked(ctx context.Context) error {
+	defer s.invalidateStatus()
 	if s.nftPath == "" {
 		return errors.New("nft is not available")
 	}
 	if !s.db.Enabled {
 		// Disable: remove our tables.
-		_, _ = s.nft(ctx, "delete", "table", "inet", "atlas")
-		_, _ = s.nft(ctx, "delete", "table", "ip", "atlas_nat")
+		_, _ = s.nft(ctx, "delete", "table", "inet", s.names.Filter)
+		_, _ = s.nft(ctx, "delete", "table", "ip", s.names.NAT)
 		return nil
 	}
 
-	if err := s.ensureFilter(ctx); err != nil {
+	if err := s.ensureFilter(ctx, s.inputPolicyLocked()); err != nil {
 		return err
 	}
+	// The NAT table is recreated rather than flushed, so a changed chain priority
+	// takes effect.
+	_, _ = s.nft(ctx, "delete", "table", "ip", s.names.NAT)
 	if err := s.ensureNAT(ctx); err != nil {
 		return err
 	}
 
 	// Flush (our tables only).
-	_, _ = s.nft(ctx, "flush", "chain", "inet", "atlas", "input")
-	_, _ = s.nft(ctx, "flush", "chain", "ip", "atlas_nat", "prerouting")
+	_, _ = s.nft(ctx, "flush", "chain", "inet", s.names.Filter, "input")
+
+	for _, b := range s.db.Bans {
+		if err := s.addBanRule(ctx, b); err != nil {
+			return fmt.Errorf("apply ban %s: %w", b.ID, err)
+		}
+	}
+	for _, r := range s.systemRulesLocked() {
+		if err := s.addSystemRule(ctx, r); err != nil {
+			return fmt.Errorf("apply %s: %w", r.ID, err)
+		}
+	}
 
 	// Apply rules in order.
 	for _, r := range s.db.Rules {
@@ -1121,30 +1577,33 @@ func (s *FirewallService) applyLocked(ctx context.Context) error {
 	return nil
 }
 
-func (s *FirewallService) ensureFilter(ctx context.Context) error {
-	if _, err := s.nft(ctx, "list", "table", "inet", "atlas"); err != nil {
-		if _, err := s.nft(ctx, "add", "table", "inet", "atlas"); err != nil {
+func (s *FirewallService) ensureFilter(ctx context.Context, policy string) error {
+	if _, err := s.nft(ctx, "list", "table", "inet", s.names.Filter); err != nil {
+		if _, err := s.nft(ctx, "add", "table", "inet", s.names.Filter); err != nil {
 			return err
 		}
 	}
-	if _, err := s.nft(ctx, "list", "chain", "inet", "atlas", "input"); err != nil {
-		args := []string{"add", "chain", "inet", "atlas", "input", "{", "type", "filter", "hook", "input", "priority", "0", ";", "policy", "accept", ";", "}"}
-		if _, err := s.nft(ctx, args...); err != nil {
-			return err
-		}
-	}
-	return nil
+	// "add chain" on an existing base chain updates its policy, so run it every time.
+	args := []string{"add", "chain", "inet", s.names.Filter, "input", "{", "type", "filter", "hook", "input", "priority", "0", ";", "policy", policy, ";", "}"}
+	_, err := s.nft(ctx, args...)
+	return err
 }
 
 func (s *FirewallService) ensureNAT(ctx context.Context) error {
 	// NAT is in ip family for broad compatibility.
-	if _, err := s.nft(ctx, "list", "table", "ip", "atlas_nat"); err != nil {
-		if _, err := s.nft(ctx, "add", "table", "ip", "atlas_nat"); err != nil {
+	if _, err := s.nft(ctx, "list", "table", "ip", s.names.NAT); err != nil {
+		if _, err := s.nft(ctx, "add", "table", "ip", s.names.NAT); err != nil {
+			return err
+		}
+	}
+	if _, err := s.nft(ctx, "list", "chain", "ip", s.names.NAT, "prerouting"); err != nil {
+		args := []string{"add", "chain", "ip", s.names.NAT, "prerouting", "{", "type", "nat", "hook", "prerouting", "priority", strconv.Itoa(s.natPriority()), ";", "}"}
+		if _, err := s.nft(ctx, args...); err != nil {
 			return err
 		}
 	}
-	if _, err := s.nft(ctx, "list", "chain", "ip", "atlas_nat", "prerouting"); err != nil {
-		args := []string{"add", "chain", "ip", "atlas_nat", "prerouting", "{", "type", "nat", "hook", "prerouting", "priority", "-100", ";", "}"}
+	if _, err := s.nft(ctx, "list", "chain", "ip", s.names.NAT, "postrouting"); err != nil {
+		args := []string{"add", "chain", "ip", s.names.NAT, "postrouting", "{", "type", "nat", "hook", "postrouting", "priority", "100", ";", "}"}
 		if _, err := s.nft(ctx, args...); err != nil {
 			return err
 		}
@@ -1152,8 +1611,35 @@ func (s *FirewallService) ensureNAT(ctx context.Context) error {
 	return nil
 }
 
+// defaultMaxFWRules is the rule cap when FirewallConfig.MaxRules is unset.
+const defaultMaxFWRules = 1000
+
+var errTooManyRules = errors.New("too many rules")
+
+func (s *FirewallService) maxRules() int {
+	if s.cfg.MaxRules > 0 {
+		return s.cfg.MaxRules
+	}
+	return defaultMaxFWRules
+}
+
+// ruleCountLocked is what maxRules caps: every ban is a host rule too.
+func (s *FirewallService) ruleCountLocked() int {
+	return len(s.db.Rules) + len(s.db.Bans)
+}
+
+// defaultNATPriority is nft's dstnat priority, where DNAT and redirects normally run.
+const defaultNATPriority = -100
+
+func (s *FirewallService) natPriority() int {
+	if s.cfg.NATPriority != nil {
+		return *s.cfg.NATPriority
+	}
+	return defaultNATPriority
+}
+
 func (s *FirewallService) applyRule(ctx context.Context, r FWRule) error {
-	comment := nftString("atlas:" + r.ID)
+	comment := s.names.comment(r.ID)
 	switch r.Type {
 	case "allow":
 		return s.addFilterRule(ctx, r, "accept", comment)
@@ -1167,18 +1653,33 @@ func (s *FirewallService) applyRule(ctx context.Context, r FWRule) error {
 }
 
 func (s *FirewallService) addFilterRule(ctx context.Context, r FWRule, verdict string, comment string) error {
-	dport := fmt.Sprintf("%d", r.PortFrom)
-	if r.PortTo != r.PortFrom {
-		dport = fmt.Sprintf("%d-%d", r.PortFrom, r.PortTo)
+	args := []string{"add", "rule", "inet", s.names.Filter, "input"}
+	if r.Interface != "" {
+		args = append(args, "iifname", nftString(r.Interface))
 	}
-	args := []string{"add", "rule", "inet", "atlas", "input", r.Proto, "dport", dport, verdict, "comment", comment}
+	args = append(args, r.Proto, "dport", nftDport(r), verdict, "comment", comment)
 	_, err := s.nft(ctx, args...)
 	return err
 }
 
 func (s *FirewallService) addRedirectRule(ctx context.Context, r FWRule, comment string) error {
-	args := []string{"add", "rule", "ip", "atlas_nat", "prerouting", r.Proto, "dport", fmt.Sprintf("%d", r.PortFrom), "redirect", "to", fmt.Sprintf(":%d", r.ToPort), "comment", comment}
-	_, err := s.nft(ctx, args...)
+	args := []string{"add", "rule", "ip", s.names.NAT, "prerouting"}
+	if r.Interface != "" {
+		args = append(args, "iifname", nftString(r.Interface))
+	}
+	if r.ToAddr == "" {
+		args = append(args, r.Proto, "dport", fmt.Sprintf("%d", r.PortFrom), "redirect", "to", fmt.Sprintf(":%d", r.ToPort), "comment", comment)
+		_, err := s.nft(ctx, args...)
+		return err
+	}
+	args = append(args, r.Proto, "dport", fmt.Sprintf("%d", r.PortFrom), "dnat", "to", fmt.Sprintf("%s:%d", r.ToAddr, r.ToPort), "comment", comment)
+	if _, err := s.nft(ctx, args...); err != nil {
+		return err
+	}
+	if !r.Masquerade {
+		return nil
+	}
+	_, err := s.nft(ctx, "add", "rule", "ip", s.names.NAT, "postrouting", "ip", "daddr", r.ToAddr, r.Proto, "dport", fmt.Sprintf("%d", r.ToPort), "masquerade", "comment", comment)
 	return err
 }
 
@@ -1255,6 +1756,9 @@ func (s *FirewallService) systemctl(ctx context.Context, args ...string) (string
 }
 
 func (s *FirewallService) sudoPassFor(ctx context.Context) (string, bool, error) {
+	if pass, ok := auth.SudoPasswordFromContext(ctx); ok {
+		return pass, true, nil
+	}
 	if s.sudoPassword == nil {
 		return "", false, nil
 	}
@@ -1262,7 +1766,19 @@ func (s *FirewallService) sudoPassFor(ctx context.Context) (string, bool, error)
 	if !ok || strings.TrimSpace(c.User) == "" {
 		return "", false, nil
 	}
-	return s.sudoPassword(c.User)
+	return s.sudoPassword.Get(c.User)
+}
+
+// InvalidateSudoPassword drops the cached sudo password of user.
+func (s *FirewallService) InvalidateSudoPassword(user string) {
+	s.sudoPassword.Invalidate(user)
+}
+
+func newSudoCache(provider func(user string) (string, bool, error), ttl time.Duration) *sudocache.Cache {
+	if provider == nil {
+		return nil
+	}
+	return sudocache.New(provider, ttl)
 }
 
 func (s *FirewallService) runSudoPassword(ctx context.Context, pass string, bin string, args ...string) (string, error) {
@@ -1288,9 +1804,15 @@ func (s *FirewallService) runSudoPassword(ctx context.Context, pass string, bin
 }
 
 func (s *FirewallService) applyFirewalldRule(ctx context.Context, rule FWRule, enable bool) error {
-	zone := s.firewalldZone(ctx)
-	if zone == "" {
-		zone = "public"
+	if enable {
+		// Also covers toggles, imports and profiles; removal always goes through.
+		if err := s.checkFirewalldIfaceZone(ctx, rule); err != nil {
+			return err
+		}
+	}
+	zone, err := s.firewalldRuleZone(ctx, rule)
+	if err != nil {
+		return err
 	}
 	op := "add"
 	if !enable {
@@ -1305,53 +1827,66 @@ func (s *FirewallService) applyFirewalldRule(ctx context.Context, rule FWRule, e
 		if proto == "" {
 			proto = "tcp"
 		}
+		if rule.Masquerade {
+			return errors.New("firewalld masquerades whole zones; enable it with firewall-cmd --add-masquerade instead")
+		}
 		spec := fmt.Sprintf("port=%d:proto=%s:toport=%d", rule.PortFrom, proto, rule.ToPort)
+		if rule.ToAddr != "" {
+			spec += ":toaddr=" + rule.ToAddr
+		}
 		flag := fmt.Sprintf("--%s-forward-port=%s", op, spec)
-		return s.firewalldChange(ctx, zone, flag)
+		return s.firewalldChange(ctx, zone, flag, !rule.RuntimeOnly)
 	}
 
 	if rule.Service != "" {
 		switch rule.Type {
 		case "allow":
 			flag := fmt.Sprintf("--%s-service=%s", op, rule.Service)
-			return s.firewalldChange(ctx, zone, flag)
+			return s.firewalldChange(ctx, zone, flag, !rule.RuntimeOnly)
 		case "deny":
 			rich := fmt.Sprintf("rule service name=\"%s\" drop", rule.Service)
 			flag := fmt.Sprintf("--%s-rich-rule=%s", op, rich)
-			return s.firewalldChange(ctx, zone, flag)
+			return s.firewalldChange(ctx, zone, flag, !rule.RuntimeOnly)
 		default:
 			return errors.New("unsupported rule type")
 		}
 	}
 
-	portSpec := fmt.Sprintf("%d", rule.PortFrom)
-	if rule.PortTo != rule.PortFrom {
-		portSpec = fmt.Sprintf("%d-%d", rule.PortFrom, rule.PortTo)
-	}
 	proto := strings.ToLower(strings.TrimSpace(rule.Proto))
 	if proto == "" {
 		proto = "tcp"
 	}
-	switch rule.Type {
-	case "allow":
-		flag := fmt.Sprintf("--%s-port=%s/%s", op, portSpec, proto)
-		return s.firewalldChange(ctx, zone, flag)
-	case "deny":
-		rich := fmt.Sprintf("rule port port=\"%s\" protocol=\"%s\" drop", portSpec, proto)
-		flag := fmt.Sprintf("--%s-rich-rule=%s", op, rich)
-		return s.firewalldChange(ctx, zone, flag)
-	default:
-		return errors.New("unsupported rule type")
+	// firewalld has no port lists: each element becomes its own port or rich rule.
+	for _, p := range rule.portRanges() {
+		var flag string
+		switch rule.Type {
+		case "allow":
+			flag = fmt.Sprintf("--%s-port=%s/%s", op, p, proto)
+		case "deny":
+			rich := fmt.Sprintf("rule port port=\"%s\" protocol=\"%s\" drop", p, proto)
+			flag = fmt.Sprintf("--%s-rich-rule=%s", op, rich)
+		default:
+			return errors.New("unsupported rule type")
+		}
+		if err := s.firewalldChange(ctx, zone, flag, !rule.RuntimeOnly); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (s *FirewallService) firewalldChange(ctx context.Context, zone string, opFlag string) error {
+// firewalldChange applies opFlag to the runtime configuration and, when permanent is
+// set, to the permanent one as well.
+func (s *FirewallService) firewalldChange(ctx context.Context, zone string, opFlag string, permanent bool) error {
 	args := []string{"--zone", zone, opFlag}
 	if _, err := s.firewalld(ctx, args...); err != nil {
 		return err
 	}
-	permanent := append([]string{"--permanent"}, args...)
-	if _, err := s.firewalld(ctx, permanent...); err != nil {
+	if !permanent {
+		return nil
+	}
+	permanentArgs := append([]string{"--permanent"}, args...)
+	if _, err := s.firewalld(ctx, permanentArgs...); err != nil {
 		return err
 	}
 	return nil
@@ -1364,39 +1899,46 @@ func (s *FirewallService) applyUfwRule(ctx context.Context, rule FWRule, enable
 	if rule.Type != "allow" && rule.Type != "deny" {
 		return errors.New("unsupported rule type")
 	}
-	target, err := ufwTarget(rule)
+	argSets, err := ufwRuleArgs(rule)
 	if err != nil {
 		return err
 	}
-	var args []string
-	if enable {
-		args = []string{rule.Type, target}
-	} else {
-		args = []string{"--force", "delete", rule.Type, target}
+	for _, args := range argSets {
+		if !enable {
+			args = append([]string{"--force", "delete"}, args...)
+		}
+		if _, err := s.ufw(ctx, args...); err != nil {
+			return err
+		}
 	}
-	_, err = s.ufw(ctx, args...)
-	return err
+	return nil
 }
 
-func ufwTarget(rule FWRule) (string, error) {
+// ufwTargets returns the ufw rule targets for rule; long port lists are split over
+// several ufw rules.
+func ufwTargets(rule FWRule) ([]string, error) {
 	if rule.Service != "" {
-		return rule.Service, nil
+		return []string{rule.Service}, nil
 	}
 	if rule.PortFrom <= 0 {
-		return "", errors.New("port is required")
-	}
-	target := fmt.Sprintf("%d", rule.PortFrom)
-	if rule.PortTo != rule.PortFrom {
-		target = fmt.Sprintf("%d:%d", rule.PortFrom, rule.PortTo)
+		return nil, errors.New("port is required")
 	}
+	groups := ufwPortGroups(rule)
 	proto := strings.ToLower(strings.TrimSpace(rule.Proto))
 	if proto == "" || proto == "any" {
-		return target, nil
+		if len(rule.PortRanges) > 1 {
+			// ufw only accepts multiport specs with an explicit protocol.
+			return nil, errors.New("port lists require proto tcp or udp")
+		}
+		return groups, nil
 	}
 	if proto != "tcp" && proto != "udp" {
-		return "", errors.New("proto must be tcp or udp")
+		return nil, errors.New("proto must be tcp or udp")
+	}
+	for i := range groups {
+		groups[i] += "/" + proto
 	}
-	return target + "/" + proto, nil
+	return groups, nil
 }
 
 func (s *FirewallService) readFirewalldRules(ctx context.Context) ([]FWRule, error) {
@@ -1408,7 +1950,7 @@ func (s *FirewallService) readFirewalldRules(ctx context.Context) ([]FWRule, err
 	seen := make(map[string]struct{})
 
 	appendRule := func(r FWRule) {
-		key := fmt.Sprintf("%s|%s|%d|%d|%d|%s", r.Type, r.Proto, r.PortFrom, r.PortTo, r.ToPort, r.Service)
+		key := ruleKey(r)
 		if _, ok := seen[key]; ok {
 			return
 		}
@@ -1458,6 +2000,7 @@ func (s *FirewallService) readFirewalldRules(ctx context.Context) ([]FWRule, err
 				PortFrom: from,
 				PortTo:   from,
 				ToPort:   toPort,
+				ToAddr:   firewalldForwardAddr(tok),
 			})
 		}
 	}
@@ -1540,6 +2083,12 @@ func ufwRuleToFWRule(r UFWRule) (FWRule, bool) {
 	}
 
 	to := strings.TrimSpace(r.To)
+	iface := ""
+	if i := strings.Index(to, " on "); i >= 0 {
+		// Interface rules read "80/tcp on eth1".
+		iface = strings.TrimSpace(to[i+4:])
+		to = strings.TrimSpace(to[:i])
+	}
 	if to == "" {
 		return FWRule{}, false
 	}
@@ -1549,7 +2098,7 @@ func ufwRuleToFWRule(r UFWRule) (FWRule, bool) {
 	}
 
 	if to[0] < '0' || to[0] > '9' {
-		return FWRule{Type: ruleType, Proto: "any", Service: to}, true
+		return FWRule{Type: ruleType, Proto: "any", Service: to, Interface: iface}, true
 	}
 
 	proto := ""
@@ -1559,19 +2108,28 @@ func ufwRuleToFWRule(r UFWRule) (FWRule, bool) {
 		proto = parts[1]
 	}
 
-	from, toPort, ok := parseUfwRange(base)
-	if !ok {
-		return FWRule{}, false
+	var ranges []PortRange
+	for _, part := range strings.Split(base, ",") {
+		from, toPort, ok := parseUfwRange(part)
+		if !ok {
+			return FWRule{}, false
+		}
+		ranges = append(ranges, PortRange{From: from, To: toPort})
 	}
 	if proto == "" {
 		proto = "tcp"
 	}
-	return FWRule{
-		Type:     ruleType,
-		Proto:    strings.ToLower(proto),
-		PortFrom: from,
-		PortTo:   toPort,
-	}, true
+	rule := FWRule{
+		Type:      ruleType,
+		Proto:     strings.ToLower(proto),
+		PortFrom:  ranges[0].From,
+		PortTo:    ranges[0].To,
+		Interface: iface,
+	}
+	if len(ranges) > 1 {
+		rule.PortRanges = ranges
+	}
+	return rule, true
 }
 
 func parseUfwRange(base string) (int, int, bool) {
@@ -1638,6 +2196,11 @@ func parseFirewalldForward(spec string) (int, string, int, bool) {
 			proto = strings.ToLower(strings.TrimSpace(parts[1]))
 		case "toport":
 			toPort, _ = strconv.Atoi(parts[1])
+		case "toaddr":
+			// Forwards to another host keep the port unless toport says otherwise.
+			if toPort == 0 {
+				toPort = port
+			}
 		}
 	}
 	if port <= 0 || toPort <= 0 {
@@ -1649,6 +2212,16 @@ func parseFirewalldForward(spec string) (int, string, int, bool) {
 	return port, proto, toPort, true
 }
 
+// firewalldForwardAddr returns the toaddr of a forward-port spec ("" for local ones).
+func firewalldForwardAddr(spec string) string {
+	for _, f := range strings.Split(spec, ":") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(f), "toaddr="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
 var (
 	firewalldRichPortRe    = regexp.MustCompile(`port port="([^"]+)"\s+protocol="([^"]+)"`)
 	firewalldRichServiceRe = regexp.MustCompile(`service name="([^"]+)"`)
@@ -1690,6 +2263,7 @@ func (s *FirewallService) load() error {
 	if db.Version == 0 {
 		db.Version = 1
 	}
+	migrateProfiles(&db)
 	s.mu.Lock()
 	s.db = db
 	s.mu.Unlock()
@@ -1697,23 +2271,17 @@ func (s *FirewallService) load() error {
 }
 
 func (s *FirewallService) saveLocked() error {
+	defer s.invalidateStatus()
 	path := strings.TrimSpace(s.cfg.DBPath)
 	if path == "" {
 		return errors.New("firewall db path is not configured")
 	}
-	path = filepath.Clean(path)
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return err
-	}
+	s.syncActiveProfileLocked()
 	b, err := json.MarshalIndent(s.db, "", "  ")
 	if err != nil {
 		return err
 	}
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, append(b, '\n'), 0o600); err != nil {
-		return err
-	}
-	return os.Rename(tmp, path)
+	return s.cfg.DBPerm.WriteFile(filepath.Clean(path), append(b, '\n'))
 }
 
 func randID(nBytes int) (string, error) {
@@ -0,0 +1,32 @@
+package system
+
+import (
+	"context"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/auth"
+)
+
+// fwSystemActor records changes Atlas makes on its own (expiring and unit-linked rules).
+const fwSystemActor = "atlas"
+
+// changedBy returns the user making a request, "" when unknown.
+func changedBy(ctx context.Context) string {
+	if c, ok := auth.ClaimsFromContext(ctx); ok {
+		return c.User
+	}
+	return ""
+}
+
+// touchLocked stamps the DB as changed now by user.
+func (s *FirewallService) touchLocked(user string) {
+	s.db.Updated = time.Now().UTC()
+	s.db.UpdatedBy = user
+}
+
+func (resp *FirewallRules) setUpdated(db fwDB) {
+	if !db.Updated.IsZero() {
+		resp.UpdatedUnix = db.Updated.Unix()
+	}
+	resp.UpdatedBy = db.UpdatedBy
+}
@@ -0,0 +1,291 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FWBan drops all traffic from Source. Bans sit outside the port rule model: they are
+// not part of profiles and are applied ahead of every other rule, base rules included.
+type FWBan struct {
+	ID string `json:"id"`
+	// Source is an IP address or CIDR block.
+	Source  string    `json:"source"`
+	Comment string    `json:"comment,omitempty"`
+	Created time.Time `json:"created_utc,omitempty"`
+	// ExpiresUnix lifts the ban automatically at that time (0: permanent).
+	ExpiresUnix int64  `json:"expires_unix,omitempty"`
+	CreatedBy   string `json:"created_by,omitempty"`
+}
+
+type banRequest struct {
+	Source     string `json:"source"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+	Comment    string `json:"comment,omitempty"`
+}
+
+type unbanRequest struct {
+	Source string `json:"source"`
+	ID     string `json:"id"`
+}
+
+// parseBanSource normalizes an IP address or CIDR block.
+func parseBanSource(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if ip := net.ParseIP(v); ip != nil {
+		if ip.IsUnspecified() || ip.IsLoopback() {
+			return "", fmt.Errorf("cannot ban %s", v)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.String(), nil
+		}
+		return ip.String(), nil
+	}
+	ip, n, err := net.ParseCIDR(v)
+	if err != nil {
+		return "", errors.New("source must be an IP address or CIDR block")
+	}
+	if ones, _ := n.Mask.Size(); ones == 0 || ip.IsLoopback() {
+		return "", fmt.Errorf("cannot ban %s", v)
+	}
+	return n.String(), nil
+}
+
+// matches reports whether ip is covered by the ban.
+func (b FWBan) matches(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if _, n, err := net.ParseCIDR(b.Source); err == nil {
+		return n.Contains(ip)
+	}
+	return net.ParseIP(b.Source).Equal(ip)
+}
+
+func (b FWBan) ipv6() bool {
+	return strings.Contains(b.Source, ":")
+}
+
+func (s *FirewallService) findBanLocked(source, id string) int {
+	for i, b := range s.db.Bans {
+		if (id != "" && b.ID == id) || (source != "" && b.Source == source) {
+			return i
+		}
+	}
+	return -1
+}
+
+// addBanRule inserts the nft drop rule for b; applyLocked adds bans before anything else.
+func (s *FirewallService) addBanRule(ctx context.Context, b FWBan) error {
+	family := "ip"
+	if b.ipv6() {
+		family = "ip6"
+	}
+	_, err := s.nft(ctx, "add", "rule", "inet", s.names.Filter, "input", family, "saddr", b.Source, "drop", "comment", s.names.comment(b.ID))
+	return err
+}
+
+// applyBanSystem adds or removes b with ufw or firewalld.
+func (s *FirewallService) applyBanSystem(ctx context.Context, backend string, b FWBan, enable bool) error {
+	defer s.invalidateStatus()
+	switch backend {
+	case "ufw":
+		// prepend puts the ban above every existing ufw rule.
+		args := []string{"prepend", "deny", "from", b.Source}
+		if !enable {
+			args = []string{"--force", "delete", "deny", "from", b.Source}
+		}
+		_, err := s.ufw(ctx, args...)
+		return err
+	case "firewalld":
+		zone, err := s.firewalldRuleZone(ctx, FWRule{})
+		if err != nil {
+			return err
+		}
+		family := "ipv4"
+		if b.ipv6() {
+			family = "ipv6"
+		}
+		op := "add"
+		if !enable {
+			op = "remove"
+		}
+		rich := fmt.Sprintf("rule family=\"%s\" source address=\"%s\" drop", family, b.Source)
+		return s.firewalldChange(ctx, zone, fmt.Sprintf("--%s-rich-rule=%s", op, rich), true)
+	default:
+		return errors.New("unsupported firewall backend")
+	}
+}
+
+// HandleBan drops all traffic from a source address, optionally for ttl_seconds.
+// Banning an address that is already banned updates its expiry.
+func (s *FirewallService) HandleBan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.cfg.Enabled {
+		http.Error(w, "firewall is disabled by config", http.StatusForbidden)
+		return
+	}
+	var req banRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	source, err := parseBanSource(req.Source)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.TTLSeconds < 0 || req.TTLSeconds > maxRuleTTL {
+		http.Error(w, fmt.Sprintf("ttl_seconds must be between 0 and %d", maxRuleTTL), http.StatusBadRequest)
+		return
+	}
+	by := changedBy(r.Context())
+	ban := FWBan{Source: source, Comment: strings.TrimSpace(req.Comment), Created: time.Now().UTC(), CreatedBy: by}
+	if req.TTLSeconds > 0 {
+		ban.ExpiresUnix = ban.Created.Unix() + req.TTLSeconds
+	}
+	if remote, _, _, ok := managementConn(r); ok && ban.matches(remote) {
+		http.Error(w, fmt.Sprintf("refusing to ban %s: it covers your own address %s", source, remote), http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+	backend, berr := s.backend()
+	if berr != nil {
+		http.Error(w, berr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	if backend == "nft" && !s.db.Enabled {
+		// applyLocked would only drop the Atlas tables: the ban would be saved but never enforced.
+		s.mu.Unlock()
+		http.Error(w, "Atlas firewall rules are disabled; enable them before banning", http.StatusConflict)
+		return
+	}
+	prev := s.db
+	s.db.Bans = append([]FWBan{}, s.db.Bans...)
+	existing := s.findBanLocked(source, "")
+	if max := s.maxRules(); existing < 0 && s.ruleCountLocked() >= max {
+		s.mu.Unlock()
+		http.Error(w, fmt.Sprintf("too many rules (max %d)", max), http.StatusConflict)
+		return
+	}
+	if existing >= 0 {
+		s.db.Bans[existing].ExpiresUnix = ban.ExpiresUnix
+		if ban.Comment != "" {
+			s.db.Bans[existing].Comment = ban.Comment
+		}
+		ban = s.db.Bans[existing]
+	} else {
+		if ban.ID, err = randID(10); err != nil {
+			s.mu.Unlock()
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		s.db.Bans = append(s.db.Bans, ban)
+	}
+	s.touchLocked(by)
+	if err := s.saveLocked(); err != nil {
+		s.db = prev
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existing < 0 {
+		if backend == "nft" {
+			err = s.applyLocked(ctx)
+		} else {
+			err = s.applyBanSystem(ctx, backend, ban, true)
+		}
+		if err != nil {
+			s.db = prev
+			_ = s.saveLocked()
+			s.mu.Unlock()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.mu.Unlock()
+	if ban.ExpiresUnix > 0 {
+		s.startReaper()
+	}
+	writeJSON(w, ban)
+}
+
+// HandleUnban lifts the ban on source (or with the given id).
+func (s *FirewallService) HandleUnban(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.cfg.Enabled {
+		http.Error(w, "firewall is disabled by config", http.StatusForbidden)
+		return
+	}
+	var req unbanRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	source := ""
+	if strings.TrimSpace(req.Source) != "" {
+		var err error
+		if source, err = parseBanSource(req.Source); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	id := strings.TrimSpace(req.ID)
+	if source == "" && id == "" {
+		http.Error(w, "source or id is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+	backend, berr := s.backend()
+	if berr != nil {
+		http.Error(w, berr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findBanLocked(source, id)
+	if i < 0 {
+		http.Error(w, "not banned", http.StatusNotFound)
+		return
+	}
+	ban := s.db.Bans[i]
+	prev := s.db
+	s.db.Bans = append(append([]FWBan{}, s.db.Bans[:i]...), s.db.Bans[i+1:]...)
+	s.touchLocked(changedBy(r.Context()))
+	if err := s.saveLocked(); err != nil {
+		s.db = prev
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var err error
+	if backend == "nft" {
+		err = s.applyLocked(ctx)
+	} else {
+		err = s.applyBanSystem(ctx, backend, ban, false)
+	}
+	if err != nil {
+		s.db = prev
+		_ = s.saveLocked()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,215 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// fwSystemRule is a base rule managed by Atlas itself; it is shown read-only in the UI.
+type fwSystemRule struct {
+	ID      string `json:"id"`
+	Match   string `json:"match"`
+	Verdict string `json:"verdict"`
+}
+
+// nftBaseRules keep loopback and replies to outgoing connections working, which a
+// default-deny input policy would otherwise break.
+var nftBaseRules = []fwSystemRule{
+	{ID: "system:lo", Match: "iif lo", Verdict: "accept"},
+	{ID: "system:established", Match: "ct state established,related", Verdict: "accept"},
+}
+
+type baseRulesRequest struct {
+	BaseRules  bool `json:"base_rules"`
+	PolicyDrop bool `json:"policy_drop"`
+}
+
+type baseRulesResponse struct {
+	BaseRules   bool           `json:"base_rules"`
+	PolicyDrop  bool           `json:"policy_drop"`
+	Policy      string         `json:"policy"`
+	SystemRules []fwSystemRule `json:"system_rules"`
+}
+
+// systemRulesLocked returns the base rules currently in effect (nil when disabled).
+func (s *FirewallService) systemRulesLocked() []fwSystemRule {
+	if !s.db.BaseRules {
+		return nil
+	}
+	return append([]fwSystemRule{}, nftBaseRules...)
+}
+
+func (s *FirewallService) inputPolicyLocked() string {
+	if s.db.PolicyDrop {
+		return "drop"
+	}
+	return "accept"
+}
+
+func (s *FirewallService) baseRulesLocked() baseRulesResponse {
+	return baseRulesResponse{
+		BaseRules:   s.db.BaseRules,
+		PolicyDrop:  s.db.PolicyDrop,
+		Policy:      s.inputPolicyLocked(),
+		SystemRules: append([]fwSystemRule{}, s.systemRulesLocked()...),
+	}
+}
+
+// HandleBaseRules reads (GET) or sets (POST) the nft base rules and the input chain policy.
+// policy_drop requires base_rules, so switching to default-deny can't cut off loopback
+// or established sessions (including the one the request came in on).
+func (s *FirewallService) HandleBaseRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		resp := s.baseRulesLocked()
+		s.mu.Unlock()
+		writeJSON(w, resp)
+		return
+	case http.MethodPost:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.cfg.Enabled {
+		http.Error(w, "firewall is disabled by config", http.StatusForbidden)
+		return
+	}
+	var req baseRulesRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.PolicyDrop && !req.BaseRules {
+		http.Error(w, "policy_drop requires base_rules", http.StatusBadRequest)
+		return
+	}
+	backend, berr := s.backend()
+	if berr != nil {
+		http.Error(w, berr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if backend != "nft" {
+		http.Error(w, "base rules are only supported with nft backend", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.setInputPolicyLocked(ctx, r, req.BaseRules, req.PolicyDrop); err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	writeJSON(w, s.baseRulesLocked())
+}
+
+// setInputPolicyLocked saves and applies the base rules and input policy (nft only),
+// refusing a combination that fails the lockout check for r's connection.
+func (s *FirewallService) setInputPolicyLocked(ctx context.Context, r *http.Request, baseRules, policyDrop bool) error {
+	prev := s.db
+	s.db.BaseRules = baseRules
+	s.db.PolicyDrop = policyDrop
+	if err := s.checkLockoutLocked(r, "nft"); err != nil {
+		s.db = prev
+		return err
+	}
+	s.touchLocked(changedBy(r.Context()))
+	if err := s.saveLocked(); err != nil {
+		s.db = prev
+		return err
+	}
+	if err := s.applyLocked(ctx); err != nil {
+		s.db = prev
+		_ = s.saveLocked()
+		_ = s.applyLocked(ctx)
+		return err
+	}
+	return nil
+}
+
+func writePolicyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errLockout) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func (s *FirewallService) addSystemRule(ctx context.Context, r fwSystemRule) error {
+	args := []string{"add", "rule", "inet", s.names.Filter, "input"}
+	args = append(args, strings.Fields(r.Match)...)
+	args = append(args, r.Verdict, "comment", s.names.comment(r.ID))
+	_, err := s.nft(ctx, args...)
+	return err
+}
+
+type policyRequest struct {
+	Policy string `json:"policy"`
+}
+
+type policyResponse struct {
+	Policy    string `json:"policy"`
+	BaseRules bool   `json:"base_rules"`
+}
+
+// HandlePolicy reads (GET) or sets (PUT) the default policy of the nft input chain.
+// Switching to drop also turns the base rules on, so loopback and established
+// connections keep working; with LockoutCheck it is refused when no rule would still
+// allow the caller's own connection.
+func (s *FirewallService) HandlePolicy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		resp := policyResponse{Policy: s.inputPolicyLocked(), BaseRules: s.db.BaseRules}
+		s.mu.Unlock()
+		writeJSON(w, resp)
+		return
+	case http.MethodPut:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.cfg.Enabled {
+		http.Error(w, "firewall is disabled by config", http.StatusForbidden)
+		return
+	}
+	var req policyRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	policy := strings.ToLower(strings.TrimSpace(req.Policy))
+	if policy != "accept" && policy != "drop" {
+		http.Error(w, "policy must be accept or drop", http.StatusBadRequest)
+		return
+	}
+	backend, berr := s.backend()
+	if berr != nil {
+		http.Error(w, berr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if backend != "nft" {
+		http.Error(w, "the input policy is only supported with nft backend", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	drop := policy == "drop"
+	if err := s.setInputPolicyLocked(ctx, r, s.db.BaseRules || drop, drop); err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	writeJSON(w, policyResponse{Policy: s.inputPolicyLocked(), BaseRules: s.db.BaseRules})
+}
@@ -0,0 +1,120 @@
+package system
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type deleteRulesRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type deleteRulesResponse struct {
+	Removed  []string `json:"removed"`
+	NotFound []string `json:"not_found"`
+}
+
+// HandleRulesDelete removes several rules at once: the database is saved once and the
+// nft ruleset reloaded once. ufw and firewalld still get one call per removed rule; if
+// one fails, the rules already removed are re-added and the database is restored.
+func (s *FirewallService) HandleRulesDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.cfg.Enabled {
+		http.Error(w, "firewall is disabled by config", http.StatusForbidden)
+		return
+	}
+	var req deleteRulesRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids required", http.StatusBadRequest)
+		return
+	}
+	backend, berr := s.backend()
+	if berr != nil {
+		http.Error(w, berr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if id = strings.TrimSpace(id); id != "" {
+			want[id] = true
+		}
+	}
+	resp := deleteRulesResponse{Removed: []string{}, NotFound: []string{}}
+	var out, removed []FWRule
+	for _, rr := range s.db.Rules {
+		if want[rr.ID] {
+			removed = append(removed, rr)
+			resp.Removed = append(resp.Removed, rr.ID)
+			delete(want, rr.ID)
+			continue
+		}
+		out = append(out, rr)
+	}
+	for _, id := range req.IDs {
+		if id = strings.TrimSpace(id); want[id] {
+			resp.NotFound = append(resp.NotFound, id)
+			delete(want, id)
+		}
+	}
+	if len(removed) == 0 {
+		writeJSON(w, resp)
+		return
+	}
+
+	prev := s.db
+	s.db.Rules = out
+	if err := s.checkLockoutLocked(r, backend); err != nil {
+		s.db = prev
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.touchLocked(changedBy(r.Context()))
+	if err := s.saveLocked(); err != nil {
+		s.db = prev
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if backend == "nft" {
+		if err := s.applyLocked(ctx); err != nil {
+			s.db = prev
+			_ = s.saveLocked()
+			_ = s.applyLocked(ctx)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		for i, rr := range removed {
+			if !rr.Enabled {
+				continue
+			}
+			if err := s.applyRuleSystem(ctx, backend, rr, false); err != nil {
+				for _, done := range removed[:i] {
+					if done.Enabled {
+						_ = s.applyRuleSystem(ctx, backend, done, true)
+					}
+				}
+				s.db = prev
+				_ = s.saveLocked()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	writeJSON(w, resp)
+}
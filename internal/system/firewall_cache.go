@@ -0,0 +1,59 @@
+package system
+
+import (
+	"context"
+	"time"
+)
+
+// statusCacheTTL bounds how stale a polled firewall status can be. Mutations invalidate
+// the cache immediately, so this only limits external changes (e.g. nft run by hand).
+const statusCacheTTL = 3 * time.Second
+
+type cachedStatus struct {
+	at      time.Time
+	gen     uint64
+	backend string
+	active  bool
+	err     error
+	live    *int
+}
+
+// cachedBackendStatus returns whether backend is active (and, for an active nft backend,
+// the number of live rules), shelling out at most once per statusCacheTTL.
+func (s *FirewallService) cachedBackendStatus(ctx context.Context, backend string) (active bool, live *int, _ error) {
+	s.statusMu.Lock()
+	c := s.status
+	gen := s.statusGen
+	s.statusMu.Unlock()
+	if !c.at.IsZero() && c.gen == gen && c.backend == backend && time.Since(c.at) < statusCacheTTL {
+		return c.active, c.live, c.err
+	}
+
+	active, err := s.backendActive(ctx, backend)
+	if backend == "nft" && active {
+		if rules, lerr := s.liveRules(ctx); lerr == nil {
+			n := len(rules)
+			live = &n
+		}
+	}
+	if ctx.Err() != nil {
+		// Don't cache results cut short by the caller's deadline.
+		return active, live, err
+	}
+
+	s.statusMu.Lock()
+	// A mutation during the probe bumps statusGen; keep the cache empty in that case.
+	if s.statusGen == gen {
+		s.status = cachedStatus{at: time.Now(), gen: gen, backend: backend, active: active, err: err, live: live}
+	}
+	s.statusMu.Unlock()
+	return active, live, err
+}
+
+// invalidateStatus drops the cached status after Atlas changed the firewall.
+func (s *FirewallService) invalidateStatus() {
+	s.statusMu.Lock()
+	s.statusGen++
+	s.status = cachedStatus{}
+	s.statusMu.Unlock()
+}
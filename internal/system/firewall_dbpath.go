@@ -0,0 +1,102 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DBPath returns the file the rules are stored in.
+func (s *FirewallService) DBPath() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg.DBPath
+}
+
+// RelocateDB moves the rules file to newPath and keeps using it from then on. The new
+// file is written atomically before the old one is removed; an existing file at newPath
+// is never overwritten. newPath must lie in (or below) one of allowedDirs or the current
+// file's directory, so a request can't drop a root-owned file into e.g. /etc/cron.d.
+// It returns the previous path.
+func (s *FirewallService) RelocateDB(newPath string, allowedDirs ...string) (string, error) {
+	newPath = strings.TrimSpace(newPath)
+	if newPath == "" || !filepath.IsAbs(newPath) {
+		return "", errors.New("path must be absolute")
+	}
+	newPath = filepath.Clean(newPath)
+	if err := checkWritableDir(filepath.Dir(newPath)); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldPath := s.cfg.DBPath
+	if oldPath != "" {
+		allowedDirs = append(allowedDirs, filepath.Dir(oldPath))
+	}
+	if !inDirs(filepath.Dir(newPath), allowedDirs) {
+		return "", fmt.Errorf("path must be inside %s", strings.Join(allowedDirs, " or "))
+	}
+	if filepath.Clean(oldPath) == newPath {
+		return oldPath, nil
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return "", fmt.Errorf("%s already exists", newPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	s.cfg.DBPath = newPath
+	if err := s.saveLocked(); err != nil {
+		s.cfg.DBPath = oldPath
+		return "", err
+	}
+	if oldPath != "" {
+		if err := os.Remove(oldPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			// The rules are safe at the new path; a stale copy is only clutter.
+			slog.Warn("firewall: remove old db after relocation", "path", oldPath, "err", err)
+		}
+	}
+	return oldPath, nil
+}
+
+// inDirs reports whether dir is one of dirs or below one, after resolving symlinks.
+func inDirs(dir string, dirs []string) bool {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	for _, d := range dirs {
+		if d == "" {
+			continue
+		}
+		d, err := filepath.EvalSymlinks(filepath.Clean(d))
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(d, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkWritableDir(dir string) error {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".atlas-write-test-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	_ = f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,107 @@
+package system
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dockerCheckTTL bounds how often the Docker check lists the host's nft chains.
+const dockerCheckTTL = 30 * time.Second
+
+// DockerStatus reports Docker-managed netfilter state next to Atlas's own tables.
+type DockerStatus struct {
+	// Chains lists Docker's chains as "family table chain".
+	Chains []string `json:"chains,omitempty"`
+	// Bypass: Docker DNATs published ports to containers, so that traffic is forwarded
+	// and never reaches the input hook Atlas filters in.
+	Bypass bool `json:"bypass"`
+	// RedirectOrder: Atlas redirects and Docker's DNAT share the prerouting NAT hook at
+	// the same priority, so their relative order is undefined (see NATPriority).
+	RedirectOrder bool   `json:"redirect_order,omitempty"`
+	Warning       string `json:"warning"`
+}
+
+type cachedDocker struct {
+	at time.Time
+	st *DockerStatus
+}
+
+// dockerStatus returns nil when Docker does not appear to manage netfilter rules here.
+// backend and hasRedirects describe the current Atlas rule set.
+func (s *FirewallService) dockerStatus(ctx context.Context, backend string, hasRedirects bool) *DockerStatus {
+	s.dockerMu.Lock()
+	c := s.docker
+	s.dockerMu.Unlock()
+	if c.at.IsZero() || time.Since(c.at) >= dockerCheckTTL {
+		var chains []string
+		if s.nftPath != "" {
+			if out, err := s.nft(ctx, "list", "chains"); err == nil {
+				chains = parseDockerChains(out)
+			}
+		}
+		_, ifErr := os.Stat(filepath.Join(sysClassNet, "docker0"))
+		c = cachedDocker{at: time.Now()}
+		if len(chains) > 0 || ifErr == nil {
+			c.st = &DockerStatus{Chains: chains}
+		}
+		if ctx.Err() == nil {
+			s.dockerMu.Lock()
+			s.docker = c
+			s.dockerMu.Unlock()
+		}
+	}
+	if c.st == nil {
+		return nil
+	}
+	st := *c.st
+	// Without visible chains (iptables-legacy) only docker0 gave Docker away; assume NAT.
+	nat := len(st.Chains) == 0 || dockerHasNAT(st.Chains)
+	st.Bypass = nat
+	st.RedirectOrder = nat && backend == "nft" && hasRedirects && s.natPriority() == defaultNATPriority
+	st.Warning = "Docker manages netfilter rules on this host"
+	if st.Bypass {
+		st.Warning += "; ports published by containers are DNATed and forwarded, so Atlas rules do not filter them (use Docker's DOCKER-USER chain or publish on 127.0.0.1)"
+	}
+	if st.RedirectOrder {
+		st.Warning += "; Atlas redirects run in the same prerouting NAT hook as Docker's DNAT, in no defined order"
+	}
+	return &st
+}
+
+// parseDockerChains picks Docker's chains out of `nft list chains`: chains named DOCKER*
+// (iptables-nft) and every chain of a docker* table (Docker's native nftables backend).
+func parseDockerChains(out string) []string {
+	var chains []string
+	table := ""
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		switch {
+		case len(f) >= 3 && f[0] == "table":
+			table = f[1] + " " + f[2]
+		case len(f) >= 2 && f[0] == "chain" && table != "":
+			name := f[1]
+			tname := table[strings.IndexByte(table, ' ')+1:]
+			if strings.HasPrefix(name, "DOCKER") || strings.HasPrefix(tname, "docker") {
+				chains = append(chains, table+" "+name)
+			}
+		}
+	}
+	return chains
+}
+
+// dockerHasNAT reports whether Docker has NAT chains (iptables-nft "nat" table or a
+// nat chain of its own tables).
+func dockerHasNAT(chains []string) bool {
+	for _, c := range chains {
+		f := strings.Fields(c)
+		if len(f) == 3 && (f[1] == "nat" || (strings.HasPrefix(f[1], "docker") && strings.Contains(f[2], "nat"))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// maxRuleTTL caps ttl_seconds of temporary rules (30 days).
+	maxRuleTTL = 30 * 24 * 60 * 60
+	// fwReapInterval is how often expired rules are removed; a rule may outlive its
+	// expiry by up to this long.
+	fwReapInterval = 15 * time.Second
+	// fwReapMaxBackoff caps the delay between retries while removal keeps failing.
+	fwReapMaxBackoff = 15 * time.Minute
+)
+
+func (s *FirewallService) hasExpiringRules() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.db.Rules {
+		if r.ExpiresUnix > 0 {
+			return true
+		}
+	}
+	for _, b := range s.db.Bans {
+		if b.ExpiresUnix > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *FirewallService) startReaper() {
+	s.reaperOnce.Do(func() { go s.reaperLoop() })
+}
+
+func (s *FirewallService) reaperLoop() {
+	t := time.NewTicker(fwReapInterval)
+	defer t.Stop()
+	for now := range t.C {
+		s.reapTick(now)
+	}
+}
+
+// reapTick runs reapExpired unless it is backing off after a failure, and records the
+// outcome for the rules listing. Each consecutive failure doubles the delay, up to
+// fwReapMaxBackoff.
+func (s *FirewallService) reapTick(now time.Time) {
+	s.mu.Lock()
+	wait := now.Before(s.reapNext)
+	s.mu.Unlock()
+	if wait {
+		return
+	}
+	err := s.reapExpired(now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.reapErr, s.reapFailures, s.reapNext = "", 0, time.Time{}
+		return
+	}
+	s.reapFailures++
+	delay := fwReapInterval
+	for i := 1; i < s.reapFailures && delay < fwReapMaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, fwReapMaxBackoff)
+	s.reapErr = err.Error()
+	s.reapNext = now.Add(delay)
+	slog.Error("firewall: remove expired rules", "err", err, "failures", s.reapFailures, "retry_in", delay)
+}
+
+// warningsLocked lists the rule overlaps plus a pending reaper failure, if any.
+func (s *FirewallService) warningsLocked() []string {
+	warnings := overlapWarnings(s.db.Rules)
+	if s.reapErr != "" {
+		warnings = append(warnings, fmt.Sprintf("expired rules could not be removed (%d attempts, next at %s): %s",
+			s.reapFailures, s.reapNext.UTC().Format(time.RFC3339), s.reapErr))
+	}
+	return warnings
+}
+
+// reapExpired removes rules and bans whose expiry is at or before now, saving and
+// applying the result like a DELETE would (and rolling back if that fails).
+func (s *FirewallService) reapExpired(now time.Time) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept, expired []FWRule
+	for _, r := range s.db.Rules {
+		if r.ExpiresUnix > 0 && r.ExpiresUnix <= now.Unix() {
+			expired = append(expired, r)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	var keptBans, expiredBans []FWBan
+	for _, b := range s.db.Bans {
+		if b.ExpiresUnix > 0 && b.ExpiresUnix <= now.Unix() {
+			expiredBans = append(expiredBans, b)
+			continue
+		}
+		keptBans = append(keptBans, b)
+	}
+	if len(expired) == 0 && len(expiredBans) == 0 {
+		return nil
+	}
+	backend, err := s.backend()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	prev := s.db
+	s.db.Rules = kept
+	s.db.Bans = keptBans
+	s.touchLocked(fwSystemActor)
+	if err := s.saveLocked(); err != nil {
+		s.db = prev
+		return err
+	}
+	if backend == "nft" {
+		if err := s.applyLocked(ctx); err != nil {
+			s.db = prev
+			_ = s.saveLocked()
+			return err
+		}
+	} else {
+		for _, r := range expired {
+			if !r.Enabled {
+				continue
+			}
+			if err := s.applyRuleSystem(ctx, backend, r, false); err != nil {
+				s.db = prev
+				_ = s.saveLocked()
+				return err
+			}
+		}
+		for _, b := range expiredBans {
+			if err := s.applyBanSystem(ctx, backend, b, false); err != nil {
+				s.db = prev
+				_ = s.saveLocked()
+				return err
+			}
+		}
+	}
+	for _, r := range expired {
+		slog.Info("firewall: expired rule removed", "id", r.ID, "comment", r.Comment)
+	}
+	for _, b := range expiredBans {
+		slog.Info("firewall: ban expired", "id", b.ID, "source", b.Source)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sysClassNet lists the host's network interfaces.
+const sysClassNet = "/sys/class/net"
+
+// validateInterface checks that name is a plausible interface name present on the host.
+func validateInterface(name string) error {
+	if len(name) > 15 || strings.ContainsAny(name, "/\"' \t") || name == "." || name == ".." {
+		return fmt.Errorf("bad interface name %q", name)
+	}
+	if _, err := os.Stat(filepath.Join(sysClassNet, name)); err != nil {
+		return fmt.Errorf("interface %s does not exist", name)
+	}
+	return nil
+}
+
+// interfaceOfIP returns the name of the interface that owns ip ("" if unknown).
+func interfaceOfIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, ifc := range ifaces {
+		addrs, err := ifc.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return ifc.Name
+			}
+		}
+	}
+	return ""
+}
+
+// firewalldRuleZone returns the zone a rule is added to. firewalld binds interfaces to
+// zones rather than matching them in rules, so interface rules go to that interface's zone.
+func (s *FirewallService) firewalldRuleZone(ctx context.Context, rule FWRule) (string, error) {
+	if rule.Interface == "" {
+		if zone := s.firewalldZone(ctx); zone != "" {
+			return zone, nil
+		}
+		return "public", nil
+	}
+	out, err := s.firewalld(ctx, "--get-zone-of-interface="+rule.Interface)
+	zone := strings.TrimSpace(out)
+	if err != nil || zone == "" || zone == "no zone" {
+		return "", fmt.Errorf("interface %s is not bound to a firewalld zone", rule.Interface)
+	}
+	return zone, nil
+}
+
+// checkFirewalldIfaceZone refuses interface rules whose zone also covers other traffic.
+// A firewalld rule applies to the whole zone, so adding it to a zone shared with other
+// interfaces (or bound sources) would open the port there too.
+func (s *FirewallService) checkFirewalldIfaceZone(ctx context.Context, rule FWRule) error {
+	if rule.Interface == "" {
+		return nil
+	}
+	zone, err := s.firewalldRuleZone(ctx, rule)
+	if err != nil {
+		return err
+	}
+	out, err := s.firewalld(ctx, "--zone="+zone, "--list-interfaces")
+	if err != nil {
+		return err
+	}
+	var others []string
+	for _, ifc := range strings.Fields(out) {
+		if ifc != rule.Interface {
+			others = append(others, ifc)
+		}
+	}
+	if len(others) > 0 {
+		return fmt.Errorf("zone %s also covers %s; move %s to its own zone to bind a rule to it", zone, strings.Join(others, ", "), rule.Interface)
+	}
+	out, err = s.firewalld(ctx, "--zone="+zone, "--list-sources")
+	if err != nil {
+		return err
+	}
+	if src := strings.Fields(out); len(src) > 0 {
+		return fmt.Errorf("zone %s also covers sources %s; move %s to its own zone to bind a rule to it", zone, strings.Join(src, ", "), rule.Interface)
+	}
+	return nil
+}
+
+// ufwRuleArgs returns the ufw arguments adding rule (one set per ufw rule). Rules bound to
+// an interface need ufw's extended syntax ("allow in on eth1 to any port 80 proto tcp").
+func ufwRuleArgs(rule FWRule) ([][]string, error) {
+	if rule.Interface == "" {
+		targets, err := ufwTargets(rule)
+		if err != nil {
+			return nil, err
+		}
+		out := make([][]string, len(targets))
+		for i, target := range targets {
+			out[i] = []string{rule.Type, target}
+		}
+		return out, nil
+	}
+	if rule.Service != "" {
+		return nil, errors.New("ufw does not support services on a specific interface")
+	}
+	if rule.PortFrom <= 0 {
+		return nil, errors.New("port is required")
+	}
+	proto := strings.ToLower(strings.TrimSpace(rule.Proto))
+	if proto == "any" {
+		proto = ""
+	}
+	if proto == "" && len(rule.PortRanges) > 1 {
+		return nil, errors.New("port lists require proto tcp or udp")
+	}
+	var out [][]string
+	for _, ports := range ufwPortGroups(rule) {
+		args := []string{rule.Type, "in", "on", rule.Interface, "to", "any", "port", ports}
+		if proto != "" {
+			args = append(args, "proto", proto)
+		}
+		out = append(out, args)
+	}
+	return out, nil
+}
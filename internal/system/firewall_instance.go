@@ -0,0 +1,48 @@
+package system
+
+import "strings"
+
+// DefaultFirewallInstance names the nft tables, rule comments and persistence files
+// when FirewallConfig.Instance is empty.
+const DefaultFirewallInstance = "atlas"
+
+var defaultNftNames = newNftNames(DefaultFirewallInstance)
+
+// nftNames holds everything an instance owns in the host's nft ruleset, so several
+// Atlas instances can manage their own tables side by side.
+type nftNames struct {
+	Filter string // inet table with the input chain
+	NAT    string // ip table with the prerouting/postrouting chains
+	Prefix string // rule comment prefix, followed by the rule ID
+
+	PersistPath string
+	UnitName    string
+	UnitPath    string
+}
+
+func newNftNames(instance string) nftNames {
+	if instance == "" {
+		instance = DefaultFirewallInstance
+	}
+	return nftNames{
+		Filter:      instance,
+		NAT:         instance + "_nat",
+		Prefix:      instance + ":",
+		PersistPath: "/etc/nftables.d/" + instance + ".nft",
+		UnitName:    instance + "-nft.service",
+		UnitPath:    "/etc/systemd/system/" + instance + "-nft.service",
+	}
+}
+
+// comment returns the nft comment that tags rule id as belonging to this instance.
+func (n nftNames) comment(id string) string {
+	return nftString(n.Prefix + id)
+}
+
+// ruleID extracts the rule ID from a comment, or "" if the comment is not ours.
+func (n nftNames) ruleID(comment string) string {
+	if !strings.HasPrefix(comment, n.Prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(comment, n.Prefix)
+}
@@ -0,0 +1,172 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// fwLinkInterval is how often rules linked to a systemd unit follow its state.
+const fwLinkInterval = 10 * time.Second
+
+var unitNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9:_.@\\-]*$`)
+
+func validateLinkedUnit(unit string) error {
+	if len(unit) > 256 || !unitNameRe.MatchString(unit) {
+		return errors.New("bad linked_unit name")
+	}
+	return nil
+}
+
+// unitUp maps a `systemctl is-active` state to whether linked rules should be enabled;
+// known is false for transitional states, which leave the rules alone.
+func unitUp(state string) (up, known bool) {
+	switch state {
+	case "active", "reloading":
+		return true, true
+	case "inactive", "failed":
+		return false, true
+	}
+	return false, false
+}
+
+// unitState returns the `systemctl is-active` state of unit ("unknown" if it can't tell).
+// The query needs no privileges, so it never goes through sudo.
+func (s *FirewallService) unitState(ctx context.Context, unit string) string {
+	if s.systemctlPath == "" {
+		return "unknown"
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	// is-active exits non-zero for anything but "active"; stdout still names the state.
+	out, _ := exec.CommandContext(ctx, s.systemctlPath, "is-active", "--", unit).Output()
+	if st := strings.TrimSpace(string(out)); st != "" {
+		return st
+	}
+	return "unknown"
+}
+
+func (s *FirewallService) hasLinkedRules() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.db.Rules {
+		if r.LinkedUnit != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *FirewallService) startLinker() {
+	s.linkerOnce.Do(func() { go s.linkerLoop() })
+}
+
+func (s *FirewallService) linkerLoop() {
+	t := time.NewTicker(fwLinkInterval)
+	defer t.Stop()
+	for {
+		if err := s.reconcileLinked(context.Background()); err != nil {
+			slog.Error("firewall: follow linked units", "err", err)
+		}
+		<-t.C
+	}
+}
+
+// reconcileLinked enables rules whose linked unit is running and disables the others,
+// saving and applying the result like a toggle would (and rolling back if that fails).
+func (s *FirewallService) reconcileLinked(ctx context.Context) error {
+	if !s.cfg.Enabled {
+		return nil
+	}
+	s.mu.Lock()
+	units := map[string]bool{}
+	for _, r := range s.db.Rules {
+		if r.LinkedUnit != "" {
+			units[r.LinkedUnit] = true
+		}
+	}
+	s.mu.Unlock()
+	if len(units) == 0 {
+		return nil
+	}
+	states := make(map[string]string, len(units))
+	for u := range units {
+		states[u] = s.unitState(ctx, u)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unitStates = states
+
+	rules := append([]FWRule{}, s.db.Rules...)
+	var changed []FWRule
+	for i, r := range rules {
+		up, known := unitUp(states[r.LinkedUnit])
+		if r.LinkedUnit == "" || !known || r.Enabled == up {
+			continue
+		}
+		rules[i].Enabled = up
+		rules[i].UpdatedBy = fwSystemActor
+		changed = append(changed, rules[i])
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	backend, err := s.backend()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	defer cancel()
+
+	prev := s.db
+	s.db.Rules = rules
+	s.touchLocked(fwSystemActor)
+	if err := s.saveLocked(); err != nil {
+		s.db = prev
+		return err
+	}
+	if backend == "nft" {
+		if err := s.applyLocked(ctx); err != nil {
+			s.db = prev
+			_ = s.saveLocked()
+			return err
+		}
+	} else {
+		for _, r := range changed {
+			if err := s.applyRuleSystem(ctx, backend, r, r.Enabled); err != nil {
+				s.db = prev
+				_ = s.saveLocked()
+				return err
+			}
+		}
+	}
+	for _, r := range changed {
+		slog.Info("firewall: rule follows linked unit", "id", r.ID, "unit", r.LinkedUnit, "enabled", r.Enabled)
+	}
+	return nil
+}
+
+// linkedStatesLocked returns the last seen state of each unit linked by rules.
+func (s *FirewallService) linkedStatesLocked(rules []FWRule) map[string]string {
+	var out map[string]string
+	for _, r := range rules {
+		if r.LinkedUnit == "" {
+			continue
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		st, ok := s.unitStates[r.LinkedUnit]
+		if !ok {
+			st = "unknown"
+		}
+		out[r.LinkedUnit] = st
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// managementConn returns the caller's address, the interface and local port it
+// connected to ("" when the interface is unknown).
+func managementConn(r *http.Request) (net.IP, string, int, bool) {
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return nil, "", 0, false
+	}
+	lhost, lport, err := net.SplitHostPort(local.String())
+	if err != nil {
+		return nil, "", 0, false
+	}
+	port, err := strconv.Atoi(lport)
+	if err != nil || port <= 0 {
+		return nil, "", 0, false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host), interfaceOfIP(net.ParseIP(lhost)), port, true
+}
+
+// errLockout marks lockout check failures; handlers answer them with 409.
+var errLockout = errors.New("lockout check")
+
+// checkLockoutLocked runs the lockout check (with LockoutCheck) against s.db as it is
+// about to be applied, for the connection r came in on. Every handler that changes what
+// gets applied calls it before saving.
+func (s *FirewallService) checkLockoutLocked(r *http.Request, backend string) error {
+	if !s.cfg.LockoutCheck || r == nil {
+		return nil
+	}
+	remote, iface, port, ok := managementConn(r)
+	if !ok {
+		return nil
+	}
+	return s.lockoutCheckLocked(backend, remote, iface, port)
+}
+
+// lockoutCheckLocked reports an error if applying the current rule set would stop new
+// TCP connections from remote to port. Rules are evaluated in order (the first match
+// wins, as in the nft input chain); when none matches, the nft input policy decides.
+// ufw and firewalld have their own default policies, which are not known here, so for
+// them only explicit Atlas rules can fail the check. Rules bound to an interface count
+// only when it is iface, or when iface is unknown.
+func (s *FirewallService) lockoutCheckLocked(backend string, remote net.IP, iface string, port int) error {
+	if !s.db.Enabled {
+		return nil
+	}
+	who := "your connection"
+	if remote != nil {
+		who = "your connection from " + remote.String()
+	}
+	for _, b := range s.db.Bans {
+		if b.matches(remote) {
+			return fmt.Errorf("%w: ban %s (%s) would block %s", errLockout, b.ID, b.Source, who)
+		}
+	}
+	if backend == "nft" && s.db.BaseRules && remote != nil && remote.IsLoopback() {
+		return nil
+	}
+	matches := func(r FWRule) bool {
+		if r.Interface != "" && iface != "" && r.Interface != iface {
+			return false
+		}
+		return r.matchesPacket("tcp", port)
+	}
+	// Redirects run in prerouting, before any filter rule sees the packet.
+	for _, r := range s.db.Rules {
+		if r.Type == "redirect" && matches(r) {
+			return fmt.Errorf("%w: rule %s redirects port %d to %d and would break %s", errLockout, r.ID, port, r.ToPort, who)
+		}
+	}
+	for _, r := range s.db.Rules {
+		if !matches(r) {
+			continue
+		}
+		switch r.Type {
+		case "allow":
+			return nil
+		case "deny":
+			return fmt.Errorf("%w: rule %s (deny %s %s) would block %s to port %d", errLockout, r.ID, r.Proto, rulePorts(r), who, port)
+		}
+	}
+	if backend == "nft" && s.db.PolicyDrop {
+		return fmt.Errorf("%w: input policy is drop and no rule allows tcp port %d; it would block %s", errLockout, port, who)
+	}
+	return nil
+}
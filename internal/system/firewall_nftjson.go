@@ -0,0 +1,276 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// nftLiveRule is a rule as currently loaded in the kernel (one of the Atlas tables).
+type nftLiveRule struct {
+	Family  string `json:"family"`
+	Table   string `json:"table"`
+	Chain   string `json:"chain"`
+	Handle  int    `json:"handle"`
+	Comment string `json:"comment,omitempty"`
+	// ID is the Atlas rule ID taken from an "<instance>:<id>" comment.
+	ID       string `json:"id,omitempty"`
+	Proto    string `json:"proto,omitempty"`
+	PortFrom int    `json:"port_from,omitempty"`
+	PortTo   int    `json:"port_to,omitempty"`
+	Verdict  string `json:"verdict,omitempty"`
+	ToPort   int    `json:"to_port,omitempty"`
+	ToAddr   string `json:"to_addr,omitempty"`
+	Packets  uint64 `json:"packets,omitempty"`
+	Bytes    uint64 `json:"bytes,omitempty"`
+}
+
+type nftTable struct {
+	Found bool
+	Rules []nftLiveRule
+}
+
+// nftListTable reads a table with `nft -j`, falling back to the text format when the
+// installed nft has no JSON support (remembered for later calls) or its JSON output
+// fails to parse (this call only). A missing table is not an error (Found=false).
+func (s *FirewallService) nftListTable(ctx context.Context, family, table string) (nftTable, error) {
+	if !s.nftNoJSON.Load() {
+		out, err := s.nft(ctx, "-j", "list", "table", family, table)
+		switch {
+		case err == nil:
+			t, perr := parseNftJSON([]byte(out), family, table, s.names)
+			if perr == nil {
+				return t, nil
+			}
+		case nftJSONUnsupported(err):
+			s.nftNoJSON.Store(true)
+		case nftNoSuchTable(err):
+			return nftTable{}, nil
+		default:
+			return nftTable{}, err
+		}
+	}
+	out, err := s.nft(ctx, "-a", "list", "table", family, table)
+	if err != nil {
+		if nftNoSuchTable(err) {
+			return nftTable{}, nil
+		}
+		return nftTable{}, err
+	}
+	return parseNftText(out, family, table, s.names), nil
+}
+
+// liveRules returns the rules loaded in the Atlas filter and NAT tables.
+func (s *FirewallService) liveRules(ctx context.Context) ([]nftLiveRule, error) {
+	var out []nftLiveRule
+	for _, t := range [][2]string{{"inet", s.names.Filter}, {"ip", s.names.NAT}} {
+		tbl, err := s.nftListTable(ctx, t[0], t[1])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tbl.Rules...)
+	}
+	return out, nil
+}
+
+func nftJSONUnsupported(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unrecognized option") ||
+		strings.Contains(msg, "invalid option") ||
+		strings.Contains(msg, "json") && strings.Contains(msg, "support")
+}
+
+func nftNoSuchTable(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "no such file or directory") || strings.Contains(msg, "does not exist")
+}
+
+type nftJSONDoc struct {
+	Nftables []map[string]json.RawMessage `json:"nftables"`
+}
+
+type nftJSONRule struct {
+	Family  string            `json:"family"`
+	Table   string            `json:"table"`
+	Chain   string            `json:"chain"`
+	Handle  int               `json:"handle"`
+	Comment string            `json:"comment"`
+	Expr    []json.RawMessage `json:"expr"`
+}
+
+type nftJSONMatch struct {
+	Op   string `json:"op"`
+	Left struct {
+		Payload *struct {
+			Protocol string `json:"protocol"`
+			Field    string `json:"field"`
+		} `json:"payload"`
+	} `json:"left"`
+	Right json.RawMessage `json:"right"`
+}
+
+func parseNftJSON(b []byte, family, table string, names nftNames) (nftTable, error) {
+	var doc nftJSONDoc
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nftTable{}, err
+	}
+	if doc.Nftables == nil {
+		return nftTable{}, errors.New("nft json: missing nftables array")
+	}
+	var t nftTable
+	for _, obj := range doc.Nftables {
+		if raw, ok := obj["table"]; ok {
+			var tb struct {
+				Family string `json:"family"`
+				Name   string `json:"name"`
+			}
+			if json.Unmarshal(raw, &tb) == nil && tb.Family == family && tb.Name == table {
+				t.Found = true
+			}
+			continue
+		}
+		raw, ok := obj["rule"]
+		if !ok {
+			continue
+		}
+		var jr nftJSONRule
+		if err := json.Unmarshal(raw, &jr); err != nil {
+			return nftTable{}, err
+		}
+		r := nftLiveRule{Family: jr.Family, Table: jr.Table, Chain: jr.Chain, Handle: jr.Handle, Comment: jr.Comment}
+		for _, e := range jr.Expr {
+			parseNftJSONExpr(e, &r)
+		}
+		r.ID = names.ruleID(r.Comment)
+		t.Rules = append(t.Rules, r)
+	}
+	return t, nil
+}
+
+func parseNftJSONExpr(raw json.RawMessage, r *nftLiveRule) {
+	var e map[string]json.RawMessage
+	if json.Unmarshal(raw, &e) != nil {
+		return
+	}
+	for k, v := range e {
+		switch k {
+		case "match":
+			var m nftJSONMatch
+			if json.Unmarshal(v, &m) != nil || m.Left.Payload == nil || m.Left.Payload.Field != "dport" {
+				continue
+			}
+			r.Proto = m.Left.Payload.Protocol
+			var port int
+			var rng struct {
+				Range []int `json:"range"`
+			}
+			var set struct {
+				Set []json.RawMessage `json:"set"`
+			}
+			right := m.Right
+			// Port lists are anonymous sets; report their first element.
+			if json.Unmarshal(right, &set) == nil && len(set.Set) > 0 {
+				right = set.Set[0]
+			}
+			if json.Unmarshal(right, &port) == nil {
+				r.PortFrom, r.PortTo = port, port
+			} else if json.Unmarshal(right, &rng) == nil && len(rng.Range) == 2 {
+				r.PortFrom, r.PortTo = rng.Range[0], rng.Range[1]
+			}
+		case "counter":
+			var c struct {
+				Packets uint64 `json:"packets"`
+				Bytes   uint64 `json:"bytes"`
+			}
+			if json.Unmarshal(v, &c) == nil {
+				r.Packets, r.Bytes = c.Packets, c.Bytes
+			}
+		case "redirect":
+			var rd struct {
+				Port int `json:"port"`
+			}
+			if json.Unmarshal(v, &rd) == nil {
+				r.ToPort = rd.Port
+			}
+			r.Verdict = "redirect"
+		case "dnat":
+			var dn struct {
+				Addr string `json:"addr"`
+				Port int    `json:"port"`
+			}
+			if json.Unmarshal(v, &dn) == nil {
+				r.ToAddr, r.ToPort = dn.Addr, dn.Port
+			}
+			r.Verdict = "dnat"
+		case "masquerade":
+			r.Verdict = "masquerade"
+		case "accept", "drop", "reject":
+			r.Verdict = k
+		}
+	}
+}
+
+var (
+	nftTextChainRe   = regexp.MustCompile(`^\s*chain\s+(\S+)\s*\{`)
+	nftTextDportRe   = regexp.MustCompile(`\b(tcp|udp)\s+dport\s+(\d+)(?:-(\d+))?`)
+	nftTextVerdict   = regexp.MustCompile(`\b(accept|drop|reject)\b`)
+	nftTextRedirect  = regexp.MustCompile(`\bredirect to :(\d+)`)
+	nftTextDNAT      = regexp.MustCompile(`\bdnat to ([0-9.]+)(?::(\d+))?`)
+	nftTextCounterRe = regexp.MustCompile(`\bcounter packets (\d+) bytes (\d+)`)
+	nftTextCommentRe = regexp.MustCompile(`\bcomment "((?:[^"\\]|\\.)*)"`)
+	nftTextHandleRe  = regexp.MustCompile(`#\s*handle\s+(\d+)\s*$`)
+)
+
+// parseNftText parses `nft -a list table` output; used only when JSON is unavailable.
+func parseNftText(out, family, table string, names nftNames) nftTable {
+	t := nftTable{Found: strings.Contains(out, "table "+family+" "+table)}
+	chain := ""
+	for _, ln := range strings.Split(out, "\n") {
+		if m := nftTextChainRe.FindStringSubmatch(ln); m != nil {
+			chain = m[1]
+			continue
+		}
+		if chain == "" || strings.Contains(ln, " hook ") {
+			continue
+		}
+		hm := nftTextHandleRe.FindStringSubmatch(ln)
+		if hm == nil {
+			continue
+		}
+		r := nftLiveRule{Family: family, Table: table, Chain: chain}
+		r.Handle, _ = strconv.Atoi(hm[1])
+		if m := nftTextDportRe.FindStringSubmatch(ln); m != nil {
+			r.Proto = m[1]
+			r.PortFrom, _ = strconv.Atoi(m[2])
+			r.PortTo = r.PortFrom
+			if m[3] != "" {
+				r.PortTo, _ = strconv.Atoi(m[3])
+			}
+		}
+		if m := nftTextRedirect.FindStringSubmatch(ln); m != nil {
+			r.Verdict = "redirect"
+			r.ToPort, _ = strconv.Atoi(m[1])
+		} else if m := nftTextDNAT.FindStringSubmatch(ln); m != nil {
+			r.Verdict = "dnat"
+			r.ToAddr = m[1]
+			r.ToPort, _ = strconv.Atoi(m[2])
+		} else if strings.Contains(ln, " masquerade") {
+			r.Verdict = "masquerade"
+		} else if m := nftTextVerdict.FindStringSubmatch(ln); m != nil {
+			r.Verdict = m[1]
+		}
+		if m := nftTextCounterRe.FindStringSubmatch(ln); m != nil {
+			r.Packets, _ = strconv.ParseUint(m[1], 10, 64)
+			r.Bytes, _ = strconv.ParseUint(m[2], 10, 64)
+		}
+		if m := nftTextCommentRe.FindStringSubmatch(ln); m != nil {
+			r.Comment = strings.ReplaceAll(m[1], `\"`, `"`)
+			r.ID = names.ruleID(r.Comment)
+		}
+		t.Rules = append(t.Rules, r)
+	}
+	return t
+}
@@ -0,0 +1,250 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type persistResponse struct {
+	Path       string `json:"path"`
+	Exists     bool   `json:"exists"`
+	UnitName   string `json:"unit_name"`
+	UnitExists bool   `json:"unit_exists"`
+	Rules      int    `json:"rules,omitempty"`
+}
+
+// HandlePersist writes (POST) or removes (DELETE) a boot-time copy of the nft ruleset,
+// loaded by a oneshot systemd unit so the rules survive Atlas being stopped.
+func (s *FirewallService) HandlePersist(w http.ResponseWriter, r *http.Request) {
+	resp := persistResponse{
+		Path:     s.names.PersistPath,
+		UnitName: s.names.UnitName,
+	}
+	if r.Method == http.MethodGet {
+		resp.Exists = fileExists(s.names.PersistPath)
+		resp.UnitExists = fileExists(s.names.UnitPath)
+		writeJSON(w, resp)
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.cfg.Enabled {
+		http.Error(w, "firewall is disabled by config", http.StatusForbidden)
+		return
+	}
+	backend, berr := s.backend()
+	if berr != nil {
+		http.Error(w, berr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if backend != "nft" {
+		http.Error(w, "persist is only supported with nft backend", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodDelete {
+		if err := s.removePersisted(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, resp)
+		return
+	}
+
+	s.mu.Lock()
+	script := renderNftScript(s.db, s.natPriority(), s.names)
+	n := len(s.db.Rules)
+	s.mu.Unlock()
+
+	if err := s.writePersisted(ctx, script); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Exists = true
+	resp.UnitExists = true
+	resp.Rules = n
+	writeJSON(w, resp)
+}
+
+// renderNftScript renders the DB as an `nft -f` script. Each table is declared, deleted and
+// recreated so loading it is idempotent and never touches non-Atlas tables. natPriority is
+// the priority of the prerouting NAT chain; names are the instance's tables and comment prefix.
+// Temporary rules and bans are left out: nothing would expire them if the script is loaded
+// at boot without Atlas running.
+func renderNftScript(db fwDB, natPriority int, names nftNames) string {
+	var b strings.Builder
+	b.WriteString("#!/usr/sbin/nft -f\n")
+	b.WriteString("# Generated by Atlas; changes are overwritten on the next persist.\n\n")
+	fmt.Fprintf(&b, "table inet %[1]s\ndelete table inet %[1]s\n", names.Filter)
+	fmt.Fprintf(&b, "table ip %[1]s\ndelete table ip %[1]s\n", names.NAT)
+	if !db.Enabled {
+		return b.String()
+	}
+
+	var filter, nat, snat []string
+	for _, r := range db.Rules {
+		if !r.Enabled || r.Service != "" || r.ExpiresUnix > 0 {
+			continue
+		}
+		comment := names.comment(r.ID)
+		iif := ""
+		if r.Interface != "" {
+			iif = "iifname " + nftString(r.Interface) + " "
+		}
+		switch r.Type {
+		case "allow", "deny":
+			verdict := "accept"
+			if r.Type == "deny" {
+				verdict = "drop"
+			}
+			filter = append(filter, fmt.Sprintf("%s%s dport %s %s comment %s", iif, r.Proto, nftDport(r), verdict, comment))
+		case "redirect":
+			if r.ToAddr == "" {
+				nat = append(nat, fmt.Sprintf("%s%s dport %d redirect to :%d comment %s", iif, r.Proto, r.PortFrom, r.ToPort, comment))
+				continue
+			}
+			nat = append(nat, fmt.Sprintf("%s%s dport %d dnat to %s:%d comment %s", iif, r.Proto, r.PortFrom, r.ToAddr, r.ToPort, comment))
+			if r.Masquerade {
+				snat = append(snat, fmt.Sprintf("ip daddr %s %s dport %d masquerade comment %s", r.ToAddr, r.Proto, r.ToPort, comment))
+			}
+		}
+	}
+
+	policy := "accept"
+	if db.PolicyDrop {
+		policy = "drop"
+	}
+	if db.BaseRules {
+		var base []string
+		for _, r := range nftBaseRules {
+			base = append(base, fmt.Sprintf("%s %s comment %s", r.Match, r.Verdict, names.comment(r.ID)))
+		}
+		filter = append(base, filter...)
+	}
+	var bans []string
+	for _, ban := range db.Bans {
+		if ban.ExpiresUnix > 0 {
+			continue
+		}
+		family := "ip"
+		if ban.ipv6() {
+			family = "ip6"
+		}
+		bans = append(bans, fmt.Sprintf("%s saddr %s drop comment %s", family, ban.Source, names.comment(ban.ID)))
+	}
+	filter = append(bans, filter...)
+
+	b.WriteString("\ntable inet " + names.Filter + " {\n\tchain input {\n\t\ttype filter hook input priority 0; policy " + policy + ";\n")
+	for _, ln := range filter {
+		b.WriteString("\t\t" + ln + "\n")
+	}
+	b.WriteString("\t}\n}\n")
+	b.WriteString("\ntable ip " + names.NAT + " {\n\tchain prerouting {\n\t\ttype nat hook prerouting priority " + strconv.Itoa(natPriority) + ";\n")
+	for _, ln := range nat {
+		b.WriteString("\t\t" + ln + "\n")
+	}
+	b.WriteString("\t}\n\tchain postrouting {\n\t\ttype nat hook postrouting priority 100;\n")
+	for _, ln := range snat {
+		b.WriteString("\t\t" + ln + "\n")
+	}
+	b.WriteString("\t}\n}\n")
+	return b.String()
+}
+
+func nftPersistUnitContents(nftPath, scriptPath string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Atlas persisted nftables ruleset
+DefaultDependencies=no
+Before=network-pre.target
+Wants=network-pre.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=%s -f %s
+
+[Install]
+WantedBy=sysinit.target
+`, nftPath, scriptPath)
+}
+
+func (s *FirewallService) writePersisted(ctx context.Context, script string) error {
+	dir, err := os.MkdirTemp("", "atlas-nft-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	scriptTmp := filepath.Join(dir, filepath.Base(s.names.PersistPath))
+	if err := os.WriteFile(scriptTmp, []byte(script), 0o644); err != nil {
+		return err
+	}
+	if _, err := s.rootExec(ctx, s.nftPath, "-c", "-f", scriptTmp); err != nil {
+		return fmt.Errorf("nft check: %w", err)
+	}
+	unitTmp := filepath.Join(dir, s.names.UnitName)
+	if err := os.WriteFile(unitTmp, []byte(nftPersistUnitContents(s.nftPath, s.names.PersistPath)), 0o644); err != nil {
+		return err
+	}
+
+	if _, err := s.rootExec(ctx, "install", "-D", "-m", "0644", scriptTmp, s.names.PersistPath); err != nil {
+		return err
+	}
+	if _, err := s.rootExec(ctx, "install", "-m", "0644", unitTmp, s.names.UnitPath); err != nil {
+		return err
+	}
+	if s.systemctlPath == "" {
+		return errors.New("systemctl not found")
+	}
+	if _, err := s.systemctl(ctx, "daemon-reload"); err != nil {
+		return err
+	}
+	_, err = s.systemctl(ctx, "enable", s.names.UnitName)
+	return err
+}
+
+func (s *FirewallService) removePersisted(ctx context.Context) error {
+	if s.systemctlPath != "" && fileExists(s.names.UnitPath) {
+		if _, err := s.systemctl(ctx, "disable", s.names.UnitName); err != nil {
+			return err
+		}
+	}
+	if _, err := s.rootExec(ctx, "rm", "-f", s.names.UnitPath, s.names.PersistPath); err != nil {
+		return err
+	}
+	if s.systemctlPath != "" {
+		_, _ = s.systemctl(ctx, "daemon-reload")
+	}
+	return nil
+}
+
+// rootExec runs a command as root, using sudo when not already root.
+func (s *FirewallService) rootExec(ctx context.Context, bin string, args ...string) (string, error) {
+	if os.Geteuid() != 0 && s.sudoPath != "" {
+		if pass, ok, err := s.sudoPassFor(ctx); err != nil {
+			return "", err
+		} else if ok && pass != "" {
+			return s.runSudoPassword(ctx, pass, bin, args...)
+		}
+		all := append([]string{"-n", "--", bin}, args...)
+		return s.run(ctx, s.sudoPath, all...)
+	}
+	return s.run(ctx, bin, args...)
+}
+
+func fileExists(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && !st.IsDir()
+}
@@ -0,0 +1,115 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxRulePorts caps the elements of a port list ("80,443,8000-8100").
+	maxRulePorts = 64
+	// ufwMaxPortWeight is ufw's multiport limit: 15 ports, a range counting as two.
+	ufwMaxPortWeight = 15
+)
+
+// PortRange is one element of a multi-port rule; From == To for a single port.
+type PortRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+func (p PortRange) String() string {
+	if p.To != 0 && p.To != p.From {
+		return fmt.Sprintf("%d-%d", p.From, p.To)
+	}
+	return fmt.Sprintf("%d", p.From)
+}
+
+// portRanges returns every port range the rule matches.
+func (r FWRule) portRanges() []PortRange {
+	if len(r.PortRanges) > 0 {
+		return r.PortRanges
+	}
+	to := r.PortTo
+	if to == 0 {
+		to = r.PortFrom
+	}
+	return []PortRange{{From: r.PortFrom, To: to}}
+}
+
+// parsePortList parses "80", "1000-2000" or a comma-separated list of both.
+func parsePortList(ports string) ([]PortRange, error) {
+	var out []PortRange
+	seen := map[PortRange]bool{}
+	for _, part := range strings.Split(ports, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, errors.New("empty element in ports list")
+		}
+		from, to, ok := parsePortRange(part)
+		if !ok {
+			return nil, fmt.Errorf("bad port %q", part)
+		}
+		p := PortRange{From: from, To: to}
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	if len(out) > maxRulePorts {
+		return nil, fmt.Errorf("at most %d ports per rule", maxRulePorts)
+	}
+	return out, nil
+}
+
+// nftDport renders the dport match: a plain port/range, or an anonymous set for lists.
+func nftDport(r FWRule) string {
+	ranges := r.portRanges()
+	if len(ranges) == 1 {
+		return ranges[0].String()
+	}
+	parts := make([]string, len(ranges))
+	for i, p := range ranges {
+		parts[i] = p.String()
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
+
+// ufwPortGroups splits the rule's ports into ufw multiport specs ("80,443,8000:8100"),
+// starting a new group whenever ufw's per-rule limit would be exceeded.
+func ufwPortGroups(r FWRule) []string {
+	var groups []string
+	var cur []string
+	weight := 0
+	for _, p := range r.portRanges() {
+		w := 1
+		spec := fmt.Sprintf("%d", p.From)
+		if p.To != p.From {
+			w = 2
+			spec = fmt.Sprintf("%d:%d", p.From, p.To)
+		}
+		if weight+w > ufwMaxPortWeight {
+			groups = append(groups, strings.Join(cur, ","))
+			cur, weight = nil, 0
+		}
+		cur = append(cur, spec)
+		weight += w
+	}
+	if len(cur) > 0 {
+		groups = append(groups, strings.Join(cur, ","))
+	}
+	return groups
+}
+
+func portRangesOverlap(a, b []PortRange) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.From <= y.To && y.From <= x.To {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultProfile = "default"
+
+var profileNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+type fwProfile struct {
+	Name   string `json:"name"`
+	Rules  int    `json:"rules"`
+	Active bool   `json:"active"`
+}
+
+type profilesResponse struct {
+	Active   string      `json:"active"`
+	Profiles []fwProfile `json:"profiles"`
+}
+
+type createProfileRequest struct {
+	Name     string `json:"name"`
+	CopyFrom string `json:"copy_from,omitempty"`
+}
+
+type activateProfileRequest struct {
+	Name string `json:"name"`
+}
+
+// migrateProfiles moves a pre-profiles DB (single rule list) into the "default" profile.
+func migrateProfiles(db *fwDB) {
+	if strings.TrimSpace(db.ActiveProfile) == "" {
+		db.ActiveProfile = defaultProfile
+	}
+	if db.Profiles == nil {
+		db.Profiles = make(map[string][]FWRule)
+	}
+	if _, ok := db.Profiles[db.ActiveProfile]; !ok {
+		db.Profiles[db.ActiveProfile] = cloneRules(db.Rules)
+	}
+}
+
+func (s *FirewallService) syncActiveProfileLocked() {
+	if s.db.ActiveProfile == "" {
+		s.db.ActiveProfile = defaultProfile
+	}
+	profiles := make(map[string][]FWRule, len(s.db.Profiles)+1)
+	for name, rules := range s.db.Profiles {
+		profiles[name] = rules
+	}
+	profiles[s.db.ActiveProfile] = cloneRules(s.db.Rules)
+	s.db.Profiles = profiles
+}
+
+func cloneRules(in []FWRule) []FWRule {
+	if in == nil {
+		return []FWRule{}
+	}
+	return append([]FWRule{}, in...)
+}
+
+func (s *FirewallService) HandleProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		resp := s.profilesLocked()
+		s.mu.Unlock()
+		writeJSON(w, resp)
+		return
+	case http.MethodPost:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.cfg.Enabled {
+		http.Error(w, "firewall is disabled by config", http.StatusForbidden)
+		return
+	}
+	var req createProfileRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if !profileNameRe.MatchString(name) {
+		http.Error(w, "bad profile name", http.StatusBadRequest)
+		return
+	}
+	from := strings.TrimSpace(req.CopyFrom)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncActiveProfileLocked()
+	if _, ok := s.db.Profiles[name]; ok {
+		http.Error(w, "profile already exists", http.StatusConflict)
+		return
+	}
+	rules := []FWRule{}
+	if from != "" {
+		src, ok := s.db.Profiles[from]
+		if !ok {
+			http.Error(w, "copy_from profile not found", http.StatusNotFound)
+			return
+		}
+		rules = cloneRules(src)
+	}
+	prev := s.db
+	profiles := make(map[string][]FWRule, len(s.db.Profiles)+1)
+	for k, v := range s.db.Profiles {
+		profiles[k] = v
+	}
+	profiles[name] = rules
+	s.db.Profiles = profiles
+	s.touchLocked(changedBy(r.Context()))
+	if err := s.saveLocked(); err != nil {
+		s.db = prev
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, s.profilesLocked())
+}
+
+func (s *FirewallService) HandleProfileActivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.cfg.Enabled {
+		http.Error(w, "firewall is disabled by config", http.StatusForbidden)
+		return
+	}
+	var req activateProfileRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	backend, berr := s.backend()
+	if berr != nil {
+		http.Error(w, berr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.activateProfileLocked(ctx, r, backend, name); err != nil {
+		if errors.Is(err, errProfileNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, errLockout) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, s.profilesLocked())
+}
+
+var errProfileNotFound = errors.New("profile not found")
+
+// activateProfileLocked replaces the live rules with the named profile and applies them,
+// unless that would lock out the connection of r. On failure the previous rules are
+// restored both in the DB and on the system.
+func (s *FirewallService) activateProfileLocked(ctx context.Context, r *http.Request, backend, name string) error {
+	s.syncActiveProfileLocked()
+	rules, ok := s.db.Profiles[name]
+	if !ok {
+		return errProfileNotFound
+	}
+	if name == s.db.ActiveProfile {
+		return nil
+	}
+
+	prev := s.db
+	s.db.Rules = cloneRules(rules)
+	s.db.ActiveProfile = name
+	if err := s.checkLockoutLocked(r, backend); err != nil {
+		s.db = prev
+		return err
+	}
+	s.touchLocked(changedBy(ctx))
+	if err := s.saveLocked(); err != nil {
+		s.db = prev
+		return err
+	}
+
+	var err error
+	if backend == "nft" {
+		err = s.applyLocked(ctx)
+		if err != nil {
+			s.db = prev
+			_ = s.saveLocked()
+			_ = s.applyLocked(ctx)
+			return err
+		}
+		return nil
+	}
+	if err = s.replaceSystemRules(ctx, backend, prev.Rules, s.db.Rules); err != nil {
+		next := s.db.Rules
+		s.db = prev
+		_ = s.saveLocked()
+		_ = s.replaceSystemRules(ctx, backend, next, prev.Rules)
+		return err
+	}
+	return nil
+}
+
+// replaceSystemRules removes the enabled rules in from and adds the enabled rules in to
+// (ufw/firewalld backends, which are rule-by-rule).
+func (s *FirewallService) replaceSystemRules(ctx context.Context, backend string, from, to []FWRule) error {
+	for _, r := range from {
+		if !r.Enabled {
+			continue
+		}
+		if err := s.applyRuleSystem(ctx, backend, r, false); err != nil {
+			return err
+		}
+	}
+	for _, r := range to {
+		if !r.Enabled {
+			continue
+		}
+		if err := s.applyRuleSystem(ctx, backend, r, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FirewallService) profilesLocked() profilesResponse {
+	active := s.db.ActiveProfile
+	if active == "" {
+		active = defaultProfile
+	}
+	resp := profilesResponse{Active: active}
+	seen := false
+	for name, rules := range s.db.Profiles {
+		n := len(rules)
+		if name == active {
+			n = len(s.db.Rules)
+			seen = true
+		}
+		resp.Profiles = append(resp.Profiles, fwProfile{Name: name, Rules: n, Active: name == active})
+	}
+	if !seen {
+		resp.Profiles = append(resp.Profiles, fwProfile{Name: active, Rules: len(s.db.Rules), Active: true})
+	}
+	sort.Slice(resp.Profiles, func(i, j int) bool { return resp.Profiles[i].Name < resp.Profiles[j].Name })
+	return resp
+}
@@ -0,0 +1,159 @@
+package system
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type simulateRequest struct {
+	Proto     string `json:"proto"`
+	Port      int    `json:"port"`
+	Source    string `json:"source"`
+	Interface string `json:"interface"`
+}
+
+type simulateResponse struct {
+	Verdict string `json:"verdict"` // accept|drop|forward
+	// RuleID is the rule that decided the verdict ("" when the input policy did).
+	RuleID string  `json:"rule_id,omitempty"`
+	Rule   *FWRule `json:"rule,omitempty"`
+	Reason string  `json:"reason"`
+	// RedirectedTo is the port a redirect rule rewrote the destination to.
+	RedirectedTo int    `json:"redirected_to,omitempty"`
+	RedirectID   string `json:"redirect_id,omitempty"`
+	// ForwardedTo is the host:port a forwarding redirect sends the packet to; the input
+	// rules then never see it.
+	ForwardedTo string `json:"forwarded_to,omitempty"`
+	Policy      string `json:"policy"`
+	// Skipped lists enabled service rules, whose ports are only known to the backend.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// matchesPacket reports whether the enabled port rule r matches a new connection to
+// port over proto. Interface matching is left to the caller.
+func (r FWRule) matchesPacket(proto string, port int) bool {
+	if !r.Enabled || r.Service != "" || !protosOverlap(r.Proto, proto) {
+		return false
+	}
+	for _, p := range r.portRanges() {
+		if p.From <= port && port <= p.To {
+			return true
+		}
+	}
+	return false
+}
+
+// simulateLocked evaluates Atlas's own rule model for a new incoming connection, in the
+// order the nft backend applies it: bans, base rules, redirects (prerouting), then the
+// first matching allow/deny rule, then the input policy. Only bans match on the source
+// address.
+func (s *FirewallService) simulateLocked(req simulateRequest) simulateResponse {
+	resp := simulateResponse{Policy: s.inputPolicyLocked()}
+	if !s.db.Enabled {
+		resp.Verdict = "accept"
+		resp.Reason = "atlas firewall rules are disabled"
+		return resp
+	}
+	if src := net.ParseIP(req.Source); src != nil {
+		for _, b := range s.db.Bans {
+			if b.matches(src) {
+				resp.Verdict = "drop"
+				resp.RuleID = b.ID
+				resp.Reason = fmt.Sprintf("source %s is banned (%s)", req.Source, b.Source)
+				return resp
+			}
+		}
+	}
+	if s.db.BaseRules && req.Interface == "lo" {
+		resp.Verdict = "accept"
+		resp.RuleID = "system:lo"
+		resp.Reason = "loopback traffic is accepted by a base rule"
+		return resp
+	}
+	onIface := func(r FWRule) bool { return r.Interface == "" || r.Interface == req.Interface }
+	for _, r := range s.db.Rules {
+		if r.Enabled && r.Service != "" {
+			resp.Skipped = append(resp.Skipped, r.ID)
+		}
+	}
+
+	port := req.Port
+	for _, r := range s.db.Rules {
+		if r.Type == "redirect" && onIface(r) && r.matchesPacket(req.Proto, port) {
+			resp.RedirectedTo = r.ToPort
+			resp.RedirectID = r.ID
+			if r.ToAddr != "" {
+				rule := r
+				resp.Rule = &rule
+				resp.RuleID = r.ID
+				resp.Verdict = "forward"
+				resp.ForwardedTo = fmt.Sprintf("%s:%d", r.ToAddr, r.ToPort)
+				resp.Reason = fmt.Sprintf("rule %s forwards %s port %d to %s", r.ID, req.Proto, port, resp.ForwardedTo)
+				return resp
+			}
+			port = r.ToPort
+			break
+		}
+	}
+	for _, r := range s.db.Rules {
+		if (r.Type != "allow" && r.Type != "deny") || !onIface(r) || !r.matchesPacket(req.Proto, port) {
+			continue
+		}
+		rule := r
+		resp.Rule = &rule
+		resp.RuleID = r.ID
+		if r.Type == "allow" {
+			resp.Verdict = "accept"
+		} else {
+			resp.Verdict = "drop"
+		}
+		resp.Reason = fmt.Sprintf("first matching rule: %s %s %s", r.Type, r.Proto, rulePorts(r))
+		return resp
+	}
+	if s.db.PolicyDrop {
+		resp.Verdict = "drop"
+	} else {
+		resp.Verdict = "accept"
+	}
+	resp.Reason = fmt.Sprintf("no rule matches %s port %d; input policy is %s", req.Proto, port, resp.Policy)
+	return resp
+}
+
+// HandleSimulate answers whether a new incoming connection would be accepted by the
+// stored rule set. It only evaluates Atlas's model; nothing is sent to the kernel.
+func (s *FirewallService) HandleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req simulateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	req.Proto = strings.ToLower(strings.TrimSpace(req.Proto))
+	if req.Proto == "" {
+		req.Proto = "tcp"
+	}
+	if req.Proto != "tcp" && req.Proto != "udp" {
+		http.Error(w, "bad proto", http.StatusBadRequest)
+		return
+	}
+	if req.Port <= 0 || req.Port > 65535 {
+		http.Error(w, "bad port", http.StatusBadRequest)
+		return
+	}
+	req.Source = strings.TrimSpace(req.Source)
+	if req.Source != "" && net.ParseIP(req.Source) == nil {
+		http.Error(w, "bad source address", http.StatusBadRequest)
+		return
+	}
+	req.Interface = strings.TrimSpace(req.Interface)
+
+	s.mu.Lock()
+	resp := s.simulateLocked(req)
+	s.mu.Unlock()
+	writeJSON(w, resp)
+}
@@ -0,0 +1,21 @@
+package system
+
+import "sort"
+
+// ruleSorts are the orders GET /api/firewall/rules?sort= accepts. Without one, rules
+// keep the order they are applied in, which is what decides between overlapping rules.
+var ruleSorts = map[string]func(a, b FWRule) bool{
+	// Rules saved before creation times were recorded have none and come first.
+	"created": func(a, b FWRule) bool { return a.Created.Before(b.Created) },
+	"port": func(a, b FWRule) bool {
+		if a.PortFrom != b.PortFrom {
+			return a.PortFrom < b.PortFrom
+		}
+		return a.Proto < b.Proto
+	},
+	"type": func(a, b FWRule) bool { return a.Type < b.Type },
+}
+
+func sortRules(rules []FWRule, less func(a, b FWRule) bool) {
+	sort.SliceStable(rules, func(i, j int) bool { return less(rules[i], rules[j]) })
+}
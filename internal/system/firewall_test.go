@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/MrTeeett/atlas/internal/auth"
 )
 
 func TestFirewallDisabledByConfig(t *testing.T) {
@@ -37,7 +42,7 @@ func TestFirewallDisabledByConfig(t *testing.T) {
 	if rr.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d", rr.Code)
 	}
-	var st fwStatus
+	var st FirewallStatus
 	if err := json.Unmarshal(rr.Body.Bytes(), &st); err != nil {
 		t.Fatalf("json: %v", err)
 	}
@@ -383,3 +388,1626 @@ func writeScript(t *testing.T, dir, name, content string) string {
 	}
 	return path
 }
+
+func TestFirewallLoadMigratesDefaultProfile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "fw.db")
+	old := `{"version":1,"enabled":true,"rules":[{"id":"a","enabled":true,"type":"allow","proto":"tcp","port_from":22,"port_to":22}]}`
+	if err := os.WriteFile(dbPath, []byte(old), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: dbPath})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db.ActiveProfile != "default" {
+		t.Fatalf("active=%q", s.db.ActiveProfile)
+	}
+	if got := s.db.Profiles["default"]; len(got) != 1 || got[0].ID != "a" {
+		t.Fatalf("default profile=%#v", got)
+	}
+}
+
+func TestFirewallProfilesActivateWithFakeNft(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "fw.db")
+	logPath := filepath.Join(dir, "nft.log")
+	nftPath := writeScript(t, dir, "nft.sh", `#!/bin/sh
+echo "$@" >> "`+logPath+`"
+if [ "$1" = "list" ]; then exit 1; fi
+case "$*" in
+  *"dport 666 "*) exit 1;;
+esac
+exit 0
+`)
+
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: dbPath})
+	s.nftPath = nftPath
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.db.Rules = []FWRule{{ID: "a", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 22, PortTo: 22}}
+	s.mu.Unlock()
+
+	post := func(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "http://example/api/firewall/profiles", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+
+	if rr := post(s.HandleProfiles, `{"name":"maint","copy_from":"default"}`); rr.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := post(s.HandleProfiles, `{"name":"maint"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate status=%d", rr.Code)
+	}
+	if rr := post(s.HandleProfiles, `{"name":"bad name"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad name status=%d", rr.Code)
+	}
+
+	// Make "maint" contain a rule the fake nft rejects, so activation rolls back.
+	s.mu.Lock()
+	s.db.Profiles["maint"] = append(s.db.Profiles["maint"], FWRule{ID: "x", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 666, PortTo: 666})
+	s.mu.Unlock()
+	if rr := post(s.HandleProfileActivate, `{"name":"maint"}`); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("activate failing status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	s.mu.Lock()
+	if s.db.ActiveProfile != "default" || len(s.db.Rules) != 1 {
+		s.mu.Unlock()
+		t.Fatalf("expected rollback, got active=%q rules=%#v", s.db.ActiveProfile, s.db.Rules)
+	}
+	s.db.Profiles["maint"] = []FWRule{{ID: "m", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 8080, PortTo: 8080}}
+	s.mu.Unlock()
+
+	if rr := post(s.HandleProfileActivate, `{"name":"missing"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing status=%d", rr.Code)
+	}
+	rr := post(s.HandleProfileActivate, `{"name":"maint"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("activate status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	var resp profilesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if resp.Active != "maint" || len(resp.Profiles) != 2 {
+		t.Fatalf("resp=%#v", resp)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.db.Rules) != 1 || s.db.Rules[0].ID != "m" {
+		t.Fatalf("live rules=%#v", s.db.Rules)
+	}
+	if got := s.db.Profiles["default"]; len(got) != 1 || got[0].ID != "a" {
+		t.Fatalf("default profile lost: %#v", got)
+	}
+}
+
+func TestRenderNftScript(t *testing.T) {
+	t.Parallel()
+
+	db := fwDB{Enabled: true, Rules: []FWRule{
+		{ID: "a", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 22, PortTo: 22},
+		{ID: "b", Enabled: true, Type: "deny", Proto: "udp", PortFrom: 1000, PortTo: 1002},
+		{ID: "c", Enabled: false, Type: "allow", Proto: "tcp", PortFrom: 23, PortTo: 23},
+		{ID: "d", Enabled: true, Type: "redirect", Proto: "tcp", PortFrom: 80, PortTo: 80, ToPort: 8080},
+		{ID: "e", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 8443, PortTo: 8443, ExpiresUnix: 1},
+	}, Bans: []FWBan{
+		{ID: "f", Source: "203.0.113.7"},
+		{ID: "g", Source: "203.0.113.8", ExpiresUnix: 1},
+	}}
+	out := renderNftScript(db, defaultNATPriority, defaultNftNames)
+	for _, want := range []string{
+		"delete table inet atlas",
+		`tcp dport 22 accept comment "atlas:a"`,
+		`udp dport 1000-1002 drop comment "atlas:b"`,
+		`tcp dport 80 redirect to :8080 comment "atlas:d"`,
+		`ip saddr 203.0.113.7 drop comment "atlas:f"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "atlas:c") {
+		t.Fatalf("disabled rule rendered:\n%s", out)
+	}
+	if strings.Contains(out, "atlas:e") || strings.Contains(out, "atlas:g") {
+		t.Fatalf("temporary rule or ban persisted:\n%s", out)
+	}
+	if !strings.Contains(out, "policy accept;") || strings.Contains(out, "iif lo") {
+		t.Fatalf("base rules rendered without being enabled:\n%s", out)
+	}
+
+	db.BaseRules, db.PolicyDrop = true, true
+	out = renderNftScript(db, defaultNATPriority, defaultNftNames)
+	if !strings.Contains(out, "policy drop;") || !strings.Contains(out, `iif lo accept comment "atlas:system:lo"`) ||
+		strings.Index(out, "ct state established,related accept") > strings.Index(out, "atlas:a") {
+		t.Fatalf("expected base rules before user rules with policy drop:\n%s", out)
+	}
+
+	db.Enabled = false
+	out = renderNftScript(db, defaultNATPriority, defaultNftNames)
+	if strings.Contains(out, "chain input") {
+		t.Fatalf("disabled firewall should only delete tables:\n%s", out)
+	}
+}
+
+func TestFirewallInstanceNames(t *testing.T) {
+	t.Parallel()
+
+	names := newNftNames("edge")
+	if names.Filter != "edge" || names.NAT != "edge_nat" || names.UnitName != "edge-nft.service" || names.PersistPath != "/etc/nftables.d/edge.nft" {
+		t.Fatalf("unexpected names: %+v", names)
+	}
+	out := renderNftScript(fwDB{Enabled: true, Rules: []FWRule{
+		{ID: "a", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 22, PortTo: 22},
+	}}, defaultNATPriority, names)
+	for _, want := range []string{"delete table inet edge\n", "delete table ip edge_nat\n", "table inet edge {", `comment "edge:a"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "atlas") {
+		t.Fatalf("default names leaked into:\n%s", out)
+	}
+
+	// Rules of another instance sharing the host are not ours.
+	tbl := parseNftText(`table inet edge { # handle 3
+	chain input { # handle 1
+		type filter hook input priority filter; policy accept;
+		tcp dport 22 accept comment "edge:a" # handle 2
+		tcp dport 80 accept comment "atlas:b" # handle 4
+	}
+}
+`, "inet", "edge", names)
+	if len(tbl.Rules) != 2 || tbl.Rules[0].ID != "a" || tbl.Rules[1].ID != "" {
+		t.Fatalf("unexpected rules: %+v", tbl.Rules)
+	}
+}
+
+func TestParseNftJSON(t *testing.T) {
+	t.Parallel()
+
+	doc := `{"nftables":[{"metainfo":{"version":"1.0.6","json_schema_version":1}},
+{"table":{"family":"inet","name":"atlas","handle":3}},
+{"chain":{"family":"inet","table":"atlas","name":"input","handle":1,"type":"filter","hook":"input","prio":0,"policy":"accept"}},
+{"rule":{"family":"inet","table":"atlas","chain":"input","handle":4,"comment":"atlas:abc","expr":[{"match":{"op":"==","left":{"payload":{"protocol":"tcp","field":"dport"}},"right":22}},{"counter":{"packets":7,"bytes":420}},{"accept":null}]}},
+{"rule":{"family":"inet","table":"atlas","chain":"input","handle":5,"comment":"atlas:def","expr":[{"match":{"op":"==","left":{"payload":{"protocol":"udp","field":"dport"}},"right":{"range":[1000,2000]}}},{"drop":null}]}}]}`
+	tbl, err := parseNftJSON([]byte(doc), "inet", "atlas", defaultNftNames)
+	if err != nil {
+		t.Fatalf("parseNftJSON: %v", err)
+	}
+	if !tbl.Found || len(tbl.Rules) != 2 {
+		t.Fatalf("unexpected table: %#v", tbl)
+	}
+	r := tbl.Rules[0]
+	if r.ID != "abc" || r.Proto != "tcp" || r.PortFrom != 22 || r.PortTo != 22 || r.Verdict != "accept" || r.Packets != 7 || r.Bytes != 420 || r.Handle != 4 {
+		t.Fatalf("unexpected rule: %#v", r)
+	}
+	r = tbl.Rules[1]
+	if r.ID != "def" || r.Proto != "udp" || r.PortFrom != 1000 || r.PortTo != 2000 || r.Verdict != "drop" {
+		t.Fatalf("unexpected rule: %#v", r)
+	}
+
+	if _, err := parseNftJSON([]byte("table inet atlas {"), "inet", "atlas", defaultNftNames); err == nil {
+		t.Fatalf("expected error for text input")
+	}
+}
+
+func TestParseNftText(t *testing.T) {
+	t.Parallel()
+
+	out := `table ip atlas_nat { # handle 7
+	chain prerouting { # handle 1
+		type nat hook prerouting priority dstnat; policy accept;
+		tcp dport 80 counter packets 3 bytes 180 redirect to :8080 comment "atlas:r1" # handle 2
+	}
+}
+`
+	tbl := parseNftText(out, "ip", "atlas_nat", defaultNftNames)
+	if !tbl.Found || len(tbl.Rules) != 1 {
+		t.Fatalf("unexpected table: %#v", tbl)
+	}
+	r := tbl.Rules[0]
+	if r.Chain != "prerouting" || r.ID != "r1" || r.Proto != "tcp" || r.PortFrom != 80 || r.Verdict != "redirect" || r.ToPort != 8080 || r.Packets != 3 || r.Handle != 2 {
+		t.Fatalf("unexpected rule: %#v", r)
+	}
+}
+
+func TestNftListTableJSONFallback(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	text := `table ip atlas_nat { # handle 7
+	chain prerouting { # handle 1
+		tcp dport 80 redirect to :8080 comment "atlas:r1" # handle 2
+	}
+}`
+	newService := func(jsonBranch string) *FirewallService {
+		nftPath := writeScript(t, t.TempDir(), "nft.sh", "#!/bin/sh\nif [ \"$1\" = -j ]; then\n"+jsonBranch+"\nfi\ncat <<'EOF'\n"+text+"\nEOF\n")
+		s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+		s.nftPath = nftPath
+		s.sudoPath = ""
+		return s
+	}
+
+	// Unparsable JSON falls back to text for this call but keeps trying JSON.
+	s := newService(`echo '{"nftables":'; exit 0`)
+	for i := 0; i < 2; i++ {
+		tbl, err := s.nftListTable(context.Background(), "ip", "atlas_nat")
+		if err != nil || len(tbl.Rules) != 1 || tbl.Rules[0].ID != "r1" {
+			t.Fatalf("parse-error fallback: tbl=%#v err=%v", tbl, err)
+		}
+	}
+	if s.nftNoJSON.Load() {
+		t.Fatalf("a parse error must not disable JSON for later calls")
+	}
+
+	// An nft without JSON support is remembered.
+	s = newService(`echo "Error: unrecognized option '-j'" >&2; exit 1`)
+	if tbl, err := s.nftListTable(context.Background(), "ip", "atlas_nat"); err != nil || len(tbl.Rules) != 1 {
+		t.Fatalf("unsupported fallback: tbl=%#v err=%v", tbl, err)
+	}
+	if !s.nftNoJSON.Load() {
+		t.Fatalf("unsupported -j should disable JSON")
+	}
+}
+
+func TestParseConnections(t *testing.T) {
+	t.Parallel()
+
+	out := `tcp   ESTAB  0      0      10.0.0.5:22        10.0.0.9:51514    users:(("sshd",pid=812,fd=4))
+tcp   ESTAB  0      0      10.0.0.5:22        10.0.0.9:51514    users:(("sshd",pid=812,fd=4))
+tcp   LISTEN 0      128    0.0.0.0:80         0.0.0.0:*         users:(("nginx",pid=90,fd=6))
+udp   UNCONN 0      0      [fe80::1]%eth0:546 [::]:*
+`
+	items := parseConnections(out)
+	if len(items) != 3 {
+		t.Fatalf("expected 3 deduplicated items, got %#v", items)
+	}
+	c := items[0]
+	if c.Proto != "tcp" || c.State != "ESTAB" || c.LocalPort != 22 || c.Peer != "10.0.0.9:51514" || c.PeerPort != 51514 || c.Process != "sshd" || c.PID != 812 {
+		t.Fatalf("unexpected conn: %#v", c)
+	}
+	if items[2].Interface != "eth0" || items[2].LocalPort != 546 {
+		t.Fatalf("unexpected udp conn: %#v", items[2])
+	}
+}
+
+func TestFirewallRejectsDuplicatesAndWarnsOnOverlap(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	nftPath := writeScript(t, dir, "nft.sh", "#!/bin/sh\nexit 0\n")
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = nftPath
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/firewall/rules", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		s.HandleRules(rr, req)
+		return rr
+	}
+	if rr := post(`{"enabled":true,"type":"allow","proto":"tcp","ports":"22"}`); rr.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"enabled":false,"type":"allow","proto":"tcp","ports":"22","comment":"again"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"enabled":true,"type":"deny","proto":"tcp","ports":"20-30"}`); rr.Code != http.StatusOK {
+		t.Fatalf("overlap should be allowed, status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"enabled":true,"type":"deny","proto":"udp","ports":"22"}`); rr.Code != http.StatusOK {
+		t.Fatalf("create udp status=%d", rr.Code)
+	}
+
+	rr := httptest.NewRecorder()
+	s.HandleRules(rr, httptest.NewRequest(http.MethodGet, "/api/firewall/rules", nil))
+	var resp FirewallRules
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v body=%q", err, rr.Body.String())
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "deny tcp 20-30 overlaps allow tcp 22") {
+		t.Fatalf("unexpected warnings: %v", resp.Warnings)
+	}
+
+	// Editing a rule into a copy of another one is rejected too.
+	var udpID string
+	for _, r := range resp.Rules {
+		if r.Proto == "udp" {
+			udpID = r.ID
+		}
+	}
+	put := httptest.NewRequest(http.MethodPut, "/api/firewall/rules/"+udpID, strings.NewReader(`{"type":"deny","proto":"tcp","ports":"20-30"}`))
+	rr = httptest.NewRecorder()
+	s.HandleRuleID(rr, put)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("update duplicate status=%d body=%q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestFirewallBaseRulesWithFakeNft(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "nft.log")
+	nftPath := writeScript(t, dir, "nft.sh", `#!/bin/sh
+echo "$@" >> "`+logPath+`"
+exit 0
+`)
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = nftPath
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.mu.Unlock()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.HandleBaseRules(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/base", strings.NewReader(body)))
+		return rr
+	}
+	if rr := post(`{"base_rules":false,"policy_drop":true}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("policy_drop without base rules: status=%d", rr.Code)
+	}
+	rr := post(`{"base_rules":true,"policy_drop":true}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	var resp baseRulesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Policy != "drop" || len(resp.SystemRules) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	log := string(b)
+	for _, want := range []string{"policy drop", "add rule inet atlas input iif lo accept", "ct state established,related accept"} {
+		if !strings.Contains(log, want) {
+			t.Fatalf("missing %q in nft calls:\n%s", want, log)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	s.HandleRules(rr, httptest.NewRequest(http.MethodGet, "/api/firewall/rules", nil))
+	var rules FirewallRules
+	if err := json.Unmarshal(rr.Body.Bytes(), &rules); err != nil {
+		t.Fatalf("decode rules: %v", err)
+	}
+	if len(rules.SystemRules) != 2 || rules.Policy != "drop" {
+		t.Fatalf("rules response should list system rules: %+v", rules)
+	}
+}
+
+func TestFirewallPolicyWithFakeNft(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "nft.log")
+	nftPath := writeScript(t, dir, "nft.sh", `#!/bin/sh
+echo "$@" >> "`+logPath+`"
+exit 0
+`)
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = nftPath
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.mu.Unlock()
+
+	call := func(method, body string) (*httptest.ResponseRecorder, policyResponse) {
+		rr := httptest.NewRecorder()
+		s.HandlePolicy(rr, httptest.NewRequest(method, "/api/firewall/policy", strings.NewReader(body)))
+		var resp policyResponse
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return rr, resp
+	}
+	if _, resp := call(http.MethodGet, ""); resp.Policy != "accept" || resp.BaseRules {
+		t.Fatalf("default policy: %+v", resp)
+	}
+	if rr, _ := call(http.MethodPut, `{"policy":"reject"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad policy: status=%d", rr.Code)
+	}
+
+	// Drop brings the base rules with it.
+	rr, resp := call(http.MethodPut, `{"policy":"drop"}`)
+	if rr.Code != http.StatusOK || resp.Policy != "drop" || !resp.BaseRules {
+		t.Fatalf("set drop: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if log := string(b); !strings.Contains(log, "policy drop") || !strings.Contains(log, "iif lo accept") {
+		t.Fatalf("expected drop policy and base rules in nft calls:\n%s", log)
+	}
+
+	rr, resp = call(http.MethodPut, `{"policy":"accept"}`)
+	if rr.Code != http.StatusOK || resp.Policy != "accept" || !resp.BaseRules {
+		t.Fatalf("set accept: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	s.mu.Lock()
+	drop := s.db.PolicyDrop
+	s.mu.Unlock()
+	if drop {
+		t.Fatal("policy not stored in the DB")
+	}
+}
+
+func TestFirewallStatusCached(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "nft.log")
+	nftPath := writeScript(t, dir, "nft.sh", `#!/bin/sh
+echo "$@" >> "`+logPath+`"
+exit 1
+`)
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = nftPath
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+
+	calls := func() int {
+		b, _ := os.ReadFile(logPath)
+		return bytes.Count(b, []byte("\n"))
+	}
+	status := func() {
+		rr := httptest.NewRecorder()
+		s.HandleStatus(rr, httptest.NewRequest(http.MethodGet, "/api/firewall/status", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d", rr.Code)
+		}
+	}
+
+	status()
+	first := calls()
+	if first == 0 {
+		t.Fatalf("expected nft to be probed")
+	}
+	status()
+	status()
+	if got := calls(); got != first {
+		t.Fatalf("cached polls should not spawn nft: %d -> %d calls", first, got)
+	}
+
+	s.mu.Lock()
+	_ = s.saveLocked()
+	s.mu.Unlock()
+	status()
+	if got := calls(); got == first {
+		t.Fatalf("a mutation should invalidate the cached status")
+	}
+}
+
+func TestFirewallTemporaryRulesExpire(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	nftPath := writeScript(t, dir, "nft.sh", "#!/bin/sh\nexit 0\n")
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = nftPath
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.mu.Unlock()
+
+	create := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.HandleRules(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/rules", strings.NewReader(body)))
+		return rr
+	}
+	if rr := create(`{"enabled":true,"type":"allow","proto":"tcp","ports":"8080","ttl_seconds":-5,"position":-1}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("negative ttl: status=%d", rr.Code)
+	}
+	rr := create(`{"enabled":true,"type":"allow","proto":"tcp","ports":"8080","ttl_seconds":3600,"position":-1}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create temp: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	var temp FWRule
+	if err := json.Unmarshal(rr.Body.Bytes(), &temp); err != nil || temp.ExpiresUnix == 0 {
+		t.Fatalf("expected expiry, err=%v rule=%+v", err, temp)
+	}
+	if rr := create(`{"enabled":true,"type":"allow","proto":"tcp","ports":"22","position":-1}`); rr.Code != http.StatusOK {
+		t.Fatalf("create permanent: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	s.HandleRules(rr, httptest.NewRequest(http.MethodGet, "/api/firewall/rules", nil))
+	var resp FirewallRules
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if left := resp.ExpiresIn[temp.ID]; left <= 3500 || left > 3600 || len(resp.ExpiresIn) != 1 {
+		t.Fatalf("unexpected expires_in: %v", resp.ExpiresIn)
+	}
+
+	if err := s.reapExpired(time.Now()); err != nil {
+		t.Fatalf("reap (nothing due): %v", err)
+	}
+	if err := s.reapExpired(time.Unix(temp.ExpiresUnix, 0)); err != nil {
+		t.Fatalf("reap: %v", err)
+	}
+	s.mu.Lock()
+	rules := append([]FWRule{}, s.db.Rules...)
+	s.mu.Unlock()
+	if len(rules) != 1 || rules[0].PortFrom != 22 {
+		t.Fatalf("expected only the permanent rule, got %+v", rules)
+	}
+	s2 := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	if len(s2.db.Rules) != 1 {
+		t.Fatalf("expired rule still persisted: %+v", s2.db.Rules)
+	}
+}
+
+func TestFirewallReapFailureBacksOff(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = writeScript(t, dir, "nft-fail.sh", "#!/bin/sh\necho boom >&2\nexit 1\n")
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	now := time.Now()
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.db.Rules = []FWRule{{ID: "t", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 8080, PortTo: 8080, ExpiresUnix: now.Unix()}}
+	s.mu.Unlock()
+
+	warnings := func() []string {
+		rules, err := s.Rules(context.Background())
+		if err != nil {
+			t.Fatalf("rules: %v", err)
+		}
+		return rules.Warnings
+	}
+	failures := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.reapFailures
+	}
+
+	s.reapTick(now)
+	if failures() != 1 || len(warnings()) != 1 || !strings.Contains(warnings()[0], "expired rules could not be removed") {
+		t.Fatalf("failures=%d warnings=%q", failures(), warnings())
+	}
+	// Inside the backoff nothing is retried; afterwards each failure doubles it.
+	s.reapTick(now.Add(fwReapInterval - time.Second))
+	if failures() != 1 {
+		t.Fatalf("retried during backoff: failures=%d", failures())
+	}
+	s.reapTick(now.Add(fwReapInterval))
+	s.mu.Lock()
+	next := s.reapNext
+	s.mu.Unlock()
+	if failures() != 2 || !next.Equal(now.Add(3*fwReapInterval)) {
+		t.Fatalf("failures=%d next=%v", failures(), next.Sub(now))
+	}
+
+	s.nftPath = writeScript(t, dir, "nft-ok.sh", "#!/bin/sh\nexit 0\n")
+	s.reapTick(next)
+	if failures() != 0 || len(warnings()) != 0 {
+		t.Fatalf("failure not cleared: failures=%d warnings=%q", failures(), warnings())
+	}
+	s.mu.Lock()
+	left := len(s.db.Rules)
+	s.mu.Unlock()
+	if left != 0 {
+		t.Fatalf("expired rule kept: %d rules", left)
+	}
+}
+
+func TestFirewallRuleFollowsLinkedUnit(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state")
+	setState := func(st string) {
+		if err := os.WriteFile(stateFile, []byte(st+"\n"), 0o600); err != nil {
+			t.Fatalf("write state: %v", err)
+		}
+	}
+	setState("inactive")
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = writeScript(t, dir, "nft.sh", "#!/bin/sh\nexit 0\n")
+	s.systemctlPath = writeScript(t, dir, "systemctl.sh", "#!/bin/sh\ncat "+stateFile+"\n")
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.mu.Unlock()
+
+	rr := httptest.NewRecorder()
+	s.HandleRules(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/rules",
+		strings.NewReader(`{"enabled":true,"type":"allow","proto":"udp","ports":"27015","linked_unit":"game.service","position":-1}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	var rule FWRule
+	if err := json.Unmarshal(rr.Body.Bytes(), &rule); err != nil || rule.Enabled || rule.LinkedUnit != "game.service" {
+		t.Fatalf("expected a disabled linked rule, err=%v rule=%+v", err, rule)
+	}
+
+	rr = httptest.NewRecorder()
+	s.HandleRuleID(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/rules/"+rule.ID+"/toggle", strings.NewReader(`{"enabled":true}`)))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("manual toggle of a linked rule: status=%d", rr.Code)
+	}
+
+	setState("active")
+	if err := s.reconcileLinked(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	resp, err := s.Rules(context.Background())
+	if err != nil {
+		t.Fatalf("rules: %v", err)
+	}
+	if len(resp.Rules) != 1 || !resp.Rules[0].Enabled || resp.LinkedUnits["game.service"] != "active" {
+		t.Fatalf("expected the rule enabled with an active unit, got %+v %v", resp.Rules, resp.LinkedUnits)
+	}
+
+	// Transitional states leave the rule as it is.
+	setState("deactivating")
+	if err := s.reconcileLinked(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	s.mu.Lock()
+	enabled := s.db.Rules[0].Enabled
+	s.mu.Unlock()
+	if !enabled {
+		t.Fatalf("a transitional state should not disable the rule")
+	}
+	setState("failed")
+	if err := s.reconcileLinked(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	s.mu.Lock()
+	enabled = s.db.Rules[0].Enabled
+	s.mu.Unlock()
+	if enabled {
+		t.Fatalf("expected the rule disabled once the unit failed")
+	}
+}
+
+func TestFirewallPortLists(t *testing.T) {
+	t.Parallel()
+
+	var r FWRule
+	if err := parsePortsInto(&r, "80, 443,8000-8100,443"); err != nil {
+		t.Fatalf("parse list: %v", err)
+	}
+	want := []PortRange{{80, 80}, {443, 443}, {8000, 8100}}
+	if !reflect.DeepEqual(r.PortRanges, want) || r.PortFrom != 80 || r.PortTo != 80 {
+		t.Fatalf("parsed list wrong: %#v", r)
+	}
+	for _, bad := range []string{"80,", "80,,443", "80,abc", "80,0"} {
+		if err := parsePortsInto(&FWRule{}, bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+	if err := parsePortsInto(&r, "22"); err != nil || r.PortRanges != nil || r.PortFrom != 22 {
+		t.Fatalf("single port after list: err=%v rule=%#v", err, r)
+	}
+
+	rule := FWRule{Type: "allow", Proto: "tcp", PortFrom: 80, PortTo: 80, PortRanges: want}
+	if err := validateRule(rule); err != nil {
+		t.Fatalf("validate list: %v", err)
+	}
+	bad := rule
+	bad.PortRanges = []PortRange{{80, 80}, {70000, 70000}}
+	if err := validateRule(bad); err == nil {
+		t.Fatalf("expected out-of-range element to be rejected")
+	}
+	redirect := rule
+	redirect.Type, redirect.ToPort = "redirect", 8080
+	if err := validateRule(redirect); err == nil {
+		t.Fatalf("expected redirect with a port list to be rejected")
+	}
+
+	if got := nftDport(rule); got != "{ 80, 443, 8000-8100 }" {
+		t.Fatalf("nftDport=%q", got)
+	}
+	if got := nftDport(FWRule{PortFrom: 1000, PortTo: 2000}); got != "1000-2000" {
+		t.Fatalf("nftDport range=%q", got)
+	}
+	script := renderNftScript(fwDB{Enabled: true, Rules: []FWRule{{ID: "a", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 80, PortTo: 80, PortRanges: want}}}, defaultNATPriority, defaultNftNames)
+	if !strings.Contains(script, `tcp dport { 80, 443, 8000-8100 } accept comment "atlas:a"`) {
+		t.Fatalf("script missing set rule:\n%s", script)
+	}
+
+	targets, err := ufwTargets(rule)
+	if err != nil || !reflect.DeepEqual(targets, []string{"80,443,8000:8100/tcp"}) {
+		t.Fatalf("ufwTargets=%q err=%v", targets, err)
+	}
+	long := FWRule{Type: "allow", Proto: "udp"}
+	for p := 1; p <= 16; p++ {
+		long.PortRanges = append(long.PortRanges, PortRange{p, p})
+	}
+	long.PortFrom, long.PortTo = 1, 1
+	if targets, err := ufwTargets(long); err != nil || len(targets) != 2 || !strings.HasPrefix(targets[1], "16/") {
+		t.Fatalf("expected the list split over two ufw rules, got %q err=%v", targets, err)
+	}
+
+	imported, ok := ufwRuleToFWRule(UFWRule{To: "80,443,8000:8100/tcp", Action: "ALLOW"})
+	if !ok || ruleKey(imported) != ruleKey(rule) {
+		t.Fatalf("ufw list did not round-trip: ok=%v rule=%#v", ok, imported)
+	}
+
+	deny := FWRule{Enabled: true, Type: "deny", Proto: "tcp", PortFrom: 443, PortTo: 443}
+	allow := rule
+	allow.Enabled = true
+	if w := overlapWarnings([]FWRule{allow, deny}); len(w) != 1 || !strings.Contains(w[0], "80,443,8000-8100") {
+		t.Fatalf("overlap warnings=%q", w)
+	}
+}
+
+func TestFirewallApplyLockoutCheck(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	nftPath := writeScript(t, dir, "nft.sh", "#!/bin/sh\nexit 0\n")
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db"), LockoutCheck: true})
+	s.nftPath = nftPath
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+
+	apply := func(remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/firewall/apply", nil)
+		r.RemoteAddr = remote
+		r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 8443}))
+		rr := httptest.NewRecorder()
+		s.HandleApply(rr, r)
+		return rr
+	}
+	setRules := func(policyDrop bool, rules ...FWRule) {
+		s.mu.Lock()
+		s.db.Enabled = true
+		s.db.BaseRules = true
+		s.db.PolicyDrop = policyDrop
+		s.db.Rules = rules
+		s.mu.Unlock()
+	}
+
+	setRules(true, FWRule{ID: "ssh", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 22, PortTo: 22})
+	rr := apply("203.0.113.5:50000")
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "policy is drop") {
+		t.Fatalf("policy drop: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := apply("127.0.0.1:50000"); rr.Code != http.StatusNoContent {
+		t.Fatalf("loopback caller: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	setRules(false, FWRule{ID: "block", Enabled: true, Type: "deny", Proto: "tcp", PortFrom: 8000, PortTo: 9000})
+	rr = apply("203.0.113.5:50000")
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "rule block") {
+		t.Fatalf("deny rule: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	setRules(true,
+		FWRule{ID: "panel", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 443, PortTo: 443, PortRanges: []PortRange{{443, 443}, {8443, 8443}}},
+		FWRule{ID: "block", Enabled: true, Type: "deny", Proto: "tcp", PortFrom: 8000, PortTo: 9000},
+	)
+	if rr := apply("203.0.113.5:50000"); rr.Code != http.StatusNoContent {
+		t.Fatalf("allowed by earlier rule: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestFirewallRuleChangesRunLockoutCheck(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db"), LockoutCheck: true})
+	s.nftPath = writeScript(t, dir, "nft.sh", "#!/bin/sh\nexit 0\n")
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.mu.Unlock()
+
+	send := func(h http.HandlerFunc, method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.RemoteAddr = "203.0.113.5:50000"
+		r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 8443}))
+		rr := httptest.NewRecorder()
+		h(rr, r)
+		return rr
+	}
+	rr := send(s.HandleRules, http.MethodPost, "/api/firewall/rules", `{"enabled":true,"type":"deny","proto":"tcp","ports":"8443"}`)
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "lockout check") {
+		t.Fatalf("deny rule for the panel port: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if resp, err := s.Rules(context.Background()); err != nil || len(resp.Rules) != 0 {
+		t.Fatalf("refused rule was kept: err=%v rules=%+v", err, resp.Rules)
+	}
+
+	// Created disabled it's harmless; enabling it by toggle or by editing is refused too.
+	rr = send(s.HandleRules, http.MethodPost, "/api/firewall/rules", `{"enabled":false,"type":"deny","proto":"tcp","ports":"8443"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("disabled rule: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	var rule FWRule
+	if err := json.Unmarshal(rr.Body.Bytes(), &rule); err != nil {
+		t.Fatal(err)
+	}
+	if rr := send(s.HandleRuleID, http.MethodPost, "/api/firewall/rules/"+rule.ID+"/toggle", `{"enabled":true}`); rr.Code != http.StatusConflict {
+		t.Fatalf("toggle: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	s.mu.Lock()
+	enabled := s.db.Rules[0].Enabled
+	s.mu.Unlock()
+	if enabled {
+		t.Fatal("refused toggle was kept")
+	}
+	if rr := send(s.HandlePolicy, http.MethodPut, "/api/firewall/policy", `{"policy":"drop"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("policy drop: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := send(s.HandleBaseRules, http.MethodPost, "/api/firewall/base", `{"base_rules":true,"policy_drop":true}`); rr.Code != http.StatusConflict {
+		t.Fatalf("base rules with policy drop: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	s.mu.Lock()
+	policyDrop := s.db.PolicyDrop
+	s.mu.Unlock()
+	if policyDrop {
+		t.Fatal("refused policy change was kept")
+	}
+}
+
+func TestFirewallRuleInterface(t *testing.T) {
+	t.Parallel()
+	if _, err := os.Stat(filepath.Join(sysClassNet, "lo")); err != nil {
+		t.Skip("no /sys/class/net/lo")
+	}
+
+	s := &FirewallService{}
+	rule, err := s.ruleFromCreate(createRuleRequest{Type: "allow", Proto: "tcp", Ports: "80,443", Interface: "lo"})
+	if err != nil || rule.Interface != "lo" {
+		t.Fatalf("create: rule=%#v err=%v", rule, err)
+	}
+	if _, err := s.ruleFromCreate(createRuleRequest{Type: "allow", Proto: "tcp", Ports: "80", Interface: "atlas-nope0"}); err == nil {
+		t.Fatalf("expected a missing interface to be rejected")
+	}
+	if _, err := s.ruleFromUpdate(updateRuleRequest{Type: "allow", Proto: "tcp", Ports: "80", Interface: "../lo"}); err == nil {
+		t.Fatalf("expected a bad interface name to be rejected")
+	}
+
+	rule.ID, rule.Enabled = "a", true
+	script := renderNftScript(fwDB{Enabled: true, Rules: []FWRule{rule}}, defaultNATPriority, defaultNftNames)
+	if !strings.Contains(script, `iifname "lo" tcp dport { 80, 443 } accept comment "atlas:a"`) {
+		t.Fatalf("script missing interface match:\n%s", script)
+	}
+
+	args, err := ufwRuleArgs(rule)
+	want := [][]string{{"allow", "in", "on", "lo", "to", "any", "port", "80,443", "proto", "tcp"}}
+	if err != nil || !reflect.DeepEqual(args, want) {
+		t.Fatalf("ufwRuleArgs=%q err=%v", args, err)
+	}
+	imported, ok := ufwRuleToFWRule(UFWRule{To: "80,443/tcp on lo", Action: "ALLOW IN"})
+	if !ok || ruleKey(imported) != ruleKey(rule) {
+		t.Fatalf("ufw interface rule did not round-trip: ok=%v rule=%#v", ok, imported)
+	}
+
+	plain := rule
+	plain.Interface = ""
+	if ruleKey(plain) == ruleKey(rule) {
+		t.Fatalf("rules on different interfaces must not be duplicates")
+	}
+	other := FWRule{Enabled: true, Type: "deny", Proto: "tcp", PortFrom: 80, PortTo: 80, Interface: "eth9"}
+	if w := overlapWarnings([]FWRule{rule, other}); len(w) != 0 {
+		t.Fatalf("rules on different interfaces must not overlap: %q", w)
+	}
+}
+
+func TestFirewalldIfaceZoneMustBeExclusive(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	fwPath := writeScript(t, dir, "firewall-cmd.sh", `#!/bin/sh
+case "$*" in
+  *"--get-zone-of-interface=eth0"*) echo "public";;
+  *"--get-zone-of-interface=eth1"*) echo "dmz";;
+  *"--zone=public --list-interfaces"*) echo "eth0 eth2";;
+  *"--zone=dmz --list-interfaces"*) echo "eth1";;
+  *) ;;
+esac
+exit 0
+`)
+	s := NewFirewallService(FirewallConfig{Enabled: true})
+	s.fwCmdPath = fwPath
+	s.sudoPath = ""
+
+	ctx := context.Background()
+	if err := s.checkFirewalldIfaceZone(ctx, FWRule{Interface: "eth0"}); err == nil || !strings.Contains(err.Error(), "eth2") {
+		t.Fatalf("shared zone: err=%v", err)
+	}
+	if err := s.checkFirewalldIfaceZone(ctx, FWRule{Interface: "eth1"}); err != nil {
+		t.Fatalf("exclusive zone: %v", err)
+	}
+	if err := s.checkFirewalldIfaceZone(ctx, FWRule{}); err != nil {
+		t.Fatalf("rule without interface: %v", err)
+	}
+}
+
+func TestFirewallSimulate(t *testing.T) {
+	t.Parallel()
+
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(t.TempDir(), "fw.db")})
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.db.BaseRules = true
+	s.db.PolicyDrop = true
+	s.db.Rules = []FWRule{
+		{ID: "r1", Enabled: true, Type: "redirect", Proto: "tcp", PortFrom: 8080, ToPort: 80},
+		{ID: "r2", Enabled: true, Type: "deny", Proto: "tcp", PortFrom: 443, Interface: "eth1"},
+		{ID: "r3", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 80, PortTo: 443},
+		{ID: "r4", Enabled: false, Type: "allow", Proto: "udp", PortFrom: 53},
+	}
+	s.mu.Unlock()
+
+	simulate := func(body string) simulateResponse {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		s.HandleSimulate(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/simulate", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("simulate %s: status=%d body=%q", body, rr.Code, rr.Body.String())
+		}
+		var resp simulateResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	if got := simulate(`{"proto":"tcp","port":443,"source":"1.2.3.4"}`); got.Verdict != "accept" || got.RuleID != "r3" {
+		t.Fatalf("tcp/443: %+v", got)
+	}
+	if got := simulate(`{"proto":"tcp","port":443,"interface":"eth1"}`); got.Verdict != "drop" || got.RuleID != "r2" {
+		t.Fatalf("tcp/443 on eth1: %+v", got)
+	}
+	if got := simulate(`{"proto":"tcp","port":8080}`); got.Verdict != "accept" || got.RedirectedTo != 80 || got.RuleID != "r3" {
+		t.Fatalf("tcp/8080: %+v", got)
+	}
+	if got := simulate(`{"proto":"udp","port":53}`); got.Verdict != "drop" || got.RuleID != "" || got.Policy != "drop" {
+		t.Fatalf("udp/53: %+v", got)
+	}
+	if got := simulate(`{"proto":"udp","port":53,"interface":"lo"}`); got.Verdict != "accept" || got.RuleID != "system:lo" {
+		t.Fatalf("udp/53 on lo: %+v", got)
+	}
+
+	rr := httptest.NewRecorder()
+	s.HandleSimulate(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/simulate", strings.NewReader(`{"proto":"tcp","port":22,"source":"nope"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad source: status=%d", rr.Code)
+	}
+}
+
+func TestFirewallRulesBulkDelete(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "nft.log")
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = writeScript(t, dir, "nft.sh", "#!/bin/sh\necho \"$@\" >> \""+logPath+"\"\nexit 0\n")
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.db.Rules = []FWRule{
+		{ID: "a", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 22},
+		{ID: "b", Enabled: true, Type: "allow", Proto: "tcp", PortFrom: 80},
+		{ID: "c", Enabled: false, Type: "allow", Proto: "udp", PortFrom: 53},
+	}
+	s.mu.Unlock()
+
+	rr := httptest.NewRecorder()
+	s.HandleRulesDelete(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/rules/delete", strings.NewReader(`{"ids":["c","missing","a"]}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	var resp deleteRulesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if strings.Join(resp.Removed, ",") != "a,c" || strings.Join(resp.NotFound, ",") != "missing" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	s.mu.Lock()
+	rules := s.db.Rules
+	s.mu.Unlock()
+	if len(rules) != 1 || rules[0].ID != "b" {
+		t.Fatalf("unexpected rules left: %+v", rules)
+	}
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if n := strings.Count(string(b), "flush chain inet atlas input"); n != 1 {
+		t.Fatalf("expected one reload, got %d:\n%s", n, b)
+	}
+}
+
+func TestFirewallImportSystemOnDemand(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.fwCmdPath = writeScript(t, dir, "firewall-cmd.sh", `#!/bin/sh
+case "$*" in
+  *"--state"*) echo "running";;
+  *"--get-default-zone"*) echo "public";;
+  *"--get-active-zones"*) echo "public";;
+  *"--list-ports"*) echo "22/tcp 8080/tcp";;
+  *) ;;
+esac
+exit 0
+`)
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.nftPath = ""
+
+	resp, err := s.Rules(context.Background())
+	if err != nil {
+		t.Fatalf("Rules: %v", err)
+	}
+	if len(resp.Rules) != 0 {
+		t.Fatalf("rules were imported on read without auto import: %+v", resp.Rules)
+	}
+
+	importRules := func() importSystemResponse {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		s.HandleImportSystem(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/import-system", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("import: status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		var out importSystemResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return out
+	}
+	if got := importRules(); len(got.Imported) != 2 {
+		t.Fatalf("expected 2 imported rules, got %+v", got)
+	}
+	if got := importRules(); len(got.Imported) != 0 {
+		t.Fatalf("second import should add nothing, got %+v", got)
+	}
+
+	auto := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "auto.db"), AutoImport: true})
+	auto.fwCmdPath = s.fwCmdPath
+	auto.sudoPath = ""
+	auto.ufwPath = ""
+	auto.nftPath = ""
+	if resp, err := auto.Rules(context.Background()); err != nil || len(resp.Rules) != 2 {
+		t.Fatalf("auto import: err=%v rules=%+v", err, resp.Rules)
+	}
+}
+
+func TestFirewallRecordsWhoChangedRules(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = writeScript(t, dir, "nft.sh", "#!/bin/sh\nexit 0\n")
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.mu.Unlock()
+
+	as := func(user string, r *http.Request) *http.Request {
+		return r.WithContext(auth.WithClaims(r.Context(), auth.Claims{UserInfo: auth.UserInfo{User: user, Role: "admin"}}))
+	}
+
+	rr := httptest.NewRecorder()
+	s.HandleRules(rr, as("alice", httptest.NewRequest(http.MethodPost, "/api/firewall/rules",
+		strings.NewReader(`{"enabled":true,"type":"allow","proto":"tcp","ports":"22","position":-1}`))))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	var rule FWRule
+	if err := json.Unmarshal(rr.Body.Bytes(), &rule); err != nil || rule.CreatedBy != "alice" {
+		t.Fatalf("expected created_by alice, err=%v rule=%+v", err, rule)
+	}
+
+	rr = httptest.NewRecorder()
+	s.HandleRuleID(rr, as("bob", httptest.NewRequest(http.MethodPut, "/api/firewall/rules/"+rule.ID,
+		strings.NewReader(`{"type":"allow","proto":"tcp","ports":"2222"}`))))
+	if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
+		t.Fatalf("update: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	resp, err := s.Rules(context.Background())
+	if err != nil {
+		t.Fatalf("Rules: %v", err)
+	}
+	if len(resp.Rules) != 1 || resp.Rules[0].CreatedBy != "alice" || resp.Rules[0].UpdatedBy != "bob" {
+		t.Fatalf("unexpected rules %+v", resp.Rules)
+	}
+	if resp.UpdatedBy != "bob" || resp.UpdatedUnix == 0 {
+		t.Fatalf("unexpected rule set stamp by=%q unix=%d", resp.UpdatedBy, resp.UpdatedUnix)
+	}
+}
+
+func TestFirewalldRuntimeOnlyRule(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "fwcmd.log")
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.fwCmdPath = writeScript(t, dir, "firewall-cmd.sh", `#!/bin/sh
+echo "$@" >> "`+logPath+`"
+case "$*" in
+  *"--get-default-zone"*) echo "public";;
+esac
+exit 0
+`)
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.nftPath = ""
+
+	create := func(body string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		s.HandleRules(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/rules", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("create: status=%d body=%q", rr.Code, rr.Body.String())
+		}
+	}
+	create(`{"enabled":true,"type":"allow","proto":"tcp","ports":"8080","permanent":false,"position":-1}`)
+	create(`{"enabled":true,"type":"allow","proto":"tcp","ports":"9090","position":-1}`)
+
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	log := string(b)
+	if !strings.Contains(log, "--add-port=8080/tcp") || strings.Contains(log, "--permanent --zone public --add-port=8080/tcp") {
+		t.Fatalf("expected a runtime-only 8080 rule:\n%s", log)
+	}
+	if !strings.Contains(log, "--permanent --zone public --add-port=9090/tcp") {
+		t.Fatalf("expected a permanent 9090 rule:\n%s", log)
+	}
+
+	nft := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "nft.db")})
+	nft.nftPath = writeScript(t, dir, "nft.sh", "#!/bin/sh\nexit 0\n")
+	nft.sudoPath = ""
+	nft.ufwPath = ""
+	nft.fwCmdPath = ""
+	rr := httptest.NewRecorder()
+	nft.HandleRules(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/rules",
+		strings.NewReader(`{"enabled":true,"type":"allow","proto":"tcp","ports":"8080","permanent":false}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("runtime-only rule on nft: status=%d", rr.Code)
+	}
+}
+
+func TestFirewallDockerStatus(t *testing.T) {
+	t.Parallel()
+
+	out := `table inet atlas {
+	chain input {
+		type filter hook input priority filter; policy accept;
+	}
+}
+table ip nat {
+	chain DOCKER {
+	}
+	chain PREROUTING {
+		type nat hook prerouting priority dstnat; policy accept;
+	}
+}
+table ip filter {
+	chain DOCKER-USER {
+	}
+	chain FORWARD {
+		type filter hook forward priority filter; policy drop;
+	}
+}
+`
+	want := []string{"ip nat DOCKER", "ip filter DOCKER-USER"}
+	if got := parseDockerChains(out); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("chains=%q want %q", got, want)
+	}
+	if got := parseDockerChains("table inet atlas {\n\tchain input {\n\t}\n}\n"); len(got) != 0 {
+		t.Fatalf("no docker: %q", got)
+	}
+
+	dir := t.TempDir()
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.sudoPath = ""
+	s.nftPath = writeScript(t, dir, "nft", "#!/bin/sh\ncat <<'EOF'\n"+out+"EOF\n")
+	st := s.dockerStatus(context.Background(), "nft", true)
+	if st == nil || !st.Bypass || !st.RedirectOrder || len(st.Chains) != 2 || st.Warning == "" {
+		t.Fatalf("docker status: %+v", st)
+	}
+	if st := s.dockerStatus(context.Background(), "ufw", true); st == nil || st.RedirectOrder {
+		t.Fatalf("ufw: %+v", st)
+	}
+}
+
+func TestFirewallForwardRule(t *testing.T) {
+	t.Parallel()
+
+	base := FWRule{ID: "f", Enabled: true, Type: "redirect", Proto: "tcp", PortFrom: 8080, PortTo: 8080, ToPort: 80, ToAddr: "10.0.0.5", Masquerade: true}
+	if err := validateRule(base); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	for name, mut := range map[string]func(*FWRule){
+		"ipv6":        func(r *FWRule) { r.ToAddr = "fd00::5" },
+		"hostname":    func(r *FWRule) { r.ToAddr = "example.com" },
+		"loopback":    func(r *FWRule) { r.ToAddr = "127.0.0.1" },
+		"allow":       func(r *FWRule) { r.Type = "allow" },
+		"masq-only":   func(r *FWRule) { r.ToAddr = "" },
+		"unspecified": func(r *FWRule) { r.ToAddr = "0.0.0.0" },
+	} {
+		r := base
+		mut(&r)
+		if err := validateRule(r); err == nil {
+			t.Fatalf("%s: expected a validation error", name)
+		}
+	}
+
+	local := FWRule{ID: "l", Enabled: true, Type: "redirect", Proto: "udp", PortFrom: 53, PortTo: 53, ToPort: 5353}
+	script := renderNftScript(fwDB{Enabled: true, Rules: []FWRule{base, local}}, -150, defaultNftNames)
+	for _, want := range []string{
+		"type nat hook prerouting priority -150;",
+		`tcp dport 8080 dnat to 10.0.0.5:80 comment "atlas:f"`,
+		"type nat hook postrouting priority 100;",
+		`ip daddr 10.0.0.5 tcp dport 80 masquerade comment "atlas:f"`,
+		`udp dport 53 redirect to :5353 comment "atlas:l"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("missing %q in:\n%s", want, script)
+		}
+	}
+
+	tbl := parseNftText("table ip atlas_nat { # handle 7\n\tchain prerouting { # handle 1\n\t\ttype nat hook prerouting priority dstnat; policy accept;\n"+
+		"\t\ttcp dport 8080 dnat to 10.0.0.5:80 comment \"atlas:f\" # handle 2\n\t}\n}\n", "ip", "atlas_nat", defaultNftNames)
+	if len(tbl.Rules) != 1 || tbl.Rules[0].Verdict != "dnat" || tbl.Rules[0].ToAddr != "10.0.0.5" || tbl.Rules[0].ToPort != 80 {
+		t.Fatalf("parsed: %+v", tbl.Rules)
+	}
+
+	if got := firewalldForwardAddr("port=80:proto=tcp:toport=8080:toaddr=1.2.3.4"); got != "1.2.3.4" {
+		t.Fatalf("toaddr=%q", got)
+	}
+	if port, _, toPort, ok := parseFirewalldForward("port=80:proto=tcp:toaddr=1.2.3.4"); !ok || port != 80 || toPort != 80 {
+		t.Fatalf("forward without toport: port=%d to=%d ok=%v", port, toPort, ok)
+	}
+
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(t.TempDir(), "fw.db")})
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.db.Rules = []FWRule{base, {ID: "d", Enabled: true, Type: "deny", Proto: "tcp", PortFrom: 8080, PortTo: 8080}}
+	resp := s.simulateLocked(simulateRequest{Proto: "tcp", Port: 8080})
+	s.mu.Unlock()
+	if resp.Verdict != "forward" || resp.ForwardedTo != "10.0.0.5:80" || resp.RuleID != "f" {
+		t.Fatalf("simulate: %+v", resp)
+	}
+}
+
+func TestFirewallBanWithFakeNft(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "nft.log")
+	nftPath := writeScript(t, dir, "nft.sh", `#!/bin/sh
+echo "$@" >> "`+logPath+`"
+exit 0
+`)
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = nftPath
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+	s.mu.Lock()
+	s.db.Enabled = true
+	s.db.BaseRules = true
+	s.mu.Unlock()
+
+	post := func(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/ban", strings.NewReader(body)))
+		return rr
+	}
+	for _, bad := range []string{`{"source":"nope"}`, `{"source":"0.0.0.0/0"}`, `{"source":"127.0.0.1"}`, `{"source":"203.0.113.7","ttl_seconds":-1}`} {
+		if rr := post(s.HandleBan, bad); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d", bad, rr.Code)
+		}
+	}
+	rr := post(s.HandleBan, `{"source":"203.0.113.7","ttl_seconds":600}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("ban: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	var ban FWBan
+	if err := json.Unmarshal(rr.Body.Bytes(), &ban); err != nil || ban.ID == "" || ban.ExpiresUnix == 0 {
+		t.Fatalf("unexpected ban: %+v (%v)", ban, err)
+	}
+	if rr := post(s.HandleBan, `{"source":"2001:db8::/32"}`); rr.Code != http.StatusOK {
+		t.Fatalf("ban v6: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	log := string(b)
+	ban4 := strings.LastIndex(log, "ip saddr 203.0.113.7 drop")
+	lo := strings.LastIndex(log, "iif lo accept")
+	if ban4 < 0 || !strings.Contains(log, "ip6 saddr 2001:db8::/32 drop") || ban4 > lo {
+		t.Fatalf("expected bans before the base rules:\n%s", log)
+	}
+	script := renderNftScript(s.db, defaultNATPriority, defaultNftNames)
+	if !strings.Contains(script, "ip6 saddr 2001:db8::/32 drop") || strings.Contains(script, ban.ID) {
+		t.Fatalf("persisted script should hold only the permanent ban:\n%s", script)
+	}
+
+	rr = httptest.NewRecorder()
+	s.HandleRules(rr, httptest.NewRequest(http.MethodGet, "/api/firewall/rules", nil))
+	var rules FirewallRules
+	if err := json.Unmarshal(rr.Body.Bytes(), &rules); err != nil {
+		t.Fatalf("decode rules: %v", err)
+	}
+	if len(rules.Bans) != 2 || len(rules.Rules) != 0 || rules.ExpiresIn[ban.ID] <= 0 {
+		t.Fatalf("bans should be listed apart from rules: %+v", rules)
+	}
+
+	sim := s.simulateLocked(simulateRequest{Proto: "tcp", Port: 22, Source: "203.0.113.7"})
+	if sim.Verdict != "drop" || sim.RuleID != ban.ID {
+		t.Fatalf("simulate banned source: %+v", sim)
+	}
+
+	if err := s.reapExpired(time.Unix(ban.ExpiresUnix, 0)); err != nil {
+		t.Fatalf("reap: %v", err)
+	}
+	if rr := post(s.HandleUnban, `{"source":"203.0.113.7"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expired ban still present: status=%d", rr.Code)
+	}
+	if rr := post(s.HandleUnban, `{"source":"2001:db8::/32"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("unban: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	s2 := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	if len(s2.db.Bans) != 0 {
+		t.Fatalf("bans still persisted: %+v", s2.db.Bans)
+	}
+
+	// Bans count against the rule cap.
+	s.cfg.MaxRules = 1
+	if rr := post(s.HandleBan, `{"source":"198.51.100.1"}`); rr.Code != http.StatusOK {
+		t.Fatalf("ban under the cap: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := post(s.HandleBan, `{"source":"198.51.100.2"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("ban over the cap: status=%d", rr.Code)
+	}
+	if rr := post(s.HandleBan, `{"source":"198.51.100.1","ttl_seconds":60}`); rr.Code != http.StatusOK {
+		t.Fatalf("updating an existing ban at the cap: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	// With Atlas rules disabled nft would never enforce the ban.
+	s.cfg.MaxRules = 0
+	s.mu.Lock()
+	s.db.Enabled = false
+	s.mu.Unlock()
+	if rr := post(s.HandleBan, `{"source":"198.51.100.3"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("ban with rules disabled: status=%d", rr.Code)
+	}
+}
+
+func TestFirewallMaxRules(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db"), MaxRules: 2})
+	s.nftPath = writeScript(t, dir, "nft.sh", "#!/bin/sh\nexit 0\n")
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/firewall/rules", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		s.HandleRules(rr, req)
+		return rr
+	}
+	if rr := post(`{"enabled":true,"type":"allow","proto":"tcp","ports":"22"}`); rr.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"enabled":true,"type":"allow","proto":"tcp","ports":"80"}`); rr.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	rr := post(`{"enabled":true,"type":"allow","proto":"tcp","ports":"443"}`)
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "max 2") {
+		t.Fatalf("over the cap: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+
+	imp := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "imp.db"), MaxRules: 1})
+	imp.fwCmdPath = writeScript(t, dir, "firewall-cmd.sh", `#!/bin/sh
+case "$*" in
+  *"--state"*) echo "running";;
+  *"--get-default-zone"*) echo "public";;
+  *"--get-active-zones"*) echo "public";;
+  *"--list-ports"*) echo "22/tcp 8080/tcp";;
+  *) ;;
+esac
+exit 0
+`)
+	imp.sudoPath = ""
+	imp.ufwPath = ""
+	imp.nftPath = ""
+	rr = httptest.NewRecorder()
+	imp.HandleImportSystem(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/import-system", nil))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("import over the cap: status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if resp, err := imp.Rules(context.Background()); err != nil || len(resp.Rules) != 0 {
+		t.Fatalf("import should add nothing: err=%v rules=%+v", err, resp.Rules)
+	}
+}
+
+func TestFirewallRulesSort(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs shell script")
+	}
+
+	dir := t.TempDir()
+	s := NewFirewallService(FirewallConfig{Enabled: true, DBPath: filepath.Join(dir, "fw.db")})
+	s.nftPath = writeScript(t, dir, "nft.sh", "#!/bin/sh\nexit 0\n")
+	s.sudoPath = ""
+	s.ufwPath = ""
+	s.fwCmdPath = ""
+
+	post := func(body string) FWRule {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		s.HandleRules(rr, httptest.NewRequest(http.MethodPost, "/api/firewall/rules", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("create status=%d body=%q", rr.Code, rr.Body.String())
+		}
+		var rule FWRule
+		if err := json.Unmarshal(rr.Body.Bytes(), &rule); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if rule.Created.IsZero() {
+			t.Fatalf("created rule has no creation time: %+v", rule)
+		}
+		return rule
+	}
+	post(`{"enabled":true,"type":"deny","proto":"tcp","ports":"443"}`)
+	post(`{"enabled":true,"type":"allow","proto":"tcp","ports":"22","position":-1}`)
+	post(`{"enabled":true,"type":"allow","proto":"udp","ports":"80","position":0}`)
+	// Creation times a second apart, oldest first: 443, 22, 80.
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.mu.Lock()
+	age := map[int]int{443: 0, 22: 1, 80: 2}
+	for i := range s.db.Rules {
+		s.db.Rules[i].Created = base.Add(time.Duration(age[s.db.Rules[i].PortFrom]) * time.Second)
+	}
+	s.mu.Unlock()
+
+	ports := func(query string) ([]int, string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		s.HandleRules(rr, httptest.NewRequest(http.MethodGet, "/api/firewall/rules"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("get %s: status=%d body=%q", query, rr.Code, rr.Body.String())
+		}
+		var resp FirewallRules
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var out []int
+		for _, r := range resp.Rules {
+			out = append(out, r.PortFrom)
+		}
+		return out, resp.Sort
+	}
+	for _, tc := range []struct {
+		query string
+		want  []int
+	}{
+		{"", []int{80, 443, 22}},
+		{"?sort=created", []int{443, 22, 80}},
+		{"?sort=port", []int{22, 80, 443}},
+		{"?sort=type", []int{80, 22, 443}},
+	} {
+		got, sortBy := ports(tc.query)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%q: ports=%v, want %v", tc.query, got, tc.want)
+		}
+		if want := strings.TrimPrefix(tc.query, "?sort="); sortBy != want {
+			t.Fatalf("%q: sort=%q", tc.query, sortBy)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	s.HandleRules(rr, httptest.NewRequest(http.MethodGet, "/api/firewall/rules?sort=name", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("unknown sort: status=%d", rr.Code)
+	}
+}
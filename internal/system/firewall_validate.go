@@ -0,0 +1,60 @@
+package system
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ruleKey identifies what a rule matches and does; two rules with the same key are duplicates.
+func ruleKey(r FWRule) string {
+	return fmt.Sprintf("%s|%s|%s|%s:%d|%s|%s", r.Type, r.Proto, rulePorts(r), r.ToAddr, r.ToPort, r.Service, r.Interface)
+}
+
+// findDuplicate returns the first rule (other than skipID) with the same key as r.
+func findDuplicate(rules []FWRule, r FWRule, skipID string) (FWRule, bool) {
+	key := ruleKey(r)
+	for _, rr := range rules {
+		if rr.ID != skipID && ruleKey(rr) == key {
+			return rr, true
+		}
+	}
+	return FWRule{}, false
+}
+
+// overlapWarnings lists enabled allow/deny pairs whose ports and protocols overlap.
+// They are only advisory: rule order decides which one wins, and that can be intended.
+func overlapWarnings(rules []FWRule) []string {
+	var out []string
+	for i, a := range rules {
+		if !a.Enabled || a.Service != "" || (a.Type != "allow" && a.Type != "deny") {
+			continue
+		}
+		for _, b := range rules[i+1:] {
+			if !b.Enabled || b.Service != "" || (b.Type != "allow" && b.Type != "deny") || a.Type == b.Type {
+				continue
+			}
+			if a.Interface != "" && b.Interface != "" && a.Interface != b.Interface {
+				continue
+			}
+			if !protosOverlap(a.Proto, b.Proto) || !portRangesOverlap(a.portRanges(), b.portRanges()) {
+				continue
+			}
+			out = append(out, fmt.Sprintf("%s %s %s overlaps %s %s %s; the earlier rule wins",
+				a.Type, a.Proto, rulePorts(a), b.Type, b.Proto, rulePorts(b)))
+		}
+	}
+	return out
+}
+
+func protosOverlap(a, b string) bool {
+	return a == b || a == "any" || b == "any"
+}
+
+func rulePorts(r FWRule) string {
+	ranges := r.portRanges()
+	parts := make([]string, len(ranges))
+	for i, p := range ranges {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, ",")
+}
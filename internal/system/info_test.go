@@ -71,3 +71,26 @@ func TestCharsToStringStopsAtZero(t *testing.T) {
 		t.Fatalf("got %q", got)
 	}
 }
+
+func TestReadMounts(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "mounts")
+	data := "/dev/sda1 / ext4 rw,relatime 0 0\n" +
+		"server:/export /mnt/my\\040share nfs4 rw,vers=4.2 0 0\n" +
+		"bogus\n"
+	if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	mounts, err := ReadMounts(p)
+	if err != nil {
+		t.Fatalf("ReadMounts: %v", err)
+	}
+	if len(mounts) != 2 {
+		t.Fatalf("expected 2 mounts, got %#v", mounts)
+	}
+	m := mounts[1]
+	if m.Device != "server:/export" || m.Target != "/mnt/my share" || m.FSType != "nfs4" || len(m.Options) != 2 || m.Options[1] != "vers=4.2" {
+		t.Fatalf("unexpected mount: %#v", m)
+	}
+}
@@ -0,0 +1,59 @@
+package system
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Mount struct {
+	Device  string   `json:"device"`
+	Target  string   `json:"target"`
+	FSType  string   `json:"fstype"`
+	Options []string `json:"options"`
+}
+
+// ReadMounts parses a mounts table in /proc/mounts format.
+func ReadMounts(path string) ([]Mount, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	out := []Mount{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		out = append(out, Mount{
+			Device:  unescapeMountField(fields[0]),
+			Target:  unescapeMountField(fields[1]),
+			FSType:  fields[2],
+			Options: strings.Split(fields[3], ","),
+		})
+	}
+	return out, sc.Err()
+}
+
+// unescapeMountField decodes the octal escapes (\040 for space etc.) used by the kernel.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"os/user"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -13,26 +15,58 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	"unicode/utf8"
+
+	"github.com/MrTeeett/atlas/internal/auth"
+	"github.com/MrTeeett/atlas/internal/nss"
+	"github.com/MrTeeett/atlas/internal/units"
 )
 
+// defaultPasswdTTL is how long /etc/passwd is cached unless SetPasswdTTL says otherwise.
+const defaultPasswdTTL = 5 * time.Minute
+
 type ProcessService struct {
-	mu          sync.Mutex
+	mu sync.Mutex
+	// passwdPath and passwdTTL default to /etc/passwd and 5 minutes.
+	passwdPath  string
+	passwdTTL   time.Duration
 	passwdAt    time.Time
 	uidToUser   map[uint32]string
 	passwdError error
 
+	// nssUsers caches NSS lookups for uids missing from /etc/passwd ("" when unknown).
+	nssUsers  map[uint32]string
+	lookupUID func(uid string) (*user.User, error)
+
 	prevAt      time.Time
 	prevTotal   uint64
 	prevPerProc map[int]uint64
+
+	kill func(pid int, sig syscall.Signal) error
+
+	// allowedSignals restricts non-admin users (nil: every signal parseSignal accepts).
+	allowedSignals map[syscall.Signal]bool
+
+	// maxCommand caps Command in the list (0: defaultMaxCommandLen).
+	maxCommand int
 }
 
+// defaultMaxCommandLen is how many bytes of a command line the process list returns.
+const defaultMaxCommandLen = 512
+
 type Process struct {
-	PID         int     `json:"pid"`
-	User        string  `json:"user"`
-	Command     string  `json:"command"`
-	RSSBytes    uint64  `json:"rss_bytes"`
-	State       string  `json:"state"`
-	CPUUsagePct float64 `json:"cpu_usage_pct"`
+	PID     int    `json:"pid"`
+	User    string `json:"user"`
+	Command string `json:"command"`
+	// CommandTruncated is set when the list shortened Command (and Args); the details
+	// endpoint returns them in full.
+	CommandTruncated bool `json:"command_truncated,omitempty"`
+	// Args is the argv from /proc/<pid>/cmdline ([Name] for kernel threads).
+	Args        []string `json:"args"`
+	RSSBytes    uint64   `json:"rss_bytes"`
+	RSSHuman    string   `json:"rss_human,omitempty"`
+	State       string   `json:"state"`
+	CPUUsagePct float64  `json:"cpu_usage_pct"`
 }
 
 type processListResponse struct {
@@ -40,7 +74,55 @@ type processListResponse struct {
 }
 
 func NewProcessService() *ProcessService {
-	return &ProcessService{}
+	return &ProcessService{lookupUID: nss.LookupId}
+}
+
+// SetPasswdTTL sets how long /etc/passwd is cached for uid lookups (<= 0: 5 minutes).
+func (s *ProcessService) SetPasswdTTL(d time.Duration) {
+	s.mu.Lock()
+	s.passwdTTL = d
+	s.mu.Unlock()
+}
+
+// SetMaxCommandLen sets how much of each command line the list returns (<= 0: 512 bytes).
+func (s *ProcessService) SetMaxCommandLen(n int) {
+	s.mu.Lock()
+	s.maxCommand = n
+	s.mu.Unlock()
+}
+
+// InvalidatePasswd makes the next listing re-read /etc/passwd (and drop cached NSS names).
+func (s *ProcessService) InvalidatePasswd() {
+	s.mu.Lock()
+	s.uidToUser = nil
+	s.mu.Unlock()
+}
+
+// SetAllowedSignals limits the signals non-admin users may send (e.g. HUP and TERM only).
+// An empty list allows all signals.
+func (s *ProcessService) SetAllowedSignals(names []string) error {
+	if len(names) == 0 {
+		s.allowedSignals = nil
+		return nil
+	}
+	allowed := make(map[syscall.Signal]bool, len(names))
+	for _, n := range names {
+		sig, ok := parseSignal(n)
+		if !ok {
+			return fmt.Errorf("unknown signal %q", n)
+		}
+		allowed[sig] = true
+	}
+	s.allowedSignals = allowed
+	return nil
+}
+
+func (s *ProcessService) signalAllowed(r *http.Request, sig syscall.Signal) bool {
+	if s.allowedSignals == nil || s.allowedSignals[sig] {
+		return true
+	}
+	c, ok := auth.ClaimsFromContext(r.Context())
+	return ok && strings.EqualFold(strings.TrimSpace(c.Role), "admin")
 }
 
 func (s *ProcessService) HandleList(w http.ResponseWriter, r *http.Request) {
@@ -48,11 +130,19 @@ func (s *ProcessService) HandleList(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	if r.URL.Query().Get("refresh") == "1" {
+		s.InvalidatePasswd()
+	}
 	ps, err := s.list()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if units.HumanRequested(r) {
+		for i := range ps {
+			ps[i].RSSHuman = units.HumanizeBytes(ps[i].RSSBytes)
+		}
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_ = json.NewEncoder(w).Encode(processListResponse{Processes: ps})
 }
@@ -65,6 +155,14 @@ type signalRequest struct {
 	PID    int    `json:"pid"`
 	PIDs   []int  `json:"pids"`
 	Signal string `json:"signal"`
+	// Targets give each process its own signal, e.g. TERM for a parent and KILL for
+	// a stuck child; entries without one use Signal.
+	Targets []signalTarget `json:"targets"`
+}
+
+type signalTarget struct {
+	PID    int    `json:"pid"`
+	Signal string `json:"signal"`
 }
 
 func (s *ProcessService) HandleSignal(w http.ResponseWriter, r *http.Request) {
@@ -73,41 +171,113 @@ func (s *ProcessService) HandleSignal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req signalRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSON(w, r, &req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
-	var pids []int
+	targets := make([]signalTarget, 0, 1+len(req.PIDs)+len(req.Targets))
 	if req.PID > 0 {
-		pids = append(pids, req.PID)
+		targets = append(targets, signalTarget{PID: req.PID})
 	}
 	for _, pid := range req.PIDs {
 		if pid > 0 {
-			pids = append(pids, pid)
+			targets = append(targets, signalTarget{PID: pid})
+		}
+	}
+	for _, t := range req.Targets {
+		if t.PID > 0 {
+			targets = append(targets, t)
 		}
 	}
-	if len(pids) == 0 {
+	if len(targets) == 0 {
 		http.Error(w, "pid(s) are required", http.StatusBadRequest)
 		return
 	}
-	sig, ok := parseSignal(req.Signal)
-	if !ok {
-		http.Error(w, "unknown signal", http.StatusBadRequest)
-		return
+	// Validate the whole batch before signalling anything.
+	sigs := make([]syscall.Signal, len(targets))
+	byPID := map[int]syscall.Signal{}
+	for i, t := range targets {
+		name := t.Signal
+		if strings.TrimSpace(name) == "" {
+			name = req.Signal
+		}
+		sig, ok := parseSignal(name)
+		if !ok {
+			http.Error(w, "unknown signal", http.StatusBadRequest)
+			return
+		}
+		if !s.signalAllowed(r, sig) {
+			http.Error(w, "signal not allowed", http.StatusForbidden)
+			return
+		}
+		if prev, ok := byPID[t.PID]; ok && prev != sig {
+			http.Error(w, fmt.Sprintf("pid %d is given different signals", t.PID), http.StatusBadRequest)
+			return
+		}
+		byPID[t.PID] = sig
+		sigs[i] = sig
 	}
 
+	kill := s.kill
+	if kill == nil {
+		kill = syscall.Kill
+	}
+	resp := signalResponse{Results: []signalResult{}}
 	seen := map[int]bool{}
-	for _, pid := range pids {
+	var nOK, nNoProc, nPerm int
+	for i, t := range targets {
+		pid, sig := t.PID, sigs[i]
 		if seen[pid] {
 			continue
 		}
 		seen[pid] = true
-		if err := syscall.Kill(pid, sig); err != nil {
-			http.Error(w, "kill pid "+strconv.Itoa(pid)+": "+err.Error(), http.StatusInternalServerError)
-			return
+		res := signalResult{PID: pid, Signal: signalName(sig), Status: "ok"}
+		if err := kill(pid, sig); err != nil {
+			switch {
+			case errors.Is(err, syscall.ESRCH):
+				res.Status = "no_such_process"
+				nNoProc++
+			case errors.Is(err, syscall.EPERM):
+				res.Status = "permission_denied"
+				res.Hint = "process belongs to another user; elevated privileges are required"
+				nPerm++
+			default:
+				res.Status = "error"
+			}
+			res.Error = err.Error()
+		} else {
+			nOK++
 		}
+		resp.Results = append(resp.Results, res)
 	}
-	w.WriteHeader(http.StatusNoContent)
+
+	status := http.StatusOK
+	switch {
+	case nOK == len(resp.Results):
+	case nOK > 0:
+		status = http.StatusMultiStatus
+	case nNoProc == len(resp.Results):
+		status = http.StatusNotFound
+	case nPerm > 0:
+		status = http.StatusForbidden
+	default:
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+type signalResult struct {
+	PID    int    `json:"pid"`
+	Signal string `json:"signal"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+type signalResponse struct {
+	Results []signalResult `json:"results"`
 }
 
 func (s *ProcessService) list() ([]Process, error) {
@@ -116,12 +286,10 @@ func (s *ProcessService) list() ([]Process, error) {
 		return nil, err
 	}
 
-	users := s.loadPasswd()
+	s.loadPasswd()
 
-	totalNow, err := readTotalCPUJiffies("/proc/stat")
-	if err != nil {
-		return nil, err
-	}
+	// Without /proc/stat the list is still useful; CPU percentages just stay zero.
+	totalNow, _ := readTotalCPUJiffies("/proc/stat")
 	now := time.Now()
 
 	var out []Process
@@ -134,7 +302,7 @@ func (s *ProcessService) list() ([]Process, error) {
 		if err != nil {
 			continue
 		}
-		p, err := readProc(pid, users)
+		p, err := readProc(pid, s.userName)
 		if err != nil {
 			continue
 		}
@@ -151,7 +319,11 @@ func (s *ProcessService) list() ([]Process, error) {
 	s.prevAt = now
 	s.prevTotal = totalNow
 	s.prevPerProc = perProcNow
+	maxCommand := s.maxCommand
 	s.mu.Unlock()
+	if maxCommand <= 0 {
+		maxCommand = defaultMaxCommandLen
+	}
 
 	if !prevAt.IsZero() && prevTotal > 0 && totalNow > prevTotal {
 		dTotal := totalNow - prevTotal
@@ -176,10 +348,37 @@ func (s *ProcessService) list() ([]Process, error) {
 	if len(out) > 300 {
 		out = out[:300]
 	}
+	for i := range out {
+		out[i].truncateCommand(maxCommand)
+	}
 	return out, nil
 }
 
-func readProc(pid int, uidToUser map[uint32]string) (Process, error) {
+// truncateCommand cuts Command to max bytes (on a rune boundary) plus an ellipsis, and
+// keeps only the arguments that fit.
+func (p *Process) truncateCommand(max int) {
+	if len(p.Command) <= max {
+		return
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(p.Command[cut]) {
+		cut--
+	}
+	p.Command = p.Command[:cut] + "…"
+	p.CommandTruncated = true
+	n, size := 0, 0
+	for n < len(p.Args) && size+len(p.Args[n]) <= max {
+		size += len(p.Args[n]) + 1
+		n++
+	}
+	if n == 0 {
+		p.Args = []string{p.Command}
+		return
+	}
+	p.Args = p.Args[:n]
+}
+
+func readProc(pid int, userName func(uid uint32) string) (Process, error) {
 	statusPath := filepath.Join("/proc", strconv.Itoa(pid), "status")
 	name, state, uid, rss, err := parseProcStatus(statusPath)
 	if err != nil {
@@ -188,17 +387,18 @@ func readProc(pid int, uidToUser map[uint32]string) (Process, error) {
 
 	cmdlinePath := filepath.Join("/proc", strconv.Itoa(pid), "cmdline")
 	cmdline, _ := os.ReadFile(cmdlinePath)
-	command := strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	args := splitCmdline(cmdline)
+	command := strings.TrimSpace(strings.Join(args, " "))
 	if command == "" {
 		command = name
+		args = []string{name}
 	}
 
-	user := uidToUser[uid]
-
 	return Process{
 		PID:      pid,
-		User:     user,
+		User:     userName(uid),
 		Command:  command,
+		Args:     args,
 		RSSBytes: rss,
 		State:    state,
 	}, nil
@@ -259,6 +459,39 @@ func readProcCPUJiffies(pid int) (uint64, error) {
 	return utime + stime, nil
 }
 
+// splitCmdline splits the NUL-separated /proc cmdline; the trailing NUL doesn't add an
+// empty argument, but empty arguments in between are kept.
+func splitCmdline(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	s := strings.TrimSuffix(string(b), "\x00")
+	return strings.Split(s, "\x00")
+}
+
+// signalName is the inverse of parseSignal ("TERM", or the number).
+func signalName(sig syscall.Signal) string {
+	switch sig {
+	case syscall.SIGHUP:
+		return "HUP"
+	case syscall.SIGINT:
+		return "INT"
+	case syscall.SIGTERM:
+		return "TERM"
+	case syscall.SIGKILL:
+		return "KILL"
+	case syscall.SIGSTOP:
+		return "STOP"
+	case syscall.SIGCONT:
+		return "CONT"
+	case syscall.SIGUSR1:
+		return "USR1"
+	case syscall.SIGUSR2:
+		return "USR2"
+	}
+	return strconv.Itoa(int(sig))
+}
+
 func parseSignal(s string) (syscall.Signal, bool) {
 	s = strings.TrimSpace(strings.ToUpper(s))
 	s = strings.TrimPrefix(s, "SIG")
@@ -334,12 +567,20 @@ func (s *ProcessService) loadPasswd() map[uint32]string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if time.Since(s.passwdAt) < 5*time.Minute && s.uidToUser != nil {
+	ttl := s.passwdTTL
+	if ttl <= 0 {
+		ttl = defaultPasswdTTL
+	}
+	if time.Since(s.passwdAt) < ttl && s.uidToUser != nil {
 		return s.uidToUser
 	}
 
 	m := map[uint32]string{}
-	b, err := os.ReadFile("/etc/passwd")
+	path := s.passwdPath
+	if path == "" {
+		path = "/etc/passwd"
+	}
+	b, err := os.ReadFile(path)
 	if err == nil {
 		for _, line := range strings.Split(string(b), "\n") {
 			if line == "" || strings.HasPrefix(line, "#") {
@@ -358,6 +599,43 @@ func (s *ProcessService) loadPasswd() map[uint32]string {
 	}
 	s.passwdAt = time.Now()
 	s.uidToUser = m
+	s.nssUsers = map[uint32]string{}
 	s.passwdError = err
 	return s.uidToUser
 }
+
+// userName resolves uid from the cached /etc/passwd and falls back to NSS (LDAP, SSSD,
+// ...) via getent for uids not listed there. NSS results, including misses, are cached
+// until the next passwd reload. The lookup runs without s.mu held, since getent may wait
+// on a directory server.
+func (s *ProcessService) userName(uid uint32) string {
+	s.mu.Lock()
+	if name, ok := s.uidToUser[uid]; ok {
+		s.mu.Unlock()
+		return name
+	}
+	if name, ok := s.nssUsers[uid]; ok {
+		s.mu.Unlock()
+		return name
+	}
+	lookup, loadedAt := s.lookupUID, s.passwdAt
+	s.mu.Unlock()
+
+	name := ""
+	if lookup != nil {
+		if u, err := lookup(strconv.FormatUint(uint64(uid), 10)); err == nil {
+			name = u.Username
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A passwd reload in the meantime started a fresh cache; don't mix in older results.
+	if s.passwdAt.Equal(loadedAt) {
+		if s.nssUsers == nil {
+			s.nssUsers = map[uint32]string{}
+		}
+		s.nssUsers[uid] = name
+	}
+	return name
+}
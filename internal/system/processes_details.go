@@ -0,0 +1,104 @@
+package system
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/MrTeeett/atlas/internal/auth"
+)
+
+// secretEnvWords mark variables whose values are never returned, not even to admins.
+var secretEnvWords = []string{"TOKEN", "PASSWORD", "PASSWD", "SECRET", "KEY"}
+
+type processEnvVar struct {
+	Name string `json:"name"`
+	// Value is only set for admins, and never for secret-looking names.
+	Value    string `json:"value,omitempty"`
+	Redacted bool   `json:"redacted,omitempty"`
+}
+
+type processDetailsResponse struct {
+	Process
+	// Env is set with ?env=1; EnvError explains why it could not be read.
+	Env      []processEnvVar `json:"env,omitempty"`
+	EnvError string          `json:"env_error,omitempty"`
+}
+
+func secretEnvName(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, w := range secretEnvWords {
+		if strings.Contains(upper, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEnviron splits /proc/<pid>/environ (NUL-separated NAME=value entries).
+func parseEnviron(b []byte, values bool) []processEnvVar {
+	out := []processEnvVar{}
+	for _, entry := range bytes.Split(b, []byte{0}) {
+		if len(entry) == 0 {
+			continue
+		}
+		name, value, _ := strings.Cut(string(entry), "=")
+		v := processEnvVar{Name: name}
+		switch {
+		case secretEnvName(name):
+			v.Redacted = true
+		case values:
+			v.Value = value
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// HandleDetails returns one process. With ?env=1 it adds the environment: names for
+// users with process management, values for admins only.
+func (s *ProcessService) HandleDetails(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	pid, err := strconv.Atoi(r.URL.Query().Get("pid"))
+	if err != nil || pid <= 0 {
+		http.Error(w, "bad pid", http.StatusBadRequest)
+		return
+	}
+	withEnv := r.URL.Query().Get("env") == "1"
+	c, _ := auth.ClaimsFromContext(r.Context())
+	if withEnv && !c.CanProcs {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	s.loadPasswd()
+	p, err := readProc(pid, s.userName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "no such process", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := processDetailsResponse{Process: p}
+	if withEnv {
+		b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "environ"))
+		switch {
+		case err == nil:
+			resp.Env = parseEnviron(b, strings.EqualFold(strings.TrimSpace(c.Role), "admin"))
+		case errors.Is(err, os.ErrPermission):
+			resp.EnvError = "permission denied: the process belongs to another user"
+		default:
+			resp.EnvError = err.Error()
+		}
+	}
+	writeJSON(w, resp)
+}
@@ -2,9 +2,16 @@ package system
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+
+	"github.com/MrTeeett/atlas/internal/auth"
 )
 
 func TestProcessHandleSignalValidation(t *testing.T) {
@@ -28,6 +35,29 @@ func TestProcessHandleSignalValidation(t *testing.T) {
 		t.Fatalf("expected 400, got %d", rr.Code)
 	}
 
+	// Trailing data after the JSON object
+	req = httptest.NewRequest(http.MethodPost, "http://example/api/processes/signal", bytes.NewReader([]byte(`{"pid":123,"signal":"TERM"} {"pid":1}`)))
+	rr = httptest.NewRecorder()
+	s.HandleSignal(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for trailing data, got %d", rr.Code)
+	}
+
+	// Oversized body: the app-level limitBody middleware wraps the body in a
+	// MaxBytesReader; a valid request that exceeds it must still be rejected.
+	body := `{"pid":123,"signal":"TERM","pad":"` + strings.Repeat("A", 1<<20) + `"}`
+	req = httptest.NewRequest(http.MethodPost, "http://example/api/processes/signal", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	req.Body = http.MaxBytesReader(rr, req.Body, 1<<10)
+	s.kill = func(int, syscall.Signal) error {
+		t.Fatal("oversized body reached kill")
+		return nil
+	}
+	s.HandleSignal(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for oversized body, got %d", rr.Code)
+	}
+
 	// Unknown signal
 	req = httptest.NewRequest(http.MethodPost, "http://example/api/processes/signal", bytes.NewReader([]byte(`{"pid":123,"signal":"NOPE"}`)))
 	rr = httptest.NewRecorder()
@@ -36,3 +66,186 @@ func TestProcessHandleSignalValidation(t *testing.T) {
 		t.Fatalf("expected 400, got %d", rr.Code)
 	}
 }
+
+func TestProcessHandleSignalResults(t *testing.T) {
+	t.Parallel()
+
+	s := NewProcessService()
+	s.kill = func(pid int, sig syscall.Signal) error {
+		switch pid {
+		case 1:
+			return syscall.EPERM
+		case 2:
+			return syscall.ESRCH
+		}
+		return nil
+	}
+	cases := []struct {
+		body string
+		code int
+	}{
+		{`{"pids":[10,11],"signal":"TERM"}`, http.StatusOK},
+		{`{"pids":[10,1,2],"signal":"TERM"}`, http.StatusMultiStatus},
+		{`{"pids":[2],"signal":"TERM"}`, http.StatusNotFound},
+		{`{"pids":[1,2],"signal":"TERM"}`, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "http://example/api/processes/signal", strings.NewReader(tc.body))
+		rr := httptest.NewRecorder()
+		s.HandleSignal(rr, req)
+		if rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d body=%q", tc.body, tc.code, rr.Code, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://example/api/processes/signal", strings.NewReader(`{"pids":[10,1,2,10],"signal":"KILL"}`))
+	rr := httptest.NewRecorder()
+	s.HandleSignal(rr, req)
+	var resp signalResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("expected deduplicated results, got %#v", resp.Results)
+	}
+	if resp.Results[0].Status != "ok" || resp.Results[1].Status != "permission_denied" || resp.Results[1].Hint == "" || resp.Results[2].Status != "no_such_process" {
+		t.Fatalf("unexpected results: %#v", resp.Results)
+	}
+}
+
+func TestProcessHandleSignalAllowlist(t *testing.T) {
+	t.Parallel()
+
+	s := NewProcessService()
+	s.kill = func(pid int, sig syscall.Signal) error { return nil }
+	if err := s.SetAllowedSignals([]string{"BOGUS"}); err == nil {
+		t.Fatalf("expected error for unknown signal")
+	}
+	if err := s.SetAllowedSignals([]string{"HUP", "sigterm"}); err != nil {
+		t.Fatalf("SetAllowedSignals: %v", err)
+	}
+
+	send := func(role, sig string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/processes/signal", strings.NewReader(`{"pid":10,"signal":"`+sig+`"}`))
+		req = req.WithContext(auth.WithClaims(req.Context(), auth.Claims{UserInfo: auth.UserInfo{User: "op", Role: role}}))
+		rr := httptest.NewRecorder()
+		s.HandleSignal(rr, req)
+		return rr.Code
+	}
+	if code := send("user", "TERM"); code != http.StatusOK {
+		t.Fatalf("TERM should be allowed, got %d", code)
+	}
+	if code := send("user", "KILL"); code != http.StatusForbidden {
+		t.Fatalf("KILL should be forbidden, got %d", code)
+	}
+	if code := send("user", "9"); code != http.StatusForbidden {
+		t.Fatalf("numeric KILL should be forbidden, got %d", code)
+	}
+	if code := send("admin", "KILL"); code != http.StatusOK {
+		t.Fatalf("admins keep the full set, got %d", code)
+	}
+}
+
+func TestProcessHandleSignalTargets(t *testing.T) {
+	t.Parallel()
+
+	s := NewProcessService()
+	sent := map[int]syscall.Signal{}
+	s.kill = func(pid int, sig syscall.Signal) error {
+		sent[pid] = sig
+		return nil
+	}
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/processes/signal", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		s.HandleSignal(rr, req)
+		return rr
+	}
+
+	rr := send(`{"signal":"TERM","targets":[{"pid":10},{"pid":11,"signal":"KILL"}],"pids":[12]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if sent[10] != syscall.SIGTERM || sent[11] != syscall.SIGKILL || sent[12] != syscall.SIGTERM {
+		t.Fatalf("unexpected signals: %v", sent)
+	}
+	var resp signalResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	got := map[int]string{}
+	for _, r := range resp.Results {
+		got[r.PID] = r.Signal
+	}
+	if got[10] != "TERM" || got[11] != "KILL" || got[12] != "TERM" {
+		t.Fatalf("unexpected results: %#v", resp.Results)
+	}
+
+	// Without a top-level signal every target needs its own.
+	clear(sent)
+	if rr := send(`{"targets":[{"pid":10,"signal":"HUP"},{"pid":11}]}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a target without signal, got %d", rr.Code)
+	}
+	if rr := send(`{"targets":[{"pid":10,"signal":"TERM"},{"pid":10,"signal":"KILL"}]}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for conflicting signals, got %d", rr.Code)
+	}
+	if len(sent) != 0 {
+		t.Fatalf("rejected batches must not signal anything: %v", sent)
+	}
+}
+
+func TestProcessHandleDetailsEnv(t *testing.T) {
+	t.Parallel()
+
+	env := parseEnviron([]byte("PATH=/bin\x00DB_PASSWORD=hunter2\x00api_key=x\x00EMPTY=\x00"), true)
+	if len(env) != 4 || env[0] != (processEnvVar{Name: "PATH", Value: "/bin"}) {
+		t.Fatalf("unexpected env: %+v", env)
+	}
+	if !env[1].Redacted || env[1].Value != "" || !env[2].Redacted || env[2].Value != "" {
+		t.Fatalf("secrets must be redacted: %+v", env)
+	}
+	if env := parseEnviron([]byte("PATH=/bin\x00"), false); env[0].Value != "" || env[0].Redacted {
+		t.Fatalf("values must be hidden: %+v", env)
+	}
+
+	s := NewProcessService()
+	get := func(info *auth.UserInfo, query string) (int, processDetailsResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/api/processes/details?"+query, nil)
+		if info != nil {
+			req = req.WithContext(auth.WithClaims(req.Context(), auth.Claims{UserInfo: *info}))
+		}
+		rr := httptest.NewRecorder()
+		s.HandleDetails(rr, req)
+		var out processDetailsResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &out)
+		return rr.Code, out
+	}
+	self := "pid=" + strconv.Itoa(os.Getpid())
+
+	if code, out := get(nil, self); code != http.StatusOK || out.PID != os.Getpid() || out.Env != nil {
+		t.Fatalf("details: %d %+v", code, out)
+	}
+	if code, _ := get(&auth.UserInfo{User: "u", Role: "user"}, self+"&env=1"); code != http.StatusForbidden {
+		t.Fatalf("env without process permission: %d", code)
+	}
+	if code, _ := get(nil, "pid=abc"); code != http.StatusBadRequest {
+		t.Fatalf("bad pid: %d", code)
+	}
+
+	find := func(env []processEnvVar, name string) (processEnvVar, bool) {
+		for _, v := range env {
+			if v.Name == name {
+				return v, true
+			}
+		}
+		return processEnvVar{}, false
+	}
+	_, out := get(&auth.UserInfo{User: "u", Role: "user", CanProcs: true}, self+"&env=1")
+	if v, ok := find(out.Env, "PATH"); !ok || v.Value != "" {
+		t.Fatalf("non-admin should see names only: %+v %q", v, out.EnvError)
+	}
+	_, out = get(&auth.UserInfo{User: "a", Role: "admin", CanProcs: true}, self+"&env=1")
+	if v, ok := find(out.Env, "PATH"); !ok || v.Value == "" {
+		t.Fatalf("admin should see values: %+v %q", v, out.EnvError)
+	}
+}
@@ -1,9 +1,13 @@
 package system
 
 import (
+	"errors"
 	"os"
+	"os/user"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParseSignal(t *testing.T) {
@@ -56,3 +60,112 @@ func TestReadTotalCPUJiffies(t *testing.T) {
 		t.Fatalf("total=%d", total)
 	}
 }
+
+func TestSplitCmdline(t *testing.T) {
+	t.Parallel()
+
+	got := splitCmdline([]byte("/usr/bin/python3\x00-c\x00print('a b')\x00\x00x\x00"))
+	want := []string{"/usr/bin/python3", "-c", "print('a b')", "", "x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("splitCmdline = %q, want %q", got, want)
+	}
+	if got := splitCmdline(nil); got != nil {
+		t.Fatalf("empty cmdline = %q", got)
+	}
+}
+
+func TestProcessTruncateCommand(t *testing.T) {
+	t.Parallel()
+
+	p := Process{Command: "java -jar app.jar", Args: []string{"java", "-jar", "app.jar"}}
+	p.truncateCommand(100)
+	if p.CommandTruncated || p.Command != "java -jar app.jar" || len(p.Args) != 3 {
+		t.Fatalf("short command changed: %+v", p)
+	}
+
+	p.truncateCommand(11)
+	if !p.CommandTruncated || p.Command != "java -jar a…" {
+		t.Fatalf("truncated command = %+v", p)
+	}
+	if want := []string{"java", "-jar"}; !reflect.DeepEqual(p.Args, want) {
+		t.Fatalf("args = %q, want %q", p.Args, want)
+	}
+
+	// Cut on a rune boundary, never inside a multi-byte character.
+	p = Process{Command: "aéé", Args: []string{"aéé"}}
+	p.truncateCommand(2)
+	if p.Command != "a…" || !reflect.DeepEqual(p.Args, []string{"a…"}) {
+		t.Fatalf("utf-8 truncation = %+v", p)
+	}
+}
+
+func TestProcessUserNameFallsBackToNSS(t *testing.T) {
+	t.Parallel()
+
+	calls := map[string]int{}
+	s := &ProcessService{
+		passwdAt:  time.Now(),
+		uidToUser: map[uint32]string{0: "root"},
+		lookupUID: func(uid string) (*user.User, error) {
+			calls[uid]++
+			if uid == "5001" {
+				return &user.User{Uid: uid, Username: "ldapuser"}, nil
+			}
+			return nil, errors.New("unknown uid")
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if got := s.userName(0); got != "root" {
+			t.Fatalf("uid 0: got %q", got)
+		}
+		if got := s.userName(5001); got != "ldapuser" {
+			t.Fatalf("uid 5001: got %q", got)
+		}
+		if got := s.userName(6000); got != "" {
+			t.Fatalf("uid 6000: got %q", got)
+		}
+	}
+	want := map[string]int{"5001": 1, "6000": 1}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("lookups=%v want %v (file hits must not query NSS; results must be cached)", calls, want)
+	}
+}
+
+func TestProcessPasswdCacheTTLAndInvalidate(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "passwd")
+	write := func(name string) {
+		if err := os.WriteFile(path, []byte(name+":x:5001:5001::/home/x:/bin/sh\n"), 0o644); err != nil {
+			t.Fatalf("write passwd: %v", err)
+		}
+	}
+	write("alice")
+	s := NewProcessService()
+	s.passwdPath = path
+	s.lookupUID = func(string) (*user.User, error) { return nil, errors.New("unknown uid") }
+	s.SetPasswdTTL(time.Hour)
+	name := func() string {
+		s.loadPasswd()
+		return s.userName(5001)
+	}
+
+	if got := name(); got != "alice" {
+		t.Fatalf("got %q", got)
+	}
+	write("bob")
+	if got := name(); got != "alice" {
+		t.Fatalf("expected cached name, got %q", got)
+	}
+	s.InvalidatePasswd()
+	if got := name(); got != "bob" {
+		t.Fatalf("expected reloaded name after invalidation, got %q", got)
+	}
+
+	s.SetPasswdTTL(time.Nanosecond)
+	write("carol")
+	time.Sleep(time.Millisecond)
+	if got := name(); got != "carol" {
+		t.Fatalf("expected reload after TTL, got %q", got)
+	}
+}
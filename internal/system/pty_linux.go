@@ -85,3 +85,17 @@ func ioctl(fd int, req, arg uintptr) error {
 	}
 	return nil
 }
+
+// passwordMode reports whether the PTY looks like it is reading a secret: echo is off
+// while canonical mode is on (getpass, sudo). Readline disables both, so shell input
+// is not affected.
+func passwordMode(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	var tio syscall.Termios
+	if err := ioctl(int(f.Fd()), syscall.TCGETS, uintptr(unsafe.Pointer(&tio))); err != nil {
+		return true
+	}
+	return tio.Lflag&syscall.ECHO == 0 && tio.Lflag&syscall.ICANON != 0
+}
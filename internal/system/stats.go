@@ -2,6 +2,7 @@ package system
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,19 +14,35 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/MrTeeett/atlas/internal/units"
 )
 
 type StatsService struct {
 	mu   sync.Mutex
 	prev statsSample
+
+	// last is the most recent sample, returned for polls within ?min_interval.
+	last    Stats
+	lastAt  time.Time
+	lastSeq uint64
+
+	// procRoot and statfsPath default to /proc and /; tests point them elsewhere.
+	procRoot   string
+	statfsPath string
+	// warmup is the minimum gap between the samples of ?blocking=1 (0: statsWarmup).
+	warmup time.Duration
 }
 
 type statsSample struct {
 	at       time.Time
+	cpuOK    bool
 	cpuTotal uint64
 	cpuIdle  uint64
+	netOK    bool
 	netRx    uint64
 	netTx    uint64
+	disks    map[string]diskCounters
 }
 
 type Stats struct {
@@ -44,49 +61,202 @@ type Stats struct {
 
 	NetRxBytesS float64 `json:"net_rx_bytes_s"`
 	NetTxBytesS float64 `json:"net_tx_bytes_s"`
+
+	// Disks lists I/O rates of whole block devices (empty if /proc/diskstats is unavailable).
+	Disks []DiskIOStat `json:"disks"`
+
+	// Errors maps failed probes ("cpu", "mem", "disk", "net", "disk_io") to the reason;
+	// their fields are zero.
+	Errors map[string]string `json:"errors,omitempty"`
+
+	// Cached is set when a previous sample was returned because of ?min_interval.
+	Cached bool `json:"cached,omitempty"`
+
+	// Human holds formatted copies of the byte values, only with ?human=1.
+	Human *StatsHuman `json:"human,omitempty"`
+}
+
+type StatsHuman struct {
+	MemTotal  string `json:"mem_total"`
+	MemUsed   string `json:"mem_used"`
+	DiskTotal string `json:"disk_total"`
+	DiskUsed  string `json:"disk_used"`
+	NetRx     string `json:"net_rx"`
+	NetTx     string `json:"net_tx"`
 }
 
 func NewStatsService() *StatsService {
 	return &StatsService{}
 }
 
+// statsWarmup is how far apart ?blocking=1 takes its two samples at least.
+const statsWarmup = 200 * time.Millisecond
+
+// maxStatsMinInterval caps ?min_interval so a client can't pin a stale sample forever.
+const maxStatsMinInterval = time.Minute
+
+// HandleStats computes a fresh sample. With ?min_interval=2s (or =2) a sample younger
+// than that is reused instead (marked cached), and a matching If-None-Match yields 304.
+// CPU and network rates are deltas since the previous sample, so the first one is zero;
+// ?blocking=1 takes a second sample ~200ms later instead of returning that.
 func (s *StatsService) HandleStats(w http.ResponseWriter, r *http.Request) {
-	st, err := s.collect()
+	minInterval, err := parseMinInterval(r.URL.Query().Get("min_interval"))
+	if err != nil {
+		http.Error(w, "bad min_interval", http.StatusBadRequest)
+		return
+	}
+	blocking := r.URL.Query().Get("blocking") == "1"
+	st, seq, err := s.sample(r.Context(), minInterval, blocking)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	etag := `"` + strconv.FormatUint(seq, 10) + `"`
+	w.Header().Set("ETag", etag)
+	if st.Cached && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if units.HumanRequested(r) {
+		st.Human = &StatsHuman{
+			MemTotal:  units.HumanizeBytes(st.MemTotalBytes),
+			MemUsed:   units.HumanizeBytes(st.MemUsedBytes),
+			DiskTotal: units.HumanizeBytes(st.DiskTotalBytes),
+			DiskUsed:  units.HumanizeBytes(st.DiskUsedBytes),
+			NetRx:     units.HumanizeRate(st.NetRxBytesS),
+			NetTx:     units.HumanizeRate(st.NetTxBytesS),
+		}
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_ = json.NewEncoder(w).Encode(st)
 }
 
+// sample returns the last sample if it is younger than minInterval, otherwise a fresh
+// one (after warmUp if blocking); seq identifies the sample for ETags.
+func (s *StatsService) sample(ctx context.Context, minInterval time.Duration, blocking bool) (Stats, uint64, error) {
+	if minInterval > 0 {
+		s.mu.Lock()
+		if !s.lastAt.IsZero() && time.Since(s.lastAt) < minInterval {
+			st, seq := s.last, s.lastSeq
+			s.mu.Unlock()
+			st.Cached = true
+			return st, seq, nil
+		}
+		s.mu.Unlock()
+	}
+	if blocking {
+		if err := s.warmUp(ctx); err != nil {
+			return Stats{}, 0, err
+		}
+	}
+	st, err := s.collect()
+	if err != nil {
+		return Stats{}, 0, err
+	}
+	s.mu.Lock()
+	s.lastSeq++
+	s.last, s.lastAt = st, time.Now()
+	seq := s.lastSeq
+	s.mu.Unlock()
+	return st, seq, nil
+}
+
+// warmUp makes sure the previous sample is at least warmup old, taking one first if
+// there is none, so the next collect has real rates.
+func (s *StatsService) warmUp(ctx context.Context) error {
+	warmup := s.warmup
+	if warmup <= 0 {
+		warmup = statsWarmup
+	}
+	s.mu.Lock()
+	at := s.prev.at
+	s.mu.Unlock()
+	if at.IsZero() {
+		if _, err := s.collect(); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		at = s.prev.at
+		s.mu.Unlock()
+	}
+	wait := warmup - time.Since(at)
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func parseMinInterval(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, ferr := strconv.ParseFloat(v, 64)
+		if ferr != nil || !(secs >= 0) {
+			return 0, err
+		}
+		d = time.Duration(min(secs, maxStatsMinInterval.Seconds()) * float64(time.Second))
+	}
+	if d < 0 {
+		return 0, errors.New("negative interval")
+	}
+	return min(d, maxStatsMinInterval), nil
+}
+
 func (s *StatsService) Collect() (Stats, error) {
 	return s.collect()
 }
 
 func (s *StatsService) collect() (Stats, error) {
 	now := time.Now()
+	proc := s.procRoot
+	if proc == "" {
+		proc = "/proc"
+	}
+	statfsPath := s.statfsPath
+	if statfsPath == "" {
+		statfsPath = "/"
+	}
+	// Each probe is best-effort: a hidden /proc file in a hardened container only zeroes
+	// its own section and is reported in Errors.
+	errs := map[string]string{}
 
-	total, idle, cores, err := readCPUStat("/proc/stat")
+	total, idle, cores, err := readCPUStat(filepath.Join(proc, "stat"))
+	cpuOK := err == nil
 	if err != nil {
-		return Stats{}, err
+		errs["cpu"] = err.Error()
 	}
 
-	memTotal, memAvail, err := readMemInfo("/proc/meminfo")
+	memTotal, memAvail, err := readMemInfo(filepath.Join(proc, "meminfo"))
 	if err != nil {
-		return Stats{}, err
+		errs["mem"] = err.Error()
 	}
 	memUsed := memTotal - memAvail
 
-	diskTotal, diskAvail, err := statFS("/")
+	diskTotal, diskAvail, err := statFS(statfsPath)
 	if err != nil {
-		return Stats{}, err
+		errs["disk"] = err.Error()
 	}
 	diskUsed := diskTotal - diskAvail
 
-	netRx, netTx, err := readNetDev("/proc/net/dev")
+	netRx, netTx, err := readNetDev(filepath.Join(proc, "net", "dev"))
+	netOK := err == nil
+	if err != nil {
+		errs["net"] = err.Error()
+	}
+
+	disks, err := readDiskStats(filepath.Join(proc, "diskstats"), isWholeDisk)
 	if err != nil {
-		return Stats{}, err
+		errs["disk_io"] = err.Error()
 	}
 
 	var cpuUsagePct float64
@@ -95,18 +265,27 @@ func (s *StatsService) collect() (Stats, error) {
 
 	s.mu.Lock()
 	prev := s.prev
-	s.prev = statsSample{at: now, cpuTotal: total, cpuIdle: idle, netRx: netRx, netTx: netTx}
+	s.prev = statsSample{at: now, cpuOK: cpuOK, cpuTotal: total, cpuIdle: idle, netOK: netOK, netRx: netRx, netTx: netTx, disks: disks}
 	s.mu.Unlock()
 
+	var diskIO []DiskIOStat
+	if prev.at.IsZero() {
+		diskIO = diskRates(nil, disks, 0)
+	} else {
+		diskIO = diskRates(prev.disks, disks, now.Sub(prev.at))
+	}
+
 	if !prev.at.IsZero() {
-		if dTotal := total - prev.cpuTotal; dTotal > 0 {
-			dIdle := idle - prev.cpuIdle
-			cpuUsagePct = (float64(dTotal-dIdle) / float64(dTotal)) * 100
+		if cpuOK && prev.cpuOK {
+			if dTotal := total - prev.cpuTotal; dTotal > 0 {
+				dIdle := idle - prev.cpuIdle
+				cpuUsagePct = (float64(dTotal-dIdle) / float64(dTotal)) * 100
+			}
 		}
 		secs := now.Sub(prev.at).Seconds()
-		if secs > 0 {
-			rxPerS = float64(netRx-prev.netRx) / secs
-			txPerS = float64(netTx-prev.netTx) / secs
+		if secs > 0 && netOK && prev.netOK {
+			rxPerS = float64(counterDelta(netRx, prev.netRx)) / secs
+			txPerS = float64(counterDelta(netTx, prev.netTx)) / secs
 		}
 	}
 
@@ -120,7 +299,7 @@ func (s *StatsService) collect() (Stats, error) {
 		diskUsedPct = (float64(diskUsed) / float64(diskTotal)) * 100
 	}
 
-	return Stats{
+	st := Stats{
 		TimeUnix: now.Unix(),
 
 		CPUCores:    cores,
@@ -136,7 +315,13 @@ func (s *StatsService) collect() (Stats, error) {
 
 		NetRxBytesS: rxPerS,
 		NetTxBytesS: txPerS,
-	}, nil
+
+		Disks: diskIO,
+	}
+	if len(errs) > 0 {
+		st.Errors = errs
+	}
+	return st, nil
 }
 
 func readCPUStat(path string) (total uint64, idle uint64, cores int, _ error) {
@@ -1,9 +1,13 @@
 package system
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestReadCPUStatParsesTotalsAndCores(t *testing.T) {
@@ -73,3 +77,161 @@ wlan0: 5 0 0 0 0 0 0 0 7 0 0 0 0 0 0 0
 		t.Fatalf("rx=%d tx=%d", rx, tx)
 	}
 }
+
+func TestReadDiskStatsAndRates(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "diskstats")
+	write := func(data string) {
+		if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	keep := func(name string) bool { return name == "sda" || name == "nvme0n1" }
+
+	write(`   8       0 sda 100 0 2000 50 10 0 4000 20 0 100 70
+   8       1 sda1 90 0 1800 40 10 0 4000 20 0 90 60
+   7       0 loop0 5 0 10 1 0 0 0 0 0 1 1
+ 259       0 nvme0n1 1 0 8 1 1 0 8 1 0 1 2
+`)
+	first, err := readDiskStats(p, keep)
+	if err != nil {
+		t.Fatalf("readDiskStats: %v", err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("expected 2 devices, got %v", first)
+	}
+	if got := diskRates(nil, first, 0); len(got) != 2 || got[1].ReadBytesS != 0 {
+		t.Fatalf("first sample should have zero rates: %+v", got)
+	}
+
+	write(`   8       0 sda 200 0 4048 50 20 0 5024 20 0 600 70
+ 259       0 nvme0n1 0 0 0 0 0 0 0 0 0 0 0
+`)
+	second, err := readDiskStats(p, keep)
+	if err != nil {
+		t.Fatalf("readDiskStats: %v", err)
+	}
+	rates := diskRates(first, second, 2*time.Second)
+	if len(rates) != 2 || rates[0].Device != "nvme0n1" || rates[1].Device != "sda" {
+		t.Fatalf("unexpected order: %+v", rates)
+	}
+	sda := rates[1]
+	if sda.ReadBytesS != 2048*512/2 || sda.WriteBytesS != 1024*512/2 || sda.UtilPct != 25 {
+		t.Fatalf("sda rates: %+v", sda)
+	}
+	if nv := rates[0]; nv.ReadBytesS != 0 || nv.WriteBytesS != 0 || nv.UtilPct != 0 {
+		t.Fatalf("reset counters should read as idle: %+v", nv)
+	}
+}
+
+func TestCollectReportsMissingProbes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "meminfo"), []byte("MemTotal: 1000 kB\nMemAvailable: 250 kB\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	s := &StatsService{procRoot: dir, statfsPath: filepath.Join(dir, "missing")}
+
+	for i := 0; i < 2; i++ {
+		st, err := s.collect()
+		if err != nil {
+			t.Fatalf("collect: %v", err)
+		}
+		for _, k := range []string{"cpu", "disk", "net", "disk_io"} {
+			if st.Errors[k] == "" {
+				t.Fatalf("expected %s error, got %#v", k, st.Errors)
+			}
+		}
+		if _, ok := st.Errors["mem"]; ok {
+			t.Fatalf("unexpected mem error: %q", st.Errors["mem"])
+		}
+		if st.MemTotalBytes != 1000*1024 || st.MemUsedBytes != 750*1024 {
+			t.Fatalf("unexpected mem: total=%d used=%d", st.MemTotalBytes, st.MemUsedBytes)
+		}
+		if st.CPUUsagePct != 0 || st.NetRxBytesS != 0 || st.DiskTotalBytes != 0 {
+			t.Fatalf("expected zeroed fields, got %+v", st)
+		}
+	}
+}
+
+func TestHandleStatsMinInterval(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := &StatsService{procRoot: dir, statfsPath: dir}
+
+	get := func(query, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/stats"+query, nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		s.HandleStats(w, r)
+		return w
+	}
+
+	w1 := get("", "")
+	w2 := get("", "")
+	if w1.Header().Get("ETag") == w2.Header().Get("ETag") || strings.Contains(w2.Body.String(), `"cached"`) {
+		t.Fatalf("default polls must be fresh: %q %q", w1.Header().Get("ETag"), w2.Header().Get("ETag"))
+	}
+
+	w3 := get("?min_interval=30s", "")
+	if w3.Code != http.StatusOK || w3.Header().Get("ETag") != w2.Header().Get("ETag") || !strings.Contains(w3.Body.String(), `"cached":true`) {
+		t.Fatalf("expected cached sample, status=%d etag=%q body=%q", w3.Code, w3.Header().Get("ETag"), w3.Body.String())
+	}
+	if w := get("?min_interval=30", w3.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", w.Code)
+	}
+	if w := get("?min_interval=-1", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestHandleStatsBlockingFirstRead(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	// replace swaps a /proc file atomically, so a concurrent read never sees it half written.
+	replace := func(name, data string) {
+		tmp := filepath.Join(dir, name+".tmp")
+		if err := os.WriteFile(tmp, []byte(data), 0o600); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	replace("stat", "cpu  100 0 0 100 0 0 0 0 0 0\n")
+	s := &StatsService{procRoot: dir, statfsPath: dir, warmup: 300 * time.Millisecond}
+
+	// Busy 75% of the time while the request waits between its two samples.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		replace("stat", "cpu  175 0 0 125 0 0 0 0 0 0\n")
+	}()
+	start := time.Now()
+	w := httptest.NewRecorder()
+	s.HandleStats(w, httptest.NewRequest(http.MethodGet, "/api/stats?blocking=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", w.Code, w.Body.String())
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Fatalf("blocking first read returned after %v", d)
+	}
+	if !strings.Contains(w.Body.String(), `"cpu_usage_pct":75`) {
+		t.Fatalf("expected delta-based cpu usage, got %q", w.Body.String())
+	}
+
+	// With a baseline old enough, blocking doesn't wait again.
+	time.Sleep(300 * time.Millisecond)
+	start = time.Now()
+	s.HandleStats(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/stats?blocking=1", nil))
+	if d := time.Since(start); d >= 300*time.Millisecond {
+		t.Fatalf("second blocking read waited %v", d)
+	}
+}
@@ -7,12 +7,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -29,19 +29,45 @@ type TerminalConfig struct {
 	SudoEnabled bool
 	SudoAny     bool
 	SudoUsers   []string
+	// HelperBinary is the atlas binary used as `fs-helper` (default: os.Executable).
+	HelperBinary string
 
 	// Limits
 	TailBytes  int
 	SessionTTL time.Duration
+	// MaxLifetime closes a session this long after creation, even if active (0: no cap).
+	MaxLifetime time.Duration
+	// MaxSessionsPerUser/MaxTotalSessions cap concurrent sessions (0: unlimited).
+	MaxSessionsPerUser int
+	MaxTotalSessions   int
+
+	// ExtraEnv is set in every session after the built-in TERM/COLORTERM/ATLAS vars.
+	ExtraEnv map[string]string
+	// EnvBlocklist drops inherited variables by name ("AWS_*" matches a prefix).
+	EnvBlocklist []string
+	// CleanEnv starts sessions from a minimal environment instead of os.Environ().
+	CleanEnv bool
+
+	// StreamBuffer is the number of output chunks queued per stream client (default 128).
+	// Values below 2 are raised to 2: resuming a client after drops queues two chunks.
+	StreamBuffer int
+	// StreamBlock is how long output waits for a client whose queue is full before the
+	// client is marked as lagging and its output dropped (default 200ms).
+	StreamBlock time.Duration
 }
 
 type TerminalService struct {
 	cfg      TerminalConfig
 	sudoPath string
 	shell    string
+	// helperPath is the atlas binary, used as `fs-helper` to list directories as another user.
+	helperPath string
 
 	mu       sync.Mutex
 	sessions map[string]*termSession
+	// total and perUser include sessions that are still starting.
+	total   int
+	perUser map[string]int
 
 	cmdIdxMu  sync.Mutex
 	cmdIdx    *cmdIndex
@@ -51,17 +77,29 @@ type TerminalService struct {
 }
 
 type termSession struct {
-	id  string
-	as  string
-	pty ptyPair
-	cmd *exec.Cmd
+	id      string
+	as      string
+	owner   string
+	created time.Time
+	pty     ptyPair
+	cmd     *exec.Cmd
+	// encoding is termEncodingRaw or termEncodingUTF8; utf8 is set for the latter.
+	encoding string
+	utf8     *utf8Normalizer
 
 	mu     sync.Mutex
 	closed bool
 	tail   []byte
-	subs   map[chan []byte]struct{}
+	// subs maps each stream client's channel to whether it has dropped output that
+	// has not been reported to it yet.
+	subs map[chan []byte]bool
 
 	lastActive time.Time
+
+	// history holds command lines typed into the session (see recordInput).
+	history   []string
+	lineBuf   []byte
+	lineDirty bool
 }
 
 func NewTerminalService(cfg TerminalConfig) *TerminalService {
@@ -71,16 +109,30 @@ func NewTerminalService(cfg TerminalConfig) *TerminalService {
 	if cfg.SessionTTL <= 0 {
 		cfg.SessionTTL = 30 * time.Minute
 	}
+	if cfg.StreamBuffer <= 0 {
+		cfg.StreamBuffer = 128
+	} else if cfg.StreamBuffer < 2 {
+		cfg.StreamBuffer = 2
+	}
+	if cfg.StreamBlock <= 0 {
+		cfg.StreamBlock = 200 * time.Millisecond
+	}
 	sudoPath, _ := exec.LookPath("sudo")
 	shell := "/bin/bash"
 	if p, err := exec.LookPath("bash"); err == nil {
 		shell = p
 	}
+	helperPath := strings.TrimSpace(cfg.HelperBinary)
+	if helperPath == "" {
+		helperPath, _ = os.Executable()
+	}
 	return &TerminalService{
-		cfg:      cfg,
-		sudoPath: sudoPath,
-		shell:    shell,
-		sessions: map[string]*termSession{},
+		cfg:        cfg,
+		sudoPath:   sudoPath,
+		helperPath: helperPath,
+		shell:      shell,
+		sessions:   map[string]*termSession{},
+		perUser:    map[string]int{},
 	}
 }
 
@@ -177,8 +229,9 @@ type createRequest struct {
 }
 
 type createResponse struct {
-	ID string `json:"id"`
-	As string `json:"as"`
+	ID       string `json:"id"`
+	As       string `json:"as"`
+	Encoding string `json:"encoding"`
 }
 
 func (s *TerminalService) HandleCreate(w http.ResponseWriter, r *http.Request) {
@@ -191,10 +244,15 @@ func (s *TerminalService) HandleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req createRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeJSON(w, r, &req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
+	encoding, err := parseTermEncoding(r.URL.Query().Get("encoding"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	as := strings.TrimSpace(req.As)
 	if as == "" || as == "self" {
 		as = "self"
@@ -210,16 +268,28 @@ func (s *TerminalService) HandleCreate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	owner := ""
+	if c, ok := auth.ClaimsFromContext(r.Context()); ok {
+		owner = c.User
+	}
+	if err := s.reserveSession(owner); err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
 	id, err := randomID(18)
 	if err != nil {
+		s.releaseSession(owner)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	sess, err := s.startSession(id, as, req.Cols, req.Rows)
+	sess, err := s.startSession(id, as, req.Cols, req.Rows, encoding)
 	if err != nil {
+		s.releaseSession(owner)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	sess.owner = owner
 
 	s.mu.Lock()
 	s.sessions[id] = sess
@@ -227,7 +297,118 @@ func (s *TerminalService) HandleCreate(w http.ResponseWriter, r *http.Request) {
 
 	s.reaperOnce.Do(func() { go s.reaperLoop() })
 
-	writeJSON(w, createResponse{ID: id, As: as})
+	writeJSON(w, createResponse{ID: id, As: as, Encoding: encoding})
+}
+
+// reserveSession counts a new session for owner, enforcing the configured limits.
+func (s *TerminalService) reserveSession(owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneClosedLocked()
+	if s.cfg.MaxTotalSessions > 0 && s.total >= s.cfg.MaxTotalSessions {
+		return errors.New("too many terminal sessions")
+	}
+	if s.cfg.MaxSessionsPerUser > 0 && s.perUser[owner] >= s.cfg.MaxSessionsPerUser {
+		return errors.New("too many terminal sessions for this user")
+	}
+	s.total++
+	s.perUser[owner]++
+	return nil
+}
+
+func (s *TerminalService) releaseSession(owner string) {
+	s.mu.Lock()
+	s.releaseLocked(owner)
+	s.mu.Unlock()
+}
+
+func (s *TerminalService) releaseLocked(owner string) {
+	if s.total > 0 {
+		s.total--
+	}
+	if s.perUser[owner] <= 1 {
+		delete(s.perUser, owner)
+	} else {
+		s.perUser[owner]--
+	}
+}
+
+// removeSessionLocked forgets a session and releases its slot; it does not close it.
+func (s *TerminalService) removeSessionLocked(id string) {
+	sess := s.sessions[id]
+	if sess == nil {
+		return
+	}
+	delete(s.sessions, id)
+	s.releaseLocked(sess.owner)
+}
+
+// pruneClosedLocked drops sessions whose shell already exited, so they don't count
+// against the limits until the next reaper tick.
+func (s *TerminalService) pruneClosedLocked() {
+	for id, sess := range s.sessions {
+		sess.mu.Lock()
+		closed := sess.closed
+		sess.mu.Unlock()
+		if closed {
+			s.removeSessionLocked(id)
+		}
+	}
+}
+
+type sessionInfo struct {
+	ID             string `json:"id"`
+	As             string `json:"as"`
+	Encoding       string `json:"encoding"`
+	CreatedUnix    int64  `json:"created_unix"`
+	LastActiveUnix int64  `json:"last_active_unix"`
+}
+
+type sessionsResponse struct {
+	Sessions           []sessionInfo `json:"sessions"`
+	UserCount          int           `json:"user_count"`
+	TotalCount         int           `json:"total_count"`
+	MaxSessionsPerUser int           `json:"max_sessions_per_user,omitempty"`
+	MaxTotalSessions   int           `json:"max_total_sessions,omitempty"`
+}
+
+// HandleList lists the caller's sessions together with the current session counts.
+func (s *TerminalService) HandleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	owner := ""
+	if c, ok := auth.ClaimsFromContext(r.Context()); ok {
+		owner = c.User
+	}
+	resp := sessionsResponse{
+		Sessions:           []sessionInfo{},
+		MaxSessionsPerUser: s.cfg.MaxSessionsPerUser,
+		MaxTotalSessions:   s.cfg.MaxTotalSessions,
+	}
+	s.mu.Lock()
+	s.pruneClosedLocked()
+	resp.UserCount = s.perUser[owner]
+	resp.TotalCount = s.total
+	for _, sess := range s.sessions {
+		if sess.owner != owner {
+			continue
+		}
+		sess.mu.Lock()
+		last := sess.lastActive
+		sess.mu.Unlock()
+		resp.Sessions = append(resp.Sessions, sessionInfo{
+			ID:             sess.id,
+			As:             sess.as,
+			Encoding:       sess.encoding,
+			CreatedUnix:    sess.created.Unix(),
+			LastActiveUnix: last.Unix(),
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(resp.Sessions, func(i, j int) bool { return resp.Sessions[i].CreatedUnix < resp.Sessions[j].CreatedUnix })
+	writeJSON(w, resp)
 }
 
 func (s *TerminalService) validateAs(r *http.Request, as string) error {
@@ -283,7 +464,7 @@ func (s *TerminalService) validateAs(r *http.Request, as string) error {
 	return nil
 }
 
-func (s *TerminalService) startSession(id, as string, cols, rows int) (*termSession, error) {
+func (s *TerminalService) startSession(id, as string, cols, rows int, encoding string) (*termSession, error) {
 	pty, err := openPTY(cols, rows)
 	if err != nil {
 		return nil, err
@@ -301,13 +482,7 @@ func (s *TerminalService) startSession(id, as string, cols, rows int) (*termSess
 		// Minimal Ubuntu images often lack xterm-256color terminfo, which disables colors in many shells/tools.
 		term = "xterm"
 	}
-	env := stripEnv(os.Environ(), "TERM=", "COLORTERM=")
-	env = append(env,
-		"TERM="+term,
-		"COLORTERM=truecolor",
-		"ATLAS=1",
-	)
-	cmd.Env = env
+	cmd.Env = s.sessionEnv(os.Environ(), term)
 
 	// Attach to slave side.
 	cmd.Stdin = pty.slave
@@ -335,10 +510,15 @@ func (s *TerminalService) startSession(id, as string, cols, rows int) (*termSess
 		as:         as,
 		pty:        pty,
 		cmd:        cmd,
-		subs:       map[chan []byte]struct{}{},
+		encoding:   encoding,
+		subs:       map[chan []byte]bool{},
+		created:    time.Now(),
 		lastActive: time.Now(),
 	}
-	go sess.readLoop(s.cfg.TailBytes)
+	if encoding == termEncodingUTF8 {
+		sess.utf8 = &utf8Normalizer{}
+	}
+	go sess.readLoop(s.cfg.TailBytes, s.cfg.StreamBlock)
 	return sess, nil
 }
 
@@ -383,6 +563,49 @@ func hasTerminfo(term string) bool {
 	return false
 }
 
+// cleanEnvKeep lists the variables kept from the process environment when CleanEnv is set.
+var cleanEnvKeep = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG"}
+
+func (s *TerminalService) sessionEnv(base []string, term string) []string {
+	var env []string
+	if s.cfg.CleanEnv {
+		for _, e := range base {
+			name, _, _ := strings.Cut(e, "=")
+			if slices.Contains(cleanEnvKeep, name) {
+				env = append(env, e)
+			}
+		}
+	} else {
+		env = append(env, base...)
+	}
+
+	drop := []string{"TERM=", "COLORTERM="}
+	for _, name := range s.cfg.EnvBlocklist {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			drop = append(drop, prefix)
+		} else {
+			drop = append(drop, name+"=")
+		}
+	}
+	env = stripEnv(env, drop...)
+	env = append(env,
+		"TERM="+term,
+		"COLORTERM=truecolor",
+		"ATLAS=1",
+	)
+
+	names := make([]string, 0, len(s.cfg.ExtraEnv))
+	for name := range s.cfg.ExtraEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = stripEnv(env, name+"=")
+		env = append(env, name+"="+s.cfg.ExtraEnv[name])
+	}
+	return env
+}
+
 func stripEnv(env []string, prefixes ...string) []string {
 	if len(env) == 0 || len(prefixes) == 0 {
 		return env
@@ -415,7 +638,8 @@ func (s *TerminalService) reaperLoop() {
 			closed := sess.closed
 			last := sess.lastActive
 			sess.mu.Unlock()
-			if closed || now.Sub(last) > s.cfg.SessionTTL {
+			expired := s.cfg.MaxLifetime > 0 && now.Sub(sess.created) > s.cfg.MaxLifetime
+			if closed || expired || now.Sub(last) > s.cfg.SessionTTL {
 				dead = append(dead, id)
 			}
 		}
@@ -423,19 +647,32 @@ func (s *TerminalService) reaperLoop() {
 			if sess := s.sessions[id]; sess != nil {
 				_ = sess.close()
 			}
-			delete(s.sessions, id)
+			s.removeSessionLocked(id)
 		}
 		s.mu.Unlock()
 	}
 }
 
-func (t *termSession) readLoop(tailLimit int) {
+// droppedMarker is sent to a stream client before the first chunk it receives after
+// some output had to be dropped for it.
+var droppedMarker = []byte("\r\n\x1b[7m[atlas: output dropped, client too slow]\x1b[0m\r\n")
+
+func (t *termSession) readLoop(tailLimit int, block time.Duration) {
 	defer func() { _ = t.close() }()
 	buf := make([]byte, 32*1024)
 	for {
 		n, err := t.pty.master.Read(buf)
+		var chunk []byte
 		if n > 0 {
-			chunk := append([]byte{}, buf[:n]...)
+			chunk = append([]byte{}, buf[:n]...)
+		}
+		if t.utf8 != nil {
+			chunk = t.utf8.normalize(chunk)
+			if err != nil {
+				chunk = append(chunk, t.utf8.flush()...)
+			}
+		}
+		if len(chunk) > 0 {
 			t.mu.Lock()
 			t.lastActive = time.Now()
 			if tailLimit > 0 {
@@ -446,15 +683,13 @@ func (t *termSession) readLoop(tailLimit int) {
 					} else {
 						t.tail = append([]byte{}, t.tail[drop:]...)
 					}
+					if t.utf8 != nil {
+						t.tail = trimToRuneStart(t.tail)
+					}
 				}
 				t.tail = append(t.tail, chunk...)
 			}
-			for ch := range t.subs {
-				select {
-				case ch <- chunk:
-				default:
-				}
-			}
+			t.publishLocked(chunk, block)
 			t.mu.Unlock()
 		}
 		if err != nil {
@@ -463,6 +698,49 @@ func (t *termSession) readLoop(tailLimit int) {
 	}
 }
 
+// publishLocked queues chunk for every stream client. A client whose queue is full holds
+// up the PTY reader (and with it the command) for at most block; after that its output is
+// dropped until the queue has room again, at which point droppedMarker is queued first.
+func (t *termSession) publishLocked(chunk []byte, block time.Duration) {
+	var timer *time.Timer
+	expired := false
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for ch, dropped := range t.subs {
+		if dropped {
+			// Resume only when both the marker and the chunk fit.
+			if cap(ch)-len(ch) < 2 {
+				continue
+			}
+			ch <- droppedMarker
+			ch <- chunk
+			t.subs[ch] = false
+			continue
+		}
+		select {
+		case ch <- chunk:
+			continue
+		default:
+		}
+		if expired {
+			t.subs[ch] = true
+			continue
+		}
+		if timer == nil {
+			timer = time.NewTimer(block)
+		}
+		select {
+		case ch <- chunk:
+		case <-timer.C:
+			expired = true
+			t.subs[ch] = true
+		}
+	}
+}
+
 func (t *termSession) close() error {
 	t.mu.Lock()
 	if t.closed {
@@ -567,14 +845,14 @@ func (s *TerminalService) handleStream(w http.ResponseWriter, r *http.Request, s
 		return
 	}
 
-	ch := make(chan []byte, 128)
+	ch := make(chan []byte, s.cfg.StreamBuffer)
 	sess.mu.Lock()
 	if sess.closed {
 		sess.mu.Unlock()
 		http.Error(w, "closed", http.StatusGone)
 		return
 	}
-	sess.subs[ch] = struct{}{}
+	sess.subs[ch] = false
 	tail := append([]byte{}, sess.tail...)
 	sess.mu.Unlock()
 
@@ -616,7 +894,7 @@ type writeRequest struct {
 
 func (s *TerminalService) handleWrite(w http.ResponseWriter, r *http.Request, sess *termSession) {
 	var req writeRequest
-	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+	if err := decodeJSON(w, r, &req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -632,6 +910,7 @@ func (s *TerminalService) handleWrite(w http.ResponseWriter, r *http.Request, se
 	sess.mu.Lock()
 	sess.lastActive = time.Now()
 	sess.mu.Unlock()
+	sess.recordInput(raw)
 	_, _ = sess.pty.master.Write(raw)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -643,7 +922,7 @@ type resizeRequest struct {
 
 func (s *TerminalService) handleResize(w http.ResponseWriter, r *http.Request, sess *termSession) {
 	var req resizeRequest
-	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+	if err := decodeJSON(w, r, &req); err != nil {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
@@ -661,7 +940,7 @@ func (s *TerminalService) handleResize(w http.ResponseWriter, r *http.Request, s
 func (s *TerminalService) handleClose(w http.ResponseWriter, r *http.Request, sess *termSession) {
 	_ = sess.close()
 	s.mu.Lock()
-	delete(s.sessions, sess.id)
+	s.removeSessionLocked(sess.id)
 	s.mu.Unlock()
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -673,6 +952,8 @@ type completeResponse struct {
 type completeItem struct {
 	Label  string `json:"label"`
 	Detail string `json:"detail,omitempty"`
+	// Type is "command", "file" or "dir".
+	Type string `json:"type,omitempty"`
 }
 
 func (s *TerminalService) HandleComplete(w http.ResponseWriter, r *http.Request) {
@@ -684,10 +965,52 @@ func (s *TerminalService) HandleComplete(w http.ResponseWriter, r *http.Request)
 	if len(q) > 128 {
 		q = q[:128]
 	}
+	var sess *termSession
+	if id := r.URL.Query().Get("session"); id != "" {
+		sess = s.getSession(id)
+		owner := ""
+		if c, ok := auth.ClaimsFromContext(r.Context()); ok {
+			owner = c.User
+		}
+		if sess == nil || sess.owner != owner {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+	}
+	if looksLikePath(q) {
+		writeJSON(w, completeResponse{Items: s.completePaths(r.Context(), sess, q)})
+		return
+	}
+	var history []completeItem
+	if sess != nil {
+		history = sess.historyMatches(q)
+	}
 	items := s.completeCommands(q)
+	if len(history) > 0 {
+		items = mergeCompletions(history, items, 60)
+	}
 	writeJSON(w, completeResponse{Items: items})
 }
 
+// mergeCompletions puts first before rest, dropping duplicate labels, up to limit items.
+func mergeCompletions(first, rest []completeItem, limit int) []completeItem {
+	seen := map[string]bool{}
+	out := make([]completeItem, 0, min(len(first)+len(rest), limit))
+	for _, list := range [][]completeItem{first, rest} {
+		for _, it := range list {
+			if len(out) >= limit {
+				return out
+			}
+			if seen[it.Label] {
+				continue
+			}
+			seen[it.Label] = true
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
 type cmdIndex struct {
 	names []string
 	where map[string]string
@@ -702,7 +1025,7 @@ func (s *TerminalService) completeCommands(prefix string) []completeItem {
 			continue
 		}
 		detail := idx.where[name]
-		out = append(out, completeItem{Label: name, Detail: detail})
+		out = append(out, completeItem{Label: name, Detail: detail, Type: "command"})
 		if len(out) >= 60 {
 			break
 		}
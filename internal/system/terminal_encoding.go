@@ -0,0 +1,69 @@
+package system
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Terminal output encodings, chosen with ?encoding= when the session is created.
+const (
+	// termEncodingRaw passes PTY output through unchanged (the default).
+	termEncodingRaw = "raw"
+	// termEncodingUTF8 replaces invalid UTF-8 in PTY output with U+FFFD.
+	termEncodingUTF8 = "utf8"
+)
+
+func parseTermEncoding(v string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", termEncodingRaw:
+		return termEncodingRaw, nil
+	case termEncodingUTF8, "utf-8":
+		return termEncodingUTF8, nil
+	}
+	return "", fmt.Errorf("unknown encoding %q (want raw or utf8)", v)
+}
+
+var utf8Replacement = []byte(string(utf8.RuneError))
+
+// utf8Normalizer makes PTY output valid UTF-8. A sequence split across two reads is
+// held back until the next read completes it.
+type utf8Normalizer struct {
+	pending []byte
+}
+
+func (n *utf8Normalizer) normalize(chunk []byte) []byte {
+	b := append(n.pending, chunk...)
+	n.pending = nil
+	cut := len(b)
+	for i := len(b) - 1; i >= 0 && i > len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	if cut < len(b) {
+		n.pending = append([]byte{}, b[cut:]...)
+	}
+	return bytes.ToValidUTF8(b[:cut], utf8Replacement)
+}
+
+// flush returns what is still held back once the PTY is closed.
+func (n *utf8Normalizer) flush() []byte {
+	b := n.pending
+	n.pending = nil
+	return bytes.ToValidUTF8(b, utf8Replacement)
+}
+
+// trimToRuneStart drops leading continuation bytes, left over when the front of the
+// tail buffer was cut in the middle of a character.
+func trimToRuneStart(b []byte) []byte {
+	i := 0
+	for i < len(b) && i < utf8.UTFMax && !utf8.RuneStart(b[i]) {
+		i++
+	}
+	return b[i:]
+}
@@ -0,0 +1,76 @@
+package system
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// termHistoryMax caps the remembered command lines per session.
+	termHistoryMax = 200
+	// termHistoryLineMax drops longer lines (pastes, heredocs) from the history.
+	termHistoryLineMax = 512
+	// termHistorySuggest caps history items in one completion response.
+	termHistorySuggest = 10
+)
+
+// recordInput tracks the line being typed into the PTY and appends it to the session
+// history on Enter. Lines edited with escape sequences (arrows, history recall) and
+// lines typed while the PTY is in password mode are not recorded.
+func (t *termSession) recordInput(raw []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, b := range raw {
+		switch {
+		case b == '\r' || b == '\n':
+			line := strings.TrimSpace(string(t.lineBuf))
+			if line != "" && !t.lineDirty && len(line) <= termHistoryLineMax && utf8.ValidString(line) && !passwordMode(t.pty.master) {
+				t.addHistoryLocked(line)
+			}
+			t.lineBuf = t.lineBuf[:0]
+			t.lineDirty = false
+		case b == 0x7f || b == 0x08: // backspace
+			if n := len(t.lineBuf); n > 0 {
+				_, size := utf8.DecodeLastRune(t.lineBuf)
+				t.lineBuf = t.lineBuf[:n-size]
+			}
+		case b == 0x03 || b == 0x15: // ^C, ^U
+			t.lineBuf = t.lineBuf[:0]
+			t.lineDirty = false
+		case b < 0x20: // escape sequences, tab completion and other controls
+			t.lineDirty = true
+		default:
+			if len(t.lineBuf) <= termHistoryLineMax {
+				t.lineBuf = append(t.lineBuf, b)
+			}
+		}
+	}
+}
+
+func (t *termSession) addHistoryLocked(line string) {
+	if n := len(t.history); n > 0 && t.history[n-1] == line {
+		return
+	}
+	t.history = append(t.history, line)
+	if len(t.history) > termHistoryMax {
+		t.history = append(t.history[:0], t.history[len(t.history)-termHistoryMax:]...)
+	}
+}
+
+// historyMatches returns distinct history lines starting with prefix, most recent first.
+func (t *termSession) historyMatches(prefix string) []completeItem {
+	prefix = strings.ToLower(prefix)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen := map[string]bool{}
+	var out []completeItem
+	for i := len(t.history) - 1; i >= 0 && len(out) < termHistorySuggest; i-- {
+		line := t.history[i]
+		if seen[line] || !strings.HasPrefix(strings.ToLower(line), prefix) {
+			continue
+		}
+		seen[line] = true
+		out = append(out, completeItem{Label: line, Detail: "history", Type: "command"})
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const termPathSuggest = 60
+
+// looksLikePath reports whether a completion query should be completed against the
+// file system instead of command names.
+func looksLikePath(q string) bool {
+	return strings.Contains(q, "/") || strings.HasPrefix(q, "~") || strings.HasPrefix(q, ".")
+}
+
+type pathEntry struct {
+	name  string
+	isDir bool
+}
+
+// completePaths lists directory entries matching q as the session's identity (self when
+// sess is nil). Relative paths resolve against the shell's cwd for self sessions and the
+// user's home directory otherwise.
+func (s *TerminalService) completePaths(ctx context.Context, sess *termSession, q string) []completeItem {
+	as := "self"
+	if sess != nil {
+		as = sess.as
+	}
+	home := homeDirOf(as)
+
+	dirPart, partial := "", q
+	if i := strings.LastIndex(q, "/"); i >= 0 {
+		dirPart, partial = q[:i+1], q[i+1:]
+	}
+	if dirPart == "" && strings.HasPrefix(q, "~") {
+		// "~" or "~name": nothing to list yet, complete to the home directory itself.
+		if q == "~" && home != "" {
+			return []completeItem{{Label: "~/", Detail: home, Type: "dir"}}
+		}
+		return nil
+	}
+
+	dir := dirPart
+	switch {
+	case dir == "":
+		dir = "."
+	case strings.HasPrefix(dir, "~/"):
+		if home == "" {
+			return nil
+		}
+		dir = filepath.Join(home, dir[2:])
+	}
+	if !filepath.IsAbs(dir) {
+		base := home
+		if as == "self" && sess != nil && sess.cmd != nil && sess.cmd.Process != nil {
+			if cwd, err := os.Readlink("/proc/" + strconv.Itoa(sess.cmd.Process.Pid) + "/cwd"); err == nil {
+				base = cwd
+			}
+		}
+		if base == "" {
+			return nil
+		}
+		dir = filepath.Join(base, dir)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	var entries []pathEntry
+	var err error
+	if as == "self" {
+		entries, err = listDirSelf(dir)
+	} else {
+		entries, err = s.listDirAs(ctx, as, dir)
+	}
+	if err != nil {
+		return nil
+	}
+
+	showHidden := strings.HasPrefix(partial, ".")
+	out := make([]completeItem, 0, 16)
+	for _, e := range entries {
+		if !strings.HasPrefix(e.name, partial) || (!showHidden && strings.HasPrefix(e.name, ".")) {
+			continue
+		}
+		it := completeItem{Label: dirPart + e.name, Type: "file"}
+		if e.isDir {
+			it.Label += "/"
+			it.Type = "dir"
+		}
+		out = append(out, it)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i].Type == "dir") != (out[j].Type == "dir") {
+			return out[i].Type == "dir"
+		}
+		return out[i].Label < out[j].Label
+	})
+	if len(out) > termPathSuggest {
+		out = out[:termPathSuggest]
+	}
+	return out
+}
+
+func homeDirOf(as string) string {
+	if as == "self" {
+		h, _ := os.UserHomeDir()
+		return h
+	}
+	u, err := user.Lookup(as)
+	if err != nil {
+		return ""
+	}
+	return u.HomeDir
+}
+
+func listDirSelf(dir string) ([]pathEntry, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]pathEntry, 0, len(des))
+	for _, de := range des {
+		isDir := de.IsDir()
+		if de.Type()&os.ModeSymlink != 0 {
+			if st, err := os.Stat(filepath.Join(dir, de.Name())); err == nil {
+				isDir = st.IsDir()
+			}
+		}
+		out = append(out, pathEntry{name: de.Name(), isDir: isDir})
+	}
+	return out, nil
+}
+
+// listDirAs lists dir through the fs helper running as another user, so completion
+// only shows what that user could see.
+func (s *TerminalService) listDirAs(ctx context.Context, as, dir string) ([]pathEntry, error) {
+	if s.sudoPath == "" || s.helperPath == "" {
+		return nil, os.ErrNotExist
+	}
+	cmd := exec.CommandContext(ctx, s.sudoPath, "-n", "-u", as, s.helperPath, "fs-helper", "--root", "/", "list", "--path", dir)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Entries []struct {
+			Name  string `json:"name"`
+			IsDir bool   `json:"is_dir"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, err
+	}
+	entries := make([]pathEntry, 0, len(resp.Entries))
+	for _, e := range resp.Entries {
+		entries = append(entries, pathEntry{name: e.Name, isDir: e.IsDir})
+	}
+	return entries, nil
+}
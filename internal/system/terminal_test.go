@@ -6,7 +6,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/MrTeeett/atlas/internal/auth"
 )
@@ -101,3 +108,255 @@ func TestTerminalValidateAs(t *testing.T) {
 		t.Fatalf("expected ok, got %v", err)
 	}
 }
+
+func TestTerminalSessionLimits(t *testing.T) {
+	t.Parallel()
+
+	s := NewTerminalService(TerminalConfig{Enabled: true, MaxSessionsPerUser: 2, MaxTotalSessions: 3})
+	if err := s.reserveSession("alice"); err != nil {
+		t.Fatalf("reserve 1: %v", err)
+	}
+	if err := s.reserveSession("alice"); err != nil {
+		t.Fatalf("reserve 2: %v", err)
+	}
+	if err := s.reserveSession("alice"); err == nil {
+		t.Fatalf("expected per-user limit")
+	}
+	if err := s.reserveSession("bob"); err != nil {
+		t.Fatalf("reserve bob: %v", err)
+	}
+	if err := s.reserveSession("carol"); err == nil {
+		t.Fatalf("expected total limit")
+	}
+	s.releaseSession("alice")
+	if err := s.reserveSession("carol"); err != nil {
+		t.Fatalf("reserve after release: %v", err)
+	}
+
+	// A closed session is pruned and frees its slot.
+	s.mu.Lock()
+	s.sessions["x"] = &termSession{id: "x", owner: "bob", closed: true, subs: map[chan []byte]bool{}}
+	s.mu.Unlock()
+
+	ctx := auth.WithClaims(context.Background(), auth.Claims{UserInfo: auth.UserInfo{User: "bob"}})
+	req := httptest.NewRequest(http.MethodGet, "http://example/api/term/sessions", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	s.HandleList(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d", rr.Code)
+	}
+	var resp sessionsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if resp.UserCount != 0 || resp.TotalCount != 2 || resp.MaxSessionsPerUser != 2 {
+		t.Fatalf("resp=%#v", resp)
+	}
+}
+
+func TestTerminalSessionEnv(t *testing.T) {
+	t.Parallel()
+
+	base := []string{"PATH=/bin", "HOME=/root", "TERM=dumb", "SECRET_TOKEN=x", "AWS_KEY=y", "LANG=C", "FOO=1"}
+
+	s := NewTerminalService(TerminalConfig{Enabled: true})
+	want := []string{"PATH=/bin", "HOME=/root", "SECRET_TOKEN=x", "AWS_KEY=y", "LANG=C", "FOO=1", "TERM=xterm", "COLORTERM=truecolor", "ATLAS=1"}
+	if got := s.sessionEnv(base, "xterm"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("default env:\n got %q\nwant %q", got, want)
+	}
+
+	s = NewTerminalService(TerminalConfig{
+		Enabled:      true,
+		ExtraEnv:     map[string]string{"LANG": "en_US.UTF-8", "EDITOR": "vim"},
+		EnvBlocklist: []string{"SECRET_TOKEN", "AWS_*"},
+	})
+	want = []string{"PATH=/bin", "HOME=/root", "FOO=1", "TERM=xterm", "COLORTERM=truecolor", "ATLAS=1", "EDITOR=vim", "LANG=en_US.UTF-8"}
+	if got := s.sessionEnv(base, "xterm"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("extra/blocklist env:\n got %q\nwant %q", got, want)
+	}
+
+	s = NewTerminalService(TerminalConfig{Enabled: true, CleanEnv: true})
+	want = []string{"PATH=/bin", "HOME=/root", "LANG=C", "TERM=xterm", "COLORTERM=truecolor", "ATLAS=1"}
+	if got := s.sessionEnv(base, "xterm"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("clean env:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestTerminalCompleteFromHistory(t *testing.T) {
+	t.Parallel()
+
+	s := NewTerminalService(TerminalConfig{Enabled: true})
+	sess := &termSession{id: "s1", owner: "alice", subs: map[chan []byte]bool{}}
+	s.mu.Lock()
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+
+	sess.recordInput([]byte("systemctl status nginx\r"))
+	sess.recordInput([]byte("ls -la\r"))
+	sess.recordInput([]byte("sysx\x7f\x7f\x7f\x7fsystemctl restart nginx\r"))
+	sess.recordInput([]byte("sys\x1b[A\r"))        // recalled with an arrow key: not recorded
+	sess.recordInput([]byte("systemctl oops\x03")) // cancelled
+	sess.recordInput([]byte("systemctl status nginx\r"))
+
+	complete := func(user, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/term/complete?"+query, nil)
+		r = r.WithContext(auth.WithClaims(r.Context(), auth.Claims{UserInfo: auth.UserInfo{User: user}}))
+		w := httptest.NewRecorder()
+		s.HandleComplete(w, r)
+		return w
+	}
+
+	w := complete("alice", "q=sys&session=s1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", w.Code, w.Body.String())
+	}
+	var resp completeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var got []string
+	for _, it := range resp.Items {
+		if it.Detail == "history" {
+			got = append(got, it.Label)
+		}
+	}
+	want := []string{"systemctl status nginx", "systemctl restart nginx"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("history items=%q want %q", got, want)
+	}
+	if len(resp.Items) > 0 && resp.Items[0].Detail != "history" {
+		t.Fatalf("history should come first: %+v", resp.Items)
+	}
+
+	if w := complete("bob", "q=sys&session=s1"); w.Code != http.StatusNotFound {
+		t.Fatalf("foreign session: status=%d", w.Code)
+	}
+	w = complete("alice", "q=sys")
+	if strings.Contains(w.Body.String(), `"history"`) {
+		t.Fatalf("session-less completion must not include history: %s", w.Body.String())
+	}
+}
+
+func TestTerminalCompletePaths(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"config.yaml", ".hidden", "other.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewTerminalService(TerminalConfig{Enabled: true})
+	r := httptest.NewRequest(http.MethodGet, "/api/term/complete?q="+url.QueryEscape(dir+"/con"), nil)
+	w := httptest.NewRecorder()
+	s.HandleComplete(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%q", w.Code, w.Body.String())
+	}
+	var resp completeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := []completeItem{
+		{Label: dir + "/conf.d/", Type: "dir"},
+		{Label: dir + "/config.yaml", Type: "file"},
+	}
+	if !reflect.DeepEqual(resp.Items, want) {
+		t.Fatalf("items=%+v want %+v", resp.Items, want)
+	}
+
+	if got := s.completePaths(r.Context(), nil, dir+"/"); len(got) != 3 {
+		t.Fatalf("hidden entries should be skipped: %+v", got)
+	}
+	if got := s.completePaths(r.Context(), nil, dir+"/.h"); len(got) != 1 || got[0].Type != "file" {
+		t.Fatalf("dot prefix should show hidden entries: %+v", got)
+	}
+}
+
+func TestTerminalPublishMarksDroppedOutput(t *testing.T) {
+	t.Parallel()
+
+	slow := make(chan []byte, 2)
+	fast := make(chan []byte, 8)
+	sess := &termSession{subs: map[chan []byte]bool{slow: false, fast: false}}
+
+	sess.mu.Lock()
+	for _, s := range []string{"a", "b", "c"} {
+		sess.publishLocked([]byte(s), 10*time.Millisecond)
+	}
+	sess.mu.Unlock()
+	if !sess.subs[slow] || sess.subs[fast] {
+		t.Fatalf("expected only the slow client to be marked: %v", sess.subs)
+	}
+	if len(fast) != 3 {
+		t.Fatalf("fast client got %d chunks, want 3", len(fast))
+	}
+
+	// Nothing is queued while there is no room for the marker and the chunk.
+	<-slow
+	sess.mu.Lock()
+	sess.publishLocked([]byte("d"), 10*time.Millisecond)
+	sess.mu.Unlock()
+	<-slow
+	sess.mu.Lock()
+	sess.publishLocked([]byte("e"), 10*time.Millisecond)
+	sess.mu.Unlock()
+
+	var got []string
+	for len(slow) > 0 {
+		got = append(got, string(<-slow))
+	}
+	if want := []string{string(droppedMarker), "e"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("slow client got %q, want %q", got, want)
+	}
+	if sess.subs[slow] {
+		t.Fatalf("slow client still marked as dropping")
+	}
+}
+
+func TestTerminalUTF8Encoding(t *testing.T) {
+	t.Parallel()
+
+	if enc, err := parseTermEncoding(""); err != nil || enc != termEncodingRaw {
+		t.Fatalf("default encoding = %q, %v", enc, err)
+	}
+	if _, err := parseTermEncoding("latin1"); err == nil {
+		t.Fatal("expected unknown encoding to be rejected")
+	}
+
+	// "é" split across reads is kept; the stray 0xff is replaced.
+	var n utf8Normalizer
+	got := string(n.normalize([]byte("ab\xc3"))) + string(n.normalize([]byte("\xa9\xff€"))) + string(n.normalize([]byte("\xe2\x82"))) + string(n.flush())
+	if want := "abé\uFFFD€\uFFFD"; got != want {
+		t.Fatalf("normalized %q, want %q", got, want)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan []byte, 64)
+	sess := &termSession{pty: ptyPair{master: r}, utf8: &utf8Normalizer{}, subs: map[chan []byte]bool{ch: false}}
+	go func() {
+		for _, s := range []string{"ab\xc3", "\xa9\xff", "€€€"} {
+			_, _ = w.Write([]byte(s))
+			time.Sleep(5 * time.Millisecond)
+		}
+		_ = w.Close()
+	}()
+	sess.readLoop(8, time.Second)
+	var out []byte
+	for b := range ch {
+		out = append(out, b...)
+	}
+	if want := "abé\uFFFD€€€"; string(out) != want {
+		t.Fatalf("streamed %q, want %q", out, want)
+	}
+	if !utf8.Valid(sess.tail) || !bytes.HasSuffix(out, sess.tail) || len(sess.tail) == 0 {
+		t.Fatalf("tail %q is not a valid suffix of %q", sess.tail, out)
+	}
+}
@@ -16,6 +16,11 @@ export async function ensureMe(force = false) {
     state.canExec = !!me.can_exec;
     state.canProcs = !!me.can_procs;
     state.canFW = !!me.can_firewall;
+    state.canFWEdit = !!me.can_firewall_edit;
+    state.timeZone = me.time_zone || "UTC";
+    state.maintenance = !!me.maintenance;
+    state.mustChangePassword = !!me.must_change_password;
+    window.dispatchEvent(new Event("atlas:maintenance"));
     const meNode = document.getElementById("me");
     if (meNode) meNode.textContent = state.me;
   })();
@@ -50,6 +55,7 @@ export async function api(path, options = {}) {
     throw new Error(`${res.status} ${res.statusText}${text ? `: ${text}` : ""}`);
   }
 
+  if (typeof options.onHeaders === "function") options.onHeaders(res.headers);
   const ct = res.headers.get("content-type") || "";
   if (ct.includes("application/json")) return res.json();
   return res.text();
@@ -13,6 +13,12 @@ export const en = {
     ru: "Russian",
   },
   common: {
+    maintenanceBanner: "Maintenance mode: the panel is read-only.",
+    securityOk: "HTTPS",
+    securityWarn: "Insecure",
+    securityPlainHttp: "The connection is not encrypted (plain HTTP).",
+    securityInsecureCookies: "The session cookie is sent without the Secure flag (cookie_secure is off).",
+    securitySelfSigned: "The server uses a self-signed certificate.",
     loading: "Loading…",
     refresh: "Refresh",
     save: "Save",
@@ -34,6 +40,17 @@ export const en = {
     logout: "Logout",
     secondsShort: "s",
   },
+  password: {
+    title: "Password",
+    current: "Current password",
+    new: "New password",
+    confirm: "Repeat new password",
+    change: "Change password",
+    changed: "Password changed.",
+    mismatch: "The new passwords do not match.",
+    newRequired: "Enter a new password.",
+    required: "Your administrator requires you to set a new password before using Atlas.",
+  },
   settings: {
     title: "Settings",
     theme: "Theme",
@@ -41,6 +58,7 @@ export const en = {
     themeDark: "Dark",
     themeLight: "Light",
     language: "Language",
+    timeZone: "Time zone",
     httpsTitle: "HTTPS (admin)",
     httpsOnlyAdmin: "Admin only.",
     httpsHelp: "Use existing certificate files by specifying absolute paths, or paste a PEM certificate and private key. Atlas enables HTTPS after restart.",
@@ -56,6 +74,16 @@ export const en = {
     httpsPathsAbs: "paths must begin with /",
     httpsStatusEnabled: "enabled: {cert} / {key} (restart required)",
     httpsStatusDisabled: "disabled",
+    httpsExpires: "certificate expires {date} ({days} days left)",
+    httpsExpired: "certificate expired {date}",
+    httpsSubject: "Subject",
+    httpsIssuer: "Issuer",
+    httpsSelfSigned: "self-signed",
+    httpsSANs: "Names",
+    httpsValidity: "Valid",
+    httpsRegenerate: "Regenerate self-signed",
+    httpsRegenerateConfirm: "Generate a new self-signed certificate? It is used after restart.",
+    httpsRegenerated: "new certificate valid until {date} (restart required)",
     updateTitle: "Update",
     updateChannel: "Channel",
     updateChannelAuto: "auto",
@@ -68,6 +96,12 @@ export const en = {
     updateStatus: "version: {version} · build: {channel} · target: {target}",
     updateLastError: "last error",
     updateLogsHint: "Tip: open Admin → Logs to see updater output.",
+    updateRolledBack: "The new version failed its health check after restart; the previous binary was restored.",
+    updateCheckNow: "Check now",
+    updateAvailable: "Update available: {tag}",
+    updateUpToDate: "Up to date (latest release: {tag})",
+    updateCheckError: "update check failed",
+    updateCheckOff: "Automatic update checks are off (update_check_hours).",
     autostartTitle: "Autostart (systemd)",
     autostartHelp: "Enable/disable autostart via systemd for this Atlas instance.",
     autostartEnable: "Enable autostart",
@@ -78,7 +112,13 @@ export const en = {
     autostartStatus: "enabled: {enabled} · active: {active} · unit: {unit} · unit exists: {unit_exists}",
     autostartError: "autostart status error",
     uninstallTitle: "Remove",
-    uninstallHelp: "Removes Atlas binary and local data files (config, keys, DB). This is irreversible.",
+    uninstallHelp: "Stops and disables the service and removes the selected files. This is irreversible.",
+    uninstallBinary: "Binary (and update backup)",
+    uninstallConfig: "Config file",
+    uninstallData: "Data (master key, user and firewall DBs, TLS files)",
+    uninstallUnit: "systemd unit",
+    uninstallPreview: "Show files",
+    uninstallNothing: "No files would be removed.",
     uninstallPrompt: "Type DELETE to remove Atlas:",
     uninstallConfirmMismatch: "confirm mismatch",
     uninstallButton: "Remove Atlas",
@@ -104,12 +144,22 @@ export const en = {
     network: "Network",
     download: "Download",
     upload: "Upload",
+    diskIO: "Disk I/O",
+    diskRead: "Read",
+    diskWrite: "Write",
+    diskUtil: "Util",
+    unavailable: "Unavailable metrics",
     system: "System",
     hostname: "Hostname",
     os: "OS",
     kernel: "Kernel",
     uptime: "Uptime",
     load: "Load",
+    atlasService: "Atlas service",
+    serviceActive: "running",
+    serviceInactive: "not running",
+    serviceEnabled: "starts on boot",
+    serviceDisabled: "does not start on boot",
     now: "now",
     secondsAgo: "-{s}s",
     historyWindow: "Window",
@@ -154,6 +204,13 @@ export const en = {
     sigHup: "Reload (HUP)",
     sigUsr1: "USR1",
     sigUsr2: "USR2",
+    showEnv: "Environment…",
+    envTitle: "Environment of process {pid}",
+    envRedacted: "(hidden)",
+    envNamesOnly: "Values are shown to admins only.",
+    showCommand: "Full command…",
+    commandTitle: "Command of process {pid}",
+    signalFailed: "Signal failed for",
   },
   files: {
     entrypoints: "Entry points",
@@ -171,6 +228,7 @@ export const en = {
     newFolderTitle: "New folder",
     newFileTitle: "New file",
     uploadTitle: "Upload",
+    uploadFailed: "Some files were not uploaded:",
     renameTitle: "Rename (F2)",
     deleteTitle: "Delete (Del)",
     viewTitle: "View",
@@ -181,10 +239,12 @@ export const en = {
     atlasRootHint: "ATLAS_ROOT limits access",
     dropHint: "Drop files here to upload",
     linuxUserPrompt: "Linux user:",
+    sudoNeedsPassword: "Sudo asks for a password: store a sudo password (Admin → Sudo) to use other users.",
     folderNamePrompt: "Folder name:",
     fileNamePrompt: "File name:",
     renamePrompt: "New name:",
     deleteConfirm: "Delete: {n} item(s)? (folders are deleted recursively)",
+    deletePlan: "This removes {count} file(s) and folder(s), {size} in total:",
     download: "Download",
     binaryDisabled: "Looks like a binary file, editing is disabled.",
     folder: "Folder",
@@ -234,13 +294,25 @@ export const en = {
     atlasNote: "System firewall ({tool}) is active. Atlas rules are separate.",
     euid: "euid",
     sudo: "sudo",
+    sudoNeedsPassword: "Sudo asks for a password: store a sudo password (Admin → Sudo) so Atlas can manage the firewall.",
     configDisabled: "Firewall is disabled in config (enable_firewall=false).",
     rulesTitle: "Rules",
     externalTitle: "{tool} rules (read-only)",
     externalActive: "{tool} rules detected (read-only).",
     externalInactive: "{tool} is installed but inactive.",
     externalEmpty: "No {tool} rules detected.",
+    systemRule: "system",
+    systemRuleHint: "Managed by Atlas",
+    baseRulesOn: "Add base rules",
+    baseRulesOff: "Remove base rules",
+    policyDrop: "Default deny",
+    policyAccept: "Default allow",
+    policyDropConfirm: "Drop all incoming traffic not matched by an allow rule? Make sure the port you use to reach this server is allowed.",
+    overlapWarning: "Overlapping rules",
     externalError: "Failed to read {tool} rules: {err}",
+    dockerDetected: "Docker manages netfilter rules on this host.",
+    dockerBypass: "Ports published by Docker containers are forwarded past Atlas rules. Filter them in Docker's DOCKER-USER chain or publish them on 127.0.0.1.",
+    dockerRedirectOrder: "Atlas redirects and Docker's port forwarding run in the same NAT hook; which one applies first is undefined.",
     externalThTo: "To",
     externalThAction: "Action",
     externalThFrom: "From",
@@ -258,11 +330,60 @@ export const en = {
     thPorts: "Ports / Service",
     thComment: "Comment",
     thActions: "Actions",
-    portsPlaceholder: "22 or 1000-2000",
+    portsPlaceholder: "22, 1000-2000 or 80,443",
     toPortPlaceholder: "to port (redirect)",
+    toAddrPlaceholder: "to address (forward, optional)",
+    masquerade: "masquerade",
+    masqueradeHint: "Rewrite the source address so the target host replies through this server",
     serviceLabel: "Service",
     servicePlaceholder: "ssh, http, samba...",
+    interfaceLabel: "Interface",
+    interfacePlaceholder: "any (e.g. eth1)",
+    onInterface: "on {iface}",
+    linkedUnitLabel: "Linked unit",
+    linkedUnitPlaceholder: "e.g. game.service (optional)",
+    linkedUnit: "follows {unit}: {state}",
+    linkedUnitHint: "Enabled automatically while the linked unit is active",
+    simulate: "Test packet",
+    simulateTitle: "Would this connection be allowed?",
+    simulateSource: "Source IP",
+    simulateSourcePlaceholder: "any (e.g. 1.2.3.4)",
+    simulateAccept: "Accepted",
+    simulateDrop: "Dropped",
+    simulateForward: "Forwarded to {to}",
+    simulateRule: "matched rule {id}",
+    simulateRedirect: "redirected to port {port} by rule {id}",
+    simulateSkipped: "Service rules are not evaluated: {ids}",
+    readOnly: "You can view the firewall but not change it.",
+    ban: "Ban IP",
+    banTitle: "Drop all traffic from an address",
+    banSource: "Address",
+    banSourcePlaceholder: "IP or CIDR (e.g. 203.0.113.0/24)",
+    banned: "banned",
+    unban: "Unban",
+    unbanConfirm: "Lift the ban on {source}?",
+    importSystem: "Import {tool} rules",
+    importSystemDone: "Imported rules: {n}",
+    permanentLabel: "Permanent",
+    permanentHint: "Unchecked: the rule is applied to the firewalld runtime only and disappears after a reload or reboot",
+    runtimeOnly: "runtime only",
+    createdBy: "created by {user}",
+    updatedBy: "last changed by {user}",
+    createdAt: "created {time}",
+    sortLabel: "Order",
+    sortApply: "as applied",
+    sortCreated: "by creation time",
+    sortPort: "by port",
+    sortType: "by type",
+    sortedNote: "Sorted view: the firewall applies these rules in a different order.",
     commentPlaceholder: "comment",
+    ttlLabel: "Expire after",
+    ttlPermanent: "permanent",
+    ttl15m: "15 minutes",
+    ttl1h: "1 hour",
+    ttl4h: "4 hours",
+    ttl1d: "1 day",
+    expiresIn: "expires in {t}",
     ruleTitle: "Rule",
     type: "Type",
     proto: "Proto",
@@ -271,7 +392,7 @@ export const en = {
     optionsTitle: "Options",
     enabledLabel: "Enabled",
     commentLabel: "Comment",
-    portsHelp: "Ports support: single (80) or range (1000-2000). Set service to target a service instead of ports.",
+    portsHelp: "Ports support: single (80), range (1000-2000) or a comma-separated list of both (80,443,8000-8100). Set service to target a service instead of ports.",
     badServiceRedirect: "Redirect does not support service target.",
     editRuleTitle: "Edit rule",
     addRuleTitle: "Add rule",
@@ -282,6 +403,9 @@ export const en = {
     deleteRuleConfirm: "Delete rule {id}?",
   },
   admin: {
+    maintenanceOn: "Enable maintenance",
+    maintenanceOff: "Disable maintenance",
+    maintenanceConfirm: "Put the panel into read-only maintenance mode? Non-admin changes will be refused until it is disabled.",
     server: "Server",
     config: "Config",
     users: "Users",
@@ -338,6 +462,9 @@ export const en = {
     labelMasterKeyFile: "Master key file",
     labelUserDBPath: "User DB path",
     labelFWDBPath: "Firewall DB path",
+    fwDBMove: "Move now",
+    fwDBMoveHint: "\"Move now\" relocates the rules file immediately, without a restart. The new path must be inside the config directory, state_dir or the current DB directory.",
+    fwDBMoved: "Firewall DB moved to {path}",
     listenHostHint: "0.0.0.0 for remote access, 127.0.0.1 for local only.",
     listenPortHint: "1..65535",
     basePathHint: "URL prefix (starts with /). Use / to disable.",
@@ -382,9 +509,14 @@ export const en = {
     permExec: "Terminal/exec",
     permProcs: "Processes control",
     permFW: "Firewall",
+    permFWReadOnly: "Firewall: view only",
+    permFWReadOnlyHint: "Status, rules and port usage can be viewed, but nothing can be changed",
+    fwViewOnly: "view only",
     permFSSudo: "FS sudo",
     permFSAny: "FS any user",
     permFSUsers: "FS users",
+    mustChangePassword: "Require a password change at next login",
+    mustChangeShort: "must change password",
     addUserTitle: "Add user",
     editUserTitle: "Edit user",
     usernamePlaceholder: "username",
@@ -397,7 +529,14 @@ export const en = {
       restart: "restart",
       reboot: "reboot",
       shutdown: "shutdown",
+      uninstall: "uninstall",
     },
+    approvalsTitle: "Pending approvals",
+    approvalsNone: "No actions are waiting for approval.",
+    approvalBy: "requested by {user} at {time}",
+    approve: "Approve",
+    approvalConfirm: "Approve {action} requested by {user}? It runs immediately.",
+    approvalPending: "Another admin must approve this action (Admin → Pending approvals).",
 
     tail: "Tail",
     autoRefresh: "Auto refresh",
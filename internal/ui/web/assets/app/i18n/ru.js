@@ -13,6 +13,12 @@ export const ru = {
     ru: "Русский",
   },
   common: {
+    maintenanceBanner: "Режим обслуживания: панель только для чтения.",
+    securityOk: "HTTPS",
+    securityWarn: "Небезопасно",
+    securityPlainHttp: "Соединение не зашифровано (обычный HTTP).",
+    securityInsecureCookies: "Cookie сессии передаётся без флага Secure (cookie_secure выключен).",
+    securitySelfSigned: "Сервер использует самоподписанный сертификат.",
     loading: "Загрузка…",
     refresh: "Обновить",
     save: "Сохранить",
@@ -34,6 +40,17 @@ export const ru = {
     logout: "Выход",
     secondsShort: "с",
   },
+  password: {
+    title: "Пароль",
+    current: "Текущий пароль",
+    new: "Новый пароль",
+    confirm: "Повторите новый пароль",
+    change: "Сменить пароль",
+    changed: "Пароль изменён.",
+    mismatch: "Новые пароли не совпадают.",
+    newRequired: "Введите новый пароль.",
+    required: "Администратор требует задать новый пароль перед работой с Atlas.",
+  },
   settings: {
     title: "Настройки",
     theme: "Тема",
@@ -41,6 +58,7 @@ export const ru = {
     themeDark: "Тёмная",
     themeLight: "Светлая",
     language: "Язык",
+    timeZone: "Часовой пояс",
     httpsTitle: "HTTPS (admin)",
     httpsOnlyAdmin: "Только для admin.",
     httpsHelp: "Укажи абсолютные пути к существующим файлам сертификата/ключа или вставь PEM-сертификат и приватный ключ. Atlas включит HTTPS после перезапуска.",
@@ -56,6 +74,16 @@ export const ru = {
     httpsPathsAbs: "пути должны начинаться с /",
     httpsStatusEnabled: "включено: {cert} / {key} (нужен перезапуск)",
     httpsStatusDisabled: "выключено",
+    httpsExpires: "сертификат истекает {date} (осталось дней: {days})",
+    httpsExpired: "сертификат истёк {date}",
+    httpsSubject: "Субъект",
+    httpsIssuer: "Издатель",
+    httpsSelfSigned: "самоподписанный",
+    httpsSANs: "Имена",
+    httpsValidity: "Действует",
+    httpsRegenerate: "Перевыпустить самоподписанный",
+    httpsRegenerateConfirm: "Сгенерировать новый самоподписанный сертификат? Он будет использован после перезапуска.",
+    httpsRegenerated: "новый сертификат действует до {date} (нужен перезапуск)",
     updateTitle: "Обновление",
     updateChannel: "Канал",
     updateChannelAuto: "авто",
@@ -68,6 +96,12 @@ export const ru = {
     updateStatus: "версия: {version} · сборка: {channel} · цель: {target}",
     updateLastError: "последняя ошибка",
     updateLogsHint: "Подсказка: открой Админ → Логи чтобы видеть вывод обновления.",
+    updateRolledBack: "Новая версия не прошла проверку после перезапуска; восстановлен предыдущий бинарник.",
+    updateCheckNow: "Проверить",
+    updateAvailable: "Доступно обновление: {tag}",
+    updateUpToDate: "Установлена актуальная версия (последний релиз: {tag})",
+    updateCheckError: "проверка обновлений не удалась",
+    updateCheckOff: "Автоматическая проверка обновлений выключена (update_check_hours).",
     autostartTitle: "Автозапуск (systemd)",
     autostartHelp: "Включает/выключает автозапуск через systemd для текущего Atlas.",
     autostartEnable: "Включить автозапуск",
@@ -78,7 +112,13 @@ export const ru = {
     autostartStatus: "включено: {enabled} · активно: {active} · unit: {unit} · unit существует: {unit_exists}",
     autostartError: "ошибка статуса автозапуска",
     uninstallTitle: "Удаление",
-    uninstallHelp: "Удаляет бинарник Atlas и локальные файлы (конфиг, ключи, БД). Действие необратимо.",
+    uninstallHelp: "Останавливает и отключает службу и удаляет выбранные файлы. Это необратимо.",
+    uninstallBinary: "Бинарник (и резервная копия обновления)",
+    uninstallConfig: "Файл конфигурации",
+    uninstallData: "Данные (мастер-ключ, БД пользователей и firewall, файлы TLS)",
+    uninstallUnit: "Юнит systemd",
+    uninstallPreview: "Показать файлы",
+    uninstallNothing: "Ни один файл не будет удалён.",
     uninstallPrompt: "Введи DELETE чтобы удалить Atlas:",
     uninstallConfirmMismatch: "неверное подтверждение",
     uninstallButton: "Удалить Atlas",
@@ -105,11 +145,21 @@ export const ru = {
     network: "Сеть",
     download: "Загрузка",
     upload: "Передача",
+    diskIO: "Дисковый ввод-вывод",
+    diskRead: "Чтение",
+    diskWrite: "Запись",
+    diskUtil: "Загрузка",
+    unavailable: "Недоступные метрики",
     hostname: "Имя узла",
     os: "ОС",
     kernel: "Ядро",
     uptime: "Аптайм",
     load: "Нагрузка",
+    atlasService: "Служба Atlas",
+    serviceActive: "запущена",
+    serviceInactive: "не запущена",
+    serviceEnabled: "стартует при загрузке",
+    serviceDisabled: "не стартует при загрузке",
     now: "сейчас",
     secondsAgo: "-{s}с",
     historyWindow: "Период",
@@ -154,6 +204,13 @@ export const ru = {
     sigHup: "Перечитать (HUP)",
     sigUsr1: "USR1",
     sigUsr2: "USR2",
+    showEnv: "Окружение…",
+    envTitle: "Окружение процесса {pid}",
+    envRedacted: "(скрыто)",
+    envNamesOnly: "Значения видны только администраторам.",
+    showCommand: "Полная команда…",
+    commandTitle: "Команда процесса {pid}",
+    signalFailed: "Не удалось отправить сигнал",
   },
   files: {
     entrypoints: "Точки входа",
@@ -171,6 +228,7 @@ export const ru = {
     newFolderTitle: "Новая папка",
     newFileTitle: "Новый файл",
     uploadTitle: "Загрузить",
+    uploadFailed: "Часть файлов не загружена:",
     renameTitle: "Переименовать (F2)",
     deleteTitle: "Удалить (Del)",
     viewTitle: "Вид",
@@ -181,10 +239,12 @@ export const ru = {
     atlasRootHint: "ATLAS_ROOT ограничивает доступ",
     dropHint: "Перетащите файлы сюда для загрузки",
     linuxUserPrompt: "Linux пользователь:",
+    sudoNeedsPassword: "Sudo запрашивает пароль: сохраните пароль sudo (Админ → Sudo), чтобы работать от других пользователей.",
     folderNamePrompt: "Имя папки:",
     fileNamePrompt: "Имя файла:",
     renamePrompt: "Новое имя:",
     deleteConfirm: "Удалить: {n} шт.? (папки удаляются рекурсивно)",
+    deletePlan: "Будет удалено файлов и папок: {count}, всего {size}:",
     download: "Скачать",
     binaryDisabled: "Похоже на бинарный файл, редактирование отключено.",
     folder: "Папка",
@@ -234,13 +294,25 @@ export const ru = {
     atlasNote: "Системный фаервол ({tool}) активен. Правила Atlas отдельные.",
     euid: "euid",
     sudo: "sudo",
+    sudoNeedsPassword: "Sudo запрашивает пароль: сохраните пароль sudo (Админ → Sudo), чтобы Atlas мог управлять файрволом.",
     configDisabled: "Фаервол отключён в конфиге (enable_firewall=false).",
     rulesTitle: "Правила",
     externalTitle: "Правила {tool} (только чтение)",
     externalActive: "Обнаружены правила {tool} (только чтение).",
     externalInactive: "{tool} установлен, но не активен.",
     externalEmpty: "Правила {tool} не найдены.",
+    systemRule: "система",
+    systemRuleHint: "Управляется Atlas",
+    baseRulesOn: "Добавить базовые правила",
+    baseRulesOff: "Убрать базовые правила",
+    policyDrop: "Запрещать по умолчанию",
+    policyAccept: "Разрешать по умолчанию",
+    policyDropConfirm: "Отбрасывать весь входящий трафик, не разрешённый правилами? Убедитесь, что порт, через который вы подключаетесь, разрешён.",
+    overlapWarning: "Пересекающиеся правила",
     externalError: "Не удалось прочитать правила {tool}: {err}",
+    dockerDetected: "На этом сервере правилами netfilter управляет Docker.",
+    dockerBypass: "Порты, опубликованные контейнерами Docker, пересылаются в обход правил Atlas. Фильтруйте их в цепочке DOCKER-USER или публикуйте на 127.0.0.1.",
+    dockerRedirectOrder: "Перенаправления Atlas и проброс портов Docker работают в одном NAT-хуке; порядок их применения не определён.",
     externalThTo: "Куда",
     externalThAction: "Действие",
     externalThFrom: "Откуда",
@@ -258,11 +330,60 @@ export const ru = {
     thPorts: "Порты / Сервисы",
     thComment: "Комментарий",
     thActions: "Действия",
-    portsPlaceholder: "22 или 1000-2000",
+    portsPlaceholder: "22, 1000-2000 или 80,443",
     toPortPlaceholder: "на порт (redirect)",
+    toAddrPlaceholder: "на адрес (проброс, необязательно)",
+    masquerade: "маскарадинг",
+    masqueradeHint: "Подменять адрес источника, чтобы целевой хост отвечал через этот сервер",
     serviceLabel: "Сервис",
     servicePlaceholder: "ssh, http, samba...",
+    interfaceLabel: "Интерфейс",
+    interfacePlaceholder: "любой (например, eth1)",
+    onInterface: "на {iface}",
+    linkedUnitLabel: "Привязка к юниту",
+    linkedUnitPlaceholder: "например, game.service (необязательно)",
+    linkedUnit: "следует за {unit}: {state}",
+    linkedUnitHint: "Включается автоматически, пока привязанный юнит активен",
+    simulate: "Проверить пакет",
+    simulateTitle: "Будет ли подключение разрешено?",
+    simulateSource: "IP источника",
+    simulateSourcePlaceholder: "любой (например, 1.2.3.4)",
+    simulateAccept: "Разрешено",
+    simulateDrop: "Отброшено",
+    simulateForward: "Переслано на {to}",
+    simulateRule: "сработало правило {id}",
+    simulateRedirect: "перенаправлено на порт {port} правилом {id}",
+    simulateSkipped: "Правила-сервисы не проверяются: {ids}",
+    readOnly: "Вы можете просматривать фаервол, но не изменять его.",
+    ban: "Заблокировать IP",
+    banTitle: "Отбрасывать весь трафик с адреса",
+    banSource: "Адрес",
+    banSourcePlaceholder: "IP или CIDR (например, 203.0.113.0/24)",
+    banned: "заблокирован",
+    unban: "Разблокировать",
+    unbanConfirm: "Снять блокировку с {source}?",
+    importSystem: "Импортировать правила {tool}",
+    importSystemDone: "Импортировано правил: {n}",
+    permanentLabel: "Постоянное",
+    permanentHint: "Если снято, правило применяется только к текущей конфигурации firewalld и пропадёт после перезагрузки",
+    runtimeOnly: "временное (runtime)",
+    createdBy: "создано: {user}",
+    updatedBy: "изменено: {user}",
+    createdAt: "создано {time}",
+    sortLabel: "Порядок",
+    sortApply: "как применяются",
+    sortCreated: "по времени создания",
+    sortPort: "по порту",
+    sortType: "по типу",
+    sortedNote: "Отсортированный вид: межсетевой экран применяет эти правила в другом порядке.",
     commentPlaceholder: "комментарий",
+    ttlLabel: "Удалить через",
+    ttlPermanent: "никогда",
+    ttl15m: "15 минут",
+    ttl1h: "1 час",
+    ttl4h: "4 часа",
+    ttl1d: "1 день",
+    expiresIn: "истекает через {t}",
     ruleTitle: "Правило",
     type: "Тип",
     proto: "Протокол",
@@ -271,7 +392,7 @@ export const ru = {
     optionsTitle: "Опции",
     enabledLabel: "Включено",
     commentLabel: "Комментарий",
-    portsHelp: "Порты: одно значение (80) или диапазон (1000-2000). Сервис можно указать вместо портов.",
+    portsHelp: "Порты: одно значение (80), диапазон (1000-2000) или список через запятую (80,443,8000-8100). Сервис можно указать вместо портов.",
     badServiceRedirect: "Redirect не поддерживает сервис.",
     editRuleTitle: "Редактировать правило",
     addRuleTitle: "Добавить правило",
@@ -282,6 +403,9 @@ export const ru = {
     deleteRuleConfirm: "Удалить правило {id}?",
   },
   admin: {
+    maintenanceOn: "Включить обслуживание",
+    maintenanceOff: "Выключить обслуживание",
+    maintenanceConfirm: "Перевести панель в режим обслуживания (только чтение)? Изменения вне админки будут отклоняться, пока режим не выключен.",
     server: "Сервер",
     config: "Настройки",
     users: "Пользователи",
@@ -338,6 +462,9 @@ export const ru = {
     labelMasterKeyFile: "Файл master key",
     labelUserDBPath: "База пользователей",
     labelFWDBPath: "База фаервола",
+    fwDBMove: "Переместить",
+    fwDBMoveHint: "«Переместить» переносит файл правил сразу, без перезапуска. Новый путь должен быть внутри каталога конфигурации, state_dir или текущего каталога БД.",
+    fwDBMoved: "База фаервола перемещена в {path}",
     listenHostHint: "0.0.0.0 для удаленного доступа, 127.0.0.1 только локально.",
     listenPortHint: "1..65535",
     basePathHint: "Префикс URL (начинается с /). Используй / чтобы отключить.",
@@ -382,9 +509,14 @@ export const ru = {
     permExec: "Терминал/exec",
     permProcs: "Управление процессами",
     permFW: "Фаервол",
+    permFWReadOnly: "Фаервол: только просмотр",
+    permFWReadOnlyHint: "Можно смотреть статус, правила и занятые порты, но ничего нельзя менять",
+    fwViewOnly: "только просмотр",
     permFSSudo: "FS sudo",
     permFSAny: "FS любой пользователь",
     permFSUsers: "FS пользователи",
+    mustChangePassword: "Потребовать смену пароля при следующем входе",
+    mustChangeShort: "нужно сменить пароль",
     addUserTitle: "Добавить пользователя",
     editUserTitle: "Редактировать пользователя",
     usernamePlaceholder: "логин",
@@ -397,7 +529,14 @@ export const ru = {
       restart: "перезапуск",
       reboot: "перезагрузка",
       shutdown: "выключение",
+      uninstall: "удаление",
     },
+    approvalsTitle: "Ожидают подтверждения",
+    approvalsNone: "Нет действий, ожидающих подтверждения.",
+    approvalBy: "запросил {user} в {time}",
+    approve: "Подтвердить",
+    approvalConfirm: "Подтвердить {action} от {user}? Действие выполнится сразу.",
+    approvalPending: "Действие должен подтвердить другой администратор (Админ → Ожидают подтверждения).",
 
     tail: "Хвост",
     autoRefresh: "Автообновление",
@@ -1,4 +1,4 @@
-import { ensureMe } from "./api.js";
+import { api, ensureMe } from "./api.js";
 import { el } from "./dom.js";
 import { initLang, t } from "./i18n.js";
 import { state, views } from "./state.js";
@@ -9,6 +9,7 @@ import { renderFirewall } from "./views/firewall.js";
 import { renderMonitor } from "./views/monitor.js";
 import { renderAdmin } from "./views/admin.js";
 import { renderSettings } from "./views/settings.js";
+import { renderPasswordRequired } from "./views/password.js";
 
 function setView(id) {
   state.view = id;
@@ -33,10 +34,54 @@ async function render() {
   await map[state.view](viewRoot);
 }
 
+async function applyBranding() {
+  const b = await api("api/branding").catch(() => null);
+  if (!b) return;
+  const brand = document.querySelector(".topbar .brand");
+  if (brand) {
+    brand.replaceChildren(
+      ...(b.logo_url ? [el("img", { class: "brand-logo", src: b.logo_url, alt: "" })] : []),
+      b.name || "Atlas",
+    );
+  }
+  document.title = b.name || "Atlas";
+}
+
+const securityWarningKeys = {
+  plain_http: "common.securityPlainHttp",
+  insecure_cookies: "common.securityInsecureCookies",
+  self_signed: "common.securitySelfSigned",
+};
+
+let security = null;
+
+function renderSecurity() {
+  const badge = document.getElementById("securityBadge");
+  if (!badge || !security) return;
+  const warnings = security.warnings || [];
+  // A self-signed certificate alone still means an encrypted connection.
+  const insecure = warnings.some(w => w !== "self_signed");
+  badge.hidden = false;
+  badge.classList.toggle("warn", insecure);
+  badge.textContent = t(insecure ? "common.securityWarn" : "common.securityOk");
+  badge.title = warnings.map(w => t(securityWarningKeys[w] || w)).join("\n");
+}
+
+async function applySecurity() {
+  security = await api("api/system/security").catch(() => null);
+  renderSecurity();
+}
+
 async function main() {
   initTheme();
   initLang();
   await ensureMe(true);
+  applyBranding();
+  applySecurity();
+  if (state.mustChangePassword) {
+    renderPasswordRequired(document.getElementById("view"));
+    return;
+  }
   const tabs = document.getElementById("tabs");
   const logoutLink = document.getElementById("logoutLink");
   const enabledViews = views.filter(v =>
@@ -56,12 +101,23 @@ async function main() {
   const u = new URL(window.location.href);
   const requestedView = (u.searchParams.get("view") || "").trim();
 
+  function renderMaintenance() {
+    const banner = document.getElementById("maintenanceBanner");
+    if (!banner) return;
+    banner.hidden = !state.maintenance;
+    banner.textContent = t("common.maintenanceBanner");
+  }
+  window.addEventListener("atlas:maintenance", renderMaintenance);
+
   window.addEventListener("atlas:lang", () => {
     renderTabs();
+    renderMaintenance();
+    renderSecurity();
     render().catch(() => {});
   });
 
   renderTabs();
+  renderMaintenance();
   const first = enabledViews.some(v => v.id === "dashboard") ? "dashboard" : enabledViews[0]?.id || "dashboard";
   setView(requestedView && enabledViews.some(v => v.id === requestedView) ? requestedView : first);
 }
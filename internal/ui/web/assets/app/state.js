@@ -6,6 +6,10 @@ export const state = {
   canExec: false,
   canProcs: false,
   canFW: false,
+  canFWEdit: false,
+  timeZone: "UTC",
+  maintenance: false,
+  mustChangePassword: false,
   view: "dashboard",
 };
 
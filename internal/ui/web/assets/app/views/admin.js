@@ -1,5 +1,6 @@
 import { api } from "../api.js";
 import { el } from "../dom.js";
+import { fmtDate } from "../format.js";
 import { t } from "../i18n.js";
 import { state } from "../state.js";
 
@@ -170,6 +171,21 @@ export async function renderAdmin(root) {
           disabled: !actionsEnabled ? "disabled" : null,
           onclick: () => confirmAction("restart", cfg.service_name),
         }, t("admin.restartService")),
+        el("button", {
+          class: state.maintenance ? "secondary" : "danger",
+          onclick: async () => {
+            const enabled = !state.maintenance;
+            if (enabled && !confirm(t("admin.maintenanceConfirm"))) return;
+            const res = await api("api/admin/maintenance", {
+              method: "POST",
+              headers: { "content-type": "application/json" },
+              body: JSON.stringify({ enabled }),
+            });
+            state.maintenance = !!res.enabled;
+            window.dispatchEvent(new Event("atlas:maintenance"));
+            await render();
+          },
+        }, state.maintenance ? t("admin.maintenanceOff") : t("admin.maintenanceOn")),
         el("button", {
           class: "danger",
           disabled: !actionsEnabled ? "disabled" : null,
@@ -200,18 +216,55 @@ export async function renderAdmin(root) {
               alert(t("admin.typeToken", { token }));
               return;
             }
-            await api("api/admin/action", {
+            const res = await api("api/admin/action", {
               method: "POST",
               headers: { "content-type": "application/json" },
               body: JSON.stringify({ action, confirm: token }),
             });
             m.close();
+            if (res?.pending) {
+              alert(t("admin.approvalPending"));
+              await render();
+            }
           },
         }, t("admin.run")),
       ]);
       input.focus();
     }
 
+    let approvals = null;
+    try {
+      approvals = await api("api/admin/approvals");
+    } catch {}
+    const approvalsCard = el("div", { class: "card", style: "margin-top:12px;" },
+      el("div", { class: "path" }, t("admin.approvalsTitle")),
+      ...(approvals?.pending || []).map((a) => el("div", { class: "toolbar" },
+        pill(t(`admin.action.${a.action}`) || a.action),
+        el("span", { class: "path" }, t("admin.approvalBy", { user: a.requester || "—", time: fmtDate(a.created_unix) })),
+        el("span", { class: "pm-spacer" }),
+        a.requester === state.me ? null : el("button", {
+          class: "danger",
+          onclick: async () => {
+            if (!confirm(t("admin.approvalConfirm", { action: a.action, user: a.requester }))) return;
+            try {
+              await api(`api/admin/approvals/${encodeURIComponent(a.id)}`, { method: "POST" });
+            } catch (e) {
+              alert(e.message || String(e));
+            }
+            await render();
+          },
+        }, t("admin.approve")),
+        el("button", {
+          class: "secondary",
+          onclick: async () => {
+            await api(`api/admin/approvals/${encodeURIComponent(a.id)}`, { method: "DELETE" }).catch(() => {});
+            await render();
+          },
+        }, t("common.cancel")),
+      )),
+      approvals?.pending?.length ? null : el("div", { class: "path" }, t("admin.approvalsNone")),
+    );
+
     const cfgCard = el("div", { class: "card", style: "margin-top:12px;" },
       el("div", { class: "path" }, t("admin.configTitle")),
       el("div", { class: "toolbar" },
@@ -225,7 +278,7 @@ export async function renderAdmin(root) {
       el("div", { class: "path" }, t("admin.configRestartHint")),
     );
 
-    replaceMain(head, sys, actionsCard, cfgCard);
+    replaceMain(head, sys, actionsCard, ...(approvals?.required ? [approvalsCard] : []), cfgCard);
   }
 
   async function renderConfig() {
@@ -254,6 +307,28 @@ export async function renderAdmin(root) {
     const masterKeyIn = el("input", { class: "mono", value: currentCfg.master_key_file || "" });
     const userDBIn = el("input", { class: "mono", value: currentCfg.user_db_path || "" });
     const fwDBIn = el("input", { class: "mono", value: currentCfg.firewall_db_path || "" });
+    const fwDBMoveBtn = el("button", {
+      class: "secondary",
+      onclick: async () => {
+        const path = String(fwDBIn.value || "").trim();
+        if (!path || path === currentCfg.firewall_db_path) return;
+        fwDBMoveBtn.disabled = true;
+        try {
+          const res = await api("api/admin/firewall/db", {
+            method: "POST",
+            headers: { "content-type": "application/json" },
+            body: JSON.stringify({ path }),
+          });
+          currentCfg.firewall_db_path = res.path;
+          fwDBIn.value = res.path;
+          alert(t("admin.fwDBMoved", { path: res.path }));
+        } catch (e) {
+          alert(e.message || String(e));
+        } finally {
+          fwDBMoveBtn.disabled = false;
+        }
+      },
+    }, t("admin.fwDBMove"));
 
     const logLevelIn = el("select");
     for (const v of ["debug", "info", "warn", "error", "off"]) {
@@ -310,7 +385,7 @@ export async function renderAdmin(root) {
         fieldRow(t("admin.labelServiceName"), serviceNameIn),
         fieldRow(t("admin.labelMasterKeyFile"), masterKeyIn),
         fieldRow(t("admin.labelUserDBPath"), userDBIn),
-        fieldRow(t("admin.labelFWDBPath"), fwDBIn),
+        fieldRow(t("admin.labelFWDBPath"), el("div", { class: "toolbar" }, fwDBIn, fwDBMoveBtn), t("admin.fwDBMoveHint")),
       ),
       el("div", { class: "path", style: "margin-top:12px;" }, t("admin.configRestartHint")),
     );
@@ -388,11 +463,11 @@ export async function renderAdmin(root) {
     const tbody = el("tbody");
     for (const u of users) {
       tbody.append(el("tr", {},
-        el("td", { class: "mono" }, u.user),
+        el("td", { class: "mono" }, u.user, u.must_change_password ? el("span", { class: "pill", style: "margin-left:6px;" }, t("admin.mustChangeShort")) : null),
         el("td", { class: "mono" }, roleLabel(u.role || "user")),
         el("td", {}, yesNo(u.can_exec)),
         el("td", {}, yesNo(u.can_procs)),
-        el("td", {}, yesNo(u.can_fw)),
+        el("td", {}, u.can_fw && u.fw_read_only ? t("admin.fwViewOnly") : yesNo(u.can_fw)),
         el("td", {}, yesNo(u.fs_sudo)),
         el("td", { class: "mono" }, (u.fs_any ? "*" : (u.fs_users || []).join(",")) || "—"),
         el("td", { style: "text-align:right; white-space:nowrap;" },
@@ -423,9 +498,11 @@ export async function renderAdmin(root) {
       const canExec = el("input", { type: "checkbox", checked: !!user?.can_exec });
       const canProcs = el("input", { type: "checkbox", checked: !!user?.can_procs });
       const canFW = el("input", { type: "checkbox", checked: !!user?.can_fw });
+      const fwReadOnly = el("input", { type: "checkbox", checked: !!user?.fw_read_only });
       const fsSudo = el("input", { type: "checkbox", checked: !!user?.fs_sudo });
       const fsAny = el("input", { type: "checkbox", checked: !!user?.fs_any });
       const fsUsers = el("input", { class: "mono", placeholder: t("admin.fsUsersCsvPlaceholder"), value: arrToCSV(user?.fs_users || []) });
+      const mustChange = el("input", { type: "checkbox", checked: !!user?.must_change_password });
 
       const form = el("div", { class: "split" },
         el("div", {},
@@ -433,12 +510,14 @@ export async function renderAdmin(root) {
           el("div", { class: "toolbar" }, el("span", { class: "path" }, t("admin.user")), userIn),
           el("div", { class: "toolbar" }, el("span", { class: "path" }, t("admin.role")), roleSel),
           el("div", { class: "toolbar" }, el("span", { class: "path" }, t("admin.password")), passIn),
+          el("div", { class: "toolbar" }, mustChange, el("span", { class: "path" }, t("admin.mustChangePassword"))),
         ),
         el("div", {},
           el("div", { class: "path" }, t("admin.permissions")),
           el("div", { class: "toolbar" }, canExec, el("span", { class: "path" }, t("admin.permExec"))),
           el("div", { class: "toolbar" }, canProcs, el("span", { class: "path" }, t("admin.permProcs"))),
           el("div", { class: "toolbar" }, canFW, el("span", { class: "path" }, t("admin.permFW"))),
+          el("div", { class: "toolbar", title: t("admin.permFWReadOnlyHint") }, fwReadOnly, el("span", { class: "path" }, t("admin.permFWReadOnly"))),
           el("div", { class: "toolbar" }, fsSudo, el("span", { class: "path" }, t("admin.permFSSudo"))),
           el("div", { class: "toolbar" }, fsAny, el("span", { class: "path" }, t("admin.permFSAny"))),
           el("div", { class: "toolbar" }, el("span", { class: "path" }, t("admin.permFSUsers")), fsUsers),
@@ -456,9 +535,11 @@ export async function renderAdmin(root) {
               can_exec: !!canExec.checked,
               can_procs: !!canProcs.checked,
               can_fw: !!canFW.checked,
+              fw_read_only: !!fwReadOnly.checked,
               fs_sudo: !!fsSudo.checked,
               fs_any: !!fsAny.checked,
               fs_users: csvToArr(fsUsers.value),
+              must_change_password: !!mustChange.checked,
             };
             if (!payload.user) { alert(t("admin.userRequired")); return; }
             if (!isEdit && !payload.pass) { alert(t("admin.passwordRequired")); return; }
@@ -124,9 +124,11 @@ export async function renderFiles(root) {
 
   async function loadIdentities() {
     const info = await api("api/fs/identities");
-    fm.fsSelfName = info.self || "self";
+    fm.fsSelfName = info.self && info.self !== "self" ? info.self : (info.self_uid != null ? `uid ${info.self_uid}` : "self");
     fm.fsAllowed = Array.isArray(info.allowed) ? info.allowed : ["self"];
     fm.fsAny = fm.fsAllowed.includes("*");
+    fm.maxRead = info.max_read_bytes || 1048576;
+    fm.sudoNeedsPassword = !!(info.sudo && info.sudo.needs_stored_password);
 
     const allowedUsers = new Set(fm.fsAllowed);
     fsUserSelect.replaceChildren();
@@ -433,7 +435,7 @@ export async function renderFiles(root) {
   }
 
   async function viewFile(path) {
-    const text = await fsApi(`api/fs/read?path=${encodeURIComponent(path)}&limit=262144`);
+    const text = await fsApi(`api/fs/read?path=${encodeURIComponent(path)}&limit=${Math.min(262144, fm.maxRead || 262144)}`);
     const head = el(
       "div",
       { class: "toolbar", style: "margin-bottom:10px;" },
@@ -448,7 +450,10 @@ export async function renderFiles(root) {
 
   async function editFile(path) {
     closeContextMenu();
-    const text = await fsApi(`api/fs/read?path=${encodeURIComponent(path)}&limit=1048576`);
+    let charset = "utf-8";
+    const text = await fsApi(`api/fs/read?path=${encodeURIComponent(path)}&limit=${fm.maxRead || 1048576}`, {
+      onHeaders: (h) => { charset = h.get("X-Atlas-Charset") || "utf-8"; },
+    });
     if (text.includes("\u0000")) {
       showModal(t("common.error"), t("files.binaryDisabled"));
       return;
@@ -472,7 +477,7 @@ export async function renderFiles(root) {
         await fsApi("api/fs/write", {
           method: "POST",
           headers: { "content-type": "application/json" },
-          body: JSON.stringify({ path, content: textarea.value }),
+          body: JSON.stringify({ path, content: textarea.value, charset }),
         });
         closeModal();
         await refresh();
@@ -486,8 +491,10 @@ export async function renderFiles(root) {
   async function uploadFiles(files) {
     const form = new FormData();
     for (const f of files) form.append("file", f, f.name);
-    await fsApi(`api/fs/upload?path=${encodeURIComponent(fm.path)}`, { method: "POST", body: form });
+    const res = await fsApi(`api/fs/upload?path=${encodeURIComponent(fm.path)}`, { method: "POST", body: form });
     await refresh();
+    const failed = (res && res.results || []).filter((r) => !r.ok);
+    if (failed.length) alert(`${t("files.uploadFailed")}\n${failed.map((r) => `${r.name}: ${r.error}`).join("\n")}`);
   }
 
   async function newFolder() {
@@ -522,7 +529,20 @@ export async function renderFiles(root) {
   async function deleteSelected() {
     const paths = Array.from(fm.selected);
     if (!paths.length) return;
-    const ok = confirm(t("files.deleteConfirm", { n: paths.length }));
+    let msg = t("files.deleteConfirm", { n: paths.length });
+    try {
+      const plan = await fsApi("api/fs/delete?dry_run=1", {
+        method: "POST",
+        headers: { "content-type": "application/json" },
+        body: JSON.stringify({ paths }),
+      });
+      msg += "\n\n" + t("files.deletePlan", { count: plan.count, size: fmtBytes(plan.total_bytes) });
+      const shown = (plan.paths || []).slice(0, 10);
+      if (shown.length) msg += "\n" + shown.join("\n") + (plan.count > shown.length ? "\n…" : "");
+    } catch {
+      // Without a preview the plain confirmation still applies.
+    }
+    const ok = confirm(msg);
     if (!ok) return;
     await fsApi("api/fs/delete", {
       method: "POST",
@@ -554,7 +574,7 @@ export async function renderFiles(root) {
             "div",
             { class: "fm-meta", title: fm.searchMode ? ent.path : "" },
             fm.searchMode
-              ? `${ent.is_dir ? t("files.folder") : fmtBytes(ent.size)} · ${ent.path}`
+              ? `${ent.is_dir ? t("files.folder") : fmtBytes(ent.size)} · ${ent.rel_path || ent.path}`
               : (ent.is_dir ? t("files.folder") : fmtBytes(ent.size)),
           ),
         );
@@ -594,7 +614,7 @@ export async function renderFiles(root) {
         { class: "fm-row", "data-path": ent.path },
         el("td", {}, (() => {
           const nameCol = el("div", { class: "fm-namecol" }, el("span", { class: "mono" }, ent.name));
-          if (fm.searchMode) nameCol.append(el("div", { class: "fm-subpath mono", title: ent.path }, ent.path));
+          if (fm.searchMode) nameCol.append(el("div", { class: "fm-subpath mono", title: ent.path }, ent.rel_path || ent.path));
           return el("div", { class: "fm-namecell" }, entryIcon(ent, true), nameCol);
         })()),
         el("td", {}, ent.is_dir ? "—" : fmtBytes(ent.size)),
@@ -626,6 +646,7 @@ export async function renderFiles(root) {
     status.replaceChildren(
       el("span", {}, t("files.statusUser", { user: state.me || "—" })),
       el("span", {}, t("files.statusFs", { fs: fsUserDisplay() })),
+      fm.sudoNeedsPassword && fm.fsUser !== "self" ? el("span", { style: "color:var(--danger);" }, t("files.sudoNeedsPassword")) : " ",
       el("span", {}, t("files.statusItems", { n: entries.length })),
       fm.searching ? el("span", {}, t("files.searching")) : " ",
       fm.searchMode ? el("span", {}, t("files.searchResults", { q: fm.search })) : " ",
@@ -1,5 +1,6 @@
 import { api } from "../api.js";
 import { el } from "../dom.js";
+import { fmtUptime } from "../format.js";
 import { t } from "../i18n.js";
 import { state } from "../state.js";
 
@@ -26,9 +27,14 @@ function modal(title, bodyNodes, actions) {
 function parsePortsInput(s) {
   s = String(s || "").trim();
   if (!s) return null;
-  if (/^\d+$/.test(s)) return s;
-  if (/^\d+\s*-\s*\d+$/.test(s)) return s.replace(/\s+/g, "");
-  return null;
+  const parts = s.split(",").map((p) => p.replace(/\s+/g, ""));
+  if (!parts.every((p) => /^\d+(-\d+)?$/.test(p))) return null;
+  return parts.join(",");
+}
+
+function rulePortsText(r) {
+  const ranges = r.port_ranges?.length ? r.port_ranges : [{ from: r.port_from, to: r.port_to }];
+  return ranges.map((p) => (p.from === p.to || !p.to ? String(p.from) : `${p.from}-${p.to}`)).join(",");
 }
 
 export async function renderFirewall(root) {
@@ -41,12 +47,14 @@ export async function renderFirewall(root) {
   const body = el("div");
   wrap.append(head, body);
   root.append(wrap);
+  // rulesSort is the ?sort= of the rules list ("": the order rules are applied in).
+  let rulesSort = "";
 
   async function load() {
     body.replaceChildren(el("div", { class: "path" }, t("common.loading")));
     const [st, rules] = await Promise.all([
       api("api/firewall/status"),
-      api("api/firewall/rules").catch(() => ({ enabled: false, rules: [] })),
+      api(`api/firewall/rules${rulesSort ? `?sort=${rulesSort}` : ""}`).catch(() => ({ enabled: false, rules: [] })),
     ]);
     render(st, rules);
   }
@@ -67,6 +75,7 @@ export async function renderFirewall(root) {
       el("span", { class: "pm-spacer" }),
       el("button", {
         class: enabled ? "danger" : "",
+        disabled: !state.canFWEdit ? "disabled" : null,
         onclick: async () => {
           await api("api/firewall/enabled", {
             method: "POST",
@@ -81,17 +90,25 @@ export async function renderFirewall(root) {
       el("button", {
         class: "secondary",
         onclick: async () => { await api("api/firewall/apply", { method: "POST" }); await load(); },
-        disabled: !enabled ? "disabled" : null,
+        disabled: !enabled || !state.canFWEdit ? "disabled" : null,
       }, t("firewall.apply")),
       el("button", { class: "secondary", onclick: () => load() }, t("common.refresh")),
     );
 
     const notes = [];
     if (!st.config_enabled) notes.push(dangerText(t("firewall.configDisabled")));
+    if (!state.canFWEdit) notes.push(el("div", { class: "path" }, t("firewall.readOnly")));
     if (st.error) notes.push(dangerText(st.error));
+    if (st.sudo && st.sudo.needs_stored_password) notes.push(dangerText(t("firewall.sudoNeedsPassword")));
     if (isSystemTool) {
       notes.push(el("div", { class: "path" }, t("firewall.atlasNote", { tool })));
     }
+    if (st.docker) {
+      const chains = (st.docker.chains || []).join("\n");
+      notes.push(el("div", { class: "path", title: chains || null }, t("firewall.dockerDetected")));
+      if (st.docker.bypass) notes.push(dangerText(t("firewall.dockerBypass")));
+      if (st.docker.redirect_order) notes.push(dangerText(t("firewall.dockerRedirectOrder")));
+    }
     if (extTool) {
       if (st.external_error) {
         notes.push(dangerText(t("firewall.externalError", { tool: extTool, err: st.external_error })));
@@ -107,28 +124,41 @@ export async function renderFirewall(root) {
     );
   }
 
-  function ruleRow(r, onToggle, onEdit, onDelete, onPortLookup) {
+  function ruleRow(r, created, expiresIn, unitState, onToggle, onEdit, onDelete, onPortLookup) {
     const hasService = !!(r.service && String(r.service).trim());
-    const ports = r.port_from === r.port_to ? String(r.port_from) : `${r.port_from}-${r.port_to}`;
+    const ports = rulePortsText(r);
     const descr = hasService
       ? `service:${r.service}`
-      : (r.type === "redirect" ? `${ports} → ${r.to_port}` : ports);
-    return el("tr", {},
+      : (r.type === "redirect" ? `${ports} → ${r.to_addr ? `${r.to_addr}:` : ""}${r.to_port}${r.masquerade ? ` (${t("firewall.masquerade")})` : ""}` : ports);
+    const where = r.interface ? ` ${t("firewall.onInterface", { iface: r.interface })}` : "";
+    const audit = [
+      created ? t("firewall.createdAt", { time: created.local }) : "",
+      r.created_by ? t("firewall.createdBy", { user: r.created_by }) : "",
+      r.updated_by ? t("firewall.updatedBy", { user: r.updated_by }) : "",
+    ].filter(Boolean).join(", ");
+    return el("tr", { title: audit || null },
       el("td", {}, el("input", {
         type: "checkbox",
         checked: !!r.enabled,
+        disabled: r.linked_unit || !state.canFWEdit ? "" : null,
+        title: r.linked_unit ? t("firewall.linkedUnitHint") : null,
         onchange: (e) => onToggle(!!e.target.checked),
       })),
       el("td", { class: "mono" }, r.type),
       el("td", { class: "mono" }, r.proto),
-      el("td", { class: "mono" }, descr),
-      el("td", {}, r.comment || ""),
+      el("td", { class: "mono" }, descr + where),
+      el("td", {},
+        r.comment || "",
+        expiresIn != null ? el("span", { class: "pill", style: "margin-left:6px;" }, t("firewall.expiresIn", { t: fmtUptime(expiresIn) })) : null,
+        r.linked_unit ? el("span", { class: "pill", style: "margin-left:6px;" }, t("firewall.linkedUnit", { unit: r.linked_unit, state: unitState || "unknown" })) : null,
+        r.runtime_only ? el("span", { class: "pill", style: "margin-left:6px;", title: t("firewall.permanentHint") }, t("firewall.runtimeOnly")) : null,
+      ),
       el("td", { style: "text-align:right; white-space:nowrap;" },
         hasService ? null : el("button", { class: "secondary", onclick: () => onPortLookup(r.type === "redirect" ? r.to_port : r.port_from) }, t("firewall.whoUsesPort")),
         hasService ? null : " ",
-        el("button", { class: "secondary", onclick: onEdit }, t("common.edit")),
+        el("button", { class: "secondary", onclick: onEdit, disabled: !state.canFWEdit ? "disabled" : null }, t("common.edit")),
         " ",
-        el("button", { class: "danger", onclick: onDelete }, t("common.delete")),
+        el("button", { class: "danger", onclick: onDelete, disabled: !state.canFWEdit ? "disabled" : null }, t("common.delete")),
       ),
     );
   }
@@ -174,6 +204,53 @@ export async function renderFirewall(root) {
     );
   }
 
+  function baseRulesButtons(rulesResp) {
+    const base = (rulesResp.system_rules || []).length > 0;
+    const drop = rulesResp.policy === "drop";
+    const set = async (next) => {
+      try {
+        await api("api/firewall/base", {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify(next),
+        });
+        await load();
+      } catch (e) {
+        alert(e.message || String(e));
+      }
+    };
+    return el("span", {},
+      el("button", {
+        class: "secondary",
+        disabled: !state.canFWEdit ? "disabled" : null,
+        onclick: () => set({ base_rules: !base, policy_drop: base ? false : drop }),
+      }, t(base ? "firewall.baseRulesOff" : "firewall.baseRulesOn")),
+      " ",
+      el("button", {
+        class: drop ? "secondary" : "danger",
+        disabled: !base || !state.canFWEdit ? "disabled" : null,
+        onclick: () => {
+          if (!drop && !confirm(t("firewall.policyDropConfirm"))) return;
+          set({ base_rules: true, policy_drop: !drop });
+        },
+      }, t(drop ? "firewall.policyAccept" : "firewall.policyDrop")),
+    );
+  }
+
+  function sortSelect() {
+    const sel = el("select", {
+      onchange: (e) => {
+        rulesSort = e.target.value;
+        load().catch(err => alert(err.message || String(err)));
+      },
+    });
+    for (const [v, key] of [["", "sortApply"], ["created", "sortCreated"], ["port", "sortPort"], ["type", "sortType"]]) {
+      sel.append(el("option", { value: v }, t(`firewall.${key}`)));
+    }
+    sel.value = rulesSort;
+    return sel;
+  }
+
   function renderRules(st, rulesResp) {
     const enabled = !!rulesResp.enabled;
     const rules = rulesResp.rules || [];
@@ -183,7 +260,7 @@ export async function renderFirewall(root) {
 
     const addBtn = el("button", {
       onclick: () => openAddEdit(),
-      disabled: !st.config_enabled ? "disabled" : null,
+      disabled: !st.config_enabled || !state.canFWEdit ? "disabled" : null,
     }, t("firewall.addRule"));
 
     const table = el("table", {},
@@ -230,17 +307,32 @@ export async function renderFirewall(root) {
       for (const v of ["tcp", "udp"]) protoSel.append(el("option", { value: v }, v));
       const portsIn = el("input", { class: "mono", placeholder: t("firewall.portsPlaceholder") });
       const toPortIn = el("input", { class: "mono", type: "number", placeholder: t("firewall.toPortPlaceholder"), min: "1", max: "65535" });
+      const toAddrIn = el("input", { class: "mono", placeholder: t("firewall.toAddrPlaceholder") });
+      const masqIn = el("input", { type: "checkbox" });
+      const masqRow = el("div", { class: "toolbar", title: t("firewall.masqueradeHint") }, masqIn, el("span", { class: "path" }, t("firewall.masquerade")));
       const serviceIn = el("input", { class: "mono", placeholder: t("firewall.servicePlaceholder") });
+      const ifaceIn = el("input", { class: "mono", placeholder: t("firewall.interfacePlaceholder") });
+      const unitIn = el("input", { class: "mono", placeholder: t("firewall.linkedUnitPlaceholder") });
       const enabledIn = el("input", { type: "checkbox" });
+      const permanentIn = el("input", { type: "checkbox" });
       const commentIn = el("input", { placeholder: t("firewall.commentPlaceholder") });
+      const ttlSel = el("select");
+      for (const [v, key] of [[0, "ttlPermanent"], [900, "ttl15m"], [3600, "ttl1h"], [14400, "ttl4h"], [86400, "ttl1d"]]) {
+        ttlSel.append(el("option", { value: String(v) }, t(`firewall.${key}`)));
+      }
 
       function syncVisibility() {
         const useService = allowService && !!serviceIn.value.trim();
         portsIn.disabled = useService;
         toPortIn.style.display = typeSel.value === "redirect" && !useService ? "" : "none";
+        toAddrIn.style.display = toPortIn.style.display;
+        masqRow.style.display = typeSel.value === "redirect" && !useService && tool === "nft" && toAddrIn.value.trim() ? "" : "none";
+        enabledIn.disabled = !!unitIn.value.trim();
       }
       typeSel.addEventListener("change", syncVisibility);
       serviceIn.addEventListener("input", syncVisibility);
+      unitIn.addEventListener("input", syncVisibility);
+      toAddrIn.addEventListener("input", syncVisibility);
 
       if (rule) {
         typeSel.value = rule.type || "allow";
@@ -249,15 +341,21 @@ export async function renderFirewall(root) {
           portsIn.value = "";
           serviceIn.value = rule.service;
         } else {
-          portsIn.value = rule.port_from === rule.port_to ? String(rule.port_from) : `${rule.port_from}-${rule.port_to}`;
+          portsIn.value = rulePortsText(rule);
         }
         toPortIn.value = rule.to_port || "";
+        toAddrIn.value = rule.to_addr || "";
+        masqIn.checked = !!rule.masquerade;
+        ifaceIn.value = rule.interface || "";
+        unitIn.value = rule.linked_unit || "";
         enabledIn.checked = !!rule.enabled;
+        permanentIn.checked = !rule.runtime_only;
         commentIn.value = rule.comment || "";
       } else {
         typeSel.value = "allow";
         protoSel.value = "tcp";
         enabledIn.checked = true;
+        permanentIn.checked = true;
       }
       if (!allowService) {
         serviceIn.disabled = true;
@@ -271,13 +369,18 @@ export async function renderFirewall(root) {
           el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.type")), typeSel),
           el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.proto")), protoSel),
           el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.ports")), portsIn),
-          el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.redirectTo")), toPortIn),
+          el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.redirectTo")), toAddrIn, toPortIn),
+          masqRow,
           el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.serviceLabel")), serviceIn),
+          el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.interfaceLabel")), ifaceIn),
         ),
         el("div", {},
           el("div", { class: "path" }, t("firewall.optionsTitle")),
           el("div", { class: "toolbar" }, enabledIn, el("span", { class: "path" }, t("firewall.enabledLabel"))),
+          tool === "firewall-cmd" ? el("div", { class: "toolbar", title: t("firewall.permanentHint") }, permanentIn, el("span", { class: "path" }, t("firewall.permanentLabel"))) : null,
           el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.commentLabel")), commentIn),
+          el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.linkedUnitLabel")), unitIn),
+          rule ? null : el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.ttlLabel")), ttlSel),
           el("div", { class: "path" }, t("firewall.portsHelp")),
         ),
       );
@@ -301,19 +404,24 @@ export async function renderFirewall(root) {
               proto: protoSel.value,
               ports,
               to_port: Number(toPortIn.value || 0),
+              to_addr: typeSel.value === "redirect" ? toAddrIn.value.trim() : "",
+              masquerade: typeSel.value === "redirect" && !!toAddrIn.value.trim() && !!masqIn.checked,
               service,
+              interface: ifaceIn.value.trim(),
+              linked_unit: unitIn.value.trim(),
               comment: commentIn.value || "",
             };
+            if (tool === "firewall-cmd") payload.permanent = !!permanentIn.checked;
             try {
               if (rule) {
                 await editRule(rule, payload);
                 // enabled toggle is separate
-                if (!!enabledIn.checked !== !!rule.enabled) await toggleRule(rule, !!enabledIn.checked);
+                if (!payload.linked_unit && !rule.linked_unit && !!enabledIn.checked !== !!rule.enabled) await toggleRule(rule, !!enabledIn.checked);
               } else {
                 await api("api/firewall/rules", {
                   method: "POST",
                   headers: { "content-type": "application/json" },
-                  body: JSON.stringify({ ...payload, enabled: !!enabledIn.checked, position: -1 }),
+                  body: JSON.stringify({ ...payload, enabled: !!enabledIn.checked, position: -1, ttl_seconds: Number(ttlSel.value) }),
                 });
               }
               m.close();
@@ -376,9 +484,138 @@ export async function renderFirewall(root) {
       setTimeout(() => m.card.querySelector("button.secondary")?.click(), 10);
     }
 
+    function openSimulate() {
+      const protoSel = el("select");
+      for (const v of ["tcp", "udp"]) protoSel.append(el("option", { value: v }, v));
+      const portIn = el("input", { class: "mono", type: "number", min: "1", max: "65535", placeholder: "443" });
+      const sourceIn = el("input", { class: "mono", placeholder: t("firewall.simulateSourcePlaceholder") });
+      const ifaceIn = el("input", { class: "mono", placeholder: t("firewall.interfacePlaceholder") });
+      const out = el("div", { style: "margin-top:10px;" }, "");
+      const m = modal(t("firewall.simulateTitle"), [
+        el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.proto")), protoSel),
+        el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.port")), portIn),
+        el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.simulateSource")), sourceIn),
+        el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.interfaceLabel")), ifaceIn),
+        out,
+      ], [
+        el("button", { class: "secondary", onclick: () => m.close() }, t("common.close")),
+        el("button", {
+          onclick: async () => {
+            try {
+              const res = await api("api/firewall/simulate", {
+                method: "POST",
+                headers: { "content-type": "application/json" },
+                body: JSON.stringify({
+                  proto: protoSel.value,
+                  port: Number(portIn.value || 0),
+                  source: sourceIn.value.trim(),
+                  interface: ifaceIn.value.trim(),
+                }),
+              });
+              const accepted = res.verdict === "accept" || res.verdict === "forward";
+              const verdictKey = res.verdict === "forward" ? "firewall.simulateForward" : (accepted ? "firewall.simulateAccept" : "firewall.simulateDrop");
+              out.replaceChildren(
+                el("div", { style: `color:var(${accepted ? "--accent" : "--danger"});` },
+                  t(verdictKey, { to: res.forwarded_to || "" }),
+                  res.rule_id ? ` — ${t("firewall.simulateRule", { id: res.rule_id })}` : ""),
+                el("div", { class: "path" }, res.reason || ""),
+                res.redirect_id ? el("div", { class: "path" }, t("firewall.simulateRedirect", { port: res.redirected_to, id: res.redirect_id })) : null,
+                res.skipped?.length ? el("div", { class: "path" }, t("firewall.simulateSkipped", { ids: res.skipped.join(", ") })) : null,
+              );
+            } catch (e) {
+              out.replaceChildren(dangerText(e.message || String(e)));
+            }
+          },
+        }, t("firewall.check")),
+      ]);
+      portIn.focus();
+    }
+
+    function openBan() {
+      const sourceIn = el("input", { class: "mono", placeholder: t("firewall.banSourcePlaceholder") });
+      const ttlSel = el("select");
+      for (const [v, key] of [[0, "ttlPermanent"], [900, "ttl15m"], [3600, "ttl1h"], [14400, "ttl4h"], [86400, "ttl1d"]]) {
+        ttlSel.append(el("option", { value: String(v) }, t(`firewall.${key}`)));
+      }
+      const commentIn = el("input", { placeholder: t("firewall.commentPlaceholder") });
+      const err = el("div");
+      const m = modal(t("firewall.banTitle"), [
+        el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.banSource")), sourceIn),
+        el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.ttlLabel")), ttlSel),
+        el("div", { class: "toolbar" }, el("span", { class: "path" }, t("firewall.commentLabel")), commentIn),
+        err,
+      ], [
+        el("button", { class: "secondary", onclick: () => m.close() }, t("common.cancel")),
+        el("button", {
+          class: "danger",
+          onclick: async () => {
+            try {
+              await api("api/firewall/ban", {
+                method: "POST",
+                headers: { "content-type": "application/json" },
+                body: JSON.stringify({
+                  source: sourceIn.value.trim(),
+                  ttl_seconds: Number(ttlSel.value || 0),
+                  comment: commentIn.value.trim(),
+                }),
+              });
+              m.close();
+              await load();
+            } catch (e) {
+              err.replaceChildren(dangerText(e.message || String(e)));
+            }
+          },
+        }, t("firewall.ban")),
+      ]);
+      sourceIn.focus();
+    }
+
+    async function unban(ban) {
+      if (!confirm(t("firewall.unbanConfirm", { source: ban.source }))) return;
+      await api("api/firewall/unban", {
+        method: "POST",
+        headers: { "content-type": "application/json" },
+        body: JSON.stringify({ id: ban.id }),
+      });
+      await load();
+    }
+
+    for (const b of rulesResp.bans || []) {
+      const expiresIn = (rulesResp.expires_in || {})[b.id];
+      tbody.append(el("tr", { title: b.created_by ? t("firewall.createdBy", { user: b.created_by }) : null },
+        el("td", {}, pill(t("firewall.banned"))),
+        el("td", {}, "deny"),
+        el("td", { class: "mono", colspan: "2" }, b.source),
+        el("td", {},
+          b.comment || "",
+          expiresIn != null ? el("span", { class: "pill", style: "margin-left:6px;" }, t("firewall.expiresIn", { t: fmtUptime(expiresIn) })) : null,
+        ),
+        el("td", { style: "text-align:right;" },
+          el("button", {
+            class: "secondary",
+            disabled: !state.canFWEdit ? "disabled" : null,
+            onclick: () => unban(b).catch(e => alert(e.message || String(e))),
+          }, t("firewall.unban")),
+        ),
+      ));
+    }
+
+    for (const sr of rulesResp.system_rules || []) {
+      tbody.append(el("tr", {},
+        el("td", {}, pill(t("firewall.systemRule"))),
+        el("td", {}, sr.verdict === "accept" ? "allow" : sr.verdict),
+        el("td", { class: "mono", colspan: "2" }, sr.match),
+        el("td", {}, t("firewall.systemRuleHint")),
+        el("td", {}),
+      ));
+    }
+
     for (const r of rules) {
       tbody.append(ruleRow(
         r,
+        (rulesResp.created || {})[r.id],
+        (rulesResp.expires_in || {})[r.id],
+        (rulesResp.linked_units || {})[r.linked_unit],
         (v) => toggleRule(r, v).catch(e => alert(e.message || String(e))),
         () => openAddEdit(r),
         () => deleteRule(r).catch(e => alert(e.message || String(e))),
@@ -391,8 +628,33 @@ export async function renderFirewall(root) {
       el("div", { class: "toolbar" },
         addBtn,
         pill(t("firewall.count", { n: rules.length })),
+        el("button", { class: "secondary", onclick: () => openSimulate() }, t("firewall.simulate")),
+        el("button", {
+          class: "secondary",
+          disabled: !st.config_enabled || !state.canFWEdit ? "disabled" : null,
+          onclick: () => openBan(),
+        }, t("firewall.ban")),
+        isSystemTool ? el("button", {
+          class: "secondary",
+          disabled: !st.config_enabled || !state.canFWEdit ? "disabled" : null,
+          onclick: async () => {
+            try {
+              const res = await api("api/firewall/import-system", { method: "POST" });
+              alert(t("firewall.importSystemDone", { n: (res.imported || []).length }));
+              await load();
+            } catch (e) {
+              alert(e.message || String(e));
+            }
+          },
+        }, t("firewall.importSystem", { tool })) : null,
         pill(t(isSystemTool ? "firewall.atlasEnabledShort" : "firewall.firewallEnabled", { enabled: enabled ? t("common.yes") : t("common.no") })),
+        tool === "nft" ? baseRulesButtons(rulesResp) : null,
+        el("span", { class: "pm-spacer" }),
+        el("span", { class: "path" }, t("firewall.sortLabel")),
+        sortSelect(),
       ),
+      rulesResp.sort ? el("div", { class: "path" }, t("firewall.sortedNote")) : null,
+      ...(rulesResp.warnings || []).map((w) => el("div", { class: "path", style: "color:var(--warn, #ffb020);" }, `${t("firewall.overlapWarning")}: ${w}`)),
       table,
     );
   }
@@ -305,7 +305,8 @@ export async function renderMonitor(root, initialPage) {
   }
 
   async function tickStats() {
-    mon.stats = await api("api/stats");
+    // Share samples between tabs polling at the same time.
+    mon.stats = await api(`api/stats?min_interval=${Math.floor(mon.intervalMs / 2)}ms`);
     mon.info = await api("api/system/info");
     mon.hist.push({
       t: Date.now(),
@@ -364,6 +365,24 @@ export async function renderMonitor(root, initialPage) {
       ),
     );
 
+    const disks = (s.disks || []).length ? el("div", { class: "chart" },
+      el("div", { class: "title" }, t("monitor.diskIO")),
+      el("div", { class: "kv" },
+        ...s.disks.flatMap((d) => [
+          el("div", { class: "k" }, d.device),
+          el("div", {}, `${t("monitor.diskRead")} ${fmtRate(d.read_bytes_s)} · ${t("monitor.diskWrite")} ${fmtRate(d.write_bytes_s)} · ${t("monitor.diskUtil")} ${fmtPct(d.util_pct)}`),
+        ]),
+      ),
+    ) : null;
+
+    const errs = Object.entries(s.errors || {});
+    const unavailable = errs.length ? el("div", { class: "chart" },
+      el("div", { class: "title" }, t("monitor.unavailable")),
+      el("div", { class: "kv" },
+        ...errs.flatMap(([k, msg]) => [el("div", { class: "k" }, k), el("div", {}, msg)]),
+      ),
+    ) : null;
+
     const sys = el("div", { class: "chart" },
       el("div", { class: "title" }, t("monitor.system")),
       el("div", { class: "kv" },
@@ -372,10 +391,15 @@ export async function renderMonitor(root, initialPage) {
         el("div", { class: "k" }, t("monitor.kernel")), el("div", {}, i.kernel || "—"),
         el("div", { class: "k" }, t("monitor.uptime")), el("div", {}, fmtUptime(i.uptime_seconds)),
         el("div", { class: "k" }, t("monitor.load")), el("div", {}, `${(i.load1 || 0).toFixed(2)} ${(i.load5 || 0).toFixed(2)} ${(i.load15 || 0).toFixed(2)}`),
+        ...(i.service ? [
+          el("div", { class: "k" }, t("monitor.atlasService")),
+          el("div", { title: i.service.unit },
+            `${i.service.active ? t("monitor.serviceActive") : t("monitor.serviceInactive")} · ${i.service.enabled ? t("monitor.serviceEnabled") : t("monitor.serviceDisabled")}`),
+        ] : []),
       ),
     );
 
-    replaceMain(grid, net, sys);
+    replaceMain(grid, net, ...(disks ? [disks] : []), sys, ...(unavailable ? [unavailable] : []));
   }
 
   function renderHistory() {
@@ -470,12 +494,61 @@ export async function renderMonitor(root, initialPage) {
   async function sendSignal(sig, pidOrPids) {
     if (!state.canProcs) return;
     const body = Array.isArray(pidOrPids) ? { pids: pidOrPids, signal: sig } : { pid: pidOrPids, signal: sig };
-    await api("api/processes/signal", {
+    const res = await api("api/processes/signal", {
       method: "POST",
       headers: { "content-type": "application/json" },
       body: JSON.stringify(body),
     });
     await tickProcs();
+    const failed = (res?.results || []).filter(r => r.status !== "ok");
+    if (failed.length) alert(`${t("monitor.signalFailed")}:\n${failed.map(r => `${r.pid}: ${r.hint || r.error || r.status}`).join("\n")}`);
+  }
+
+  async function showEnv(pid) {
+    const list = el("div", { class: "path" }, t("common.loading"));
+    const card = el("div", { class: "card" },
+      el("div", { class: "pm-title" }, t("monitor.envTitle", { pid })),
+      list,
+      el("div", { class: "toolbar", style: "margin-top:10px; justify-content:flex-end;" },
+        el("button", { class: "secondary", onclick: () => wrap.remove() }, t("common.close"))),
+    );
+    const wrap = el("div", { class: "modal", onclick: (e) => { if (e.target === wrap) wrap.remove(); } }, card);
+    document.body.append(wrap);
+    try {
+      const res = await api(`api/processes/details?pid=${encodeURIComponent(pid)}&env=1`);
+      if (res.env_error) {
+        list.replaceChildren(el("div", { style: "color:var(--danger);" }, res.env_error));
+        return;
+      }
+      const rows = (res.env || []).map((v) => el("tr", {},
+        el("td", { class: "mono" }, v.name),
+        el("td", { class: "mono", style: "word-break:break-all;" }, v.redacted ? t("monitor.envRedacted") : (v.value ?? "")),
+      ));
+      list.replaceChildren(
+        state.isAdmin ? "" : el("div", { class: "path" }, t("monitor.envNamesOnly")),
+        el("table", {}, el("tbody", {}, ...rows)),
+      );
+    } catch (e) {
+      list.replaceChildren(el("div", { style: "color:var(--danger);" }, e.message || String(e)));
+    }
+  }
+
+  async function showCommand(pid) {
+    const body = el("div", { class: "mono", style: "white-space:pre-wrap; word-break:break-all;" }, t("common.loading"));
+    const card = el("div", { class: "card" },
+      el("div", { class: "pm-title" }, t("monitor.commandTitle", { pid })),
+      body,
+      el("div", { class: "toolbar", style: "margin-top:10px; justify-content:flex-end;" },
+        el("button", { class: "secondary", onclick: () => wrap.remove() }, t("common.close"))),
+    );
+    const wrap = el("div", { class: "modal", onclick: (e) => { if (e.target === wrap) wrap.remove(); } }, card);
+    document.body.append(wrap);
+    try {
+      const res = await api(`api/processes/details?pid=${encodeURIComponent(pid)}`);
+      body.textContent = res.command || "";
+    } catch (e) {
+      body.replaceChildren(el("div", { style: "color:var(--danger);" }, e.message || String(e)));
+    }
   }
 
   function renderProcesses() {
@@ -541,6 +614,9 @@ export async function renderMonitor(root, initialPage) {
           { label: t("monitor.sigHup"), action: () => sendSignal("HUP", p.pid), disabled },
           { label: t("monitor.sigUsr1"), action: () => sendSignal("USR1", p.pid), disabled },
           { label: t("monitor.sigUsr2"), action: () => sendSignal("USR2", p.pid), disabled },
+          { sep: true },
+          { label: t("monitor.showEnv"), action: () => showEnv(p.pid), disabled },
+          ...(p.command_truncated ? [{ label: t("monitor.showCommand"), action: () => showCommand(p.pid) }] : []),
         ]);
       });
       if (Number(mon.procSelected) === Number(p.pid)) tr.classList.add("selected");
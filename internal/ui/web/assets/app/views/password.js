@@ -0,0 +1,49 @@
+import { api } from "../api.js";
+import { el } from "../dom.js";
+import { t } from "../i18n.js";
+
+// passwordForm returns the "change my password" controls; onDone runs after a successful change.
+export function passwordForm(onDone) {
+  const currentIn = el("input", { type: "password", autocomplete: "current-password", style: "width:220px;" });
+  const newIn = el("input", { type: "password", autocomplete: "new-password", style: "width:220px;" });
+  const confirmIn = el("input", { type: "password", autocomplete: "new-password", style: "width:220px;" });
+  const row = (label, input) => el("div", { class: "toolbar" }, el("span", { class: "path" }, label), input);
+
+  const btn = el("button", {
+    onclick: async () => {
+      if (!newIn.value) { alert(t("password.newRequired")); return; }
+      if (newIn.value !== confirmIn.value) { alert(t("password.mismatch")); return; }
+      btn.disabled = true;
+      try {
+        await api("api/me/password", {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ current_password: currentIn.value, new_password: newIn.value }),
+        });
+        currentIn.value = newIn.value = confirmIn.value = "";
+        alert(t("password.changed"));
+        if (onDone) onDone();
+      } catch (e) {
+        alert(e.message || String(e));
+      } finally {
+        btn.disabled = false;
+      }
+    },
+  }, t("password.change"));
+
+  return el("div", {},
+    row(t("password.current"), currentIn),
+    row(t("password.new"), newIn),
+    row(t("password.confirm"), confirmIn),
+    el("div", { class: "toolbar" }, btn),
+  );
+}
+
+// renderPasswordRequired is the only view shown while the account must change its password.
+export function renderPasswordRequired(root) {
+  root.replaceChildren(el("div", { class: "card" },
+    el("div", { class: "path" }, t("password.title")),
+    el("div", { class: "path" }, t("password.required")),
+    passwordForm(() => { window.location.href = "./"; }),
+  ));
+}
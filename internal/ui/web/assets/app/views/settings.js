@@ -1,8 +1,10 @@
 import { api } from "../api.js";
 import { el } from "../dom.js";
+import { fmtDate } from "../format.js";
 import { state } from "../state.js";
 import { getLang, LANGS, setLang, t } from "../i18n.js";
 import { applyTheme, getTheme } from "../theme.js";
+import { passwordForm } from "./password.js";
 
 function row(label, node) {
   return el("div", { class: "kv" },
@@ -28,14 +30,38 @@ export async function renderSettings(root) {
   langSel.value = getLang();
   langSel.addEventListener("change", () => setLang(langSel.value));
 
+  const tzIn = el("input", { class: "mono", placeholder: "UTC", value: state.timeZone || "UTC", style: "width:180px;" });
+  const tzBtn = el("button", {
+    class: "secondary",
+    onclick: async () => {
+      try {
+        const res = await api("api/me/timezone", {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ time_zone: (tzIn.value || "").trim() }),
+        });
+        state.timeZone = res.time_zone;
+        tzIn.value = res.time_zone;
+      } catch (e) {
+        alert(e.message || String(e));
+      }
+    },
+  }, t("common.save"));
+
   const themeCard = el("div", { class: "card" },
     el("div", { class: "path" }, t("settings.title")),
     el("div", { class: "toolbar" },
       row(t("settings.themeMode"), themeSel),
       row(t("settings.language"), langSel),
+      row(t("settings.timeZone"), el("span", {}, tzIn, " ", tzBtn)),
     ),
   );
 
+  const passwordCard = el("div", { class: "card", style: "margin-top:12px;" },
+    el("div", { class: "path" }, t("password.title")),
+    passwordForm(null),
+  );
+
   // HTTPS (admin)
   const tlsCard = el("div", { class: "card", style: "margin-top:12px;" },
     el("div", { class: "path" }, t("settings.httpsTitle")),
@@ -117,6 +143,45 @@ export async function renderSettings(root) {
       },
     }, t("settings.httpsEnable"));
 
+    const expiry = el("div", { class: "path", style: "margin-top:10px;" }, "");
+    const details = el("div", { style: "margin-top:6px;" });
+    async function reloadTLSStatus() {
+      try {
+        const st = await api("api/admin/tls");
+        const sans = [...(st.dns_names || []), ...(st.ip_addresses || [])].join(", ");
+        details.replaceChildren(...(st.subject ? [
+          row(t("settings.httpsSubject"), el("span", { class: "mono" }, st.subject)),
+          row(t("settings.httpsIssuer"), el("span", { class: "mono" }, st.self_signed ? `${st.issuer} (${t("settings.httpsSelfSigned")})` : st.issuer)),
+          row(t("settings.httpsSANs"), el("span", { class: "mono" }, sans || "—")),
+          row(t("settings.httpsValidity"), `${fmtDate(st.not_before_unix)} — ${fmtDate(st.not_after_unix)}`),
+        ] : []));
+        if (st.restart_required) status.textContent = t("settings.httpsSavedRestart");
+        if (!st.enabled || !st.not_after_unix) { expiry.textContent = st.error || ""; return; }
+        const days = st.expires_in_days || 0;
+        expiry.textContent = t(days < 0 ? "settings.httpsExpired" : "settings.httpsExpires", { date: fmtDate(st.not_after_unix), days });
+        expiry.style.color = days < 30 ? "var(--danger)" : "";
+      } catch {
+        expiry.textContent = "";
+      }
+    }
+
+    const btnRegenerate = el("button", {
+      class: "secondary",
+      onclick: async () => {
+        if (!confirm(t("settings.httpsRegenerateConfirm"))) return;
+        btnRegenerate.disabled = true;
+        try {
+          const res = await api("api/admin/tls/regenerate", { method: "POST" });
+          status.textContent = t("settings.httpsRegenerated", { date: fmtDate(res.not_after_unix) });
+          await reloadTLSStatus();
+        } catch (e) {
+          alert(e.message || String(e));
+        } finally {
+          btnRegenerate.disabled = false;
+        }
+      },
+    }, t("settings.httpsRegenerate"));
+
     tlsCard.append(
       el("div", { class: "path" }, t("settings.httpsHelp")),
       el("div", { class: "path", style: "margin-top:10px;" }, t("settings.httpsCertPath")),
@@ -128,9 +193,12 @@ export async function renderSettings(root) {
       cert,
       el("div", { class: "path", style: "margin-top:10px;" }, t("settings.httpsKey")),
       key,
-      el("div", { class: "toolbar", style: "margin-top:10px;" }, btnEnable),
+      el("div", { class: "toolbar", style: "margin-top:10px;" }, btnEnable, btnRegenerate),
       status,
+      expiry,
+      details,
     );
+    reloadTLSStatus();
 
     // Autostart (systemd)
     const autoStatus = el("div", { class: "path", style: "margin-top:10px;" }, t("common.loading"));
@@ -201,6 +269,35 @@ export async function renderSettings(root) {
 
     // Uninstall
     const uninstallHint = el("div", { class: "path" }, t("settings.uninstallHelp"));
+    const scopeIn = {
+      remove_binary: el("input", { type: "checkbox", checked: true }),
+      remove_config: el("input", { type: "checkbox", checked: true }),
+      remove_data: el("input", { type: "checkbox", checked: true }),
+      remove_unit: el("input", { type: "checkbox", checked: true }),
+    };
+    const uninstallScope = () => Object.fromEntries(Object.entries(scopeIn).map(([k, v]) => [k, v.checked]));
+    const uninstallFiles = el("pre", { class: "mono", style: "margin-top:8px; white-space:pre-wrap;", hidden: "hidden" });
+    const previewBtn = el("button", {
+      class: "secondary",
+      disabled: !current?.enable_admin_actions ? "disabled" : null,
+      onclick: async () => {
+        previewBtn.disabled = true;
+        try {
+          const res = await api("api/admin/uninstall", {
+            method: "POST",
+            headers: { "content-type": "application/json" },
+            body: JSON.stringify({ ...uninstallScope(), dry_run: true }),
+          });
+          const files = Array.isArray(res.files) ? res.files : [];
+          uninstallFiles.textContent = files.length ? files.join("\n") : t("settings.uninstallNothing");
+          uninstallFiles.hidden = false;
+        } catch (e) {
+          alert(e.message || String(e));
+        } finally {
+          previewBtn.disabled = false;
+        }
+      },
+    }, t("settings.uninstallPreview"));
     const uninstallBtn = el("button", {
       class: "danger",
       disabled: !current?.enable_admin_actions ? "disabled" : null,
@@ -216,8 +313,12 @@ export async function renderSettings(root) {
           const res = await api("api/admin/uninstall", {
             method: "POST",
             headers: { "content-type": "application/json" },
-            body: JSON.stringify({ confirm: "DELETE" }),
+            body: JSON.stringify({ ...uninstallScope(), confirm: "DELETE" }),
           });
+          if (res?.pending) {
+            alert(t("admin.approvalPending"));
+            return;
+          }
           const files = Array.isArray(res.files) ? res.files : [];
           alert(`${t("settings.uninstallStarted")}\n\n${files.join("\n")}`);
         } catch (e) {
@@ -233,7 +334,12 @@ export async function renderSettings(root) {
     }
     uninstallCard.append(
       uninstallHint,
-      el("div", { class: "toolbar", style: "margin-top:10px;" }, uninstallBtn),
+      row(t("settings.uninstallBinary"), scopeIn.remove_binary),
+      row(t("settings.uninstallConfig"), scopeIn.remove_config),
+      row(t("settings.uninstallData"), scopeIn.remove_data),
+      row(t("settings.uninstallUnit"), scopeIn.remove_unit),
+      el("div", { class: "toolbar", style: "margin-top:10px;" }, previewBtn, uninstallBtn),
+      uninstallFiles,
     );
   }
 
@@ -246,6 +352,8 @@ export async function renderSettings(root) {
   } else {
     const status = el("div", { class: "path", style: "margin-top:8px;" }, t("common.loading"));
     const hint = el("div", { class: "path", style: "margin-top:6px;" }, "");
+    const checkLine = el("div", { class: "path", style: "margin-top:6px;" }, "");
+    const checkBtn = el("button", { class: "secondary" }, t("settings.updateCheckNow"));
     const channelSel = el("select", { class: "secondary" },
       el("option", { value: "auto" }, t("settings.updateChannelAuto")),
       el("option", { value: "stable" }, t("settings.updateChannelStable")),
@@ -253,12 +361,28 @@ export async function renderSettings(root) {
     );
     const btn = el("button", { class: "secondary" }, t("settings.updateNow"));
 
-    async function reload() {
+    function renderCheck(c) {
+      checkLine.style.color = c?.available ? "var(--accent)" : "";
+      if (!c?.checked_at || c.checked_at.startsWith("0001-")) {
+        checkLine.textContent = c?.auto ? "" : t("settings.updateCheckOff");
+      } else if (c.error) {
+        checkLine.textContent = `${t("settings.updateCheckError")}: ${c.error}`;
+      } else if (c.available) {
+        checkLine.textContent = t("settings.updateAvailable", { tag: c.latest });
+      } else if (c.latest) {
+        checkLine.textContent = t("settings.updateUpToDate", { tag: c.latest });
+      } else {
+        checkLine.textContent = "";
+      }
+    }
+
+    async function reload(check = false) {
       status.textContent = t("common.loading");
       hint.textContent = "";
       btn.disabled = true;
       try {
-        const res = await api("api/admin/update");
+        const res = await api(check ? "api/admin/update?check=1" : "api/admin/update");
+        renderCheck(res.check);
         const ch = (res.channel || "auto").toLowerCase();
         channelSel.value = (ch === "dev" || ch === "stable" || ch === "auto") ? ch : "auto";
         const running = !!res.status?.running;
@@ -268,6 +392,9 @@ export async function renderSettings(root) {
         const buildCh = res.build_ch || "—";
         status.textContent = t("settings.updateStatus", { version: ver, channel: buildCh, target: targetTag || res.resolved || "—" });
         hint.textContent = lastErr ? `${t("settings.updateLastError")}: ${lastErr}` : t("settings.updateLogsHint");
+        if (res.status?.rolled_back) {
+          hint.textContent = `${t("settings.updateRolledBack")} ${hint.textContent}`;
+        }
         btn.disabled = running || !res.actions_enabled;
         btn.className = running ? "secondary" : "secondary";
         btn.textContent = running ? t("settings.updateRunning") : t("settings.updateNow");
@@ -280,6 +407,15 @@ export async function renderSettings(root) {
       }
     }
 
+    checkBtn.onclick = async () => {
+      checkBtn.disabled = true;
+      try {
+        await reload(true);
+      } finally {
+        checkBtn.disabled = false;
+      }
+    };
+
     btn.onclick = async () => {
       const ok = confirm(t("settings.updateConfirm"));
       if (!ok) return;
@@ -302,14 +438,16 @@ export async function renderSettings(root) {
       el("div", { class: "toolbar", style: "margin-top:10px;" },
         row(t("settings.updateChannel"), channelSel),
         el("span", { class: "pm-spacer" }),
+        checkBtn,
         btn,
       ),
       status,
+      checkLine,
       hint,
     );
     await reload();
   }
 
-  wrap.append(themeCard, tlsCard, autostartCard, uninstallCard, updCard);
+  wrap.append(themeCard, passwordCard, tlsCard, autostartCard, uninstallCard, updCard);
   root.append(wrap);
 }
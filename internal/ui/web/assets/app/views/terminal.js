@@ -285,7 +285,7 @@ export async function renderTerminal(root) {
         onclick: () => { suggestState.idx = i; acceptSuggest(); },
       },
       el("div", { class: "name" }, it.label),
-      el("div", { class: "detail" }, it.detail || ""),
+      el("div", { class: "detail" }, it.detail || (it.type === "dir" || it.type === "file" ? it.type : "")),
       );
       return row;
     }));
@@ -527,9 +527,13 @@ export async function renderTerminal(root) {
     const t = activeTab();
     if (!t || t.term.altActive) { setSuggestVisible(false); return; }
     const token = tokenFromLine(t.lineBuf);
-    if (!token || token.length < 2 || token.length > 64 || !/^[a-zA-Z0-9._-]+$/.test(token)) { setSuggestVisible(false); return; }
+    const isPath = /[/~]/.test(token) || token.startsWith(".");
+    const ok = isPath
+      ? token.length <= 256 && /^[a-zA-Z0-9._~/+@:-]+$/.test(token)
+      : token.length >= 2 && token.length <= 64 && /^[a-zA-Z0-9._-]+$/.test(token);
+    if (!token || !ok) { setSuggestVisible(false); return; }
     suggestState.token = token;
-    const resp = await api(`api/term/complete?q=${encodeURIComponent(token)}`);
+    const resp = await api(`api/term/complete?q=${encodeURIComponent(token)}&session=${encodeURIComponent(t.id)}`);
     const items = (resp.items || []).filter((x) => x?.label);
     if (!items.length) { setSuggestVisible(false); return; }
     suggestState.items = items;
@@ -553,8 +557,10 @@ export async function renderTerminal(root) {
     if (!it.label.startsWith(tok)) return;
     const rest = it.label.slice(tok.length);
     if (rest) queueBytes(t, new TextEncoder().encode(rest));
-    queueBytes(t, new TextEncoder().encode(" "));
-    t.lineBuf += rest + " ";
+    // Directories stay open so the next segment can be completed right away.
+    const tail = it.type === "dir" ? "" : " ";
+    if (tail) queueBytes(t, new TextEncoder().encode(tail));
+    t.lineBuf += rest + tail;
     setSuggestVisible(false);
     ta.focus();
   }
@@ -0,0 +1,35 @@
+// Package units formats quantities for people rather than programs.
+package units
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// HumanizeBytes formats n with binary units: "512 B", "1.5 KiB", "20.0 GiB".
+func HumanizeBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatUint(n, 10) + " B"
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(n)/float64(div), 'f', 1, 64) + " " + "KMGTPE"[exp:exp+1] + "iB"
+}
+
+// HumanizeRate formats a bytes-per-second rate, e.g. "1.2 MiB/s".
+func HumanizeRate(bytesPerSec float64) string {
+	if !(bytesPerSec > 0) {
+		return "0 B/s"
+	}
+	return HumanizeBytes(uint64(bytesPerSec)) + "/s"
+}
+
+// HumanRequested reports whether the request asked for formatted sizes (?human=1).
+func HumanRequested(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("human"))
+	return v
+}
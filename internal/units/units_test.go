@@ -0,0 +1,26 @@
+package units
+
+import "testing"
+
+func TestHumanizeBytes(t *testing.T) {
+	t.Parallel()
+
+	cases := map[uint64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KiB",
+		1536:            "1.5 KiB",
+		5 * 1024 * 1024: "5.0 MiB",
+		20 << 30:        "20.0 GiB",
+		1 << 62:         "4.0 EiB",
+		^uint64(0):      "16.0 EiB",
+	}
+	for n, want := range cases {
+		if got := HumanizeBytes(n); got != want {
+			t.Errorf("HumanizeBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+	if got := HumanizeRate(1.5 * 1024 * 1024); got != "1.5 MiB/s" {
+		t.Errorf("HumanizeRate = %q", got)
+	}
+}
@@ -0,0 +1,179 @@
+package userdb
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExportVersion is the format version written by Export.
+const ExportVersion = 1
+
+// ExportFile is the portable (unencrypted) user list. It never contains password hashes
+// or sudo passwords.
+type ExportFile struct {
+	Version int          `json:"version"`
+	Users   []ExportUser `json:"users"`
+}
+
+type ExportUser struct {
+	User     string   `json:"user"`
+	Role     string   `json:"role"`
+	CanExec  bool     `json:"can_exec"`
+	CanProcs bool     `json:"can_procs"`
+	CanFW    bool     `json:"can_fw"`
+	FSSudo   bool     `json:"fs_sudo"`
+	FSAny    bool     `json:"fs_any"`
+	FSUsers  []string `json:"fs_users,omitempty"`
+	// FWReadOnly limits CanFW to viewing.
+	FWReadOnly bool `json:"fw_read_only,omitempty"`
+
+	// Password is only read on import. Users imported without one keep their current
+	// password, or are marked reset-required if they are new.
+	Password string `json:"password,omitempty"`
+}
+
+// Export returns all users sorted by name.
+func (s *Store) Export() (ExportFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadIfChangedLocked(); err != nil {
+		return ExportFile{}, err
+	}
+	out := ExportFile{Version: ExportVersion, Users: []ExportUser{}}
+	for name, rec := range s.db.Users {
+		role := rec.Role
+		if role == "" {
+			role = "user"
+		}
+		out.Users = append(out.Users, ExportUser{
+			User:     name,
+			Role:     role,
+			CanExec:  rec.CanExec,
+			CanProcs: rec.CanProcs,
+			CanFW:    rec.CanFW,
+			FSSudo:   rec.FSSudo,
+			FSAny:    rec.FSAny,
+			FSUsers:  append([]string{}, rec.FSUsers...),
+
+			FWReadOnly: rec.FWReadOnly,
+		})
+	}
+	sort.Slice(out.Users, func(i, j int) bool { return out.Users[i].User < out.Users[j].User })
+	return out, nil
+}
+
+type ImportResult struct {
+	Created       []string `json:"created"`
+	Updated       []string `json:"updated"`
+	ResetRequired []string `json:"reset_required"`
+}
+
+// Import creates or updates the given users. All records are validated before anything is
+// written and the DB is saved once, so either every user is imported or none is. An import
+// that demotes the last remaining admin is refused.
+func (s *Store) Import(f ExportFile) (ImportResult, error) {
+	if f.Version != 0 && f.Version != ExportVersion {
+		return ImportResult{}, fmt.Errorf("unsupported export version %d", f.Version)
+	}
+	seen := make(map[string]bool, len(f.Users))
+	for i, u := range f.Users {
+		name := strings.TrimSpace(u.User)
+		if name == "" {
+			return ImportResult{}, fmt.Errorf("users[%d]: user is required", i)
+		}
+		if seen[name] {
+			return ImportResult{}, fmt.Errorf("users[%d]: duplicate user %q", i, name)
+		}
+		seen[name] = true
+		switch strings.TrimSpace(u.Role) {
+		case "", "user", "admin":
+		default:
+			return ImportResult{}, fmt.Errorf("users[%d]: bad role %q", i, u.Role)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadIfChangedLocked(); err != nil {
+		return ImportResult{}, err
+	}
+
+	res := ImportResult{Created: []string{}, Updated: []string{}, ResetRequired: []string{}}
+	users := make(map[string]User, len(s.db.Users)+len(f.Users))
+	for k, v := range s.db.Users {
+		users[k] = v
+	}
+	for _, u := range f.Users {
+		name := strings.TrimSpace(u.User)
+		prev, exists := users[name]
+		rec := prev
+		if u.Password != "" {
+			salt, hash, iter, err := hashPassword(u.Password)
+			if err != nil {
+				return ImportResult{}, err
+			}
+			rec.SaltB64 = salt
+			rec.HashB64 = hash
+			rec.Iter = iter
+			rec.ResetRequired = false
+		} else if !exists {
+			rec.ResetRequired = true
+		}
+		rec.Role = strings.TrimSpace(u.Role)
+		if rec.Role == "" {
+			rec.Role = "user"
+		}
+		rec.CanExec = u.CanExec
+		rec.CanProcs = u.CanProcs
+		rec.CanFW = u.CanFW
+		rec.FWReadOnly = u.FWReadOnly
+		rec.FSSudo = u.FSSudo
+		rec.FSAny = u.FSAny
+		rec.FSUsers = normalizeCSV(u.FSUsers)
+		users[name] = rec
+
+		if exists {
+			res.Updated = append(res.Updated, name)
+		} else {
+			res.Created = append(res.Created, name)
+		}
+		if rec.ResetRequired {
+			res.ResetRequired = append(res.ResetRequired, name)
+		}
+	}
+
+	if hasAdmin(s.db.Users) && !hasAdmin(users) {
+		return ImportResult{}, errors.New("import would leave no admin")
+	}
+
+	prev := s.db.Users
+	s.db.Users = users
+	if err := s.saveLocked(); err != nil {
+		s.db.Users = prev
+		return ImportResult{}, err
+	}
+	return res, nil
+}
+
+func hasAdmin(users map[string]User) bool {
+	for _, u := range users {
+		if u.Role == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+func hashPassword(pass string) (saltB64, hashB64 string, iter int, err error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", "", 0, err
+	}
+	iter = 120_000
+	hash := pbkdf2Key([]byte(pass), salt, iter, 32)
+	return base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash), iter, nil
+}
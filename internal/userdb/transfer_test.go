@@ -0,0 +1,122 @@
+package userdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+
+	masterKey := bytes.Repeat([]byte{0x33}, 32)
+	src, err := Open(filepath.Join(t.TempDir(), "src.db"), masterKey)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := src.UpsertUser("alice", "pw"); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	if err := src.SetPermissions("alice", "admin", true, false, true, false, false, []string{"www"}); err != nil {
+		t.Fatalf("SetPermissions: %v", err)
+	}
+	if err := src.SetSudoPassword("alice", "sudo-secret"); err != nil {
+		t.Fatalf("SetSudoPassword: %v", err)
+	}
+
+	exp, err := src.Export()
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	raw, _ := json.Marshal(exp)
+	for _, secret := range []string{"sudo-secret", src.db.Users["alice"].HashB64, src.db.Users["alice"].SaltB64} {
+		if strings.Contains(string(raw), secret) {
+			t.Fatalf("export leaks secret material: %s", raw)
+		}
+	}
+
+	dst, err := Open(filepath.Join(t.TempDir(), "dst.db"), masterKey)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	exp.Users = append(exp.Users, ExportUser{User: "bob", Role: "user", Password: "bobpw"})
+	res, err := dst.Import(exp)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if len(res.Created) != 2 || len(res.ResetRequired) != 1 || res.ResetRequired[0] != "alice" {
+		t.Fatalf("unexpected result: %#v", res)
+	}
+	info, ok, err := dst.GetUser("alice")
+	if err != nil || !ok || info.Role != "admin" || !info.CanExec || !info.CanFW || len(info.FSUsers) != 1 {
+		t.Fatalf("unexpected alice: ok=%v err=%v %#v", ok, err, info)
+	}
+	if ok, _ := dst.Authenticate("alice", ""); ok {
+		t.Fatalf("reset-required user must not authenticate")
+	}
+	if ok, _ := dst.Authenticate("bob", "bobpw"); !ok {
+		t.Fatalf("expected bob to authenticate")
+	}
+
+	// Setting a password clears the reset mark.
+	if err := dst.UpsertUser("alice", "new"); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	if ok, _ := dst.Authenticate("alice", "new"); !ok {
+		t.Fatalf("expected alice to authenticate after reset")
+	}
+	if info, _, _ := dst.GetUser("alice"); info.Role != "admin" {
+		t.Fatalf("permissions lost on password reset: %#v", info)
+	}
+}
+
+func TestImportIsAllOrNothing(t *testing.T) {
+	t.Parallel()
+
+	s, err := Open(filepath.Join(t.TempDir(), "users.db"), bytes.Repeat([]byte{0x44}, 32))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	bad := []ExportFile{
+		{Users: []ExportUser{{User: "a", Password: "x"}, {User: " ", Password: "x"}}},
+		{Users: []ExportUser{{User: "a", Password: "x"}, {User: "a", Password: "y"}}},
+		{Users: []ExportUser{{User: "a", Password: "x"}, {User: "b", Role: "root"}}},
+		{Version: 99, Users: []ExportUser{{User: "a", Password: "x"}}},
+	}
+	for i, f := range bad {
+		if _, err := s.Import(f); err == nil {
+			t.Fatalf("case %d: expected error", i)
+		}
+	}
+	if users := s.ListUsers(); len(users) != 0 {
+		t.Fatalf("expected no users after failed imports, got %v", users)
+	}
+}
+
+func TestImportKeepsAnAdmin(t *testing.T) {
+	t.Parallel()
+
+	s, err := Open(filepath.Join(t.TempDir(), "users.db"), bytes.Repeat([]byte{0x55}, 32))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := s.Import(ExportFile{Users: []ExportUser{{User: "root", Role: "admin", Password: "x"}}}); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	// Demoting the only admin is refused and changes nothing.
+	if _, err := s.Import(ExportFile{Users: []ExportUser{{User: "root", Role: "user"}, {User: "bob", Password: "y"}}}); err == nil {
+		t.Fatalf("expected an import without admins to fail")
+	}
+	if info, _, _ := s.GetUser("root"); info.Role != "admin" {
+		t.Fatalf("admin demoted by a refused import: %#v", info)
+	}
+	if _, ok, _ := s.GetUser("bob"); ok {
+		t.Fatalf("refused import created bob")
+	}
+	// Another admin in the same file makes the demotion fine.
+	if _, err := s.Import(ExportFile{Users: []ExportUser{{User: "root", Role: "user"}, {User: "bob", Role: "admin", Password: "y"}}}); err != nil {
+		t.Fatalf("Import with a new admin: %v", err)
+	}
+}
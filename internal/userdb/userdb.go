@@ -9,6 +9,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,6 +17,7 @@ import (
 	"time"
 
 	"github.com/MrTeeett/atlas/internal/auth"
+	"github.com/MrTeeett/atlas/internal/dbfile"
 )
 
 type Store struct {
@@ -23,6 +25,7 @@ type Store struct {
 	aead cipher.AEAD
 	mu   sync.Mutex
 	db   plainDB
+	perm dbfile.Perm
 
 	loadedModTime int64
 	loadedSize    int64
@@ -38,16 +41,28 @@ type User struct {
 	Iter    int    `json:"iter"`
 	HashB64 string `json:"hash"`
 
-	Role     string   `json:"role,omitempty"`
-	CanExec  bool     `json:"can_exec,omitempty"`
-	CanProcs bool     `json:"can_procs,omitempty"`
-	CanFW    bool     `json:"can_fw,omitempty"`
-	FSSudo   bool     `json:"fs_sudo,omitempty"`
-	FSAny    bool     `json:"fs_any,omitempty"`
-	FSUsers  []string `json:"fs_users,omitempty"`
+	Role     string `json:"role,omitempty"`
+	CanExec  bool   `json:"can_exec,omitempty"`
+	CanProcs bool   `json:"can_procs,omitempty"`
+	CanFW    bool   `json:"can_fw,omitempty"`
+	// FWReadOnly limits CanFW to viewing the firewall.
+	FWReadOnly bool     `json:"fw_read_only,omitempty"`
+	FSSudo     bool     `json:"fs_sudo,omitempty"`
+	FSAny      bool     `json:"fs_any,omitempty"`
+	FSUsers    []string `json:"fs_users,omitempty"`
 
 	SudoNonce string `json:"sudo_nonce,omitempty"`
 	SudoEnc   string `json:"sudo_enc,omitempty"`
+
+	// ResetRequired marks imported users without a password; they cannot log in until
+	// an admin sets one.
+	ResetRequired bool `json:"reset_required,omitempty"`
+	// MustChangePassword makes the user set a new password after the next login. Setting a
+	// password (UpsertUser) clears it.
+	MustChangePassword bool `json:"must_change_password,omitempty"`
+
+	// TimeZone is an IANA zone name used to render times for this user (empty: UTC).
+	TimeZone string `json:"tz,omitempty"`
 }
 
 type envelope struct {
@@ -83,6 +98,13 @@ func Open(path string, masterKey []byte) (*Store, error) {
 	return s, nil
 }
 
+// SetFilePerm sets the mode/owner applied when the DB is written (default 0600).
+func (s *Store) SetFilePerm(p dbfile.Perm) {
+	s.mu.Lock()
+	s.perm = p
+	s.mu.Unlock()
+}
+
 func (s *Store) Authenticate(user, pass string) (bool, error) {
 	user = strings.TrimSpace(user)
 	if user == "" {
@@ -94,7 +116,7 @@ func (s *Store) Authenticate(user, pass string) (bool, error) {
 		return false, err
 	}
 	rec, ok := s.db.Users[user]
-	if !ok {
+	if !ok || rec.ResetRequired || rec.HashB64 == "" {
 		return false, nil
 	}
 	salt, err := base64.RawStdEncoding.DecodeString(rec.SaltB64)
@@ -141,6 +163,11 @@ func (s *Store) GetUser(user string) (UserInfo, bool, error) {
 		FSSudo:   rec.FSSudo,
 		FSAny:    rec.FSAny,
 		FSUsers:  append([]string{}, rec.FSUsers...),
+		TimeZone: rec.TimeZone,
+
+		FWReadOnly: rec.FWReadOnly,
+
+		MustChangePassword: rec.MustChangePassword,
 	}
 	if info.Role == "" {
 		info.Role = "user"
@@ -163,12 +190,10 @@ func (s *Store) UpsertUser(user, pass string) error {
 	if pass == "" {
 		return errors.New("password is required")
 	}
-	salt := make([]byte, 16)
-	if _, err := rand.Read(salt); err != nil {
+	salt, hash, iter, err := hashPassword(pass)
+	if err != nil {
 		return err
 	}
-	iter := 120_000
-	hash := pbkdf2Key([]byte(pass), salt, iter, 32)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -180,9 +205,9 @@ func (s *Store) UpsertUser(user, pass string) error {
 	}
 	prev := s.db.Users[user]
 	s.db.Users[user] = User{
-		SaltB64: base64.RawStdEncoding.EncodeToString(salt),
+		SaltB64: salt,
 		Iter:    iter,
-		HashB64: base64.RawStdEncoding.EncodeToString(hash),
+		HashB64: hash,
 
 		Role:     prev.Role,
 		CanExec:  prev.CanExec,
@@ -191,6 +216,10 @@ func (s *Store) UpsertUser(user, pass string) error {
 		FSSudo:   prev.FSSudo,
 		FSAny:    prev.FSAny,
 		FSUsers:  normalizeCSV(prev.FSUsers),
+
+		FWReadOnly: prev.FWReadOnly,
+
+		TimeZone: prev.TimeZone,
 	}
 	return s.saveLocked()
 }
@@ -224,6 +253,72 @@ func (s *Store) SetPermissions(user string, role string, canExec bool, canProcs
 	return s.saveLocked()
 }
 
+// SetFWReadOnly limits (or restores) user's firewall permission to viewing.
+func (s *Store) SetFWReadOnly(user string, v bool) error {
+	user = strings.TrimSpace(user)
+	if user == "" {
+		return errors.New("user is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadIfChangedLocked(); err != nil {
+		return err
+	}
+	rec, ok := s.db.Users[user]
+	if !ok {
+		return errors.New("user not found")
+	}
+	rec.FWReadOnly = v
+	s.db.Users[user] = rec
+	return s.saveLocked()
+}
+
+// SetMustChangePassword sets or clears the forced password change for user.
+func (s *Store) SetMustChangePassword(user string, v bool) error {
+	user = strings.TrimSpace(user)
+	if user == "" {
+		return errors.New("user is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadIfChangedLocked(); err != nil {
+		return err
+	}
+	rec, ok := s.db.Users[user]
+	if !ok {
+		return errors.New("user not found")
+	}
+	rec.MustChangePassword = v
+	s.db.Users[user] = rec
+	return s.saveLocked()
+}
+
+// SetTimeZone stores the user's display time zone; an empty tz resets it to UTC.
+func (s *Store) SetTimeZone(user, tz string) error {
+	user = strings.TrimSpace(user)
+	if user == "" {
+		return errors.New("user is required")
+	}
+	tz = strings.TrimSpace(tz)
+	if tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("unknown time zone %q", tz)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadIfChangedLocked(); err != nil {
+		return err
+	}
+	rec, ok := s.db.Users[user]
+	if !ok {
+		return errors.New("user not found")
+	}
+	rec.TimeZone = tz
+	s.db.Users[user] = rec
+	return s.saveLocked()
+}
+
 func (s *Store) SetSudoPassword(user string, pass string) error {
 	user = strings.TrimSpace(user)
 	if user == "" {
@@ -366,9 +461,6 @@ func (s *Store) loadLocked() error {
 }
 
 func (s *Store) saveLocked() error {
-	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
-		return err
-	}
 	pt, err := json.Marshal(s.db)
 	if err != nil {
 		return err
@@ -387,11 +479,7 @@ func (s *Store) saveLocked() error {
 	if err != nil {
 		return err
 	}
-	tmp := s.path + ".tmp"
-	if err := os.WriteFile(tmp, append(b, '\n'), 0o600); err != nil {
-		return err
-	}
-	if err := os.Rename(tmp, s.path); err != nil {
+	if err := s.perm.WriteFile(s.path, append(b, '\n')); err != nil {
 		return err
 	}
 	if st, err := os.Stat(s.path); err == nil {